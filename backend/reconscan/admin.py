@@ -1,6 +1,6 @@
 from django.contrib import admin
 from django.db.models import Count
-from .models import Scan, Subdomain, Endpoint, PortScanFinding, TLSScanResult, DirectoryFinding
+from .models import Scan, Subdomain, Endpoint, PortScanFinding, TLSScanResult, DirectoryFinding, DNSRecordSet
 
 
 class SubdomainInline(admin.TabularInline):
@@ -101,3 +101,13 @@ class DirectoryFindingAdmin(admin.ModelAdmin):
     raw_id_fields = ("scan",)
     readonly_fields = ("created_at",)
     date_hierarchy = "created_at"
+
+
+@admin.register(DNSRecordSet)
+class DNSRecordSetAdmin(admin.ModelAdmin):
+    list_display = ("id", "scan", "name", "nxdomain", "created_at")
+    list_filter = ("nxdomain", "created_at")
+    search_fields = ("name",)
+    raw_id_fields = ("scan",)
+    readonly_fields = ("created_at",)
+    date_hierarchy = "created_at"
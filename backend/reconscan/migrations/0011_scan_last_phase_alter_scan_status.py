@@ -0,0 +1,23 @@
+# Generated by Django 5.2.8 on 2026-10-17 10:03
+
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('reconscan', '0010_alter_scan_status'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='scan',
+            name='last_phase',
+            field=models.CharField(blank=True, default='', help_text='Last completed phase when the worker was interrupted; the scan resumes after it', max_length=32),
+        ),
+        migrations.AlterField(
+            model_name='scan',
+            name='status',
+            field=models.CharField(choices=[('PENDING', 'Pending'), ('QUEUED', 'Queued'), ('RUNNING', 'Running'), ('COMPLETED', 'Completed'), ('FAILED', 'Failed'), ('CANCELLED', 'Cancelled'), ('INTERRUPTED', 'Interrupted')], default='PENDING', max_length=16),
+        ),
+    ]
@@ -0,0 +1,23 @@
+# Generated by Django 5.2.8 on 2026-10-17 10:41
+
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('reconscan', '0011_scan_last_phase_alter_scan_status'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='scan',
+            name='truncated',
+            field=models.JSONField(blank=True, default=list, help_text='Phases that ran out of time in a COMPLETED_PARTIAL scan: phase, reason, limit, skipped'),
+        ),
+        migrations.AlterField(
+            model_name='scan',
+            name='status',
+            field=models.CharField(choices=[('PENDING', 'Pending'), ('QUEUED', 'Queued'), ('RUNNING', 'Running'), ('COMPLETED', 'Completed'), ('COMPLETED_PARTIAL', 'Completed (partial)'), ('FAILED', 'Failed'), ('CANCELLED', 'Cancelled'), ('INTERRUPTED', 'Interrupted')], default='PENDING', max_length=20),
+        ),
+    ]
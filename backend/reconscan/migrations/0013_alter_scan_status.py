@@ -0,0 +1,18 @@
+# Generated by Django 5.2.8 on 2026-10-17 11:05
+
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('reconscan', '0012_scan_truncated_alter_scan_status'),
+    ]
+
+    operations = [
+        migrations.AlterField(
+            model_name='scan',
+            name='status',
+            field=models.CharField(choices=[('PENDING', 'Pending'), ('QUEUED', 'Queued'), ('RUNNING', 'Running'), ('PAUSED', 'Paused'), ('COMPLETED', 'Completed'), ('COMPLETED_PARTIAL', 'Completed (partial)'), ('FAILED', 'Failed'), ('CANCELLED', 'Cancelled'), ('INTERRUPTED', 'Interrupted')], default='PENDING', max_length=20),
+        ),
+    ]
@@ -0,0 +1,36 @@
+# Generated by Django 5.2.8 on 2026-10-17 14:20
+
+import django.db.models.deletion
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('reconscan', '0013_alter_scan_status'),
+    ]
+
+    operations = [
+        migrations.CreateModel(
+            name='DNSRecordSet',
+            fields=[
+                ('id', models.BigAutoField(auto_created=True, primary_key=True, serialize=False, verbose_name='ID')),
+                ('name', models.CharField(db_index=True, max_length=255)),
+                ('nxdomain', models.BooleanField(default=False)),
+                ('cname_chain', models.JSONField(blank=True, default=list)),
+                ('a', models.JSONField(blank=True, default=list)),
+                ('aaaa', models.JSONField(blank=True, default=list)),
+                ('mx', models.JSONField(blank=True, default=list)),
+                ('ns', models.JSONField(blank=True, default=list)),
+                ('txt', models.JSONField(blank=True, default=list)),
+                ('caa', models.JSONField(blank=True, default=list)),
+                ('soa', models.JSONField(blank=True, default=list)),
+                ('errors', models.JSONField(blank=True, default=list)),
+                ('created_at', models.DateTimeField(auto_now_add=True)),
+                ('scan', models.ForeignKey(on_delete=django.db.models.deletion.CASCADE, related_name='dns_records', to='reconscan.scan')),
+            ],
+            options={
+                'unique_together': {('scan', 'name')},
+            },
+        ),
+    ]
@@ -0,0 +1,18 @@
+# Generated by Django 5.2.8 on 2026-10-17 15:40
+
+from django.db import migrations, models
+
+
+class Migration(migrations.Migration):
+
+    dependencies = [
+        ('reconscan', '0014_dnsrecordset'),
+    ]
+
+    operations = [
+        migrations.AddField(
+            model_name='scan',
+            name='error',
+            field=models.TextField(blank=True, default='', help_text='Why the worker refused or could not start the scan'),
+        ),
+    ]
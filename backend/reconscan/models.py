@@ -9,13 +9,36 @@ class Scan(models.Model):
 
     STATUS_CHOICES = [
         ("PENDING", "Pending"),
+        ("QUEUED", "Queued"),
         ("RUNNING", "Running"),
+        ("PAUSED", "Paused"),
         ("COMPLETED", "Completed"),
+        ("COMPLETED_PARTIAL", "Completed (partial)"),
         ("FAILED", "Failed"),
         ("CANCELLED", "Cancelled"),
+        ("INTERRUPTED", "Interrupted"),
     ]
+    # Statuses the Go worker reports through the status callback
+    WORKER_STATUSES = {"QUEUED", "RUNNING", "PAUSED", "COMPLETED", "COMPLETED_PARTIAL", "FAILED", "INTERRUPTED"}
+
     target = models.CharField(max_length=255)
-    status = models.CharField(max_length=16, choices=STATUS_CHOICES, default="PENDING")
+    status = models.CharField(max_length=20, choices=STATUS_CHOICES, default="PENDING")
+    last_phase = models.CharField(
+        max_length=32,
+        blank=True,
+        default="",
+        help_text="Last completed phase when the worker was interrupted; the scan resumes after it"
+    )
+    truncated = models.JSONField(
+        default=list,
+        blank=True,
+        help_text="Phases that ran out of time in a COMPLETED_PARTIAL scan: phase, reason, limit, skipped"
+    )
+    error = models.TextField(
+        blank=True,
+        default="",
+        help_text="Why the worker refused or could not start the scan"
+    )
     created_by = models.ForeignKey(settings.AUTH_USER_MODEL, on_delete=models.CASCADE, related_name="scans")
     created_at = models.DateTimeField(auto_now_add=True)
     updated_at = models.DateTimeField(auto_now=True)
@@ -138,3 +161,23 @@ class DirectoryFinding(models.Model):
             models.Index(fields=["issue_type"]),
             models.Index(fields=["created_at"]),
         ]
+
+class DNSRecordSet(models.Model):
+    """DNS records collected for one host by the worker's DNS stage."""
+    scan = models.ForeignKey(Scan, on_delete=models.CASCADE, related_name="dns_records")
+    name = models.CharField(max_length=255, db_index=True)
+    nxdomain = models.BooleanField(default=False)  # The name does not exist; no records are set
+    # Each list holds {"name", "type", "ttl", "value"} records as the worker sends them
+    cname_chain = models.JSONField(default=list, blank=True)
+    a = models.JSONField(default=list, blank=True)
+    aaaa = models.JSONField(default=list, blank=True)
+    mx = models.JSONField(default=list, blank=True)
+    ns = models.JSONField(default=list, blank=True)
+    txt = models.JSONField(default=list, blank=True)
+    caa = models.JSONField(default=list, blank=True)
+    soa = models.JSONField(default=list, blank=True)
+    errors = models.JSONField(default=list, blank=True)  # Queries that failed after retries
+    created_at = models.DateTimeField(auto_now_add=True)
+
+    class Meta:
+        unique_together = ("scan", "name")
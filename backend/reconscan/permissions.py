@@ -1,5 +1,8 @@
+from rest_framework.exceptions import AuthenticationFailed
 from rest_framework.permissions import BasePermission
 
+from .worker_auth import SignatureError, verify_request
+
 class IsOwnerOrAdmin(BasePermission):
     def has_object_permission(self, request, view, obj):
         user = request.user
@@ -8,3 +11,14 @@ class IsOwnerOrAdmin(BasePermission):
         if getattr(user, "role", "") == "admin":
             return True
         return getattr(obj, "owner_id", None) == user.id
+
+class IsSignedByWorker(BasePermission):
+    """Accepts callbacks carrying a valid worker signature (open when RECON_SHARED_SECRET is unset)."""
+
+    def has_permission(self, request, view):
+        try:
+            verify_request(request)
+        except SignatureError as e:
+            # 401 like the worker, whether or not a user token came along
+            raise AuthenticationFailed(f"Invalid worker signature: {e}")
+        return True
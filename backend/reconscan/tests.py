@@ -1,6 +1,15 @@
-from django.test import TestCase
+import json
+from unittest import mock
 
+from django.contrib.auth import get_user_model
+from django.core.cache import cache
+from django.test import TestCase, override_settings
+from rest_framework.test import APIClient
+
+from .models import DNSRecordSet, Scan
 from .serializers import ScanSerializer
+from .views import StartScanView
+from .worker_auth import HEADER_NONCE, HEADER_SIGNATURE, HEADER_TIMESTAMP, sign_headers, signature, string_to_sign
 
 
 class ScanSerializerTests(TestCase):
@@ -15,3 +24,180 @@ class ScanSerializerTests(TestCase):
 
 		self.assertTrue(serializer.is_valid(), serializer.errors)
 		self.assertEqual(serializer.validated_data["target"], "192.168.1.167")
+
+
+@mock.patch("reconscan.views.broadcast")
+@mock.patch("reconscan.views.get_scan_limits", return_value={"worker_count": 10, "scan_queue_priority": 2})
+@mock.patch("reconscan.views.can_start_scan", return_value=(True, ""))
+@mock.patch.object(StartScanView, "throttle_classes", [])
+class StartScanViewTests(TestCase):
+	def setUp(self):
+		self.user = get_user_model().objects.create_user(username="owner", password="pw")
+		self.client = APIClient()
+		self.client.force_authenticate(self.user)
+
+	def start(self, worker_reply):
+		with mock.patch("reconscan.worker_auth.requests.post", return_value=worker_reply) as post:
+			response = self.client.post("/api/recon/scans/start/", {"target": "example.com"}, format="json")
+		return response, post
+
+	def test_queued_reply_marks_scan_queued(self, can_start, limits, broadcast):
+		reply = mock.Mock(ok=True, status_code=200)
+		reply.json.return_value = {"ok": True, "status": "QUEUED"}
+		response, post = self.start(reply)
+
+		self.assertEqual(response.status_code, 201)
+		self.assertEqual(Scan.objects.get().status, "QUEUED")
+		self.assertEqual(json.loads(post.call_args.kwargs["data"])["queue_priority"], 2)
+
+	def test_rejected_scan_is_failed_with_worker_error(self, can_start, limits, broadcast):
+		for code, text in [(429, "scan queue is full, retry later\n"), (503, "worker is shutting down\n"), (422, "nmap is not installed\n"), (401, "invalid signature\n")]:
+			Scan.objects.all().delete()
+			response, _ = self.start(mock.Mock(ok=False, status_code=code, text=text))
+
+			self.assertGreaterEqual(response.status_code, 400, code)
+			scan = Scan.objects.get()
+			self.assertEqual(scan.status, "FAILED", code)
+			self.assertEqual(scan.error, text.strip())
+			self.assertEqual(broadcast.call_args[0][1]["status"], "FAILED")
+
+
+@mock.patch("reconscan.views.broadcast")
+class UpdateScanStatusViewTests(TestCase):
+	def setUp(self):
+		user = get_user_model().objects.create_user(username="owner", password="pw")
+		self.scan = Scan.objects.create(target="example.com", created_by=user)
+		self.client = APIClient()
+
+	def post_status(self, payload):
+		return self.client.post(f"/api/recon/scans/{self.scan.id}/status/", payload, format="json")
+
+	def test_accepts_worker_statuses(self, broadcast):
+		for new_status in ["QUEUED", "RUNNING", "PAUSED", "RUNNING", "INTERRUPTED", "COMPLETED_PARTIAL", "COMPLETED"]:
+			response = self.post_status({"status": new_status})
+
+			self.assertEqual(response.status_code, 200, new_status)
+			self.scan.refresh_from_db()
+			self.assertEqual(self.scan.status, new_status)
+
+	def test_interrupted_stores_last_phase(self, broadcast):
+		response = self.post_status({"status": "INTERRUPTED", "error": "Worker shutting down", "last_phase": "probe"})
+
+		self.assertEqual(response.status_code, 200)
+		self.scan.refresh_from_db()
+		self.assertEqual(self.scan.status, "INTERRUPTED")
+		self.assertEqual(self.scan.last_phase, "probe")
+		self.assertEqual(broadcast.call_args[0][1]["last_phase"], "probe")
+
+	def test_last_phase_is_cleared_when_scan_resumes(self, broadcast):
+		self.post_status({"status": "INTERRUPTED", "last_phase": "probe"})
+		self.post_status({"status": "RUNNING"})
+
+		self.scan.refresh_from_db()
+		self.assertEqual(self.scan.last_phase, "")
+		self.assertNotIn("last_phase", broadcast.call_args[0][1])
+
+		self.post_status({"status": "COMPLETED"})
+		self.assertNotIn("last_phase", broadcast.call_args[0][1])
+
+	def test_completed_partial_stores_truncated_phases(self, broadcast):
+		truncated = [
+			{"phase": "endpoints", "reason": "phase_budget", "limit": "15m0s"},
+			{"phase": "network", "reason": "max_duration", "skipped": True},
+		]
+		response = self.post_status({"status": "COMPLETED_PARTIAL", "error": "endpoints stopped", "truncated": truncated})
+
+		self.assertEqual(response.status_code, 200)
+		self.scan.refresh_from_db()
+		self.assertEqual(self.scan.status, "COMPLETED_PARTIAL")
+		self.assertEqual(self.scan.truncated, truncated)
+		self.assertEqual(broadcast.call_args[0][1]["truncated"], truncated)
+
+	def test_rejects_unknown_status(self, broadcast):
+		response = self.post_status({"status": "BOGUS"})
+
+		self.assertEqual(response.status_code, 400)
+		broadcast.assert_not_called()
+
+
+@mock.patch("reconscan.views.broadcast")
+class IngestDNSRecordsViewTests(TestCase):
+	def setUp(self):
+		user = get_user_model().objects.create_user(username="owner", password="pw")
+		self.scan = Scan.objects.create(target="example.com", created_by=user)
+		self.client = APIClient()
+
+	def post_records(self, items):
+		return self.client.post(f"/api/recon/scans/{self.scan.id}/ingest/dns/", {"items": items}, format="json")
+
+	def test_stores_records_per_host(self, broadcast):
+		a = [{"name": "www.example.com", "type": "A", "ttl": 300, "value": "93.184.216.34"}]
+		txt = [{"name": "example.com", "type": "TXT", "ttl": 3600, "value": "v=spf1 -all"}]
+		response = self.post_records([
+			{"name": "www.example.com", "a": a},
+			{"name": "example.com", "txt": txt, "errors": ["dns CAA example.com: timeout"]},
+			{"name": "gone.example.com", "nxdomain": True},
+			{"a": a},
+		])
+
+		self.assertEqual(response.status_code, 200)
+		self.assertEqual(response.data["count"], 3)
+		records = {r.name: r for r in DNSRecordSet.objects.filter(scan=self.scan)}
+		self.assertEqual(records["www.example.com"].a, a)
+		self.assertEqual(records["example.com"].txt, txt)
+		self.assertEqual(records["example.com"].mx, [])
+		self.assertTrue(records["gone.example.com"].nxdomain)
+		self.assertEqual(broadcast.call_args[0][1]["type"], "dns_chunk")
+
+	def test_redelivered_batch_updates_records(self, broadcast):
+		self.post_records([{"name": "www.example.com", "a": [{"name": "www.example.com", "type": "A", "ttl": 300, "value": "10.0.0.1"}]}])
+		self.post_records([{"name": "www.example.com", "a": [{"name": "www.example.com", "type": "A", "ttl": 60, "value": "10.0.0.2"}]}])
+
+		record = DNSRecordSet.objects.get(scan=self.scan, name="www.example.com")
+		self.assertEqual(record.a[0]["value"], "10.0.0.2")
+
+
+# Shared with scanner/workerauth/hmac_test.go so both sides agree on the v1 scheme.
+VECTOR_BODY = b'{"scan_id":7,"status":"COMPLETED"}'
+VECTOR_HEADERS = {
+	HEADER_TIMESTAMP: "1760000000",
+	HEADER_NONCE: "0123456789abcdef0123456789abcdef",
+	HEADER_SIGNATURE: "v1=d426f3cb8586c0c7713f7560f0f7e1a83f7e28c65254be9bd687a748c571bd25",
+}
+
+
+@override_settings(RECON_SHARED_SECRET="shared-secret", RECON_AUTH_MAX_SKEW=300)
+@mock.patch("reconscan.views.broadcast")
+class WorkerSignatureTests(TestCase):
+	def setUp(self):
+		cache.clear()
+		user = get_user_model().objects.create_user(username="owner", password="pw")
+		self.scan = Scan.objects.create(id=7, target="example.com", created_by=user)
+		self.client = APIClient()
+
+	def post_status(self, headers, now=1760000000):
+		extra = {"HTTP_" + name.upper().replace("-", "_"): value for name, value in headers.items()}
+		with mock.patch("reconscan.worker_auth.time.time", return_value=now):
+			return self.client.post("/api/recon/scans/7/status/", VECTOR_BODY, content_type="application/json", **extra)
+
+	def test_signature_matches_worker_vector(self, broadcast):
+		message = string_to_sign("POST", "/api/recon/scans/7/status/", VECTOR_HEADERS[HEADER_TIMESTAMP], VECTOR_HEADERS[HEADER_NONCE], VECTOR_BODY)
+
+		self.assertEqual(signature(b"shared-secret", message), VECTOR_HEADERS[HEADER_SIGNATURE])
+
+	def test_accepts_worker_signed_callback_once(self, broadcast):
+		self.assertEqual(self.post_status(VECTOR_HEADERS).status_code, 200)
+		self.assertEqual(Scan.objects.get(id=7).status, "COMPLETED")
+
+		self.assertEqual(self.post_status(VECTOR_HEADERS).status_code, 401)
+
+	def test_rejects_unsigned_stale_and_tampered_callbacks(self, broadcast):
+		self.assertEqual(self.post_status({}).status_code, 401)
+		self.assertEqual(self.post_status(VECTOR_HEADERS, now=1760000000 + 3600).status_code, 401)
+		self.assertEqual(self.post_status(dict(VECTOR_HEADERS, **{HEADER_NONCE: "f" * 32})).status_code, 401)
+		self.assertEqual(Scan.objects.get(id=7).status, "PENDING")
+
+	def test_outgoing_signature_verifies(self, broadcast):
+		headers = sign_headers("POST", "http://testserver/api/recon/scans/7/status/", VECTOR_BODY)
+
+		self.assertEqual(self.post_status(headers, now=int(headers[HEADER_TIMESTAMP])).status_code, 200)
@@ -3,6 +3,7 @@ from .views import (
     StartScanView, 
     CancelScanView,
     IngestSubdomainsView, 
+    IngestDNSRecordsView,
     IngestEndpointsView, 
     UpdateScanStatusView,
     ScanLogView,
@@ -19,6 +20,7 @@ urlpatterns = [
     path("scans/start/", StartScanView.as_view()),
     path("scans/<int:scan_id>/cancel/", CancelScanView.as_view()),
     path("scans/<int:scan_id>/ingest/subdomains/", IngestSubdomainsView.as_view()),
+    path("scans/<int:scan_id>/ingest/dns/", IngestDNSRecordsView.as_view()),
     path("scans/<int:scan_id>/ingest/endpoints/", IngestEndpointsView.as_view()),
     path("scans/<int:scan_id>/status/", UpdateScanStatusView.as_view()),
     path("scans/<int:scan_id>/logs/", ScanLogView.as_view()),
@@ -1,4 +1,3 @@
-import requests
 from django.conf import settings
 from rest_framework.views import APIView
 from rest_framework.response import Response
@@ -10,8 +9,10 @@ from django.utils.dateparse import parse_datetime
 from accounts.subscription_utils import can_start_scan, get_scan_limits
 from vulnerability_detection.throttles import PlanAwareScanThrottle
 
-from .models import Scan, Subdomain, Endpoint, PortScanFinding, TLSScanResult, DirectoryFinding
+from .models import Scan, Subdomain, Endpoint, PortScanFinding, TLSScanResult, DirectoryFinding, DNSRecordSet
 from .serializers import ScanSerializer
+from .permissions import IsSignedByWorker
+from .worker_auth import post_to_worker
 
 channel_layer = get_channel_layer()
 
@@ -21,6 +22,12 @@ def broadcast(scan_id: int, payload: dict):
         {"type": "scan_event", "payload": payload},
     )
 
+def fail_scan(scan, error: str):
+    scan.status = "FAILED"
+    scan.error = error
+    scan.save(update_fields=["status", "error"])
+    broadcast(scan.id, {"type": "scan_status", "scan_id": scan.id, "status": "FAILED", "error": error})
+
 class StartScanView(APIView):
     permission_classes = [permissions.IsAuthenticated]
     throttle_classes = [PlanAwareScanThrottle]
@@ -78,7 +85,7 @@ class StartScanView(APIView):
         token = request.headers.get("Authorization", "")
 
         try:
-            requests.post(go_url, json={
+            resp = post_to_worker(go_url, {
                 "scan_id": scan.id,
                 "target": scan.target,
                 "user_id": request.user.id,  # Pass user ID for file organization
@@ -94,14 +101,25 @@ class StartScanView(APIView):
                 "queue_priority": limits["scan_queue_priority"],
             }, timeout=5)
         except Exception as e:
-            scan.status = "FAILED"
-            scan.save(update_fields=["status"])
-            broadcast(scan.id, {"type": "scan_status", "scan_id": scan.id, "status": "FAILED", "error": str(e)})
+            fail_scan(scan, str(e))
             return Response({"detail": f"Go worker not reachable: {e}"}, status=500)
 
-        scan.status = "RUNNING"
+        if not resp.ok:
+            # Refused scans never start, so no status callback will follow:
+            # 429 queue full, 503 draining, 400/422 bad options or tools, 401 bad signature
+            error = resp.text.strip() or f"worker replied {resp.status_code}"
+            fail_scan(scan, error)
+            client_status = resp.status_code if resp.status_code in (400, 422, 429, 503) else 502
+            return Response({"detail": f"Scan rejected by worker: {error}"}, status=client_status)
+
+        # A busy worker queues the scan; it reports RUNNING when a slot frees up
+        try:
+            new_status = "QUEUED" if resp.json().get("status") == "QUEUED" else "RUNNING"
+        except ValueError:
+            new_status = "RUNNING"
+        scan.status = new_status
         scan.save(update_fields=["status"])
-        broadcast(scan.id, {"type": "scan_status", "scan_id": scan.id, "status": "RUNNING"})
+        broadcast(scan.id, {"type": "scan_status", "scan_id": scan.id, "status": new_status})
 
         return Response(ScanSerializer(scan).data, status=201)
 
@@ -115,13 +133,13 @@ class CancelScanView(APIView):
             return Response({"detail": "Scan not found"}, status=404)
 
         # Only cancel if scan is running
-        if scan.status not in ["PENDING", "RUNNING"]:
+        if scan.status not in ["PENDING", "QUEUED", "RUNNING", "PAUSED"]:
             return Response({"detail": "Scan is not running"}, status=400)
 
         # Tell Go scanner to cancel
         go_url = settings.GO_RECON_URL.rstrip("/") + "/cancel"
         try:
-            response = requests.post(go_url, json={"scan_id": scan.id}, timeout=5)
+            response = post_to_worker(go_url, {"scan_id": scan.id}, timeout=5)
             if response.ok:
                 # Update scan status
                 scan.status = "CANCELLED"
@@ -134,7 +152,7 @@ class CancelScanView(APIView):
             return Response({"detail": f"Go worker not reachable: {e}"}, status=500)
 
 class IngestSubdomainsView(APIView):
-    permission_classes = [permissions.AllowAny]  # dev; later secure this
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         items = request.data.get("items", [])
@@ -175,8 +193,33 @@ class IngestSubdomainsView(APIView):
         broadcast(scan.id, {"type": "subdomains_chunk", "scan_id": scan.id, "data": out})
         return Response({"ok": True, "count": len(out)})
 
+DNS_RECORD_FIELDS = ("cname_chain", "a", "aaaa", "mx", "ns", "txt", "caa", "soa", "errors")
+
+class IngestDNSRecordsView(APIView):
+    """Ingest the DNS records the worker collected, one set per host"""
+    permission_classes = [IsSignedByWorker]
+
+    def post(self, request, scan_id: int):
+        items = request.data.get("items", [])
+        scan = Scan.objects.get(id=scan_id)
+
+        out = []
+        for it in items:
+            name = it.get("name")
+            if not name:
+                continue
+            defaults = {field: it.get(field) or [] for field in DNS_RECORD_FIELDS}
+            defaults["nxdomain"] = bool(it.get("nxdomain", False))
+            obj, _ = DNSRecordSet.objects.update_or_create(scan=scan, name=name, defaults=defaults)
+            record = {"name": obj.name, "nxdomain": obj.nxdomain}
+            record.update({field: getattr(obj, field) for field in DNS_RECORD_FIELDS})
+            out.append(record)
+
+        broadcast(scan.id, {"type": "dns_chunk", "scan_id": scan.id, "data": out})
+        return Response({"ok": True, "count": len(out)})
+
 class IngestEndpointsView(APIView):
-    permission_classes = [permissions.AllowAny]  # dev; later secure this
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         items = request.data.get("items", [])
@@ -211,27 +254,44 @@ class IngestEndpointsView(APIView):
         return Response({"ok": True, "count": len(out)})
 
 class UpdateScanStatusView(APIView):
-    permission_classes = [permissions.AllowAny]  # dev; later secure this
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         scan = Scan.objects.get(id=scan_id)
         new_status = request.data.get("status")
         error = request.data.get("error", "")
 
-        if new_status not in ["RUNNING", "COMPLETED", "FAILED"]:
+        if new_status not in Scan.WORKER_STATUSES:
             return Response({"detail": "invalid status"}, status=400)
 
         scan.status = new_status
-        scan.save(update_fields=["status"])
+        update_fields = ["status"]
+        if new_status == "INTERRUPTED":
+            # The worker resumes the scan after this phase when it restarts
+            scan.last_phase = request.data.get("last_phase", "")
+            update_fields.append("last_phase")
+        elif new_status == "COMPLETED_PARTIAL":
+            scan.last_phase = request.data.get("last_phase", "") or scan.last_phase
+            scan.truncated = request.data.get("truncated") or []
+            update_fields += ["last_phase", "truncated"]
+        elif new_status in ("QUEUED", "RUNNING") and scan.last_phase:
+            # Resumed after an interruption
+            scan.last_phase = ""
+            update_fields.append("last_phase")
+        scan.save(update_fields=update_fields)
         payload = {"type": "scan_status", "scan_id": scan.id, "status": new_status}
         if error:
             payload["error"] = error
+        if new_status in ("INTERRUPTED", "COMPLETED_PARTIAL") and scan.last_phase:
+            payload["last_phase"] = scan.last_phase
+        if new_status == "COMPLETED_PARTIAL":
+            payload["truncated"] = scan.truncated
         broadcast(scan.id, payload)
         return Response({"ok": True})
 
 class ScanLogView(APIView):
     """Receive and broadcast log messages from Go worker"""
-    permission_classes = [permissions.AllowAny]  # dev; later secure this
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         message = request.data.get("message", "")
@@ -306,11 +366,15 @@ class UserScanDetailView(APIView):
         directory_findings = scan.directory_findings.all().values(
             "id", "host", "base_url", "path", "status_code", "issue_type", "evidence"
         )
+        dns_records = scan.dns_records.all().values("id", "name", "nxdomain", *DNS_RECORD_FIELDS)
         
         return Response({
             "id": scan.id,
             "target": scan.target,
             "status": scan.status,
+            "last_phase": scan.last_phase,
+            "truncated": scan.truncated,
+            "error": scan.error,
             "created_at": scan.created_at.isoformat(),
             "updated_at": scan.updated_at.isoformat(),
             "subdomains": list(subdomains),
@@ -318,6 +382,7 @@ class UserScanDetailView(APIView):
             "subdomain_count": scan.subdomains.count(),
             "endpoint_count": scan.endpoints.count(),
             "alive_count": scan.subdomains.filter(alive=True).count(),
+            "dns_records": list(dns_records),
             # Network analysis data
             "port_findings": list(port_findings),
             "tls_results": list(tls_results),
@@ -330,7 +395,7 @@ class UserScanDetailView(APIView):
 
 class IngestPortScanFindingsView(APIView):
     """Ingest port scan findings from Go worker"""
-    permission_classes = [permissions.AllowAny]  # dev; secure with worker secret in production
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         items = request.data.get("items", [])
@@ -391,7 +456,7 @@ class IngestPortScanFindingsView(APIView):
 
 class IngestTLSResultView(APIView):
     """Ingest TLS scan result from Go worker"""
-    permission_classes = [permissions.AllowAny]  # dev; secure with worker secret in production
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         scan = Scan.objects.get(id=scan_id)
@@ -438,7 +503,7 @@ class IngestTLSResultView(APIView):
 
 class IngestDirectoryFindingsView(APIView):
     """Ingest directory findings from Go worker"""
-    permission_classes = [permissions.AllowAny]  # dev; secure with worker secret in production
+    permission_classes = [IsSignedByWorker]
 
     def post(self, request, scan_id: int):
         items = request.data.get("items", [])
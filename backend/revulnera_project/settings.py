@@ -82,6 +82,10 @@ else:
 # External services
 # --------------------------------------------------
 GO_RECON_URL = "http://localhost:8080"
+# Shared HMAC secret for Django<->worker requests; must match the worker's
+# RECON_SHARED_SECRET. Empty disables signing and verification (dev).
+RECON_SHARED_SECRET = os.getenv("RECON_SHARED_SECRET", "")
+RECON_AUTH_MAX_SKEW = int(os.getenv("RECON_AUTH_MAX_SKEW_SECONDS", "300"))
 STRIPE_SECRET_KEY = os.getenv("STRIPE_SECRET_KEY", "")
 STRIPE_PUBLISHABLE_KEY = os.getenv("STRIPE_PUBLISHABLE_KEY", "")
 
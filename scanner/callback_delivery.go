@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"recon/delivery"
+	"recon/sink"
+	"recon/workerauth"
+)
+
+// callbacks batches, retries and spools every callback sent to Django.
+var callbacks *delivery.Dispatcher
+
+func startCallbackDelivery() {
+	// Configures the delivery subsystem from environment variables:
+	//   RECON_OUTBOX_DIR               spool directory for undelivered batches (default data/outbox)
+	//   RECON_CALLBACK_BATCH_SIZE      items per ingest batch (default 50)
+	//   RECON_CALLBACK_FLUSH_INTERVAL  max time an item waits in a batch (default 1s)
+	//   RECON_CALLBACK_MAX_ATTEMPTS    attempts before a batch is spooled (default 5)
+	//   RECON_JOURNAL_KEY              seals auth headers in the outbox; unset leaves them out
+	cfg := delivery.Config{
+		SpoolDir: os.Getenv("RECON_OUTBOX_DIR"),
+		Client:   callbackClient,
+		SealKey:  journalKeyFromEnv(),
+		Sign: func(req *http.Request, body []byte) {
+			workerauth.SignRequest(callbackSecret, req, body)
+		},
+	}
+	if v, err := strconv.Atoi(os.Getenv("RECON_CALLBACK_BATCH_SIZE")); err == nil && v > 0 {
+		cfg.BatchSize = v
+	}
+	if d, err := time.ParseDuration(os.Getenv("RECON_CALLBACK_FLUSH_INTERVAL")); err == nil && d > 0 {
+		cfg.FlushInterval = d
+	}
+	if v, err := strconv.Atoi(os.Getenv("RECON_CALLBACK_MAX_ATTEMPTS")); err == nil && v > 0 {
+		cfg.MaxAttempts = v
+	}
+
+	d, err := delivery.NewDispatcher(cfg)
+	if err != nil {
+		log.Fatalf("failed to start callback delivery: %v", err)
+	}
+	callbacks = d
+
+	if pending := d.Stats().SpoolPending; pending > 0 {
+		log.Printf("[delivery] %d undelivered batches in outbox, replaying", pending)
+	}
+}
+
+func scanSinkEnv(req ScanRequest) sink.Env {
+	// Describes the scan to its sinks; jsonl sinks write under RECON_SINK_DIR
+	// (default data/sinks).
+	return sink.Env{
+		Poster:      callbacks,
+		Dir:         envOr("RECON_SINK_DIR", "data/sinks"),
+		BackendBase: req.BackendBase,
+		AuthHeader:  req.AuthHeader,
+		ScanID:      req.ScanID,
+		Target:      req.Target,
+	}
+}
+
+func openScanSink(req ScanRequest) (sink.Sink, error) {
+	// Opens every sink named in the request, or the Django sink when none are.
+	return sink.Build(req.Sinks, scanSinkEnv(req))
+}
+
+func deliveryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Reports callback delivery lag, failures and outbox size.
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(callbacks.Stats())
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"recon/pipeline"
+	"recon/ratelimit"
+	reconpkg "recon/recon"
+	"recon/scope"
+)
+
+const cliUsage = `Usage: recon <command> [flags] [target]
+
+Commands:
+  serve                 run the HTTP worker for the Django backend (default)
+  scan <target>         run every phase (or -phases) against a target
+  subdomains <target>   enumerate and probe subdomains
+  endpoints <target>    discover endpoints on alive subdomains
+  network <host>        port scan, TLS and directory checks on one host
+  profiles              list scan profiles
+
+Run "recon <command> -h" for the flags of a command.
+`
+
+// Exit codes returned by runCLI.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	// Dispatches subcommands; with no arguments the worker serves HTTP as before.
+	if len(args) == 0 {
+		return serveCommand(nil, stderr)
+	}
+
+	switch args[0] {
+	case "serve":
+		return serveCommand(args[1:], stderr)
+	case "scan":
+		return scanCommand("scan", args[1:], nil, stdout, stderr)
+	case "subdomains":
+		return scanCommand("subdomains", args[1:], []string{pipeline.StageProbe, pipeline.StageDNS}, stdout, stderr)
+	case "endpoints":
+		return scanCommand("endpoints", args[1:], []string{pipeline.StageEndpoints}, stdout, stderr)
+	case "network":
+		return networkCommand(args[1:], stdout, stderr)
+	case "profiles":
+		return profilesCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "recon: unknown command %q\n\n%s", args[0], cliUsage)
+		return exitUsage
+	}
+}
+
+func serveCommand(args []string, stderr io.Writer) int {
+	// Starts the HTTP worker; -addr overrides RECON_HTTP_ADDR.
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", envOr("RECON_HTTP_ADDR", ":8080"), "listen address")
+	if err := fs.Parse(args); err != nil {
+		return usageExit(err)
+	}
+
+	serve(*addr)
+	return exitOK
+}
+
+// cliFlags are shared by the commands that run the scan pipeline.
+type cliFlags struct {
+	fs      *flag.FlagSet
+	profile *string
+	format  *string
+	output  *string
+	quiet   *bool
+	timeout *time.Duration
+	proxy   *string
+	scope   *string
+	sources *string
+	permute *bool
+	recurse *bool
+}
+
+func newCLIFlags(name string, stderr io.Writer) *cliFlags {
+	// Registers the output and profile flags common to pipeline commands.
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return &cliFlags{
+		fs:      fs,
+		profile: fs.String("profile", pipeline.DefaultProfile, "scan profile (see recon profiles)"),
+		format:  fs.String("format", formatJSONL, "output format: jsonl streams findings, json writes one report"),
+		output:  fs.String("o", "", "write results to this file instead of stdout"),
+		quiet:   fs.Bool("q", false, "do not print progress to stderr"),
+		timeout: fs.Duration("timeout", 0, "stop the scan after this long (0 for no limit)"),
+		proxy:   fs.String("proxy", "", "send scan traffic through this http, https or socks5 proxy URL"),
+		scope:   fs.String("scope", "", "JSON file with include/exclude scope rules (default: the target and its subdomains)"),
+		sources: fs.String("sources", "", "comma-separated subdomain sources: subfinder, amass, assetfinder, crt, bruteforce (default: every installed one)"),
+		permute: fs.Bool("permutations", false, "also resolve permutations of the subdomains found (sends many more DNS queries)"),
+		recurse: fs.Bool("recursive", false, "also enumerate discovered sub-zones (sends many more DNS queries)"),
+	}
+}
+
+func scanCommand(name string, args []string, phases []string, stdout, stderr io.Writer) int {
+	// Runs the selected phases of the pipeline locally and writes the findings.
+	f := newCLIFlags(name, stderr)
+	phaseList := ""
+	if phases == nil {
+		f.fs.StringVar(&phaseList, "phases", "", "comma-separated phases to run (default: all)")
+	}
+	target, err := parseWithTarget(f.fs, args)
+	if err != nil {
+		return usageExit(err)
+	}
+	if phaseList != "" {
+		phases = strings.Split(phaseList, ",")
+	}
+
+	opts, err := f.resolveOptions(pipeline.Options{Phases: phases})
+	if err != nil {
+		fmt.Fprintf(stderr, "recon %s: %v\n", name, err)
+		return exitUsage
+	}
+	if opts, err = f.adaptToTools(opts, target, stderr); err != nil {
+		fmt.Fprintf(stderr, "recon %s: %v\n", name, err)
+		return exitError
+	}
+	plan, err := localRegistry(opts).Plan(opts.Phases...)
+	if err != nil {
+		fmt.Fprintf(stderr, "recon %s: %v\n", name, err)
+		return exitUsage
+	}
+	engine, err := f.scopeEngine(target)
+	if err != nil {
+		fmt.Fprintf(stderr, "recon %s: %v\n", name, err)
+		return exitUsage
+	}
+
+	return f.run(target, plan.Stages(), stdout, stderr, func(ctx context.Context, st *pipeline.State) error {
+		ctx = withScanProxy(ratelimit.WithLimiter(ctx, scanRateLimiter(opts)), opts)
+		ctx = scope.WithEngine(ctx, engine)
+		run := pipeline.RunOptions{
+			Budgets: opts.Deadlines.Budgets(),
+			OnTruncated: func(t pipeline.Truncation) {
+				if t.Skipped {
+					st.Events.Log(fmt.Sprintf("⏭️ Skipping %s: scan reached its maximum duration", t.Stage), "warning")
+				} else {
+					st.Events.Log(fmt.Sprintf("⏱️ %s stopped after %s (%s), keeping partial results", t.Stage, t.Limit, t.Reason), "warning")
+				}
+			},
+		}
+		if d := opts.Deadlines.MaxDuration(); d > 0 {
+			run.Deadline = time.Now().Add(d)
+		}
+		return plan.Run(ctx, st, run)
+	})
+}
+
+func networkCommand(args []string, stdout, stderr io.Writer) int {
+	// Runs the network stage against a single host without enumeration.
+	f := newCLIFlags("network", stderr)
+	host, err := parseWithTarget(f.fs, args)
+	if err != nil {
+		return usageExit(err)
+	}
+
+	opts, err := f.resolveOptions(pipeline.Options{Phases: []string{pipeline.StageNetwork}})
+	if err != nil {
+		fmt.Fprintf(stderr, "recon network: %v\n", err)
+		return exitUsage
+	}
+	// The host is scanned directly, so subfinder is not needed.
+	if opts, err = f.adaptToTools(opts, "", stderr); err != nil {
+		fmt.Fprintf(stderr, "recon network: %v\n", err)
+		return exitError
+	}
+	stage, _ := localRegistry(opts).Lookup(pipeline.StageNetwork)
+	engine, err := f.scopeEngine(host)
+	if err != nil {
+		fmt.Fprintf(stderr, "recon network: %v\n", err)
+		return exitUsage
+	}
+
+	return f.run(host, []string{pipeline.StageNetwork}, stdout, stderr, func(ctx context.Context, st *pipeline.State) error {
+		pipeline.Put(st, pipeline.KeySubdomains, []reconpkg.SubdomainResult{{Name: host, Alive: true}})
+		ctx = withScanProxy(ratelimit.WithLimiter(ctx, scanRateLimiter(opts)), opts)
+		return stage.Run(scope.WithEngine(ctx, engine), st)
+	})
+}
+
+func profilesCommand(args []string, stdout, stderr io.Writer) int {
+	// Prints every scan profile with its description.
+	fs := flag.NewFlagSet("profiles", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return usageExit(err)
+	}
+
+	loadScanProfiles()
+	for _, p := range scanProfiles.List() {
+		fmt.Fprintf(stdout, "%-10s %s\n", p.Name, p.Description)
+	}
+	return exitOK
+}
+
+func (f *cliFlags) resolveOptions(override pipeline.Options) (pipeline.Options, error) {
+	// Applies command-level overrides on top of the chosen profile.
+	if *f.format != formatJSONL && *f.format != formatJSON {
+		return pipeline.Options{}, fmt.Errorf("unknown format %q (valid: jsonl, json)", *f.format)
+	}
+	if *f.quiet {
+		log.SetOutput(io.Discard)
+	}
+	loadScanProfiles()
+	configureRateLimit()
+	configureProxy()
+	configureDNS()
+	override.Proxy = *f.proxy
+	if *f.sources != "" {
+		override.Subdomains.Sources = strings.Split(*f.sources, ",")
+	}
+	if *f.permute {
+		override.Subdomains.Permutations = f.permute
+	}
+	if *f.recurse {
+		override.Subdomains.Recursive = f.recurse
+	}
+	return scanProfiles.Resolve(*f.profile, override)
+}
+
+func (f *cliFlags) scopeEngine(target string) (*scope.Engine, error) {
+	// Builds the scope from -scope, defaulting to the target and its subdomains.
+	rules, err := loadScopeFile(*f.scope)
+	if err != nil {
+		return nil, err
+	}
+	return scope.New(rules, target)
+}
+
+func (f *cliFlags) adaptToTools(opts pipeline.Options, target string, stderr io.Writer) (pipeline.Options, error) {
+	// Checks the installed tools and drops the missing optional ones.
+	toolInventory.Check(context.Background())
+	opts, warnings, err := opts.AdaptToTools(toolInventory, target)
+	if err != nil {
+		return opts, err
+	}
+	if !*f.quiet {
+		for _, warning := range warnings {
+			fmt.Fprintf(stderr, "⚠️ %s\n", warning)
+		}
+	}
+	return opts, nil
+}
+
+func (f *cliFlags) run(target string, stages []string, stdout, stderr io.Writer, runFn func(context.Context, *pipeline.State) error) int {
+	// Wires events to the result writer, runs the scan and reports the outcome.
+	out := stdout
+	if *f.output != "" {
+		file, err := os.Create(*f.output)
+		if err != nil {
+			fmt.Fprintf(stderr, "recon: %v\n", err)
+			return exitError
+		}
+		defer file.Close()
+		out = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *f.timeout)
+		defer cancel()
+	}
+
+	results := newResultWriter(out, *f.format, target, *f.profile, stages)
+	st := pipeline.NewState(0, target, 0)
+	st.Events = results.events(*f.quiet, stderr)
+
+	err := runFn(ctx, st)
+	if ctx.Err() != nil && err == nil {
+		err = ctx.Err()
+	}
+	if werr := results.finish(st, err); werr != nil {
+		fmt.Fprintf(stderr, "recon: writing results: %v\n", werr)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "recon: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func localRegistry(opts pipeline.Options) *pipeline.Registry {
+	// Local runs keep probe results in memory instead of the per-user data tree.
+	reg := opts.Registry()
+	if s, ok := reg.Lookup(pipeline.StageProbe); ok {
+		s.(*pipeline.ProbeStage).Persist = false
+	}
+	if s, ok := reg.Lookup(pipeline.StageDNS); ok {
+		s.(*pipeline.DNSStage).Persist = false
+	}
+	return reg
+}
+
+// parseWithTarget parses flags placed before or after the single positional
+// target argument.
+func parseWithTarget(fs *flag.FlagSet, args []string) (string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		err := fmt.Errorf("expected exactly one target, got %d", len(positional))
+		fmt.Fprintf(fs.Output(), "recon %s: %v\n", fs.Name(), err)
+		return "", err
+	}
+	return positional[0], nil
+}
+
+func usageExit(err error) int {
+	// -h prints the flag help and exits cleanly; other parse errors were already
+	// reported by the flag set.
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"recon/dnsutil"
+	endpointspkg "recon/endpoints"
+	networkpkg "recon/network"
+	"recon/pipeline"
+	reconpkg "recon/recon"
+	"recon/sink"
+)
+
+// Output formats supported by the CLI.
+const (
+	formatJSONL = "jsonl"
+	formatJSON  = "json"
+)
+
+// cliReport collects every finding of a CLI run. In jsonl mode only its
+// summary is written, at the end; in json mode the whole report is written.
+type cliReport struct {
+	Target       string                        `json:"target"`
+	Profile      string                        `json:"profile"`
+	Stages       []string                      `json:"stages"`
+	StartedAt    time.Time                     `json:"started_at"`
+	Duration     string                        `json:"duration"`
+	Error        string                        `json:"error,omitempty"`
+	Summary      cliSummary                    `json:"summary"`
+	Subdomains   []reconpkg.SubdomainResult    `json:"subdomains,omitempty"`
+	DNS          []dnsutil.HostRecords         `json:"dns,omitempty"`
+	Endpoints    []endpointspkg.EndpointResult `json:"endpoints,omitempty"`
+	Technologies []pipeline.HostTechnologies   `json:"technologies,omitempty"`
+	Ports        []networkpkg.PortFinding      `json:"ports,omitempty"`
+	TLS          []networkpkg.TLSResult        `json:"tls,omitempty"`
+	Directories  []networkpkg.DirectoryFinding `json:"directories,omitempty"`
+	Errors       []string                      `json:"errors,omitempty"`
+}
+
+// cliSummary counts what a CLI run found.
+type cliSummary struct {
+	Target      string   `json:"target"`
+	Stages      []string `json:"stages"`
+	Subdomains  int      `json:"subdomains"`
+	AliveHosts  int      `json:"alive_hosts"`
+	Endpoints   int      `json:"endpoints"`
+	OpenPorts   int      `json:"open_ports"`
+	TLSIssues   int      `json:"tls_issues"`
+	Directories int      `json:"directory_findings"`
+	Duration    string   `json:"duration"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// resultWriter turns pipeline events into CLI output. Events may arrive from
+// several goroutines.
+type resultWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	stream *sink.JSONL // Set in jsonl mode
+	report cliReport
+}
+
+func newResultWriter(w io.Writer, format, target, profile string, stages []string) *resultWriter {
+	r := &resultWriter{
+		w:      w,
+		report: cliReport{Target: target, Profile: profile, Stages: stages, StartedAt: time.Now().UTC()},
+	}
+	if format == formatJSONL {
+		r.stream = sink.NewJSONL(w, 0, target)
+	}
+	return r
+}
+
+func (r *resultWriter) events(quiet bool, progress io.Writer) pipeline.Events {
+	// Records every finding and streams it as a JSONL line when in jsonl mode.
+	return pipeline.Events{
+		Log: func(message, level string) {
+			if !quiet {
+				fmt.Fprintln(progress, message)
+			}
+		},
+		Subdomain: func(sub reconpkg.SubdomainResult) {
+			r.add(sink.TypeSubdomain, sub, func(rep *cliReport) {
+				rep.Subdomains = append(rep.Subdomains, sub)
+				rep.Summary.Subdomains++
+				if sub.Alive {
+					rep.Summary.AliveHosts++
+				}
+			})
+		},
+		DNS: func(rec dnsutil.HostRecords) {
+			r.add(sink.TypeDNS, rec, func(rep *cliReport) {
+				rep.DNS = append(rep.DNS, rec)
+			})
+		},
+		Endpoint: func(ep endpointspkg.EndpointResult) {
+			r.add(sink.TypeEndpoint, ep, func(rep *cliReport) {
+				rep.Endpoints = append(rep.Endpoints, ep)
+				rep.Summary.Endpoints++
+			})
+		},
+		Technologies: func(tech pipeline.HostTechnologies) {
+			r.add("technologies", tech, func(rep *cliReport) {
+				rep.Technologies = append(rep.Technologies, tech)
+			})
+		},
+		Ports: func(host string, findings []networkpkg.PortFinding) {
+			for _, p := range findings {
+				r.add(sink.TypePort, p, func(rep *cliReport) {
+					rep.Ports = append(rep.Ports, p)
+					rep.Summary.OpenPorts++
+				})
+			}
+		},
+		TLS: func(res networkpkg.TLSResult) {
+			r.add(sink.TypeTLS, res, func(rep *cliReport) {
+				rep.TLS = append(rep.TLS, res)
+				rep.Summary.TLSIssues += len(res.Issues)
+			})
+		},
+		Directories: func(host string, findings []networkpkg.DirectoryFinding) {
+			for _, d := range findings {
+				r.add(sink.TypeDirectory, d, func(rep *cliReport) {
+					rep.Directories = append(rep.Directories, d)
+					rep.Summary.Directories++
+				})
+			}
+		},
+		Error: func(err error) {
+			if !quiet {
+				fmt.Fprintf(progress, "⚠️ %v\n", err)
+			}
+			r.add("error", err.Error(), func(rep *cliReport) {
+				rep.Errors = append(rep.Errors, err.Error())
+			})
+		},
+	}
+}
+
+func (r *resultWriter) add(kind string, data interface{}, record func(*cliReport)) {
+	// Updates the report and, in jsonl mode, writes the finding immediately.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record(&r.report)
+	if r.stream != nil {
+		r.stream.Write(kind, data)
+	}
+}
+
+func (r *resultWriter) finish(st *pipeline.State, runErr error) error {
+	// Fills in results produced without events and writes the summary or report.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := &r.report
+	if subs, ok := pipeline.Get(st, pipeline.KeySubdomains); ok && rep.Summary.Subdomains == 0 {
+		// The network command seeds subdomains directly, so no events were seen.
+		rep.Summary.Subdomains = len(subs)
+		for _, sub := range subs {
+			if sub.Alive {
+				rep.Summary.AliveHosts++
+			}
+		}
+	}
+	rep.Duration = time.Since(rep.StartedAt).Round(time.Millisecond).String()
+	if runErr != nil {
+		rep.Error = runErr.Error()
+	}
+	rep.Summary.Target = rep.Target
+	rep.Summary.Stages = rep.Stages
+	rep.Summary.Duration = rep.Duration
+	rep.Summary.Error = rep.Error
+
+	if r.stream != nil {
+		r.stream.Write("summary", rep.Summary)
+		return r.stream.Err()
+	}
+	enc := json.NewEncoder(r.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
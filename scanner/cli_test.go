@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	networkpkg "recon/network"
+	"recon/pipeline"
+	reconpkg "recon/recon"
+	"recon/sink"
+)
+
+func TestParseWithTargetAcceptsFlagsOnEitherSide(t *testing.T) {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	profile := fs.String("profile", "standard", "")
+	quiet := fs.Bool("q", false, "")
+
+	target, err := parseWithTarget(fs, []string{"-q", "example.com", "-profile", "quick"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "example.com" || *profile != "quick" || !*quiet {
+		t.Fatalf("target=%q profile=%q quiet=%v", target, *profile, *quiet)
+	}
+
+	if _, err := parseWithTarget(fs, []string{"a.com", "b.com"}); err == nil {
+		t.Fatal("expected an error for two targets")
+	}
+	if _, err := parseWithTarget(fs, nil); err == nil {
+		t.Fatal("expected an error for a missing target")
+	}
+}
+
+func TestRunCLIRejectsBadInvocations(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cases := [][]string{
+		{"frobnicate"},
+		{"scan"},
+		{"scan", "-profile", "nope", "example.com"},
+		{"scan", "-phases", "subdomains,screenshots", "example.com"},
+		{"endpoints", "-format", "xml", "example.com"},
+	}
+	for _, args := range cases {
+		if code := runCLI(args, &stdout, &stderr); code != exitUsage {
+			t.Errorf("%v: exit code %d, want %d", args, code, exitUsage)
+		}
+	}
+	if code := runCLI([]string{"help"}, &stdout, &stderr); code != exitOK || !strings.Contains(stdout.String(), "scan <target>") {
+		t.Fatalf("help: exit code %d, output %q", code, stdout.String())
+	}
+}
+
+func TestResultWriterStreamsJSONLAndSummarizes(t *testing.T) {
+	var out bytes.Buffer
+	w := newResultWriter(&out, formatJSONL, "example.com", "quick", []string{pipeline.StageSubdomains, pipeline.StageProbe})
+	events := w.events(true, io.Discard)
+
+	events.Subdomain(reconpkg.SubdomainResult{Name: "a.example.com", Alive: true})
+	events.Subdomain(reconpkg.SubdomainResult{Name: "b.example.com"})
+	events.Ports("a.example.com", []networkpkg.PortFinding{{Host: "a.example.com", Port: 443}})
+	if err := w.finish(pipeline.NewState(0, "example.com", 0), errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var types []string
+	var summary struct {
+		Data cliSummary `json:"data"`
+	}
+	for _, line := range lines {
+		var rec sink.Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("bad line %q: %v", line, err)
+		}
+		types = append(types, rec.Type)
+	}
+	if got := strings.Join(types, ","); got != "subdomain,subdomain,port,summary" {
+		t.Fatalf("record types = %s", got)
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	s := summary.Data
+	if s.Subdomains != 2 || s.AliveHosts != 1 || s.OpenPorts != 1 || s.Error != "boom" {
+		t.Fatalf("summary = %+v", s)
+	}
+}
+
+func TestResultWriterJSONReport(t *testing.T) {
+	var out bytes.Buffer
+	w := newResultWriter(&out, formatJSON, "10.0.0.1", "standard", []string{pipeline.StageNetwork})
+	w.events(true, io.Discard).TLS(networkpkg.TLSResult{Host: "10.0.0.1", HasHTTPS: true, Issues: []string{"tls1.0"}})
+
+	st := pipeline.NewState(0, "10.0.0.1", 0)
+	pipeline.Put(st, pipeline.KeySubdomains, []reconpkg.SubdomainResult{{Name: "10.0.0.1", Alive: true}})
+	if err := w.finish(st, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var rep cliReport
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.TLS) != 1 || rep.Summary.TLSIssues != 1 || rep.Summary.AliveHosts != 1 || rep.Error != "" {
+		t.Fatalf("report = %+v", rep)
+	}
+}
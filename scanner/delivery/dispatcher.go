@@ -0,0 +1,647 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HeaderIdempotencyKey identifies a batch across retries and spool replays so
+// the receiver can drop duplicates.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// Config tunes batching, retries and the on-disk outbox.
+type Config struct {
+	BatchSize     int           // Items per batch before it is sent (default: 50)
+	FlushInterval time.Duration // Max time an item waits in a batch (default: 1s)
+	MaxAttempts   int           // Attempts before a batch is spooled to disk (default: 5)
+	BaseBackoff   time.Duration // First retry delay (default: 500ms)
+	MaxBackoff    time.Duration // Retry delay cap (default: 30s)
+	QueueSize     int           // Batches buffered per destination before spooling (default: 1024)
+	SpoolDir      string        // Outbox directory for undelivered batches (default: "data/outbox")
+	RetryInterval time.Duration // How often the outbox is retried (default: 30s)
+	Client        *http.Client  // HTTP client used for delivery (default: 10s timeout)
+	SealKey       []byte        // AES key sealing auth headers in the outbox; without one they are not spooled
+
+	// Sign is called before every attempt with the exact body being sent.
+	Sign func(req *http.Request, body []byte)
+}
+
+// Stats reports delivery health.
+type Stats struct {
+	ItemsEnqueued      int64   `json:"items_enqueued"`
+	BatchesDelivered   int64   `json:"batches_delivered"`
+	AttemptsFailed     int64   `json:"attempts_failed"`
+	BatchesSpooled     int64   `json:"batches_spooled"`
+	BatchesReplayed    int64   `json:"batches_replayed"`
+	BatchesDropped     int64   `json:"batches_dropped"`
+	BatchesPending     int64   `json:"batches_pending"`
+	SpoolPending       int     `json:"spool_pending"`
+	LastLagSeconds     float64 `json:"last_lag_seconds"`
+	MaxLagSeconds      float64 `json:"max_lag_seconds"`
+	LastError          string  `json:"last_error,omitempty"`
+	LastErrorAt        string  `json:"last_error_at,omitempty"`
+	LastDeliveredAt    string  `json:"last_delivered_at,omitempty"`
+	ActiveDestinations int     `json:"active_destinations"`
+}
+
+// batch is one HTTP POST: either a group of items sent as {"items": [...]} or a
+// single message sent as-is.
+type batch struct {
+	URL        string          `json:"url"`
+	Lane       string          `json:"lane,omitempty"` // Set when the lane is not URL
+	AuthHeader string          `json:"auth_header,omitempty"`
+	SealedAuth []byte          `json:"sealed_auth,omitempty"`
+	Key        string          `json:"idempotency_key"`
+	Body       json.RawMessage `json:"body"`
+	Items      int             `json:"items"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// laneKey names the lane delivering b: its Lane, or its URL by default.
+func (b *batch) laneKey() string {
+	if b.Lane != "" {
+		return b.Lane
+	}
+	return b.URL
+}
+
+type bufferKey struct {
+	lane       string
+	url        string
+	authHeader string
+}
+
+type buffer struct {
+	items  []json.RawMessage
+	oldest time.Time
+	timer  *time.Timer
+}
+
+// lane delivers batches for one destination in order. A destination is a URL
+// unless the caller names a lane, e.g. one scan's share of a webhook URL that
+// several scans post to. Spooled batches for the lane are replayed by the lane
+// too, before any live batch, so a live batch never overtakes an older spooled
+// one.
+type lane struct {
+	queue  chan *batch
+	replay chan struct{}
+}
+
+// Dispatcher batches, retries and spools callback deliveries.
+type Dispatcher struct {
+	cfg   Config
+	spool *spool
+
+	mu          sync.Mutex
+	buffers     map[bufferKey]*buffer
+	lanes       map[string]*lane
+	pendingLane map[string]int // In-flight batches per lane
+	closed      bool
+
+	pending atomic.Int64
+	kick    chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// NewDispatcher creates a dispatcher and starts its outbox replay loop.
+func NewDispatcher(cfg Config) (*Dispatcher, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.SpoolDir == "" {
+		cfg.SpoolDir = "data/outbox"
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 30 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	sp, err := openSpool(cfg.SpoolDir, cfg.SealKey)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		cfg:         cfg,
+		spool:       sp,
+		buffers:     make(map[bufferKey]*buffer),
+		lanes:       make(map[string]*lane),
+		pendingLane: make(map[string]int),
+		kick:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	d.wg.Add(1)
+	go d.replayLoop()
+	d.kickReplay()
+	return d, nil
+}
+
+// Enqueue adds one item to the batch for url. Items are posted as
+// {"items": [...]} when the batch is full or FlushInterval elapses.
+func (d *Dispatcher) Enqueue(url, authHeader string, item any) {
+	d.EnqueueLane(url, url, authHeader, item)
+}
+
+// EnqueueLane is Enqueue on a named lane instead of the URL's own. Lanes are
+// ordered and flushed independently, so scans sharing a URL do not wait on
+// each other.
+func (d *Dispatcher) EnqueueLane(laneKey, url, authHeader string, item any) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("[delivery] dropping unencodable item for %s: %v", url, err)
+		return
+	}
+
+	d.statsMu.Lock()
+	d.stats.ItemsEnqueued++
+	d.statsMu.Unlock()
+
+	key := bufferKey{lane: laneKey, url: url, authHeader: authHeader}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	buf, ok := d.buffers[key]
+	if !ok {
+		buf = &buffer{oldest: time.Now()}
+		d.buffers[key] = buf
+		buf.timer = time.AfterFunc(d.cfg.FlushInterval, func() { d.flushKey(key) })
+	}
+	buf.items = append(buf.items, data)
+	if len(buf.items) >= d.cfg.BatchSize {
+		d.flushBufferLocked(key, buf)
+	}
+}
+
+// Send delivers one message as-is, with the same retry and spool guarantees as
+// batches. Messages to the same URL are delivered in the order they were sent.
+func (d *Dispatcher) Send(url, authHeader string, payload any) {
+	d.SendLane(url, url, authHeader, payload)
+}
+
+// SendLane is Send on a named lane; see EnqueueLane.
+func (d *Dispatcher) SendLane(laneKey, url, authHeader string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[delivery] dropping unencodable payload for %s: %v", url, err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.submitLocked(&batch{
+		URL:        url,
+		Lane:       laneName(laneKey, url),
+		AuthHeader: authHeader,
+		Key:        newKey(),
+		Body:       data,
+		Items:      1,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// Flush sends every open batch and waits until all in-flight batches were
+// delivered, dropped or spooled, or ctx is done.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	for key, buf := range d.buffers {
+		d.flushBufferLocked(key, buf)
+	}
+	d.mu.Unlock()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for d.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// FlushPrefix is Flush limited to lanes whose name starts with prefix, such as
+// one scan's callback URLs, so it does not wait for other scans.
+func (d *Dispatcher) FlushPrefix(ctx context.Context, prefix string) error {
+	d.mu.Lock()
+	for key, buf := range d.buffers {
+		if strings.HasPrefix(key.lane, prefix) {
+			d.flushBufferLocked(key, buf)
+		}
+	}
+	d.mu.Unlock()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for d.pendingWithPrefix(prefix) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) pendingWithPrefix(prefix string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for name, count := range d.pendingLane {
+		if strings.HasPrefix(name, prefix) {
+			n += count
+		}
+	}
+	return n
+}
+
+// Close flushes pending deliveries and stops background work. Batches still in
+// flight when ctx expires are spooled by their lanes and replayed on next start.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	err := d.Flush(ctx)
+
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	close(d.done)
+	d.wg.Wait()
+	return err
+}
+
+// Stats returns a snapshot of delivery counters.
+func (d *Dispatcher) Stats() Stats {
+	d.statsMu.Lock()
+	s := d.stats
+	d.statsMu.Unlock()
+
+	s.BatchesPending = d.pending.Load()
+	s.SpoolPending = d.spool.count()
+
+	d.mu.Lock()
+	s.ActiveDestinations = len(d.lanes)
+	d.mu.Unlock()
+	return s
+}
+
+func (d *Dispatcher) flushKey(key bufferKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if buf, ok := d.buffers[key]; ok {
+		d.flushBufferLocked(key, buf)
+	}
+}
+
+func (d *Dispatcher) flushBufferLocked(key bufferKey, buf *buffer) {
+	// Turns an open buffer into a batch and hands it to its lane.
+	delete(d.buffers, key)
+	buf.timer.Stop()
+	if len(buf.items) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]any{"items": buf.items})
+	d.submitLocked(&batch{
+		URL:        key.url,
+		Lane:       laneName(key.lane, key.url),
+		AuthHeader: key.authHeader,
+		Key:        newKey(),
+		Body:       body,
+		Items:      len(buf.items),
+		CreatedAt:  buf.oldest,
+	})
+}
+
+func (d *Dispatcher) submitLocked(b *batch) {
+	// Queues a batch on its destination lane, spooling it if the lane is saturated
+	// or the dispatcher is shutting down.
+	if d.closed {
+		d.spoolBatch(b, "dispatcher closed")
+		return
+	}
+
+	l := d.laneLocked(b.laneKey())
+	select {
+	case l.queue <- b:
+		d.pending.Add(1)
+		d.pendingLane[b.laneKey()]++
+	default:
+		d.spoolBatch(b, "delivery queue full")
+	}
+}
+
+func (d *Dispatcher) laneLocked(name string) *lane {
+	l, ok := d.lanes[name]
+	if !ok {
+		l = &lane{queue: make(chan *batch, d.cfg.QueueSize), replay: make(chan struct{}, 1)}
+		d.lanes[name] = l
+		d.wg.Add(1)
+		go d.runLane(name, l)
+	}
+	return l
+}
+
+func (d *Dispatcher) runLane(name string, l *lane) {
+	// One goroutine per lane keeps its deliveries in order.
+	defer d.wg.Done()
+	idle := time.NewTimer(time.Minute)
+	defer idle.Stop()
+	resetIdle := func() {
+		if !idle.Stop() {
+			<-idle.C
+		}
+		idle.Reset(time.Minute)
+	}
+
+	for {
+		select {
+		case b := <-l.queue:
+			if d.replayLane(name) {
+				d.deliver(b)
+			} else {
+				d.spoolBatch(b, "older batches still spooled")
+			}
+			d.batchDone(name)
+			resetIdle()
+		case <-l.replay:
+			d.replayLane(name)
+			resetIdle()
+		case <-idle.C:
+			d.mu.Lock()
+			if len(l.queue) == 0 && len(l.replay) == 0 {
+				delete(d.lanes, name)
+				d.mu.Unlock()
+				return
+			}
+			d.mu.Unlock()
+			idle.Reset(time.Minute)
+		case <-d.done:
+			// Anything left is persisted for the next process.
+			for {
+				select {
+				case b := <-l.queue:
+					d.spoolBatch(b, "shutdown")
+					d.batchDone(name)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) batchDone(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending.Add(-1)
+	d.pendingLane[name]--
+	if d.pendingLane[name] <= 0 {
+		delete(d.pendingLane, name)
+	}
+}
+
+func (d *Dispatcher) deliver(b *batch) {
+	// Retries with exponential backoff and jitter, then spools the batch.
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		retryable, err := d.post(b)
+		if err == nil {
+			d.recordDelivered(b)
+			d.kickReplay()
+			return
+		}
+		d.recordFailure(err)
+		if !retryable {
+			log.Printf("[delivery] dropping batch %s for %s: %v", b.Key, b.URL, err)
+			d.recordDropped()
+			return
+		}
+		if attempt == d.cfg.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(d.backoff(attempt)):
+		case <-d.done:
+			d.spoolBatch(b, "shutdown during retry")
+			return
+		}
+	}
+
+	d.spoolBatch(b, "retries exhausted")
+}
+
+// post makes one delivery attempt. It reports whether a failure is worth retrying.
+func (d *Dispatcher) post(b *batch) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, b.URL, bytes.NewReader(b.Body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderIdempotencyKey, b.Key)
+	if b.AuthHeader != "" {
+		req.Header.Set("Authorization", b.AuthHeader)
+	}
+	if d.cfg.Sign != nil {
+		d.cfg.Sign(req, b.Body)
+	}
+
+	start := time.Now()
+	resp, err := d.cfg.Client.Do(req)
+	postDuration.ObserveSince(start)
+	if err != nil {
+		postErrors.Inc("network")
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	postErrors.Inc(fmt.Sprintf("%dxx", resp.StatusCode/100))
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("POST %s returned %d: %s", b.URL, resp.StatusCode, bytes.TrimSpace(body))
+	// Client errors will not succeed on retry, except timeouts and throttling.
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, err
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	// Exponential backoff with "equal jitter": half fixed, half random.
+	delay := d.cfg.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(mathrand.Int63n(int64(half)+1))
+}
+
+func (d *Dispatcher) spoolBatch(b *batch, reason string) {
+	if err := d.spool.write(b); err != nil {
+		log.Printf("[delivery] lost batch %s for %s (%s): spool failed: %v", b.Key, b.URL, reason, err)
+		d.recordDropped()
+		return
+	}
+	log.Printf("[delivery] spooled batch %s for %s (%s)", b.Key, b.URL, reason)
+	d.statsMu.Lock()
+	d.stats.BatchesSpooled++
+	d.statsMu.Unlock()
+}
+
+func (d *Dispatcher) kickReplay() {
+	if d.spool.count() == 0 {
+		return
+	}
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) replayLoop() {
+	// Retries spooled batches periodically and whenever a live delivery succeeds,
+	// by waking the lane of every destination with a backlog.
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.cfg.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		case <-d.kick:
+		}
+		d.replaySpool()
+	}
+}
+
+func (d *Dispatcher) replaySpool() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	for _, name := range d.spool.lanes() {
+		select {
+		case d.laneLocked(name).replay <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *Dispatcher) replayLane(name string) bool {
+	// Delivers the spooled batches for a lane in order, from the lane itself. It
+	// reports whether the backlog is empty, i.e. whether live batches may go out.
+	for _, path := range d.spool.listLane(name) {
+		select {
+		case <-d.done:
+			return false
+		default:
+		}
+
+		b, err := d.spool.read(path)
+		if err != nil {
+			log.Printf("[delivery] discarding unreadable outbox entry %s: %v", path, err)
+			d.spool.remove(path)
+			continue
+		}
+
+		retryable, err := d.post(b)
+		if err != nil && retryable {
+			// Destination still unavailable; keep order and try again later.
+			d.recordFailure(err)
+			return false
+		}
+		if err != nil {
+			log.Printf("[delivery] dropping outbox batch %s for %s: %v", b.Key, b.URL, err)
+			d.recordDropped()
+		} else {
+			d.recordDelivered(b)
+			d.statsMu.Lock()
+			d.stats.BatchesReplayed++
+			d.statsMu.Unlock()
+		}
+		d.spool.remove(path)
+	}
+	return true
+}
+
+func (d *Dispatcher) recordDelivered(b *batch) {
+	now := time.Now()
+	lag := now.Sub(b.CreatedAt).Seconds()
+	d.statsMu.Lock()
+	defer d.statsMu.Unlock()
+	d.stats.BatchesDelivered++
+	d.stats.LastLagSeconds = lag
+	if lag > d.stats.MaxLagSeconds {
+		d.stats.MaxLagSeconds = lag
+	}
+	d.stats.LastDeliveredAt = now.UTC().Format(time.RFC3339)
+}
+
+func (d *Dispatcher) recordFailure(err error) {
+	d.statsMu.Lock()
+	defer d.statsMu.Unlock()
+	d.stats.AttemptsFailed++
+	d.stats.LastError = err.Error()
+	d.stats.LastErrorAt = time.Now().UTC().Format(time.RFC3339)
+}
+
+func (d *Dispatcher) recordDropped() {
+	d.statsMu.Lock()
+	defer d.statsMu.Unlock()
+	d.stats.BatchesDropped++
+}
+
+// laneName is the Lane recorded on a batch: empty when it is the URL's own.
+func laneName(laneKey, url string) string {
+	if laneKey == url {
+		return ""
+	}
+	return laneKey
+}
+
+func newKey() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,328 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig(t *testing.T) Config {
+	return Config{
+		BatchSize:     3,
+		FlushInterval: 50 * time.Millisecond,
+		MaxAttempts:   3,
+		BaseBackoff:   5 * time.Millisecond,
+		MaxBackoff:    20 * time.Millisecond,
+		SpoolDir:      t.TempDir(),
+		RetryInterval: time.Hour,
+	}
+}
+
+func TestEnqueueBatchesAndRetriesWithSameKey(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		keys  []string
+		items []int
+		calls atomic.Int32
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+		mu.Unlock()
+		// Fail the first attempt so the batch is retried.
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+		mu.Lock()
+		items = append(items, len(body.Items))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		d.Enqueue(srv.URL, "", map[string]int{"n": i})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("expected one retry with the same idempotency key, got %v", keys)
+	}
+	if len(items) != 1 || items[0] != 3 {
+		t.Fatalf("expected a single batch of 3 items, got %v", items)
+	}
+	if s := d.Stats(); s.BatchesDelivered != 1 || s.AttemptsFailed != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestSpoolsWhenBackendDownAndReplaysOnRecovery(t *testing.T) {
+	var up atomic.Bool
+	var delivered atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		delivered.Add(1)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t)
+	d, err := NewDispatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Send(srv.URL, "", map[string]string{"status": "RUNNING"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.Stats(); s.BatchesSpooled != 1 || s.SpoolPending != 1 {
+		t.Fatalf("expected batch in outbox, got %+v", s)
+	}
+	_ = d.Close(ctx)
+
+	// A new dispatcher over the same outbox delivers the spooled batch once the
+	// backend is back.
+	up.Store(true)
+	d, err = NewDispatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Stats().SpoolPending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := d.Stats(); s.SpoolPending != 0 || s.BatchesReplayed != 1 || delivered.Load() != 1 {
+		t.Fatalf("expected outbox replay, got %+v delivered=%d", s, delivered.Load())
+	}
+}
+
+func TestSpoolSealsAuthHeader(t *testing.T) {
+	var up atomic.Bool
+	var gotAuth atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		gotAuth.Store(r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t)
+	cfg.SealKey = bytes.Repeat([]byte{7}, 32)
+	d, err := NewDispatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Send(srv.URL, "Bearer user-jwt", map[string]string{"status": "RUNNING"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = d.Close(ctx)
+
+	entries, _ := filepath.Glob(filepath.Join(cfg.SpoolDir, "*.json"))
+	if len(entries) != 1 {
+		t.Fatalf("expected one outbox entry, got %v", entries)
+	}
+	if data, _ := os.ReadFile(entries[0]); bytes.Contains(data, []byte("user-jwt")) {
+		t.Fatalf("auth header spooled in plaintext: %s", data)
+	}
+
+	up.Store(true)
+	d, err = NewDispatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Stats().SpoolPending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, _ := gotAuth.Load().(string); got != "Bearer user-jwt" {
+		t.Fatalf("replayed Authorization = %q", got)
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Send(srv.URL, "", map[string]string{"bad": "payload"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = d.Close(ctx)
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls.Load())
+	}
+	if s := d.Stats(); s.BatchesDropped != 1 || s.SpoolPending != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestLiveBatchDoesNotOvertakeSpooledBacklog(t *testing.T) {
+	var (
+		up       atomic.Bool
+		mu       sync.Mutex
+		statuses []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var body struct {
+			Status string `json:"status"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		statuses = append(statuses, body.Status)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d.Send(srv.URL, "", map[string]string{"status": "RUNNING"})
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.Stats(); s.SpoolPending != 1 {
+		t.Fatalf("expected RUNNING in the outbox, got %+v", s)
+	}
+
+	// The backend recovers; the final status must land after the spooled one.
+	up.Store(true)
+	d.Send(srv.URL, "", map[string]string{"status": "COMPLETED"})
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(statuses) != 2 || statuses[0] != "RUNNING" || statuses[1] != "COMPLETED" {
+		t.Fatalf("statuses delivered as %v, want [RUNNING COMPLETED]", statuses)
+	}
+	if s := d.Stats(); s.SpoolPending != 0 || s.BatchesReplayed != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestFlushPrefixWaitsOnlyForMatchingDestinations(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/scans/1/status/" {
+			<-release // Another scan's destination is stuck
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	d, err := NewDispatcher(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Send(srv.URL+"/scans/1/status/", "", map[string]string{"status": "RUNNING"})
+	d.Enqueue(srv.URL+"/scans/2/ingest/", "", map[string]int{"n": 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := d.FlushPrefix(ctx, srv.URL+"/scans/2/"); err != nil {
+		t.Fatalf("flush of scan 2 waited for scan 1: %v", err)
+	}
+	if s := d.Stats(); s.BatchesDelivered != 1 || s.BatchesPending != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	if err := d.FlushPrefix(short, srv.URL+"/scans/1/"); err == nil {
+		t.Fatal("flush of scan 1 returned while its batch was in flight")
+	}
+}
+
+func TestLanesSeparateScansSharingAURL(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"scan":1`) {
+			<-release // Scan 1's share of the webhook is stuck
+		}
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	d, err := NewDispatcher(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := srv.URL + "/hook"
+	d.SendLane(hook+"#scan/1/", hook, "", map[string]int{"scan": 1})
+	d.EnqueueLane(hook+"#scan/2/", hook, "", map[string]int{"scan": 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := d.FlushPrefix(ctx, hook+"#scan/2/"); err != nil {
+		t.Fatalf("flush of scan 2 waited for scan 1 on the same URL: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 || !strings.Contains(bodies[0], `"scan":2`) {
+		t.Fatalf("delivered = %v", bodies)
+	}
+}
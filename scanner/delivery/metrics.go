@@ -0,0 +1,9 @@
+package delivery
+
+import "recon/metrics"
+
+// Callback POST metrics; every delivery attempt is observed, including retries.
+var (
+	postDuration = metrics.NewHistogram("recon_callback_post_duration_seconds", "Latency of callback POST attempts.", metrics.LatencyBuckets)
+	postErrors   = metrics.NewCounter("recon_callback_post_errors_total", "Failed callback POST attempts by reason (network, 4xx, 5xx).", "reason")
+)
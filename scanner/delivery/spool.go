@@ -0,0 +1,230 @@
+package delivery
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spool persists undelivered batches as one JSON file each. File names start
+// with a nanosecond timestamp so replay preserves the original order. Auth
+// headers are sealed with key, or left out when there is no key, so they are
+// never written to disk in plaintext.
+type spool struct {
+	dir string
+	key []byte
+
+	mu    sync.Mutex
+	seq   int64
+	index map[string]string // Entry path -> lane
+}
+
+func openSpool(dir string, key []byte) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create outbox dir: %w", err)
+	}
+	if key != nil {
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("outbox seal key: %w", err)
+		}
+	}
+	s := &spool{dir: dir, key: key, index: make(map[string]string)}
+	for _, path := range s.list() {
+		b, err := s.read(path)
+		if err != nil {
+			log.Printf("[delivery] discarding unreadable outbox entry %s: %v", path, err)
+			_ = os.Remove(path)
+			continue
+		}
+		s.index[path] = b.laneKey()
+	}
+	return s, nil
+}
+
+func (s *spool) write(b *batch) error {
+	entry := *b
+	if entry.AuthHeader != "" {
+		if s.key == nil {
+			log.Printf("[delivery] spooling batch %s for %s without its auth header (no outbox seal key)", b.Key, b.URL)
+		} else {
+			sealed, err := s.seal(entry.AuthHeader)
+			if err != nil {
+				return err
+			}
+			entry.SealedAuth = sealed
+		}
+		entry.AuthHeader = ""
+	}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d-%s.json", time.Now().UnixNano(), s.seq%1000000, b.Key)
+	s.mu.Unlock()
+
+	// Write to a temp file first so a crash never leaves a torn entry behind.
+	path := filepath.Join(s.dir, name)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.mu.Lock()
+	s.index[path] = b.laneKey()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *spool) list() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("[delivery] failed to read outbox: %v", err)
+		return nil
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.dir, e.Name()))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *spool) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// lanes returns the lanes that have spooled batches.
+func (s *spool) lanes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool)
+	var out []string
+	for _, name := range s.index {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// listLane returns the spooled batches for a lane, oldest first.
+func (s *spool) listLane(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for path, l := range s.index {
+		if l == name {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *spool) read(path string) (*batch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b batch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	if b.URL == "" || len(b.Body) == 0 {
+		return nil, fmt.Errorf("incomplete entry")
+	}
+	if b.SealedAuth != nil {
+		header, err := s.open(b.SealedAuth)
+		if err != nil {
+			return nil, err
+		}
+		b.AuthHeader, b.SealedAuth = header, nil
+	}
+	return &b, nil
+}
+
+func (s *spool) seal(header string) ([]byte, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(header), nil), nil
+}
+
+func (s *spool) open(sealed []byte) (string, error) {
+	if s.key == nil {
+		return "", errors.New("auth header is sealed but there is no outbox seal key")
+	}
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("sealed auth header is truncated")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot unseal auth header (seal key changed?): %w", err)
+	}
+	return string(plain), nil
+}
+
+func (s *spool) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *spool) remove(path string) {
+	s.mu.Lock()
+	delete(s.index, path)
+	s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[delivery] failed to remove outbox entry %s: %v", path, err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"recon/dnsutil"
+	"recon/enum"
+)
+
+func configureDNS() {
+	// Sets the worker-wide resolver pool used for DNS brute-forcing:
+	//   RECON_DNS_RESOLVERS  comma-separated ip or ip:port (default: public resolvers)
+	//   RECON_DNS_QPS        queries per second across the pool (default 200)
+	//   RECON_DNS_WORDLIST   subdomain wordlist (default wordlists/subdomains.txt)
+	var cfg dnsutil.Config
+	if raw := os.Getenv("RECON_DNS_RESOLVERS"); raw != "" {
+		cfg.Resolvers = strings.Split(raw, ",")
+	}
+	if raw := os.Getenv("RECON_DNS_QPS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			cfg.QPS = v
+		} else {
+			log.Printf("[dns] invalid RECON_DNS_QPS %q, using the default", raw)
+		}
+	}
+	client, err := dnsutil.New(cfg)
+	if err != nil {
+		log.Fatalf("[dns] RECON_DNS_RESOLVERS: %v", err)
+	}
+	dnsutil.SetDefault(client)
+	if path := os.Getenv("RECON_DNS_WORDLIST"); path != "" {
+		enum.SetDefaultWordlist(path)
+	}
+	log.Printf("[dns] resolving through %s, wordlist %s", strings.Join(client.Resolvers(), ", "), enum.DefaultWordlist())
+}
@@ -0,0 +1,109 @@
+package dnsutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// HostRecords is the DNS data collected for one host.
+type HostRecords struct {
+	Name       string   `json:"name"`
+	NotFound   bool     `json:"nxdomain,omitempty"`    // The name does not exist; nothing else is set
+	CNAMEChain []Record `json:"cname_chain,omitempty"` // Aliases followed from Name, in order
+	A          []Record `json:"a,omitempty"`
+	AAAA       []Record `json:"aaaa,omitempty"`
+	MX         []Record `json:"mx,omitempty"`
+	NS         []Record `json:"ns,omitempty"`
+	TXT        []Record `json:"txt,omitempty"` // Includes _dmarc.<name>
+	CAA        []Record `json:"caa,omitempty"`
+	SOA        []Record `json:"soa,omitempty"`
+	Errors     []string `json:"errors,omitempty"` // Queries that failed after retries
+}
+
+// collectTypes are queried for every host after A, in this order.
+var collectTypes = []dnsmessage.Type{TypeAAAA, TypeMX, TypeNS, TypeTXT, TypeCAA, TypeSOA}
+
+// Collect queries every record type of name that analysts read: the CNAME
+// chain, A and AAAA with their TTLs, MX, NS, TXT (with the DMARC policy at
+// _dmarc.<name>), CAA and SOA. A failing query is listed in Errors and the
+// others still run; only a cancelled ctx stops collection early.
+func (c *Client) Collect(ctx context.Context, name string) *HostRecords {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	out := &HostRecords{Name: name}
+
+	resp, err := c.Query(ctx, name, TypeA)
+	switch {
+	case err != nil:
+		out.Errors = append(out.Errors, err.Error())
+	case resp.NotFound():
+		out.NotFound = true
+		return out
+	default:
+		out.add(resp.Answers)
+	}
+
+	for _, qtype := range collectTypes {
+		if ctx.Err() != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("dns %s %s: %v", TypeName(qtype), name, ctx.Err()))
+			return out
+		}
+		resp, err := c.Query(ctx, name, qtype)
+		if err != nil {
+			out.Errors = append(out.Errors, err.Error())
+			continue
+		}
+		out.add(resp.Answers)
+	}
+
+	// DMARC policies live on their own name, which usually does not exist.
+	// A CNAME there belongs to the policy, not to the host's chain.
+	if resp, err := c.Query(ctx, "_dmarc."+name, TypeTXT); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+	} else {
+		for _, rec := range resp.Answers {
+			if rec.Type == "TXT" {
+				out.TXT = append(out.TXT, rec)
+			}
+		}
+	}
+	return out
+}
+
+func (h *HostRecords) add(answers []Record) {
+	// Files answer records by type. CNAMEs are repeated in the answer to every
+	// query, so the chain is only recorded once.
+	for _, rec := range answers {
+		switch rec.Type {
+		case "CNAME":
+			if !containsRecord(h.CNAMEChain, rec) {
+				h.CNAMEChain = append(h.CNAMEChain, rec)
+			}
+		case "A":
+			h.A = append(h.A, rec)
+		case "AAAA":
+			h.AAAA = append(h.AAAA, rec)
+		case "MX":
+			h.MX = append(h.MX, rec)
+		case "NS":
+			h.NS = append(h.NS, rec)
+		case "TXT":
+			h.TXT = append(h.TXT, rec)
+		case "CAA":
+			h.CAA = append(h.CAA, rec)
+		case "SOA":
+			h.SOA = append(h.SOA, rec)
+		}
+	}
+}
+
+func containsRecord(recs []Record, want Record) bool {
+	for _, r := range recs {
+		if r.Name == want.Name && r.Value == want.Value {
+			return true
+		}
+	}
+	return false
+}
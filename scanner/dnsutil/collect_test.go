@@ -0,0 +1,91 @@
+package dnsutil
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"recon/dnsutil/dnstest"
+)
+
+func TestCollectGathersEveryRecordType(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("shop.example.com", TypeCNAME, 300, "shop.edge.example.net")
+	srv.Add("shop.edge.example.net", TypeCNAME, 120, "lb.cdn.example")
+	srv.Add("lb.cdn.example", TypeA, 60, "192.0.2.10")
+	srv.Add("lb.cdn.example", TypeAAAA, 60, "2001:db8::10")
+	srv.Add("example.com", TypeA, 300, "192.0.2.1")
+	srv.Add("example.com", TypeMX, 3600, "10 mx1.example.com", "20 mx2.example.com")
+	srv.Add("example.com", TypeNS, 86400, "ns1.example.com")
+	srv.Add("example.com", TypeTXT, 300, "v=spf1 include:_spf.example.net -all", "google-site-verification=abc123")
+	srv.Add("example.com", TypeCAA, 3600, `0 issue "letsencrypt.org"`)
+	srv.Add("example.com", TypeSOA, 3600, "ns1.example.com hostmaster.example.com 2026010101 7200 900 1209600 300")
+	srv.Add("_dmarc.example.com", TypeTXT, 300, "v=DMARC1; p=reject")
+	c := newTestClient(t, Config{}, srv)
+	ctx := context.Background()
+
+	shop := c.Collect(ctx, "Shop.Example.com")
+	wantChain := []Record{
+		{Name: "shop.example.com", Type: "CNAME", TTL: 300, Value: "shop.edge.example.net"},
+		{Name: "shop.edge.example.net", Type: "CNAME", TTL: 120, Value: "lb.cdn.example"},
+	}
+	if !reflect.DeepEqual(shop.CNAMEChain, wantChain) {
+		t.Fatalf("chain = %+v, want %+v", shop.CNAMEChain, wantChain)
+	}
+	if len(shop.A) != 1 || shop.A[0].TTL != 60 || len(shop.AAAA) != 1 || shop.AAAA[0].Value != "2001:db8::10" {
+		t.Fatalf("addresses = %+v %+v", shop.A, shop.AAAA)
+	}
+
+	apex := c.Collect(ctx, "example.com")
+	if len(apex.Errors) != 0 {
+		t.Fatalf("errors = %v", apex.Errors)
+	}
+	values := func(recs []Record) []string {
+		out := make([]string, len(recs))
+		for i, r := range recs {
+			out[i] = r.Value
+		}
+		return out
+	}
+	for _, check := range []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"MX", values(apex.MX), []string{"10 mx1.example.com", "20 mx2.example.com"}},
+		{"NS", values(apex.NS), []string{"ns1.example.com"}},
+		{"TXT", values(apex.TXT), []string{"v=spf1 include:_spf.example.net -all", "google-site-verification=abc123", "v=DMARC1; p=reject"}},
+		{"CAA", values(apex.CAA), []string{`0 issue "letsencrypt.org"`}},
+		{"SOA", values(apex.SOA), []string{"ns1.example.com hostmaster.example.com 2026010101 7200 900 1209600 300"}},
+	} {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("%s = %q, want %q", check.name, check.got, check.want)
+		}
+	}
+	if apex.TXT[2].Name != "_dmarc.example.com" {
+		t.Errorf("DMARC record name = %s", apex.TXT[2].Name)
+	}
+
+	if missing := c.Collect(ctx, "missing.example.com"); !missing.NotFound || missing.A != nil {
+		t.Fatalf("missing = %+v, want NXDOMAIN only", missing)
+	}
+}
+
+func TestCollectKeepsGoingAfterAFailedQuery(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("api.example.com", TypeA, 60, "192.0.2.20")
+	srv.Add("api.example.com", TypeTXT, 60, "token")
+	srv.Fail("api.example.com", dnsmessage.RCodeServerFailure, 4) // Both attempts of A and of AAAA
+	c := newTestClient(t, Config{Retries: 1}, srv)
+
+	got := c.Collect(context.Background(), "api.example.com")
+	if len(got.Errors) != 2 || !strings.Contains(got.Errors[0], "dns A api.example.com") || !strings.Contains(got.Errors[1], "dns AAAA") {
+		t.Fatalf("errors = %v", got.Errors)
+	}
+	if len(got.TXT) != 1 {
+		t.Fatalf("TXT = %+v, want the record despite earlier failures", got.TXT)
+	}
+}
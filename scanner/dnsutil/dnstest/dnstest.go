@@ -0,0 +1,211 @@
+// Package dnstest runs an in-process DNS server for tests. It answers like a
+// recursive resolver for the records it is given: CNAMEs are followed, "*."
+// records act as wildcards, and names it knows nothing about get NXDOMAIN.
+package dnstest
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxChain bounds how many CNAMEs an answer follows.
+const maxChain = 8
+
+// caaType is the CAA record type, which dnsmessage has no constant for.
+const caaType = dnsmessage.Type(257)
+
+// Server is a UDP DNS server on a random local port.
+type Server struct {
+	Addr string // host:port to use as a resolver
+
+	conn net.PacketConn
+
+	mu       sync.Mutex
+	records  map[string][]dnsmessage.Resource // By lower-case FQDN
+	failures map[string][]dnsmessage.RCode    // Queued error answers by FQDN
+	queries  map[string]int
+}
+
+// NewServer starts a server that stops when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("dnstest: %v", err)
+	}
+	s := &Server{
+		Addr:     conn.LocalAddr().String(),
+		conn:     conn,
+		records:  make(map[string][]dnsmessage.Resource),
+		failures: make(map[string][]dnsmessage.RCode),
+		queries:  make(map[string]int),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+// Add adds records of one type for name, which may start with "*." for a
+// wildcard. Values are written as in a zone file: an IP for A and AAAA, a
+// host name for CNAME and NS, "10 mail.example.com" for MX, the text for TXT,
+// `0 issue "ca.example"` for CAA and "ns mbox serial refresh retry expire
+// minttl" for SOA.
+func (s *Server) Add(name string, qtype dnsmessage.Type, ttl uint32, values ...string) {
+	fqdn := fqdn(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		rr := dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: mustName(fqdn), Type: qtype, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body:   body(qtype, v),
+		}
+		s.records[fqdn] = append(s.records[fqdn], rr)
+	}
+}
+
+// Fail makes the next n queries for name answer rcode, e.g. SERVFAIL.
+func (s *Server) Fail(name string, rcode dnsmessage.RCode, n int) {
+	fqdn := fqdn(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures[fqdn] = append(s.failures[fqdn], rcode)
+	}
+}
+
+// Queries returns how many queries name has received.
+func (s *Server) Queries(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[fqdn(name)]
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var req dnsmessage.Message
+		if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+			continue
+		}
+		rcode, answers := s.answer(req.Questions[0])
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: req.ID, Response: true, RecursionAvailable: true, RCode: rcode},
+			Questions: req.Questions,
+			Answers:   answers,
+		}
+		if packed, err := resp.Pack(); err == nil {
+			_, _ = s.conn.WriteTo(packed, addr)
+		}
+	}
+}
+
+func (s *Server) answer(q dnsmessage.Question) (dnsmessage.RCode, []dnsmessage.Resource) {
+	// Resolves q like a recursive resolver, following CNAMEs.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToLower(q.Name.String())
+	s.queries[name]++
+	if queued := s.failures[name]; len(queued) > 0 {
+		s.failures[name] = queued[1:]
+		return queued[0], nil
+	}
+
+	var answers []dnsmessage.Resource
+	for i := 0; i < maxChain; i++ {
+		rrs, ok := s.lookup(name)
+		if !ok {
+			return dnsmessage.RCodeNameError, answers
+		}
+		var cname *dnsmessage.Resource
+		for _, rr := range rrs {
+			rr.Header.Name = mustName(name)
+			switch {
+			case rr.Header.Type == q.Type:
+				answers = append(answers, rr)
+			case rr.Header.Type == dnsmessage.TypeCNAME:
+				cname = &rr
+			}
+		}
+		if cname == nil || q.Type == dnsmessage.TypeCNAME {
+			return dnsmessage.RCodeSuccess, answers
+		}
+		answers = append(answers, *cname)
+		name = cname.Body.(*dnsmessage.CNAMEResource).CNAME.String()
+	}
+	return dnsmessage.RCodeServerFailure, nil
+}
+
+func (s *Server) lookup(name string) ([]dnsmessage.Resource, bool) {
+	// Returns the records of name, of the closest wildcard above it, or none
+	// for a name that only exists because names below it do.
+	if rrs, ok := s.records[name]; ok {
+		return rrs, true
+	}
+	for parent := name; strings.Contains(parent, "."); {
+		parent = parent[strings.Index(parent, ".")+1:]
+		if rrs, ok := s.records["*."+parent]; ok {
+			return rrs, true
+		}
+	}
+	for known := range s.records {
+		if strings.HasSuffix(known, "."+name) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+func body(qtype dnsmessage.Type, v string) dnsmessage.ResourceBody {
+	switch qtype {
+	case dnsmessage.TypeA:
+		return &dnsmessage.AResource{A: [4]byte(net.ParseIP(v).To4())}
+	case dnsmessage.TypeAAAA:
+		return &dnsmessage.AAAAResource{AAAA: [16]byte(net.ParseIP(v).To16())}
+	case dnsmessage.TypeCNAME:
+		return &dnsmessage.CNAMEResource{CNAME: mustName(fqdn(v))}
+	case dnsmessage.TypeNS:
+		return &dnsmessage.NSResource{NS: mustName(fqdn(v))}
+	case dnsmessage.TypeMX:
+		pref, host, _ := strings.Cut(v, " ")
+		n, _ := strconv.Atoi(pref)
+		return &dnsmessage.MXResource{Pref: uint16(n), MX: mustName(fqdn(host))}
+	case dnsmessage.TypeTXT:
+		return &dnsmessage.TXTResource{TXT: []string{v}}
+	case dnsmessage.TypeSOA:
+		var ns, mbox string
+		var soa dnsmessage.SOAResource
+		fmt.Sscanf(v, "%s %s %d %d %d %d %d", &ns, &mbox, &soa.Serial, &soa.Refresh, &soa.Retry, &soa.Expire, &soa.MinTTL)
+		soa.NS, soa.MBox = mustName(fqdn(ns)), mustName(fqdn(mbox))
+		return &soa
+	case caaType:
+		var flags uint8
+		var tag, value string
+		fmt.Sscanf(v, "%d %s %q", &flags, &tag, &value)
+		data := append([]byte{flags, byte(len(tag))}, tag...)
+		return &dnsmessage.UnknownResource{Type: caaType, Data: append(data, value...)}
+	}
+	panic(fmt.Sprintf("dnstest: unsupported record type %v", qtype))
+}
+
+func fqdn(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+func mustName(name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		panic(fmt.Sprintf("dnstest: %v", err))
+	}
+	return n
+}
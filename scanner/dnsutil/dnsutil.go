@@ -0,0 +1,399 @@
+// Package dnsutil is a small DNS client that sends queries straight to a pool
+// of recursive resolvers. Unlike net.Resolver it exposes response codes, TTLs
+// and CNAMEs, spreads load across resolvers at a bounded query rate, and
+// retries a query on another resolver after SERVFAIL, REFUSED or a timeout.
+package dnsutil
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Query types used by the scanner.
+const (
+	TypeA     = dnsmessage.TypeA
+	TypeAAAA  = dnsmessage.TypeAAAA
+	TypeCNAME = dnsmessage.TypeCNAME
+	TypeNS    = dnsmessage.TypeNS
+	TypeMX    = dnsmessage.TypeMX
+	TypeTXT   = dnsmessage.TypeTXT
+	TypeSOA   = dnsmessage.TypeSOA
+	TypeCAA   = dnsmessage.Type(257) // Not known to dnsmessage
+)
+
+// DefaultResolvers are public resolvers used when none are configured.
+var DefaultResolvers = []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53", "1.0.0.1:53", "8.8.4.4:53"}
+
+// Client defaults.
+const (
+	defaultQPS     = 200
+	defaultTimeout = 2 * time.Second
+	defaultRetries = 2
+)
+
+// Config sets up a Client. Zero values use the defaults.
+type Config struct {
+	Resolvers []string      // host or host:port (default: DefaultResolvers)
+	QPS       int           // Queries per second across the pool (default 200)
+	Timeout   time.Duration // Per attempt (default 2s)
+	Retries   int           // Extra attempts after SERVFAIL, REFUSED or a timeout (default 2)
+}
+
+// ParseResolver returns addr as host:port, adding port 53 when it has none.
+func ParseResolver(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), "53"
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("resolver %q must be an IP address", addr)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Client queries a resolver pool. It is safe for concurrent use.
+type Client struct {
+	resolvers []string
+	timeout   time.Duration
+	retries   int
+	next      atomic.Uint32
+
+	mu       sync.Mutex
+	interval time.Duration // Between queries, from the QPS
+	slot     time.Time     // When the next query may be sent
+}
+
+// New returns a client for cfg.
+func New(cfg Config) (*Client, error) {
+	resolvers := cfg.Resolvers
+	if len(resolvers) == 0 {
+		resolvers = DefaultResolvers
+	}
+	c := &Client{timeout: cfg.Timeout, retries: cfg.Retries}
+	for _, r := range resolvers {
+		addr, err := ParseResolver(r)
+		if err != nil {
+			return nil, err
+		}
+		c.resolvers = append(c.resolvers, addr)
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	if c.retries <= 0 {
+		c.retries = defaultRetries
+	}
+	qps := cfg.QPS
+	if qps <= 0 {
+		qps = defaultQPS
+	}
+	c.interval = time.Second / time.Duration(qps)
+	return c, nil
+}
+
+// Resolvers returns the pool the client queries.
+func (c *Client) Resolvers() []string { return c.resolvers }
+
+// defaultClient is the worker-wide client used when a caller sets none.
+var defaultClient atomic.Pointer[Client]
+
+func init() {
+	c, _ := New(Config{})
+	defaultClient.Store(c)
+}
+
+// SetDefault replaces the worker-wide client.
+func SetDefault(c *Client) { defaultClient.Store(c) }
+
+// Default returns the worker-wide client.
+func Default() *Client { return defaultClient.Load() }
+
+// Record is one resource record from an answer.
+type Record struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   uint32 `json:"ttl"`
+	Value string `json:"value"`
+}
+
+// Response is a resolver's answer to one question.
+type Response struct {
+	RCode   dnsmessage.RCode
+	Answers []Record
+}
+
+// NotFound reports whether the name does not exist (NXDOMAIN).
+func (r *Response) NotFound() bool { return r.RCode == dnsmessage.RCodeNameError }
+
+// Addresses returns the A and AAAA values of the answer.
+func (r *Response) Addresses() []string {
+	var out []string
+	for _, rec := range r.Answers {
+		if rec.Type == "A" || rec.Type == "AAAA" {
+			out = append(out, rec.Value)
+		}
+	}
+	return out
+}
+
+// Values returns the values of the answer records of type t, e.g. "NS".
+func (r *Response) Values(t string) []string {
+	var out []string
+	for _, rec := range r.Answers {
+		if rec.Type == t {
+			out = append(out, rec.Value)
+		}
+	}
+	return out
+}
+
+// Query asks the pool one question. NXDOMAIN is a normal response; SERVFAIL,
+// REFUSED and network errors are retried on the next resolver and returned as
+// an error once every attempt failed.
+func (c *Client) Query(ctx context.Context, name string, qtype dnsmessage.Type) (*Response, error) {
+	qname, err := dnsmessage.NewName(Fqdn(name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	question := dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		server := c.resolvers[int(c.next.Add(1)-1)%len(c.resolvers)]
+		if err := c.pace(ctx); err != nil {
+			return nil, err
+		}
+		msg, err := c.exchange(ctx, server, question)
+		if err != nil {
+			queries.Inc("error")
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = fmt.Errorf("%s: %w", server, err)
+			continue
+		}
+		queries.Inc(rcodeLabel(msg.RCode))
+		if msg.RCode == dnsmessage.RCodeServerFailure || msg.RCode == dnsmessage.RCodeRefused {
+			lastErr = fmt.Errorf("%s: %s", server, rcodeLabel(msg.RCode))
+			continue
+		}
+		return &Response{RCode: msg.RCode, Answers: records(msg.Answers)}, nil
+	}
+	return nil, fmt.Errorf("dns %s %s: %w", TypeName(qtype), name, lastErr)
+}
+
+// Resolve returns the addresses name resolves to, following CNAMEs. AAAA is
+// only asked for when there is no A record. A name that does not exist
+// resolves to nothing without an error.
+func (c *Client) Resolve(ctx context.Context, name string) ([]string, error) {
+	resp, err := c.Query(ctx, name, TypeA)
+	if err != nil || resp.NotFound() {
+		return nil, err
+	}
+	if addrs := resp.Addresses(); len(addrs) > 0 {
+		return addrs, nil
+	}
+	resp, err = c.Query(ctx, name, TypeAAAA)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Addresses(), nil
+}
+
+// Fqdn returns name lower-cased with a trailing dot.
+func Fqdn(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// TypeName returns the mnemonic of t, e.g. "AAAA".
+func TypeName(t dnsmessage.Type) string {
+	if t == TypeCAA {
+		return "CAA"
+	}
+	return strings.TrimPrefix(t.String(), "Type")
+}
+
+func rcodeLabel(rc dnsmessage.RCode) string {
+	// Short response code names for errors and metrics.
+	switch rc {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return strings.TrimPrefix(rc.String(), "RCode")
+	}
+}
+
+func (c *Client) pace(ctx context.Context) error {
+	// Waits for the next query slot so the pool never exceeds its QPS.
+	c.mu.Lock()
+	now := time.Now()
+	if c.slot.Before(now) {
+		c.slot = now
+	}
+	wait := c.slot.Sub(now)
+	c.slot = c.slot.Add(c.interval)
+	c.mu.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) exchange(ctx context.Context, server string, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	// Sends q over UDP, falling back to TCP when the answer is truncated.
+	id := uint16(rand.Uint32())
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(ctx, "udp", server, packed, id)
+	if err == nil && resp.Truncated {
+		resp, err = c.roundTrip(ctx, "tcp", server, packed, id)
+	}
+	return resp, err
+}
+
+func (c *Client) roundTrip(ctx context.Context, network, server string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		// TCP messages carry a two-byte length prefix.
+		buf := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+		if _, err := conn.Write(append(buf, packed...)); err != nil {
+			return nil, err
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		body := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, err
+		}
+		return unpack(body, id)
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Stray datagrams for other queries are skipped.
+		if resp, err := unpack(buf[:n], id); err == nil {
+			return resp, nil
+		}
+	}
+}
+
+var errIDMismatch = errors.New("response ID does not match the query")
+
+func unpack(b []byte, id uint16) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil {
+		return nil, err
+	}
+	if msg.ID != id || !msg.Response {
+		return nil, errIDMismatch
+	}
+	return &msg, nil
+}
+
+func records(rrs []dnsmessage.Resource) []Record {
+	// Converts answer records to their presentation values. Types the scanner
+	// does not read are skipped.
+	out := make([]Record, 0, len(rrs))
+	for _, rr := range rrs {
+		rec := Record{
+			Name: strings.TrimSuffix(strings.ToLower(rr.Header.Name.String()), "."),
+			Type: TypeName(rr.Header.Type),
+			TTL:  rr.Header.TTL,
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			rec.Value = net.IP(body.A[:]).String()
+		case *dnsmessage.AAAAResource:
+			rec.Value = net.IP(body.AAAA[:]).String()
+		case *dnsmessage.CNAMEResource:
+			rec.Value = hostValue(body.CNAME)
+		case *dnsmessage.NSResource:
+			rec.Value = hostValue(body.NS)
+		case *dnsmessage.MXResource:
+			rec.Value = fmt.Sprintf("%d %s", body.Pref, hostValue(body.MX))
+		case *dnsmessage.TXTResource:
+			// Long records are split into strings of 255 bytes; SPF and
+			// verification tokens are read joined.
+			rec.Value = strings.Join(body.TXT, "")
+		case *dnsmessage.SOAResource:
+			rec.Value = fmt.Sprintf("%s %s %d %d %d %d %d", hostValue(body.NS), hostValue(body.MBox),
+				body.Serial, body.Refresh, body.Retry, body.Expire, body.MinTTL)
+		case *dnsmessage.UnknownResource:
+			value, ok := caaValue(body)
+			if !ok {
+				continue
+			}
+			rec.Value = value
+		default:
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func hostValue(n dnsmessage.Name) string {
+	return strings.TrimSuffix(strings.ToLower(n.String()), ".")
+}
+
+func caaValue(body *dnsmessage.UnknownResource) (string, bool) {
+	// Formats a CAA record (RFC 8659) as in a zone file: 0 issue "ca.example".
+	d := body.Data
+	if body.Type != TypeCAA || len(d) < 2 || len(d) < 2+int(d[1]) {
+		return "", false
+	}
+	tag, value := d[2:2+int(d[1])], d[2+int(d[1]):]
+	return fmt.Sprintf("%d %s %q", d[0], tag, value), true
+}
@@ -0,0 +1,107 @@
+package dnsutil
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"recon/dnsutil/dnstest"
+)
+
+func newTestClient(t *testing.T, cfg Config, servers ...*dnstest.Server) *Client {
+	t.Helper()
+	for _, s := range servers {
+		cfg.Resolvers = append(cfg.Resolvers, s.Addr)
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestResolveFollowsCNAMEs(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("www.example.com", TypeCNAME, 300, "edge.cdn.net")
+	srv.Add("edge.cdn.net", TypeA, 60, "192.0.2.10", "192.0.2.11")
+	srv.Add("v6.example.com", TypeAAAA, 60, "2001:db8::1")
+	c := newTestClient(t, Config{}, srv)
+	ctx := context.Background()
+
+	resp, err := c.Query(ctx, "WWW.example.com", TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Name: "www.example.com", Type: "CNAME", TTL: 300, Value: "edge.cdn.net"},
+		{Name: "edge.cdn.net", Type: "A", TTL: 60, Value: "192.0.2.10"},
+		{Name: "edge.cdn.net", Type: "A", TTL: 60, Value: "192.0.2.11"},
+	}
+	if !reflect.DeepEqual(resp.Answers, want) {
+		t.Fatalf("answers = %+v, want %+v", resp.Answers, want)
+	}
+
+	if addrs, err := c.Resolve(ctx, "v6.example.com"); err != nil || !reflect.DeepEqual(addrs, []string{"2001:db8::1"}) {
+		t.Fatalf("AAAA fallback = %v, %v", addrs, err)
+	}
+	if addrs, err := c.Resolve(ctx, "missing.example.com"); err != nil || addrs != nil {
+		t.Fatalf("NXDOMAIN = %v, %v; want no addresses and no error", addrs, err)
+	}
+}
+
+func TestQueryRetriesServerFailures(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("api.example.com", TypeA, 60, "192.0.2.20")
+	srv.Fail("api.example.com", dnsmessage.RCodeServerFailure, 2)
+	c := newTestClient(t, Config{}, srv)
+
+	addrs, err := c.Resolve(context.Background(), "api.example.com")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"192.0.2.20"}) {
+		t.Fatalf("after two SERVFAILs = %v, %v", addrs, err)
+	}
+	if n := srv.Queries("api.example.com"); n != 3 {
+		t.Fatalf("queries = %d, want 3", n)
+	}
+
+	srv.Fail("api.example.com", dnsmessage.RCodeRefused, 3)
+	if _, err := c.Query(context.Background(), "api.example.com", TypeA); err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Fatalf("err = %v, want REFUSED once retries run out", err)
+	}
+}
+
+func TestQueryIsPaced(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("example.com", TypeA, 60, "192.0.2.1")
+	c := newTestClient(t, Config{QPS: 20}, srv)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := c.Query(context.Background(), "example.com", TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("5 queries at 20 QPS took %s, want at least 200ms", elapsed)
+	}
+}
+
+func TestParseResolver(t *testing.T) {
+	cases := map[string]string{
+		"1.1.1.1":           "1.1.1.1:53",
+		"10.0.0.2:5353":     "10.0.0.2:5353",
+		"2001:db8::53":      "[2001:db8::53]:53",
+		"[2001:db8::53]:53": "[2001:db8::53]:53",
+	}
+	for in, want := range cases {
+		if got, err := ParseResolver(in); err != nil || got != want {
+			t.Errorf("ParseResolver(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseResolver("dns.google"); err == nil {
+		t.Error("host names must be rejected")
+	}
+}
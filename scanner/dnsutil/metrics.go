@@ -0,0 +1,6 @@
+package dnsutil
+
+import "recon/metrics"
+
+// Query metrics, across all clients.
+var queries = metrics.NewCounter("recon_dns_queries_total", "DNS queries sent to the resolver pool, by outcome (NOERROR, NXDOMAIN, SERVFAIL, REFUSED, error).", "rcode")
@@ -0,0 +1,145 @@
+// Package egress routes scan traffic through an optional outbound proxy, e.g.
+// Burp for manual review or a SOCKS5 gateway with a fixed source IP. The proxy
+// is bound to the scan context; HTTP clients pick it up per request through
+// Proxy, raw TCP dials go through DialContext, and external tools get it as a
+// command-line flag.
+package egress
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Parse validates a proxy URL. Supported schemes are http, https, socks5 and
+// socks5h; the host must include a port.
+func Parse(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (valid: http, https, socks5, socks5h)", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("proxy URL %s must include host and port", u.Redacted())
+	}
+	return u, nil
+}
+
+// IsSOCKS reports whether u is a SOCKS proxy.
+func IsSOCKS(u *url.URL) bool {
+	return u != nil && strings.HasPrefix(u.Scheme, "socks")
+}
+
+// defaultProxy is the worker-wide proxy used when ctx carries none.
+var defaultProxy atomic.Pointer[url.URL]
+
+// SetDefault sets the worker-wide proxy; nil sends traffic directly.
+func SetDefault(u *url.URL) { defaultProxy.Store(u) }
+
+type proxyKey struct{}
+
+// WithProxy returns a context whose scan traffic goes through u.
+func WithProxy(ctx context.Context, u *url.URL) context.Context {
+	return context.WithValue(ctx, proxyKey{}, u)
+}
+
+// FromContext returns the proxy bound to ctx, the worker-wide one, or nil.
+func FromContext(ctx context.Context) *url.URL {
+	if ctx != nil {
+		if u, ok := ctx.Value(proxyKey{}).(*url.URL); ok && u != nil {
+			return u
+		}
+	}
+	return defaultProxy.Load()
+}
+
+// Proxy is an http.Transport Proxy function that uses the proxy bound to the
+// request context.
+func Proxy(req *http.Request) (*url.URL, error) {
+	return FromContext(req.Context()), nil
+}
+
+// NewTransport returns the transport scan HTTP clients use: proxied per
+// request and without certificate verification, since scans inspect
+// arbitrary hosts.
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:           Proxy,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+}
+
+// DialContext opens a TCP connection to addr, through the proxy bound to ctx
+// when there is one: SOCKS5 directly, HTTP proxies with a CONNECT tunnel.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	u := FromContext(ctx)
+	direct := &net.Dialer{}
+	switch {
+	case u == nil:
+		return direct.DialContext(ctx, network, addr)
+	case IsSOCKS(u):
+		d, err := proxy.FromURL(u, direct)
+		if err != nil {
+			return nil, err
+		}
+		return d.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	default:
+		return dialConnect(ctx, direct, u, addr)
+	}
+}
+
+func dialConnect(ctx context.Context, direct *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	// Opens a tunnel to addr with an HTTP CONNECT request.
+	conn, err := direct.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy %s: %w", u.Redacted(), err)
+	}
+	if u.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %w", addr, err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %w", addr, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %s", addr, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
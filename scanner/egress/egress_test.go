@@ -0,0 +1,106 @@
+package egress
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, raw := range []string{"http://127.0.0.1:8080", "https://proxy.example.com:443", "socks5://u:p@10.0.0.1:1080", "socks5h://egress:1080"} {
+		if _, err := Parse(raw); err != nil {
+			t.Errorf("Parse(%q): %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"", "127.0.0.1:8080", "socks4://10.0.0.1:1080", "http://proxy.example.com", "http://:8080"} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("Parse(%q) should fail", raw)
+		}
+	}
+}
+
+func TestFromContextPrefersScanProxy(t *testing.T) {
+	defer SetDefault(nil)
+	if FromContext(context.Background()) != nil {
+		t.Fatal("no proxy expected by default")
+	}
+
+	worker, _ := Parse("http://127.0.0.1:8080")
+	scan, _ := Parse("socks5://127.0.0.1:1080")
+	SetDefault(worker)
+	if got := FromContext(context.Background()); got != worker {
+		t.Fatalf("FromContext = %v, want the worker default", got)
+	}
+	ctx := WithProxy(context.Background(), scan)
+	if got := FromContext(ctx); got != scan {
+		t.Fatalf("FromContext = %v, want the scan proxy", got)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", nil)
+	if got, _ := Proxy(req); got != scan {
+		t.Fatalf("Proxy = %v, want the scan proxy", got)
+	}
+}
+
+func TestDialContextTunnelsThroughHTTPProxy(t *testing.T) {
+	// A target that echoes one line, reached only through the CONNECT proxy.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		io.WriteString(conn, "echo "+line)
+	}()
+
+	var auth, connected string
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, connected = r.Header.Get("Proxy-Authorization"), r.Host
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		client, buf, _ := w.(http.Hijacker).Hijack()
+		io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(upstream, buf)
+		io.Copy(client, upstream)
+		client.Close()
+	}))
+	defer proxySrv.Close()
+
+	u, _ := url.Parse(proxySrv.URL)
+	u.User = url.UserPassword("tester", "secret")
+	conn, err := DialContext(WithProxy(context.Background(), u), "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "hello\n")
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "echo hello\n" {
+		t.Fatalf("reply = %q", reply)
+	}
+	if connected != target.Addr().String() {
+		t.Fatalf("proxy connected to %q, want %q", connected, target.Addr())
+	}
+	if !strings.HasPrefix(auth, "Basic ") {
+		t.Fatalf("missing proxy credentials, got %q", auth)
+	}
+}
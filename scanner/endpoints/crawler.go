@@ -3,16 +3,21 @@ package endpoints
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"sort"
 	"strings"
 
 	stdhtml "html"
 
+	"recon/egress"
+	"recon/pause"
+	"recon/ratelimit"
+	scopepkg "recon/scope"
+
 	xhtml "golang.org/x/net/html"
 )
 
@@ -21,6 +26,21 @@ type crawlScope struct {
 	pathPrefix string
 }
 
+type crawlNode struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// crawlQueueName names the crawler's queue in a pause checkpoint.
+const crawlQueueName = "crawl"
+
+// crawlState is the crawl recorded when a scan is paused mid-crawl.
+type crawlState struct {
+	Queue   []crawlNode `json:"queue"`
+	Seen    []string    `json:"seen"`
+	Results []string    `json:"results"`
+}
+
 func crawlApplicationEndpoints(ctx context.Context, target string, opts *DiscoveryOptions, auth *DiscoveryAuthConfig) []string {
 	// Recursive BFS crawler for application-style targets.
 	if opts == nil {
@@ -34,16 +54,12 @@ func crawlApplicationEndpoints(ctx context.Context, target string, opts *Discove
 
 	jar, _ := cookiejar.New(nil)
 	client := &http.Client{
-		Timeout: opts.Timeout,
-		Jar:     jar,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Timeout:   opts.Timeout,
+		Jar:       jar,
+		Transport: scopepkg.NewTransport(ratelimit.NewTransport(egress.NewTransport())),
 	}
 	if err := applyDiscoveryAuth(ctx, client, auth); err != nil {
-		if discoveryLogCallback != nil {
-			discoveryLogCallback(fmt.Sprintf("⚠️ Auto-login failed for %s: %v", target, err), "warning")
-		}
+		emitLog(ctx, fmt.Sprintf("⚠️ Auto-login failed for %s: %v", target, err), "warning")
 	}
 
 	maxDepth := opts.RecursiveDepth
@@ -55,11 +71,6 @@ func crawlApplicationEndpoints(ctx context.Context, target string, opts *Discove
 		maxPages = 150
 	}
 
-	type crawlNode struct {
-		URL   string
-		Depth int
-	}
-
 	queue := make([]crawlNode, 0, len(startURLs))
 	for _, seed := range startURLs {
 		queue = append(queue, crawlNode{URL: seed, Depth: 0})
@@ -68,12 +79,34 @@ func crawlApplicationEndpoints(ctx context.Context, target string, opts *Discove
 	seen := make(map[string]struct{})
 	results := make([]string, 0, maxPages)
 
+	// A scan paused before a restart recorded the crawl queue; continue from it.
+	var restored crawlState
+	if pause.Restore(ctx, crawlQueueName, &restored) {
+		queue = restored.Queue
+		results = append(results, restored.Results...)
+		for _, u := range restored.Seen {
+			seen[u] = struct{}{}
+		}
+		emitLog(ctx, fmt.Sprintf("♻️ Resuming paused crawl: %d pages crawled, %d queued", len(results), len(queue)), "info")
+	}
+	snapshot := func() any {
+		st := crawlState{Queue: queue, Seen: make([]string, 0, len(seen)), Results: results}
+		for u := range seen {
+			st.Seen = append(st.Seen, u)
+		}
+		sort.Strings(st.Seen)
+		return st
+	}
+
 	for len(queue) > 0 && len(seen) < maxPages {
 		select {
 		case <-ctx.Done():
 			return results
 		default:
 		}
+		if err := pause.Wait(ctx, crawlQueueName, snapshot); err != nil {
+			return results
+		}
 
 		node := queue[0]
 		queue = queue[1:]
@@ -116,6 +149,7 @@ func crawlApplicationEndpoints(ctx context.Context, target string, opts *Discove
 		}
 	}
 
+	pause.Done(ctx, crawlQueueName)
 	return dedupePreserveOrder(results)
 }
 
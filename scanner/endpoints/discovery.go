@@ -14,15 +14,11 @@ import (
 	"strings"
 	"sync"
 	"time"
-)
-
-// Global log callback for discovery progress messages
-var discoveryLogCallback func(message, level string)
 
-// SetDiscoveryLogCallback sets the callback for sending discovery progress logs
-func SetDiscoveryLogCallback(callback func(message, level string)) {
-	discoveryLogCallback = callback
-}
+	"recon/egress"
+	"recon/metrics"
+	"recon/pause"
+)
 
 // DiscoveryOptions configures dynamic endpoint discovery behavior
 type DiscoveryOptions struct {
@@ -116,7 +112,11 @@ func DiscoverURLsFromHosts(ctx context.Context, seeds []string, opts *DiscoveryO
 					return
 				default:
 				}
-				discoverURLsForHost(host, opts, urlChan)
+				// Paused discovery keeps no checkpoint: gau and katana rerun after a restart.
+				if err := pause.Wait(ctx, "", nil); err != nil {
+					return
+				}
+				discoverURLsForHost(ctx, host, opts, urlChan)
 			}
 		}()
 	}
@@ -155,9 +155,7 @@ func DiscoverURLsFromHosts(ctx context.Context, seeds []string, opts *DiscoveryO
 	collectWg.Wait()
 
 	log.Printf("[discovery] collected %d raw URLs, normalizing and deduplicating", len(allURLs))
-	if discoveryLogCallback != nil {
-		discoveryLogCallback(fmt.Sprintf("📦 Collected %d raw URLs, normalizing...", len(allURLs)), "info")
-	}
+	emitLog(ctx, fmt.Sprintf("📦 Collected %d raw URLs, normalizing...", len(allURLs)), "info")
 
 	// Normalize and deduplicate URLs
 	normalized := normalizeAndDeduplicateURLs(allURLs, opts.MaxURLsPerHost*len(seeds))
@@ -167,12 +165,10 @@ func DiscoverURLsFromHosts(ctx context.Context, seeds []string, opts *DiscoveryO
 }
 
 // discoverURLsForHost discovers URLs for a single host using all enabled methods
-func discoverURLsForHost(seed string, opts *DiscoveryOptions, urlChan chan<- string) {
+func discoverURLsForHost(ctx context.Context, seed string, opts *DiscoveryOptions, urlChan chan<- string) {
 	// Runs discovery methods for one host concurrently and emits raw URLs.
 	log.Printf("[discovery] discovering URLs for %s", seed)
-	if discoveryLogCallback != nil {
-		discoveryLogCallback(fmt.Sprintf("🔍 Discovering URLs for %s...", seed), "info")
-	}
+	emitLog(ctx, fmt.Sprintf("🔍 Discovering URLs for %s...", seed), "info")
 
 	gauthost := discoveryHostForGau(seed)
 	katanaTargets := discoveryTargetsForKatana(seed)
@@ -184,7 +180,7 @@ func discoverURLsForHost(seed string, opts *DiscoveryOptions, urlChan chan<- str
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			urls := runGau(gauthost, opts)
+			urls := runGau(ctx, gauthost, opts)
 			for _, u := range urls {
 				urlChan <- u
 			}
@@ -197,7 +193,7 @@ func discoverURLsForHost(seed string, opts *DiscoveryOptions, urlChan chan<- str
 		go func() {
 			defer wg.Done()
 			for _, target := range katanaTargets {
-				urls := runKatana(target, opts)
+				urls := runKatana(ctx, target, opts)
 				for _, u := range urls {
 					urlChan <- u
 				}
@@ -218,9 +214,9 @@ func discoverURLsForHost(seed string, opts *DiscoveryOptions, urlChan chan<- str
 }
 
 // runGau executes gau and returns discovered URLs
-func runGau(seed string, opts *DiscoveryOptions) []string {
+func runGau(ctx context.Context, seed string, opts *DiscoveryOptions) []string {
 	// Uses gau to collect historical URLs from public archives/indexes.
-	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
 	defer cancel()
 
 	host := discoveryHostForGau(seed)
@@ -238,26 +234,28 @@ func runGau(seed string, opts *DiscoveryOptions) []string {
 	if opts.IncludeSubdomains {
 		args = append(args, "--subs")
 	}
+	if u := egress.FromContext(ctx); u != nil {
+		args = append(args, "--proxy", u.String())
+	}
 
 	args = append(args, host)
 
-	cmd := exec.CommandContext(ctx, opts.GauBinary, args...)
+	cmd := exec.CommandContext(runCtx, opts.GauBinary, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err := cmd.Run()
+	metrics.ObserveExec("gau", start, err)
+	if err != nil {
 		if strings.Contains(err.Error(), "executable file not found") {
 			log.Printf("[discovery] gau not installed, skipping gau for %s", host)
-			if discoveryLogCallback != nil {
-				discoveryLogCallback(fmt.Sprintf("⚠️ gau not installed, skipping for %s", host), "warning")
-			}
+			emitLog(ctx, fmt.Sprintf("⚠️ gau not installed, skipping for %s", host), "warning")
 			return []string{}
 		}
 		log.Printf("[discovery] gau error for %s: %v (stderr: %s)", host, err, stderr.String())
-		if discoveryLogCallback != nil {
-			discoveryLogCallback(fmt.Sprintf("❌ gau error for %s: %v", host, err), "warning")
-		}
+		emitLog(ctx, fmt.Sprintf("❌ gau error for %s: %v", host, err), "warning")
 		return []string{}
 	}
 
@@ -270,17 +268,16 @@ func runGau(seed string, opts *DiscoveryOptions) []string {
 		}
 	}
 
+	urlsDiscovered.Add(float64(len(urls)), "gau")
 	log.Printf("[discovery] gau found %d URLs for %s", len(urls), host)
-	if discoveryLogCallback != nil {
-		discoveryLogCallback(fmt.Sprintf("✅ gau found %d URLs for %s", len(urls), host), "success")
-	}
+	emitLog(ctx, fmt.Sprintf("✅ gau found %d URLs for %s", len(urls), host), "success")
 	return urls
 }
 
 // runKatana executes katana and returns discovered URLs
-func runKatana(seed string, opts *DiscoveryOptions) []string {
+func runKatana(ctx context.Context, seed string, opts *DiscoveryOptions) []string {
 	// Uses katana crawler to discover live links and endpoints from pages/JS.
-	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
 	defer cancel()
 	candidates := discoveryTargetsForKatana(seed)
 	if len(candidates) == 0 {
@@ -311,24 +308,26 @@ func runKatana(seed string, opts *DiscoveryOptions) []string {
 		if !opts.IncludeSubdomains {
 			args = append(args, "-ns") // No subdomains
 		}
+		if u := egress.FromContext(ctx); u != nil {
+			args = append(args, "-proxy", u.String())
+		}
 
-		cmd := exec.CommandContext(ctx, opts.KatanaBinary, args...)
+		cmd := exec.CommandContext(runCtx, opts.KatanaBinary, args...)
 		var stdout, stderr bytes.Buffer
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
 
-		if err := cmd.Run(); err != nil {
+		start := time.Now()
+		err := cmd.Run()
+		metrics.ObserveExec("katana", start, err)
+		if err != nil {
 			if strings.Contains(err.Error(), "executable file not found") {
 				log.Printf("[discovery] katana not installed, skipping katana for %s", target)
-				if discoveryLogCallback != nil {
-					discoveryLogCallback(fmt.Sprintf("⚠️ katana not installed, skipping for %s", target), "warning")
-				}
+				emitLog(ctx, fmt.Sprintf("⚠️ katana not installed, skipping for %s", target), "warning")
 				return []string{}
 			}
 			log.Printf("[discovery] katana error for %s: %v (stderr: %s)", target, err, stderr.String())
-			if discoveryLogCallback != nil {
-				discoveryLogCallback(fmt.Sprintf("❌ katana error for %s", target), "warning")
-			}
+			emitLog(ctx, fmt.Sprintf("❌ katana error for %s", target), "warning")
 			continue
 		}
 
@@ -357,10 +356,9 @@ func runKatana(seed string, opts *DiscoveryOptions) []string {
 		}
 	}
 
+	urlsDiscovered.Add(float64(len(allURLs)), "katana")
 	log.Printf("[discovery] katana found %d URLs for %s", len(allURLs), seed)
-	if discoveryLogCallback != nil {
-		discoveryLogCallback(fmt.Sprintf("✅ katana found %d URLs for %s", len(allURLs), seed), "success")
-	}
+	emitLog(ctx, fmt.Sprintf("✅ katana found %d URLs for %s", len(allURLs), seed), "success")
 	return allURLs
 }
 
@@ -1,7 +1,10 @@
 package endpoints
 
 import (
+	"context"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -42,3 +45,60 @@ func TestNormalizeAndDeduplicateURLsDropsQueryNoise(t *testing.T) {
 		t.Fatalf("unexpected normalized URLs: got %v want %v", got, want)
 	}
 }
+
+func TestConcurrentDiscoveriesKeepLogsSeparate(t *testing.T) {
+	// Two scans run discovery at the same time; each must only receive its own
+	// progress messages.
+	opts := DefaultDiscoveryOptions()
+	opts.UseKatana = false
+	opts.GauBinary = "recon-missing-gau-binary"
+	opts.Workers = 2
+
+	type scanLogs struct {
+		mu       sync.Mutex
+		messages []string
+	}
+	run := func(seeds []string, logs *scanLogs) {
+		ctx := WithLogSink(context.Background(), func(message, level string) {
+			logs.mu.Lock()
+			logs.messages = append(logs.messages, message)
+			logs.mu.Unlock()
+		})
+		DiscoverURLsFromHosts(ctx, seeds, opts)
+	}
+
+	scanA := []string{"a1.scan-a.test", "a2.scan-a.test", "a3.scan-a.test"}
+	scanB := []string{"b1.scan-b.test", "b2.scan-b.test", "b3.scan-b.test"}
+	var logsA, logsB scanLogs
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); run(scanA, &logsA) }()
+		go func() { defer wg.Done(); run(scanB, &logsB) }()
+	}
+	wg.Wait()
+
+	check := func(name string, logs *scanLogs, own, other string) {
+		if len(logs.messages) == 0 {
+			t.Fatalf("%s received no progress messages", name)
+		}
+		for _, msg := range logs.messages {
+			if strings.Contains(msg, other) {
+				t.Fatalf("%s received a message from the other scan: %q", name, msg)
+			}
+		}
+		found := false
+		for _, msg := range logs.messages {
+			if strings.Contains(msg, own) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%s did not receive its own host messages: %v", name, logs.messages)
+		}
+	}
+	check("scan A", &logsA, "scan-a.test", "scan-b.test")
+	check("scan B", &logsB, "scan-b.test", "scan-a.test")
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"html"
@@ -19,8 +18,13 @@ import (
 	"sync"
 	"time"
 
+	"recon/egress"
 	"recon/fingerprint"
+	"recon/metrics"
+	"recon/pause"
+	"recon/ratelimit"
 	"recon/recon"
+	"recon/scope"
 )
 
 const (
@@ -28,14 +32,6 @@ const (
 	defaultRPS         = 10
 )
 
-// Global log callback for progress messages
-var globalLogCallback func(message, level string)
-
-// SetLogCallback sets the callback for sending progress log messages
-func SetLogCallback(callback func(message, level string)) {
-	globalLogCallback = callback
-}
-
 // ---------------- TYPES ----------------
 
 type EndpointResult struct {
@@ -63,7 +59,7 @@ func DiscoverEndpointsFromScan(ctx context.Context, userID int64, scanID int64,
 }
 
 // DiscoverEndpointsFromScanWithCallback allows streaming results via callback
-// Use SetLogCallback to enable progress log messages during discovery
+// Progress messages go to the sink bound with WithLogSink on ctx
 func DiscoverEndpointsFromScanWithAuthAndCallback(ctx context.Context, userID int64, scanID int64, target string, auth *DiscoveryAuthConfig, callback func(EndpointResult)) ([]EndpointResult, error) {
 	// End-to-end endpoint phase:
 	// load alive hosts -> discover URLs -> probe URLs -> store endpoint fingerprints/evidence.
@@ -73,6 +69,46 @@ func DiscoverEndpointsFromScanWithAuthAndCallback(ctx context.Context, userID in
 	}
 	log.Printf("[endpoints] loaded %d subdomains from %s", len(subdomains), scanFile)
 
+	return DiscoverEndpointsForSubdomains(ctx, scanID, target, subdomains, nil, auth, callback)
+}
+
+// ScanConfig tunes one run of the endpoint phase.
+type ScanConfig struct {
+	Discovery    *DiscoveryOptions
+	ProbeWorkers int // Concurrent endpoint probes
+	ProbeRPS     int // Endpoint probe rate limit (requests per second)
+}
+
+// DefaultScanConfig returns endpoint phase settings with environment overrides
+// (ENDPOINT_DISCOVERY_WORKERS, RECURSIVE_CRAWL_DEPTH, RECURSIVE_MAX_PAGES,
+// KATANA_DEPTH, MAX_URLS_PER_HOST, ENDPOINT_WORKERS, ENDPOINT_RPS).
+func DefaultScanConfig() *ScanConfig {
+	discoveryOpts := DefaultDiscoveryOptions()
+	discoveryOpts.Workers = getEnvIntOrDefault("ENDPOINT_DISCOVERY_WORKERS", 5)
+	discoveryOpts.RecursiveDepth = getEnvIntOrDefault("RECURSIVE_CRAWL_DEPTH", 5)
+	discoveryOpts.RecursiveMaxPages = getEnvIntOrDefault("RECURSIVE_MAX_PAGES", 150)
+	discoveryOpts.KatanaDepth = getEnvIntOrDefault("KATANA_DEPTH", 2)
+	discoveryOpts.MaxURLsPerHost = getEnvIntOrDefault("MAX_URLS_PER_HOST", 500)
+
+	return &ScanConfig{
+		Discovery:    discoveryOpts,
+		ProbeWorkers: getEnvIntOrDefault("ENDPOINT_WORKERS", defaultWorkerCount),
+		ProbeRPS:     getEnvIntOrDefault("ENDPOINT_RPS", defaultRPS),
+	}
+}
+
+// DiscoverEndpointsForSubdomains runs the endpoint phase on subdomain results
+// already in memory, streaming each responding endpoint to callback. A nil cfg
+// uses DefaultScanConfig. Progress messages go to the sink bound with
+// WithLogSink on ctx.
+func DiscoverEndpointsForSubdomains(ctx context.Context, scanID int64, target string, subdomains []recon.SubdomainResult, cfg *ScanConfig, auth *DiscoveryAuthConfig, callback func(EndpointResult)) ([]EndpointResult, error) {
+	if cfg == nil {
+		cfg = DefaultScanConfig()
+	}
+	if cfg.Discovery == nil {
+		cfg.Discovery = DefaultScanConfig().Discovery
+	}
+
 	// Extract alive hosts for dynamic discovery
 	aliveHosts := make([]string, 0)
 	for _, s := range subdomains {
@@ -96,65 +132,84 @@ func DiscoverEndpointsFromScanWithAuthAndCallback(ctx context.Context, userID in
 	default:
 	}
 
-	// Dynamic endpoint discovery using recursive crawling first, then passive tools when appropriate.
-	discoveryOpts := DefaultDiscoveryOptions()
-	discoveryOpts.Workers = getEnvIntOrDefault("ENDPOINT_DISCOVERY_WORKERS", 5)
-	discoveryOpts.RecursiveDepth = getEnvIntOrDefault("RECURSIVE_CRAWL_DEPTH", 5)
-	discoveryOpts.RecursiveMaxPages = getEnvIntOrDefault("RECURSIVE_MAX_PAGES", 150)
-	discoveryOpts.KatanaDepth = getEnvIntOrDefault("KATANA_DEPTH", 2)
-	discoveryOpts.MaxURLsPerHost = getEnvIntOrDefault("MAX_URLS_PER_HOST", 500)
+	// A scan paused while probing before a restart recorded the URLs it had
+	// left, so discovery is not repeated.
+	var restored endpointQueue
+	var urls []string
+	if pause.Restore(ctx, endpointQueueName, &restored) {
+		urls = restored.Remaining
+		emitLog(ctx, fmt.Sprintf("♻️ Resuming paused probing: %d endpoints found, %d URLs left", len(restored.Done), len(urls)), "info")
+	} else {
+		urls = discoverCandidateURLs(ctx, target, aliveHosts, cfg.Discovery, auth)
+	}
+
+	log.Printf("[endpoints] discovered %d unique URLs, starting probing", len(urls))
+	emitLog(ctx, fmt.Sprintf("🔍 Starting probing of %d URLs...", len(urls)), "info")
+
+	// Probe discovered URLs with streaming callback
+	workers := cfg.ProbeWorkers
+	if workers <= 0 {
+		workers = defaultWorkerCount
+	}
+	rps := cfg.ProbeRPS
+	if rps <= 0 {
+		rps = defaultRPS
+	}
+
+	var results []EndpointResult
+	if pause.FromContext(ctx) != nil {
+		results = probeURLsInBatches(ctx, urls, restored.Done, workers, rps, callback)
+	} else {
+		results = probeURLsConcurrentlyWithCallback(ctx, urls, workers, rps, callback)
+	}
+	if ctx.Err() != nil {
+		log.Printf("[endpoints] probing stopped early after %d endpoints", len(results))
+	} else {
+		log.Printf("[endpoints] probing complete: %d endpoints responding", len(results))
+		emitLog(ctx, fmt.Sprintf("✅ Probing complete: %d/%d endpoints responding", len(results), len(urls)), "success")
+	}
+	emitDrops(ctx)
 
+	// Partial results are saved too so a phase cut short by its deadline can be
+	// restored after a restart.
+	if _, err := saveEndpointsToFile(scanID, target, results); err != nil {
+		log.Printf("[endpoints] save error: %v", err)
+	}
+
+	return results, ctx.Err()
+}
+
+func discoverCandidateURLs(ctx context.Context, target string, aliveHosts []string, discoveryOpts *DiscoveryOptions, auth *DiscoveryAuthConfig) []string {
+	// Dynamic endpoint discovery using recursive crawling first, then passive tools when appropriate.
 	urls := make([]string, 0)
 	if discoveryOpts.UseRecursiveCrawl {
 		recursiveURLs := crawlApplicationEndpoints(ctx, target, discoveryOpts, auth)
+		urlsDiscovered.Add(float64(len(recursiveURLs)), "crawl")
 		if len(recursiveURLs) > 0 {
 			urls = append(urls, recursiveURLs...)
-			if globalLogCallback != nil {
-				globalLogCallback(fmt.Sprintf("🌐 Recursive crawl found %d URLs", len(recursiveURLs)), "info")
-			}
+			emitLog(ctx, fmt.Sprintf("🌐 Recursive crawl found %d URLs", len(recursiveURLs)), "info")
 		}
 	}
 
-	if !shouldPreferRecursiveCrawl(target) {
+	if (discoveryOpts.UseGau || discoveryOpts.UseKatana) && !shouldPreferRecursiveCrawl(target) {
 		seedTargets := buildDiscoverySeeds(target, aliveHosts)
 		dynamicURLs := DiscoverURLsFromHosts(ctx, seedTargets, discoveryOpts)
 		if len(dynamicURLs) > 0 {
 			urls = append(urls, dynamicURLs...)
-			if globalLogCallback != nil {
-				globalLogCallback(fmt.Sprintf("📊 Discovered %d unique URLs from gau/katana", len(dynamicURLs)), "info")
-			}
+			emitLog(ctx, fmt.Sprintf("📊 Discovered %d unique URLs from gau/katana", len(dynamicURLs)), "info")
 		}
 	}
 
+	// Archived and crawled URLs may point anywhere; only in-scope ones are probed.
+	urls = scope.FilterURLs(ctx, urls)
+	emitDrops(ctx)
+
 	if len(urls) == 0 {
 		log.Printf("[endpoints] no URLs discovered, falling back to basic paths")
-		if globalLogCallback != nil {
-			globalLogCallback("⚠️ No URLs discovered, using basic paths", "warning")
-		}
-		urls = append(urls, buildFallbackEndpointSeeds(target, aliveHosts)...)
-	}
-
-	log.Printf("[endpoints] discovered %d unique URLs, starting probing", len(urls))
-	if globalLogCallback != nil {
-		globalLogCallback(fmt.Sprintf("🔍 Starting probing of %d URLs...", len(urls)), "info")
-	}
-
-	// Probe discovered URLs with streaming callback
-	workers := getEnvIntOrDefault("ENDPOINT_WORKERS", defaultWorkerCount)
-	rps := getEnvIntOrDefault("ENDPOINT_RPS", defaultRPS)
-
-	results := probeURLsConcurrentlyWithCallback(urls, workers, rps, callback)
-
-	log.Printf("[endpoints] probing complete: %d endpoints responding", len(results))
-	if globalLogCallback != nil {
-		globalLogCallback(fmt.Sprintf("✅ Probing complete: %d/%d endpoints responding", len(results), len(urls)), "success")
+		emitLog(ctx, "⚠️ No URLs discovered, using basic paths", "warning")
+		urls = append(urls, scope.FilterURLs(ctx, buildFallbackEndpointSeeds(target, aliveHosts))...)
 	}
-
-	if _, err := saveEndpointsToFile(scanID, target, results); err != nil {
-		log.Printf("[endpoints] save error: %v", err)
-	}
-
-	return results, nil
+	return urls
 }
 
 func buildDiscoverySeeds(target string, aliveHosts []string) []string {
@@ -234,35 +289,78 @@ type HttpxResponse struct {
 	Server        string   `json:"webserver"`
 	ContentType   string   `json:"content_type"`
 	ResponseTime  string   `json:"response_time"`
+	FinalURL      string   `json:"final_url"` // Set when httpx followed redirects
 }
 
 // probeURLsConcurrently uses httpx for efficient bulk probing
 func probeURLsConcurrently(urls []string, workers int, rps int) []EndpointResult {
-	return probeURLsConcurrentlyWithCallback(urls, workers, rps, nil)
+	return probeURLsConcurrentlyWithCallback(context.Background(), urls, workers, rps, nil)
 }
 
 // probeURLsConcurrentlyWithCallback allows streaming results via callback
-func probeURLsConcurrentlyWithCallback(urls []string, workers int, rps int, callback func(EndpointResult)) []EndpointResult {
+func probeURLsConcurrentlyWithCallback(ctx context.Context, urls []string, workers int, rps int, callback func(EndpointResult)) []EndpointResult {
 	// Preferred path is httpx (fast and rich metadata).
 	// If httpx is unavailable/fails, fallback to native HTTP probing.
 	// Try httpx first (much faster and more reliable)
-	if results, err := probeWithHttpxCallback(urls, workers, rps, callback); err == nil && len(results) > 0 {
+	if results, err := probeWithHttpxCallback(ctx, urls, workers, rps, callback); err == nil && len(results) > 0 {
 		log.Printf("[endpoints] httpx found %d results", len(results))
 		return results
 	}
+	if ctx.Err() != nil {
+		return []EndpointResult{}
+	}
 
 	// Fallback to native Go implementation
 	log.Printf("[endpoints] httpx failed, using native Go client")
-	return probeWithNativeHTTPCallback(urls, workers, rps, callback)
+	return probeWithNativeHTTPCallback(ctx, urls, workers, rps, callback)
+}
+
+// endpointQueueName names the endpoint prober's queue in a pause checkpoint.
+const endpointQueueName = "endpoint_probe"
+
+// pauseBatchSize is how many URLs are probed between pause checks. Each batch
+// is one httpx run, so batches are large: most scans probe in one or two runs,
+// and a pause takes effect once the batch in flight is done.
+const pauseBatchSize = 1000
+
+// endpointQueue is the work recorded when a scan is paused during probing.
+type endpointQueue struct {
+	Remaining []string         `json:"remaining"`
+	Done      []EndpointResult `json:"done"`
+}
+
+// probeURLsInBatches probes urls in batches for scans that can be paused, so
+// a pause takes effect within one batch. done holds results restored from an
+// earlier run, which already passed them to callback; they are kept in the
+// output but not passed again.
+func probeURLsInBatches(ctx context.Context, urls []string, done []EndpointResult, workers int, rps int, callback func(EndpointResult)) []EndpointResult {
+	results := append([]EndpointResult{}, done...)
+
+	for start := 0; start < len(urls); start += pauseBatchSize {
+		remaining := urls[start:]
+		snapshot := func() any { return endpointQueue{Remaining: remaining, Done: results} }
+		if err := pause.Wait(ctx, endpointQueueName, snapshot); err != nil || ctx.Err() != nil {
+			return results
+		}
+		end := start + pauseBatchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		results = append(results, probeURLsConcurrentlyWithCallback(ctx, urls[start:end], workers, rps, callback)...)
+	}
+	if ctx.Err() == nil {
+		pause.Done(ctx, endpointQueueName)
+	}
+	return results
 }
 
 // probeWithHttpx uses httpx tool for efficient probing
 func probeWithHttpx(urls []string, workers int, rps int) ([]EndpointResult, error) {
-	return probeWithHttpxCallback(urls, workers, rps, nil)
+	return probeWithHttpxCallback(context.Background(), urls, workers, rps, nil)
 }
 
 // probeWithHttpxCallback allows streaming results via callback
-func probeWithHttpxCallback(urls []string, workers int, rps int, callback func(EndpointResult)) ([]EndpointResult, error) {
+func probeWithHttpxCallback(ctx context.Context, urls []string, workers int, rps int, callback func(EndpointResult)) ([]EndpointResult, error) {
 	// Executes httpx on a temp input file and converts JSONL output into EndpointResult.
 	// Create temp file for input URLs
 	tmpfile, err := os.CreateTemp("", "httpx-input-*.txt")
@@ -283,7 +381,7 @@ func probeWithHttpxCallback(urls []string, workers int, rps int, callback func(E
 		"-json",
 		"-l", tmpfile.Name(),
 		"-threads", fmt.Sprintf("%d", workers),
-		"-rate-limit", fmt.Sprintf("%d", rps),
+		"-rate-limit", fmt.Sprintf("%d", httpxRateLimit(ctx, urls, rps)),
 		"-timeout", "7",
 		"-retries", "1",
 		"-status-code",
@@ -296,13 +394,19 @@ func probeWithHttpxCallback(urls []string, workers int, rps int, callback func(E
 		"-match-code", "200,201,202,204,301,302,307,308,401,403,405",
 		"-no-color",
 	}
+	if u := egress.FromContext(ctx); u != nil {
+		args = append(args, "-http-proxy", u.String())
+	}
 
-	cmd := exec.Command("httpx", args...)
+	cmd := exec.CommandContext(ctx, "httpx", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err = cmd.Run()
+	metrics.ObserveExec("httpx", start, err)
+	if err != nil {
 		if strings.Contains(err.Error(), "executable file not found") {
 			return nil, fmt.Errorf("httpx not installed")
 		}
@@ -325,6 +429,12 @@ func probeWithHttpxCallback(urls []string, workers int, rps int, callback func(E
 			continue
 		}
 
+		// httpx requests outside the scope transport, so a result whose URL
+		// or redirect target left the scope is dropped here.
+		if !scope.AllowURL(ctx, httpxResp.URL) || (httpxResp.FinalURL != "" && !scope.AllowURL(ctx, httpxResp.FinalURL)) {
+			continue
+		}
+
 		// Convert httpx response to our format
 		result := EndpointResult{
 			URL:           httpxResp.URL,
@@ -360,22 +470,50 @@ func probeWithHttpxCallback(urls []string, workers int, rps int, callback func(E
 	return results, nil
 }
 
+// httpxRateLimit returns the -rate-limit for one httpx run. httpx paces all
+// URLs together, so the scan's per-host limits are summed over the hosts in
+// urls and the result is capped at rps.
+func httpxRateLimit(ctx context.Context, urls []string, rps int) int {
+	limiter := ratelimit.FromContext(ctx)
+	seen := make(map[string]struct{})
+	total := 0.0
+	for _, u := range urls {
+		host := ratelimit.Key(u)
+		if _, ok := seen[host]; ok {
+			continue
+		}
+		seen[host] = struct{}{}
+		rate := limiter.Rate(host)
+		if rate <= 0 {
+			return rps
+		}
+		total += rate
+	}
+	if total <= 0 || total >= float64(rps) {
+		return rps
+	}
+	if total < 1 {
+		return 1
+	}
+	return int(total)
+}
+
 // probeWithNativeHTTP is the fallback implementation
 func probeWithNativeHTTP(urls []string, workers int, rps int) []EndpointResult {
-	return probeWithNativeHTTPCallback(urls, workers, rps, nil)
+	return probeWithNativeHTTPCallback(context.Background(), urls, workers, rps, nil)
 }
 
 // probeWithNativeHTTPCallback allows streaming results via callback
-func probeWithNativeHTTPCallback(urls []string, workers int, rps int, callback func(EndpointResult)) []EndpointResult {
-	// Native fallback worker pool with basic rate limiting per worker.
+func probeWithNativeHTTPCallback(ctx context.Context, urls []string, workers int, rps int, callback func(EndpointResult)) []EndpointResult {
+	// Native fallback worker pool. rps caps the pool as a whole; each request is
+	// also paced per host by the scan's rate limiter.
 	jobs := make(chan string, workers*2)
 	results := make(chan EndpointResult, workers*2)
+	overall := ratelimit.New(ratelimit.Config{RequestsPerSecond: float64(rps)})
 
 	client := &http.Client{
-		Timeout: 7 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Timeout:   7 * time.Second,
+		Transport: scope.NewTransport(ratelimit.NewTransport(egress.NewTransport())),
 	}
 
 	var wg sync.WaitGroup
@@ -384,19 +522,25 @@ func probeWithNativeHTTPCallback(urls []string, workers int, rps int, callback f
 		go func() {
 			defer wg.Done()
 			for url := range jobs {
-				if res, err := probeURLNative(client, url); err == nil {
+				if err := overall.Wait(ctx, ""); err != nil {
+					continue // Drain remaining jobs without probing
+				}
+				if res, err := probeURLNative(ctx, client, url); err == nil {
 					results <- *res
 				}
-				time.Sleep(time.Second / time.Duration(rps)) // Simple rate limiting
 			}
 		}()
 	}
 
 	go func() {
+		defer close(jobs)
 		for _, u := range urls {
-			jobs <- u
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- u:
+			}
 		}
-		close(jobs)
 	}()
 
 	go func() {
@@ -432,9 +576,9 @@ func shouldKeepStatus(code int) bool {
 }
 
 // probeURLNative is the native Go fallback implementation
-func probeURLNative(client *http.Client, url string) (*EndpointResult, error) {
+func probeURLNative(ctx context.Context, client *http.Client, url string) (*EndpointResult, error) {
 	// Probes one endpoint, extracts title + selected headers, and applies lightweight fingerprint tags.
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -545,6 +689,24 @@ func saveEndpointsToFile(scanID int64, target string, eps []EndpointResult) (str
 	return path, enc.Encode(payload)
 }
 
+// LoadEndpointsForScan reads the endpoint artifact written by a previous run of the scan.
+func LoadEndpointsForScan(scanID int64, target string) ([]EndpointResult, error) {
+	// Used when a scan is resumed after a worker restart.
+	f, err := os.Open(EndpointsFilePath(scanID, target))
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	var payload struct {
+		Endpoints []EndpointResult `json:"endpoints"`
+	}
+	if err := json.NewDecoder(f).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	return payload.Endpoints, nil
+}
+
 // ---------------- ENV ----------------
 
 func getEnvOrDefault(k, d string) string {
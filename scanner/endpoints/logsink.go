@@ -0,0 +1,48 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+
+	"recon/scope"
+)
+
+// LogFunc receives progress messages for a single scan.
+type LogFunc func(message, level string)
+
+type logSinkKey struct{}
+
+// WithLogSink returns a context whose discovery and probing progress messages
+// are sent to sink. Each scan binds its own sink, so concurrent scans never
+// see each other's messages.
+func WithLogSink(ctx context.Context, sink LogFunc) context.Context {
+	return context.WithValue(ctx, logSinkKey{}, sink)
+}
+
+// logSinkFrom returns the sink bound to ctx, or nil when none was set.
+func logSinkFrom(ctx context.Context) LogFunc {
+	if ctx == nil {
+		return nil
+	}
+	sink, _ := ctx.Value(logSinkKey{}).(LogFunc)
+	return sink
+}
+
+// emitLog sends a progress message to the sink bound to ctx, if any.
+func emitLog(ctx context.Context, message, level string) {
+	if sink := logSinkFrom(ctx); sink != nil {
+		sink(message, level)
+	}
+}
+
+// emitDrops sends one summary per scope rule that dropped URLs since the last
+// summary. Without a sink the counts are left for the caller to report.
+func emitDrops(ctx context.Context) {
+	sink := logSinkFrom(ctx)
+	if sink == nil {
+		return
+	}
+	for _, d := range scope.TakeDrops(ctx) {
+		sink(fmt.Sprintf("🚧 Dropped %d out-of-scope %ss (%s)", d.Count, d.Kind, d.Rule), "info")
+	}
+}
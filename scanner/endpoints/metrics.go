@@ -0,0 +1,7 @@
+package endpoints
+
+import "recon/metrics"
+
+// urlsDiscovered counts raw URLs found by each discovery tool (gau, katana,
+// crawl) before deduplication.
+var urlsDiscovered = metrics.NewCounter("recon_urls_discovered_total", "URLs found by each discovery tool before deduplication.", "tool")
@@ -0,0 +1,37 @@
+package enum
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Amass is the OWASP amass source, run in passive mode so it only queries
+// third-party data sets and never the target.
+type Amass struct {
+	BinaryPath string        // Default: amass
+	Timeout    time.Duration // Default: 2m
+}
+
+func (a *Amass) Name() string { return SourceAmass }
+
+func (a *Amass) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	bin := a.BinaryPath
+	if bin == "" {
+		bin = "amass"
+	}
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = defaultSourceTimeout
+	}
+
+	lines, err := runTool(ctx, SourceAmass, bin, []string{"enum", "-passive", "-nocolor", "-d", domain}, timeout)
+	// Newer releases print "name (FQDN) --> ..." graph lines; the name comes first.
+	names := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, err
+}
@@ -0,0 +1,28 @@
+package enum
+
+import (
+	"context"
+	"time"
+)
+
+// Assetfinder is the tomnomnom/assetfinder source.
+type Assetfinder struct {
+	BinaryPath string        // Default: assetfinder
+	Timeout    time.Duration // Default: 2m
+}
+
+func (a *Assetfinder) Name() string { return SourceAssetfinder }
+
+func (a *Assetfinder) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	bin := a.BinaryPath
+	if bin == "" {
+		bin = "assetfinder"
+	}
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = defaultSourceTimeout
+	}
+
+	// --subs-only drops the related (non-subdomain) assets it also finds.
+	return runTool(ctx, SourceAssetfinder, bin, []string{"--subs-only", domain}, timeout)
+}
@@ -0,0 +1,184 @@
+package enum
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"recon/dnsutil"
+)
+
+// defaultBruteForceWorkers is the number of concurrent lookups.
+const defaultBruteForceWorkers = 100
+
+// labelPattern matches one DNS label; wordlist lines that are not labels,
+// e.g. URL paths, are skipped.
+var labelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var defaultWordlist atomic.Pointer[string]
+
+// SetDefaultWordlist sets the wordlist BruteForce reads when it has none.
+func SetDefaultWordlist(path string) { defaultWordlist.Store(&path) }
+
+// DefaultWordlist returns the wordlist BruteForce reads when it has none.
+func DefaultWordlist() string {
+	if p := defaultWordlist.Load(); p != nil {
+		return *p
+	}
+	return "wordlists/subdomains.txt"
+}
+
+// BruteForce resolves <word>.<domain> for every word in a wordlist against a
+// resolver pool. Names that only resolve because of wildcard DNS are dropped.
+type BruteForce struct {
+	Wordlist string          // Path, one word per line (default: DefaultWordlist)
+	Words    []string        // Replaces Wordlist when set
+	Client   *dnsutil.Client // Default: dnsutil.Default
+	Workers  int             // Concurrent lookups (default 100)
+	Timeout  time.Duration   // Default: 2m
+}
+
+func (b *BruteForce) Name() string { return SourceBruteForce }
+
+func (b *BruteForce) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	return b.Stream(ctx, domain, nil)
+}
+
+// Stream passes each hit to found as soon as it resolves.
+func (b *BruteForce) Stream(ctx context.Context, domain string, found func(name string)) ([]string, error) {
+	words := b.Words
+	if words == nil {
+		path := b.Wordlist
+		if path == "" {
+			path = DefaultWordlist()
+		}
+		var err error
+		if words, err = ReadWordlist(path); err != nil {
+			return nil, err
+		}
+	}
+	client := b.Client
+	if client == nil {
+		client = dnsutil.Default()
+	}
+	workers := b.Workers
+	if workers <= 0 {
+		workers = defaultBruteForceWorkers
+	}
+	timeout := b.Timeout
+	if timeout <= 0 {
+		timeout = defaultSourceTimeout
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	candidates := make([]string, 0, len(words))
+	for _, w := range Labels(words) {
+		candidates = append(candidates, w+"."+domain)
+	}
+	hits, failed, lastErr := ResolveNames(ctx, client, NewWildcardFilter(client), candidates, workers, found)
+	log.Printf("[enum] bruteforce resolved %d/%d names for %s (%d lookups failed)", len(hits), len(candidates), domain, failed)
+
+	switch {
+	case parent.Err() != nil:
+		return hits, fmt.Errorf("bruteforce cancelled: %w", parent.Err())
+	case ctx.Err() != nil:
+		return hits, fmt.Errorf("bruteforce timed out after %s", timeout)
+	case len(candidates) > 0 && failed == len(candidates):
+		return nil, fmt.Errorf("bruteforce: every lookup failed: %w", lastErr)
+	}
+	return hits, nil
+}
+
+// ResolveNames resolves names concurrently and returns the ones that exist,
+// in input order, leaving out wildcard answers. Each one is also passed to
+// hit (if set) as soon as it resolves. It also returns how many lookups
+// failed and the last failure.
+func ResolveNames(ctx context.Context, client *dnsutil.Client, wildcards *WildcardFilter, names []string, workers int, hit func(name string)) (found []string, failed int, lastErr error) {
+	exists := make([]bool, len(names))
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				addrs, err := client.Resolve(ctx, names[i])
+				if err != nil {
+					mu.Lock()
+					failed++
+					lastErr = err
+					mu.Unlock()
+					continue
+				}
+				exists[i] = len(addrs) > 0 && !wildcards.Matches(ctx, names[i], addrs)
+				if exists[i] && hit != nil {
+					hit(names[i])
+				}
+			}
+		}()
+	}
+	for i := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, ok := range exists {
+		if ok {
+			found = append(found, names[i])
+		}
+	}
+	return found, failed, lastErr
+}
+
+// ReadWordlist reads one word per line, skipping blank lines and # comments.
+func ReadWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading wordlist: %w", err)
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading wordlist: %w", err)
+	}
+	return words, nil
+}
+
+// Labels returns the lower-cased, deduplicated words that are valid DNS labels.
+func Labels(words []string) []string {
+	seen := make(map[string]bool, len(words))
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if !labelPattern.MatchString(w) || seen[w] {
+			continue
+		}
+		seen[w] = true
+		out = append(out, w)
+	}
+	return out
+}
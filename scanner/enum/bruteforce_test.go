@@ -0,0 +1,84 @@
+package enum
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"recon/dnsutil"
+	"recon/dnsutil/dnstest"
+)
+
+func TestBruteForceFiltersWildcardAnswers(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("*.example.com", dnsutil.TypeA, 60, "203.0.113.9")
+	srv.Add("www.example.com", dnsutil.TypeA, 60, "192.0.2.1")
+	srv.Add("api.example.com", dnsutil.TypeCNAME, 60, "api.hosting.net")
+	srv.Add("api.hosting.net", dnsutil.TypeA, 60, "192.0.2.2")
+	srv.Fail("api.example.com", dnsmessage.RCodeServerFailure, 1)
+
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{srv.Addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf := &BruteForce{Words: []string{"www", "API", "admin", "api/v1", "/", "www"}, Client: client, Workers: 4}
+
+	names, err := bf.Enumerate(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"www.example.com", "api.example.com"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %v, want %v (admin only matches the wildcard)", names, want)
+	}
+
+	wild := NewWildcardFilter(client)
+	if got := wild.Addresses(context.Background(), "example.com"); !reflect.DeepEqual(got, []string{"203.0.113.9"}) {
+		t.Fatalf("wildcard addresses = %v", got)
+	}
+	if got := wild.Addresses(context.Background(), "hosting.net"); len(got) != 0 {
+		t.Fatalf("zone without a wildcard = %v", got)
+	}
+}
+
+func TestBruteForceFailsWhenNoResolverAnswers(t *testing.T) {
+	// A closed UDP port: every query is refused or times out.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{addr}, Timeout: 100 * time.Millisecond, Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&BruteForce{Words: []string{"www", "api"}, Client: client}).Enumerate(context.Background(), "example.com")
+	if err == nil || !strings.Contains(err.Error(), "every lookup failed") {
+		t.Fatalf("err = %v, want every lookup failed", err)
+	}
+}
+
+func TestWordlistsKeepOnlyLabels(t *testing.T) {
+	words, err := ReadWordlist("../wordlists/common.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := Labels(words)
+	if len(labels) == 0 || contains(labels, "/") || contains(labels, "api/v1") {
+		t.Fatalf("labels = %v, want path entries skipped", labels)
+	}
+
+	words, err = ReadWordlist("../wordlists/subdomains.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(Labels(words)); got != len(words) {
+		t.Fatalf("subdomains.txt has %d entries that are not labels", len(words)-got)
+	}
+}
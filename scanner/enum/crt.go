@@ -0,0 +1,89 @@
+package enum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"recon/egress"
+)
+
+// DefaultCTURL is the certificate transparency search used by CertTransparency.
+const DefaultCTURL = "https://crt.sh"
+
+// CertTransparency finds names in certificates logged to certificate
+// transparency, through a crt.sh-compatible JSON search. It needs no external
+// binary.
+type CertTransparency struct {
+	BaseURL string        // Default: DefaultCTURL
+	Client  *http.Client  // Default: a client honouring the scan proxy
+	Timeout time.Duration // Default: 2m
+}
+
+func (c *CertTransparency) Name() string { return SourceCRT }
+
+func (c *CertTransparency) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	base := strings.TrimRight(c.BaseURL, "/")
+	if base == "" {
+		base = DefaultCTURL
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultSourceTimeout
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Transport: &http.Transport{Proxy: egress.Proxy}}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// %.domain matches every name under domain; crt.sh treats % as a wildcard.
+	endpoint := base + "/?q=" + url.QueryEscape("%."+domain) + "&output=json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("crt request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("crt returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var entries []struct {
+		CommonName string `json:"common_name"`
+		NameValue  string `json:"name_value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decoding crt response: %w", err)
+	}
+
+	var names []string
+	seen := make(map[string]struct{})
+	for _, e := range entries {
+		// name_value holds every SAN of the certificate, one per line.
+		for _, name := range append(strings.Split(e.NameValue, "\n"), e.CommonName) {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
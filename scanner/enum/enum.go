@@ -0,0 +1,290 @@
+package enum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"recon/dnsutil"
+	"recon/metrics"
+)
+
+// Source names, also used for attribution on results.
+const (
+	SourceSubfinder   = "subfinder"
+	SourceAmass       = "amass"
+	SourceAssetfinder = "assetfinder"
+	SourceCRT         = "crt"
+	SourceBruteForce  = "bruteforce"
+)
+
+// Sources lists every source, in the order results are attributed.
+var Sources = []string{SourceSubfinder, SourceAmass, SourceAssetfinder, SourceCRT, SourceBruteForce}
+
+// NeedsBinary reports whether source runs an external tool of the same name.
+func NeedsBinary(source string) bool {
+	return source != SourceCRT && source != SourceBruteForce
+}
+
+// defaultSourceTimeout bounds one source's run when no timeout is set.
+const defaultSourceTimeout = 120 * time.Second
+
+// Enumerator finds subdomains of a domain from one source.
+type Enumerator interface {
+	Name() string
+	// Enumerate returns the names found. On error it may still return the
+	// names found before the failure.
+	Enumerate(ctx context.Context, domain string) ([]string, error)
+}
+
+// Streamer is an Enumerator that can report each name as soon as it is found,
+// e.g. a brute-force hit as it resolves, instead of when the run ends.
+type Streamer interface {
+	Enumerator
+	// Stream is Enumerate that also passes each name to found as it is found.
+	// found may be called concurrently.
+	Stream(ctx context.Context, domain string, found func(name string)) ([]string, error)
+}
+
+// Result is one subdomain with the sources that reported it.
+type Result struct {
+	Name    string   `json:"name"`
+	Sources []string `json:"sources"`
+}
+
+// SourceError is the failure of one source.
+type SourceError struct {
+	Source string
+	Err    error
+}
+
+func (e SourceError) Error() string { return e.Source + ": " + e.Err.Error() }
+
+func (e SourceError) Unwrap() error { return e.Err }
+
+// SourceErrors lists the sources that failed during Enumerate.
+type SourceErrors []SourceError
+
+func (e SourceErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, se := range e {
+		parts[i] = se.Error()
+	}
+	return "subdomain sources failed: " + strings.Join(parts, "; ")
+}
+
+// Options configures the sources built by NewSources.
+type Options struct {
+	Timeout   time.Duration     // Per source (default: 2m)
+	Subfinder *SubfinderOptions // Overrides the subfinder binary and timeout
+	DNS       *dnsutil.Client   // Resolver pool for brute-forcing (default: dnsutil.Default)
+}
+
+// NewSources returns enumerators for the named sources in Sources order, or
+// for every source when names is empty. Unknown names are ignored.
+func NewSources(names []string, opts Options) []Enumerator {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultSourceTimeout
+	}
+	subfinder := opts.Subfinder
+	if subfinder == nil {
+		subfinder = &SubfinderOptions{Timeout: timeout}
+	}
+
+	var out []Enumerator
+	for _, name := range Sources {
+		if len(names) > 0 && !contains(names, name) {
+			continue
+		}
+		switch name {
+		case SourceSubfinder:
+			out = append(out, &Subfinder{Options: subfinder})
+		case SourceAmass:
+			out = append(out, &Amass{Timeout: timeout})
+		case SourceAssetfinder:
+			out = append(out, &Assetfinder{Timeout: timeout})
+		case SourceCRT:
+			out = append(out, &CertTransparency{Timeout: timeout})
+		case SourceBruteForce:
+			out = append(out, &BruteForce{Client: opts.DNS, Timeout: timeout})
+		}
+	}
+	return out
+}
+
+// Enumerate runs sources concurrently and merges their names, attributing each
+// to every source that reported it. Names outside domain are dropped. A
+// failing source does not stop the others: the names found are returned with
+// a SourceErrors listing the failures.
+func Enumerate(ctx context.Context, domain string, sources []Enumerator) ([]Result, error) {
+	return EnumerateStream(ctx, domain, sources, nil)
+}
+
+// EnumerateStream is Enumerate that also passes each new name to found as soon
+// as a source reports it, with that source as its only source. Streamers
+// report their names one at a time; other sources report theirs when they
+// finish, so a slow source never holds back the names of a fast one. found
+// is called from one goroutine at a time.
+func EnumerateStream(ctx context.Context, domain string, sources []Enumerator, found func(Result)) ([]Result, error) {
+	domain = cleanName(domain)
+	if domain == "" {
+		return nil, fmt.Errorf("domain is empty")
+	}
+
+	var mu sync.Mutex
+	streamed := make(map[string]bool)
+	report := func(source, raw string) {
+		name := cleanName(raw)
+		if name != domain && !strings.HasSuffix(name, "."+domain) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !streamed[name] {
+			streamed[name] = true
+			found(Result{Name: name, Sources: []string{source}})
+		}
+	}
+
+	names := make([][]string, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src Enumerator) {
+			defer wg.Done()
+			streamer, ok := src.(Streamer)
+			switch {
+			case found == nil:
+				names[i], errs[i] = src.Enumerate(ctx, domain)
+			case ok:
+				names[i], errs[i] = streamer.Stream(ctx, domain, func(name string) { report(src.Name(), name) })
+			default:
+				names[i], errs[i] = src.Enumerate(ctx, domain)
+				for _, name := range names[i] {
+					report(src.Name(), name)
+				}
+			}
+		}(i, src)
+	}
+	wg.Wait()
+
+	var results []Result
+	index := make(map[string]int)
+	var failed SourceErrors
+	for i, src := range sources {
+		if errs[i] != nil {
+			failed = append(failed, SourceError{Source: src.Name(), Err: errs[i]})
+			sourceFailures.Inc(src.Name())
+			log.Printf("[enum] %s failed for %s: %v", src.Name(), domain, errs[i])
+		}
+		count := 0
+		for _, raw := range names[i] {
+			name := cleanName(raw)
+			if name != domain && !strings.HasSuffix(name, "."+domain) {
+				continue
+			}
+			j, ok := index[name]
+			if !ok {
+				j = len(results)
+				index[name] = j
+				results = append(results, Result{Name: name})
+			}
+			if !contains(results[j].Sources, src.Name()) {
+				results[j].Sources = append(results[j].Sources, src.Name())
+				count++
+			}
+		}
+		sourceNames.Add(float64(count), src.Name())
+		log.Printf("[enum] %s found %d names for %s", src.Name(), count, domain)
+	}
+
+	if len(failed) > 0 {
+		return results, failed
+	}
+	return results, nil
+}
+
+func cleanName(raw string) string {
+	// Lower-cases a reported name and strips wildcard labels and the root dot.
+	name := strings.ToLower(strings.TrimSpace(raw))
+	name = strings.TrimPrefix(name, "*.")
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || strings.ContainsAny(name, " /:@*") {
+		return ""
+	}
+	return name
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// runTool runs a command-line source and returns the lowercase, deduplicated
+// lines it printed. When parent is cancelled or the timeout hits, the lines
+// printed so far are returned along with the error.
+func runTool(parent context.Context, tool, bin string, args []string, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	metrics.ObserveExec(tool, start, err)
+	if err != nil {
+		if parent.Err() != nil {
+			partial, _ := parseToolOutput(tool, &stdout)
+			return partial, fmt.Errorf("%s cancelled: %w", tool, parent.Err())
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			partial, _ := parseToolOutput(tool, &stdout)
+			return partial, fmt.Errorf("%s timed out after %s", tool, timeout)
+		}
+		return nil, fmt.Errorf("%s error: %w. stderr: %s", tool, err, stderr.String())
+	}
+
+	return parseToolOutput(tool, &stdout)
+}
+
+func parseToolOutput(tool string, stdout *bytes.Buffer) ([]string, error) {
+	// Returns the lowercase, deduplicated hosts printed one per line.
+	subdomains := make([]string, 0)
+	seen := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		line = strings.ToLower(line)
+
+		if _, exists := seen[line]; !exists {
+			seen[line] = struct{}{}
+			subdomains = append(subdomains, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s output: %w", tool, err)
+	}
+
+	return subdomains, nil
+}
@@ -0,0 +1,223 @@
+package enum
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSource returns fixed names and error.
+type fakeSource struct {
+	name  string
+	names []string
+	err   error
+}
+
+func (f fakeSource) Name() string { return f.name }
+
+func (f fakeSource) Enumerate(context.Context, string) ([]string, error) { return f.names, f.err }
+
+// streamSource reports names one at a time, then blocks until release is
+// closed, like a brute force still resolving.
+type streamSource struct {
+	names   []string
+	release chan struct{}
+}
+
+func (s streamSource) Name() string { return SourceBruteForce }
+
+func (s streamSource) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	return s.Stream(ctx, domain, nil)
+}
+
+func (s streamSource) Stream(_ context.Context, _ string, found func(string)) ([]string, error) {
+	for _, name := range s.names {
+		if found != nil {
+			found(name)
+		}
+	}
+	<-s.release
+	return s.names, nil
+}
+
+// fakeBinary writes a shell script that prints output and records its
+// arguments next to it.
+func fakeBinary(t *testing.T, output string) (bin, argsFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	bin = filepath.Join(dir, "tool")
+	argsFile = filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncat <<'OUT'\n" + output + "OUT\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin, argsFile
+}
+
+func readArgs(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func TestEnumerateMergesWithAttribution(t *testing.T) {
+	sources := []Enumerator{
+		fakeSource{name: SourceSubfinder, names: []string{"www.example.com", "API.example.com"}},
+		fakeSource{name: SourceAmass, err: errors.New("exit status 1")},
+		fakeSource{name: SourceCRT, names: []string{"*.example.com", "api.example.com.", "www.example.com", "example.org", "notexample.com"}},
+	}
+
+	results, err := Enumerate(context.Background(), "Example.com", sources)
+	want := []Result{
+		{Name: "www.example.com", Sources: []string{SourceSubfinder, SourceCRT}},
+		{Name: "api.example.com", Sources: []string{SourceSubfinder, SourceCRT}},
+		{Name: "example.com", Sources: []string{SourceCRT}},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("results = %+v, want %+v", results, want)
+	}
+
+	// One failing source degrades the run instead of failing it.
+	var failed SourceErrors
+	if !errors.As(err, &failed) || len(failed) != 1 || failed[0].Source != SourceAmass {
+		t.Fatalf("err = %v, want one amass failure", err)
+	}
+
+	if _, err := Enumerate(context.Background(), "example.com", sources[:1]); err != nil {
+		t.Fatalf("no failures should return no error, got %v", err)
+	}
+}
+
+func TestCommandSources(t *testing.T) {
+	ctx := context.Background()
+
+	bin, args := fakeBinary(t, "www.example.com\nWWW.example.com\n\napi.example.com\n")
+	names, err := (&Subfinder{Options: &SubfinderOptions{BinaryPath: bin}}).Enumerate(ctx, "example.com")
+	if err != nil || !reflect.DeepEqual(names, []string{"www.example.com", "api.example.com"}) {
+		t.Fatalf("subfinder = %v, %v", names, err)
+	}
+	if got := readArgs(t, args); got != "-silent -d example.com" {
+		t.Errorf("subfinder args = %q", got)
+	}
+
+	bin, args = fakeBinary(t, "mail.example.com (FQDN) --> a_record --> 192.0.2.1 (IPAddress)\ndev.example.com\n")
+	names, err = (&Amass{BinaryPath: bin}).Enumerate(ctx, "example.com")
+	if err != nil || !reflect.DeepEqual(names, []string{"mail.example.com", "dev.example.com"}) {
+		t.Fatalf("amass = %v, %v", names, err)
+	}
+	if got := readArgs(t, args); got != "enum -passive -nocolor -d example.com" {
+		t.Errorf("amass args = %q", got)
+	}
+
+	bin, args = fakeBinary(t, "shop.example.com\n")
+	names, err = (&Assetfinder{BinaryPath: bin}).Enumerate(ctx, "example.com")
+	if err != nil || !reflect.DeepEqual(names, []string{"shop.example.com"}) {
+		t.Fatalf("assetfinder = %v, %v", names, err)
+	}
+	if got := readArgs(t, args); got != "--subs-only example.com" {
+		t.Errorf("assetfinder args = %q", got)
+	}
+
+	_, err = (&Amass{BinaryPath: filepath.Join(t.TempDir(), "missing")}).Enumerate(ctx, "example.com")
+	if err == nil || !strings.HasPrefix(err.Error(), "amass error:") {
+		t.Fatalf("missing binary = %v", err)
+	}
+}
+
+func TestCertTransparency(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		if r.URL.Query().Get("output") != "json" {
+			http.Error(w, "html only", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[
+			{"common_name": "example.com", "name_value": "example.com\nwww.example.com"},
+			{"common_name": "*.dev.example.com", "name_value": "*.dev.example.com\nDEV.example.com"}
+		]`))
+	}))
+	defer srv.Close()
+
+	names, err := (&CertTransparency{BaseURL: srv.URL + "/"}).Enumerate(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "%.example.com" {
+		t.Errorf("query = %q, want %%.example.com", query)
+	}
+	if want := []string{"example.com", "www.example.com", "*.dev.example.com", "dev.example.com"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusBadGateway)
+	}))
+	defer down.Close()
+	if _, err := (&CertTransparency{BaseURL: down.URL}).Enumerate(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("unavailable log = %v, want a 502 error", err)
+	}
+}
+
+func TestNewSources(t *testing.T) {
+	var names []string
+	for _, s := range NewSources([]string{SourceCRT, SourceSubfinder, "bogus"}, Options{}) {
+		names = append(names, s.Name())
+	}
+	if want := []string{SourceSubfinder, SourceCRT}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("sources = %v, want %v", names, want)
+	}
+	if got := len(NewSources(nil, Options{})); got != len(Sources) {
+		t.Fatalf("default sources = %d, want all %d", got, len(Sources))
+	}
+}
+
+func TestEnumerateStreamReportsNamesBeforeSlowSourcesFinish(t *testing.T) {
+	release := make(chan struct{})
+	sources := []Enumerator{
+		fakeSource{name: SourceSubfinder, names: []string{"www.example.com", "other.org"}},
+		streamSource{names: []string{"dev.example.com", "www.example.com"}, release: release},
+	}
+
+	got := make(chan Result, 10)
+	done := make(chan []Result)
+	go func() {
+		results, _ := EnumerateStream(context.Background(), "example.com", sources, func(r Result) { got <- r })
+		done <- results
+	}()
+
+	// Both names arrive while the brute force is still running.
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		r := <-got
+		if seen[r.Name] || len(r.Sources) != 1 {
+			t.Fatalf("streamed %+v twice or with several sources", r)
+		}
+		seen[r.Name] = true
+	}
+	if !seen["www.example.com"] || !seen["dev.example.com"] {
+		t.Fatalf("streamed %v", seen)
+	}
+	close(release)
+
+	results := <-done
+	want := []Result{
+		{Name: "www.example.com", Sources: []string{SourceSubfinder, SourceBruteForce}},
+		{Name: "dev.example.com", Sources: []string{SourceBruteForce}},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("results = %+v, want %+v", results, want)
+	}
+	if len(got) != 0 {
+		t.Fatalf("extra names streamed: %+v", <-got)
+	}
+}
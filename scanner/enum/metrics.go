@@ -0,0 +1,9 @@
+package enum
+
+import "recon/metrics"
+
+// Enumeration metrics, across all scans.
+var (
+	sourceNames    = metrics.NewCounter("recon_enum_source_names_total", "Subdomains reported by each enumeration source.", "source")
+	sourceFailures = metrics.NewCounter("recon_enum_source_failures_total", "Enumeration source runs that failed or returned partial results.", "source")
+)
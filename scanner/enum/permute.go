@@ -0,0 +1,237 @@
+package enum
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"recon/dnsutil"
+)
+
+// SourcePermutation attributes hosts found by permuting known names.
+const SourcePermutation = "permutation"
+
+// defaultMaxPermutations caps the candidates of one Permutations run.
+const defaultMaxPermutations = 5000
+
+// DefaultPermutationWords are inserted into known names by Permute.
+var DefaultPermutationWords = []string{
+	"dev", "development", "test", "qa", "uat", "stage", "staging", "preprod", "prod",
+	"demo", "sandbox", "beta", "alpha", "old", "new", "legacy", "backup", "internal",
+	"int", "ext", "corp", "admin", "api", "app", "portal", "web", "mobile", "static",
+	"cdn", "auth", "sso", "vpn", "v1", "v2",
+}
+
+// Permute generates candidate names from known subdomains of domain, the way
+// altdns and dnsgen do. Rules run in order over every known name until max
+// candidates exist:
+//
+//  1. numbers incremented and decremented: api2 -> api1, api3
+//  2. one dash-separated part, or a label under a sub-zone, replaced by a
+//     word: dev-portal -> staging-portal, a.eu.example.com -> dev.eu.example.com
+//  3. a word joined with a dash: api-dev, dev-api
+//  4. a word joined directly: apidev, devapi
+//  5. a word added as a new label: dev.api
+//
+// Words are words plus the parts of the known names. Known names and names
+// that are not valid DNS names are never returned.
+func Permute(domain string, known []string, words []string, max int) []string {
+	if max <= 0 {
+		return nil
+	}
+	domain = cleanName(domain)
+	seen := make(map[string]bool)
+	var subs [][]string
+	var parts []string
+	for _, raw := range known {
+		name := cleanName(raw)
+		if seen[name] || !strings.HasSuffix(name, "."+domain) {
+			continue
+		}
+		seen[name] = true
+		labels := strings.Split(strings.TrimSuffix(name, "."+domain), ".")
+		subs = append(subs, labels)
+		parts = append(parts, wordsOf(labels)...)
+	}
+	words = Labels(append(append([]string{}, words...), parts...))
+
+	var out []string
+	add := func(labels ...string) bool {
+		// Records one candidate and reports whether the cap is reached.
+		for _, l := range labels {
+			if !labelPattern.MatchString(l) {
+				return len(out) >= max
+			}
+		}
+		name := strings.Join(labels, ".") + "." + domain
+		if !seen[name] && len(name) <= 253 {
+			seen[name] = true
+			out = append(out, name)
+		}
+		return len(out) >= max
+	}
+
+	rules := []func(labels []string) bool{
+		func(labels []string) bool {
+			for _, v := range numberVariants(labels[0]) {
+				if add(append([]string{v}, labels[1:]...)...) {
+					return true
+				}
+			}
+			return false
+		},
+		func(labels []string) bool {
+			pieces := strings.Split(labels[0], "-")
+			if len(pieces) == 1 && len(labels) == 1 {
+				// Replacing a whole label under the apex is brute-forcing.
+				return false
+			}
+			for i := range pieces {
+				for _, w := range words {
+					replaced := append([]string{}, pieces...)
+					replaced[i] = w
+					if add(append([]string{strings.Join(replaced, "-")}, labels[1:]...)...) {
+						return true
+					}
+				}
+			}
+			return false
+		},
+		func(labels []string) bool {
+			for _, w := range words {
+				if add(append([]string{labels[0] + "-" + w}, labels[1:]...)...) ||
+					add(append([]string{w + "-" + labels[0]}, labels[1:]...)...) {
+					return true
+				}
+			}
+			return false
+		},
+		func(labels []string) bool {
+			for _, w := range words {
+				if add(append([]string{labels[0] + w}, labels[1:]...)...) ||
+					add(append([]string{w + labels[0]}, labels[1:]...)...) {
+					return true
+				}
+			}
+			return false
+		},
+		func(labels []string) bool {
+			for _, w := range words {
+				if add(append([]string{w}, labels...)...) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	for _, rule := range rules {
+		for _, labels := range subs {
+			if rule(labels) {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+func wordsOf(labels []string) []string {
+	// Splits labels into their alphabetic parts, e.g. dev-portal2 -> dev, portal.
+	var out []string
+	for _, l := range labels {
+		for _, f := range strings.FieldsFunc(l, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			if len(f) >= 2 {
+				out = append(out, f)
+			}
+		}
+	}
+	return out
+}
+
+func numberVariants(label string) []string {
+	// Returns label with each run of digits incremented and decremented,
+	// keeping zero padding: node09 -> node08, node10.
+	var out []string
+	for i := 0; i < len(label); {
+		if label[i] < '0' || label[i] > '9' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(label) && label[j] >= '0' && label[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(label[i:j])
+		if err == nil {
+			for _, v := range []int{n - 1, n + 1} {
+				if v >= 0 {
+					out = append(out, label[:i]+fmt.Sprintf("%0*d", j-i, v)+label[j:])
+				}
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+// Permutations finds more hosts by resolving permutations of names already
+// discovered. Wildcard answers are filtered like in BruteForce.
+type Permutations struct {
+	Words         []string        // Default: DefaultPermutationWords; parts of the known names are always added
+	MaxCandidates int             // Cap on names resolved (default 5000)
+	Client        *dnsutil.Client // Default: dnsutil.Default
+	Workers       int             // Concurrent lookups (default 100)
+	Timeout       time.Duration   // Default: 2m
+}
+
+// Expand resolves permutations of known, subdomains of domain, and returns the
+// ones that exist. When it stops early the names confirmed so far are
+// returned with the error.
+func (p *Permutations) Expand(ctx context.Context, domain string, known []string) ([]string, error) {
+	words := p.Words
+	if words == nil {
+		words = DefaultPermutationWords
+	}
+	max := p.MaxCandidates
+	if max <= 0 {
+		max = defaultMaxPermutations
+	}
+	client := p.Client
+	if client == nil {
+		client = dnsutil.Default()
+	}
+	workers := p.Workers
+	if workers <= 0 {
+		workers = defaultBruteForceWorkers
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultSourceTimeout
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	candidates := Permute(domain, known, words, max)
+	found, failed, lastErr := ResolveNames(ctx, client, NewWildcardFilter(client), candidates, workers, nil)
+	sourceNames.Add(float64(len(found)), SourcePermutation)
+	log.Printf("[enum] permutation resolved %d/%d candidates for %s (%d lookups failed)", len(found), len(candidates), domain, failed)
+
+	var err error
+	switch {
+	case parent.Err() != nil:
+		err = fmt.Errorf("permutation cancelled: %w", parent.Err())
+	case ctx.Err() != nil:
+		err = fmt.Errorf("permutation timed out after %s", timeout)
+	case len(candidates) > 0 && failed == len(candidates):
+		found, err = nil, fmt.Errorf("permutation: every lookup failed: %w", lastErr)
+	}
+	if err != nil {
+		sourceFailures.Inc(SourcePermutation)
+	}
+	return found, err
+}
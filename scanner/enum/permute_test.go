@@ -0,0 +1,65 @@
+package enum
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"recon/dnsutil"
+	"recon/dnsutil/dnstest"
+)
+
+func TestPermuteAppliesRulesInOrder(t *testing.T) {
+	known := []string{"api.example.com", "dev-portal.example.com", "node09.eu.example.com", "example.com", "www.other.org"}
+	got := Permute("example.com", known, []string{"staging"}, 100000)
+
+	index := make(map[string]int, len(got))
+	for i, name := range got {
+		index[name] = i
+	}
+	for _, want := range []string{
+		"node08.eu.example.com", "node10.eu.example.com", // numbers
+		"staging-portal.example.com", "dev-staging.example.com", "staging.eu.example.com", // replaced parts
+		"api-staging.example.com", "staging-api.example.com", "api-dev.example.com", // dashes, with words from known names
+		"apistaging.example.com", "stagingapi.example.com", // joined
+		"staging.api.example.com", // new label
+	} {
+		if _, ok := index[want]; !ok {
+			t.Errorf("missing candidate %s", want)
+		}
+	}
+	for _, name := range known {
+		if _, ok := index[name]; ok {
+			t.Errorf("known name %s returned as a candidate", name)
+		}
+	}
+	if index["node10.eu.example.com"] > index["staging-portal.example.com"] || index["api-staging.example.com"] > index["staging.api.example.com"] {
+		t.Error("rules must run in order")
+	}
+
+	capped := Permute("example.com", known, []string{"staging"}, 3)
+	if want := []string{"node08.eu.example.com", "node10.eu.example.com"}; len(capped) != 3 || !reflect.DeepEqual(capped[:2], want) {
+		t.Fatalf("capped = %v, want 3 names starting with %v", capped, want)
+	}
+}
+
+func TestPermutationsExpandKeepsResolvingNames(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("api.example.com", dnsutil.TypeA, 60, "192.0.2.1")
+	srv.Add("api-dev.example.com", dnsutil.TypeA, 60, "192.0.2.5")
+	srv.Add("*.api.example.com", dnsutil.TypeA, 60, "192.0.2.1")
+
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{srv.Addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Permutations{Words: []string{"dev"}, Client: client, Workers: 4}
+	found, err := p.Expand(context.Background(), "example.com", []string{"api.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dev.api.example.com only resolves through the *.api.example.com wildcard.
+	if want := []string{"api-dev.example.com"}; !reflect.DeepEqual(found, want) {
+		t.Fatalf("found = %v, want %v", found, want)
+	}
+}
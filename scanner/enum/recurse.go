@@ -0,0 +1,179 @@
+package enum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"recon/dnsutil"
+	"recon/scope"
+)
+
+// Recursion defaults.
+const (
+	defaultRecursionDepth = 1
+	defaultMaxHosts       = 2000
+	defaultMinChildren    = 3
+	zoneCheckWorkers      = 20
+)
+
+// Recursion re-runs the sources on discovered names that look like zones of
+// their own: names with NS records, or with at least MinChildren discovered
+// names below them, like corp.example.com or eu.api.example.com. Zones the
+// scope bound to the context excludes are not enumerated.
+type Recursion struct {
+	Depth       int             // Levels of zones below the apex to enumerate (default 1)
+	MaxHosts    int             // Total hosts, the apex run's included, after which recursion stops (default 2000)
+	MinChildren int             // Discovered names below a name that make it a zone (default 3)
+	Client      *dnsutil.Client // For NS lookups; default: dnsutil.Default
+}
+
+// Expand enumerates the zones among found, the results of enumerating domain,
+// and then the zones among the new names, up to Depth levels. It returns found
+// followed by the new names, with their sources merged, and the failures of
+// sources on sub-zones. It stops at the host budget or when ctx is done.
+func (r *Recursion) Expand(ctx context.Context, domain string, found []Result, sources []Enumerator) ([]Result, SourceErrors) {
+	depth := r.Depth
+	if depth <= 0 {
+		depth = defaultRecursionDepth
+	}
+	budget := r.MaxHosts
+	if budget <= 0 {
+		budget = defaultMaxHosts
+	}
+	minChildren := r.MinChildren
+	if minChildren <= 0 {
+		minChildren = defaultMinChildren
+	}
+	client := r.Client
+	if client == nil {
+		client = dnsutil.Default()
+	}
+
+	domain = cleanName(domain)
+	results := append([]Result{}, found...)
+	index := make(map[string]int, len(results))
+	for i, res := range results {
+		index[res.Name] = i
+	}
+	enumerated := map[string]bool{domain: true}
+	frontier := found
+	var failed SourceErrors
+
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		zones := r.zones(ctx, client, domain, frontier, results, minChildren, enumerated)
+		var next []Result
+		for _, zone := range zones {
+			if len(results) >= budget {
+				log.Printf("[enum] recursion stopped at the budget of %d hosts for %s", budget, domain)
+				return results, failed
+			}
+			if ctx.Err() != nil {
+				return results, failed
+			}
+			enumerated[zone] = true
+			names, err := Enumerate(ctx, zone, sources)
+			var errs SourceErrors
+			if errors.As(err, &errs) {
+				for _, se := range errs {
+					failed = append(failed, SourceError{Source: se.Source, Err: fmt.Errorf("%s: %w", zone, se.Err)})
+				}
+			}
+
+			added := 0
+			for _, res := range names {
+				if i, ok := index[res.Name]; ok {
+					for _, src := range res.Sources {
+						if !contains(results[i].Sources, src) {
+							results[i].Sources = append(results[i].Sources, src)
+						}
+					}
+					continue
+				}
+				if len(results) >= budget {
+					break
+				}
+				index[res.Name] = len(results)
+				results = append(results, res)
+				next = append(next, res)
+				added++
+			}
+			log.Printf("[enum] recursion into %s (level %d) added %d names", zone, level, added)
+		}
+		frontier = next
+	}
+	return results, failed
+}
+
+func (r *Recursion) zones(ctx context.Context, client *dnsutil.Client, domain string, frontier, known []Result, minChildren int, enumerated map[string]bool) []string {
+	// Returns the names in frontier, and the names implied above them, that
+	// have enough known children or NS records of their own, in frontier order.
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, res := range frontier {
+		for name := res.Name; name != domain && strings.HasSuffix(name, "."+domain); name = name[strings.Index(name, ".")+1:] {
+			if !seen[name] && !enumerated[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	children := make(map[string]int)
+	for _, res := range known {
+		name := res.Name
+		for i := strings.Index(name, "."); i >= 0; i = strings.Index(name, ".") {
+			name = name[i+1:]
+			if seen[name] {
+				children[name]++
+			}
+		}
+	}
+
+	isZone := make([]bool, len(candidates))
+	sem := make(chan struct{}, zoneCheckWorkers)
+	var wg sync.WaitGroup
+	for i, name := range candidates {
+		if e := scope.FromContext(ctx); e != nil && !e.Host(ctx, name).Allowed {
+			continue
+		}
+		if children[name] >= minChildren {
+			isZone[i] = true
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			isZone[i] = hasNS(ctx, client, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var out []string
+	for i, name := range candidates {
+		if isZone[i] {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func hasNS(ctx context.Context, client *dnsutil.Client, name string) bool {
+	// Reports whether name itself has NS records, i.e. is delegated. NS records
+	// reached through a CNAME belong to another name and do not count.
+	resp, err := client.Query(ctx, name, dnsutil.TypeNS)
+	if err != nil {
+		return false
+	}
+	for _, rec := range resp.Answers {
+		if rec.Type == "NS" && rec.Name == name {
+			return true
+		}
+	}
+	return false
+}
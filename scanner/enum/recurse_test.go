@@ -0,0 +1,74 @@
+package enum
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"recon/dnsutil"
+	"recon/dnsutil/dnstest"
+)
+
+// zoneSource returns the names listed for the domain it is asked about.
+type zoneSource map[string][]string
+
+func (z zoneSource) Name() string { return "zones" }
+
+func (z zoneSource) Enumerate(_ context.Context, domain string) ([]string, error) {
+	return z[domain], nil
+}
+
+func TestRecursionEnumeratesZones(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("api.example.com", dnsutil.TypeNS, 300, "ns1.example.net")
+	srv.Add("eu.api.example.com", dnsutil.TypeNS, 300, "ns2.example.net")
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{srv.Addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []Result
+	for _, name := range []string{"www.example.com", "a.corp.example.com", "b.corp.example.com", "c.corp.example.com", "api.example.com"} {
+		found = append(found, Result{Name: name, Sources: []string{"zones"}})
+	}
+	sources := []Enumerator{
+		zoneSource{
+			"corp.example.com":   {"vpn.corp.example.com", "a.corp.example.com"},
+			"api.example.com":    {"eu.api.example.com", "x.eu.api.example.com"},
+			"eu.api.example.com": {"deep.eu.api.example.com"},
+		},
+		fakeSource{name: "broken", err: errors.New("down")},
+	}
+
+	r := &Recursion{Depth: 1, Client: client}
+	got, failed := r.Expand(context.Background(), "example.com", found, sources)
+	if want := []string{"vpn.corp.example.com", "eu.api.example.com", "x.eu.api.example.com"}; !reflect.DeepEqual(names(got[len(found):]), want) {
+		t.Fatalf("depth 1 added %v, want %v", names(got[len(found):]), want)
+	}
+	// corp.example.com has three children, api.example.com is delegated.
+	if len(failed) != 2 || failed[0].Source != "broken" || !strings.Contains(failed[0].Error(), "corp.example.com: down") {
+		t.Fatalf("failed = %v, want broken for corp.example.com and api.example.com", failed)
+	}
+
+	r.Depth = 2
+	got, _ = r.Expand(context.Background(), "example.com", found, sources)
+	if last := got[len(got)-1].Name; len(got) != 9 || last != "deep.eu.api.example.com" {
+		t.Fatalf("depth 2 = %v, want deep.eu.api.example.com last", names(got))
+	}
+
+	r.MaxHosts = 6
+	got, _ = r.Expand(context.Background(), "example.com", found, sources)
+	if want := "vpn.corp.example.com"; len(got) != 6 || got[5].Name != want {
+		t.Fatalf("with a budget of 6, got %v", names(got))
+	}
+}
+
+func names(results []Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Name
+	}
+	return out
+}
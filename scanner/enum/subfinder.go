@@ -1,11 +1,8 @@
 package enum
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 )
@@ -16,6 +13,13 @@ type SubfinderOptions struct {
 }
 
 func EnumerateSubdomains(domain string, opts *SubfinderOptions) ([]string, error) {
+	return EnumerateSubdomainsContext(context.Background(), domain, opts)
+}
+
+// EnumerateSubdomainsContext is EnumerateSubdomains with cancellation: subfinder
+// is killed as soon as ctx is done, and the subdomains it printed before that
+// are returned along with the error.
+func EnumerateSubdomainsContext(parent context.Context, domain string, opts *SubfinderOptions) ([]string, error) {
 	// Runs subfinder CLI for one domain and returns a lowercase, deduplicated list.
 	// This function is only responsible for enumeration, not liveness checks.
 	domain = strings.TrimSpace(domain)
@@ -34,43 +38,17 @@ func EnumerateSubdomains(domain string, opts *SubfinderOptions) ([]string, error
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
 	// -silent keeps output parse-friendly (one result per line).
-	cmd := exec.CommandContext(ctx, bin, "-silent", "-d", domain)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("subfinder timed out after %s", timeout)
-		}
-		return nil, fmt.Errorf("subfinder error: %w. stderr: %s", err, stderr.String())
-	}
-
-	subdomains := make([]string, 0)
-	seen := make(map[string]struct{})
-
-	scanner := bufio.NewScanner(&stdout)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		line = strings.ToLower(line)
+	return runTool(parent, SourceSubfinder, bin, []string{"-silent", "-d", domain}, timeout)
+}
 
-		if _, exists := seen[line]; !exists {
-			seen[line] = struct{}{}
-			subdomains = append(subdomains, line)
-		}
-	}
+// Subfinder is the subfinder source.
+type Subfinder struct {
+	Options *SubfinderOptions
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading subfinder output: %w", err)
-	}
+func (s *Subfinder) Name() string { return SourceSubfinder }
 
-	return subdomains, nil
+func (s *Subfinder) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	return EnumerateSubdomainsContext(ctx, domain, s.Options)
 }
@@ -0,0 +1,96 @@
+package enum
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+
+	"recon/dnsutil"
+)
+
+// wildcardProbes is how many random labels are resolved per zone.
+const wildcardProbes = 3
+
+// WildcardFilter recognizes answers that come from wildcard DNS records. The
+// parent zone of each name is probed once with random labels; a name whose
+// addresses are all among the zone's wildcard answers is not a real host.
+type WildcardFilter struct {
+	client *dnsutil.Client
+
+	mu    sync.Mutex
+	zones map[string]*wildcardZone
+}
+
+type wildcardZone struct {
+	once  sync.Once
+	addrs map[string]bool
+}
+
+// NewWildcardFilter returns a filter that probes zones through client.
+func NewWildcardFilter(client *dnsutil.Client) *WildcardFilter {
+	return &WildcardFilter{client: client, zones: make(map[string]*wildcardZone)}
+}
+
+// Addresses returns what random names directly under zone resolve to, or nil
+// when zone has no wildcard record.
+func (w *WildcardFilter) Addresses(ctx context.Context, zone string) []string {
+	addrs := w.zone(ctx, zone)
+	out := make([]string, 0, len(addrs))
+	for a := range addrs {
+		out = append(out, a)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Matches reports whether addrs, the answer for name, is a wildcard answer.
+func (w *WildcardFilter) Matches(ctx context.Context, name string, addrs []string) bool {
+	i := strings.Index(name, ".")
+	if i < 0 || len(addrs) == 0 {
+		return false
+	}
+	wild := w.zone(ctx, name[i+1:])
+	if len(wild) == 0 {
+		return false
+	}
+	for _, a := range addrs {
+		if !wild[a] {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *WildcardFilter) zone(ctx context.Context, zone string) map[string]bool {
+	// Probes zone on first use and caches its wildcard answers.
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	w.mu.Lock()
+	z, ok := w.zones[zone]
+	if !ok {
+		z = &wildcardZone{}
+		w.zones[zone] = z
+	}
+	w.mu.Unlock()
+
+	z.once.Do(func() {
+		z.addrs = make(map[string]bool)
+		for i := 0; i < wildcardProbes; i++ {
+			name := fmt.Sprintf("%016x.%s", rand.Uint64(), zone)
+			addrs, err := w.client.Resolve(ctx, name)
+			if err != nil {
+				continue
+			}
+			for _, a := range addrs {
+				z.addrs[a] = true
+			}
+		}
+		if len(z.addrs) > 0 {
+			log.Printf("[enum] wildcard DNS on *.%s (%d addresses), matching answers are ignored", zone, len(z.addrs))
+		}
+	})
+	return z.addrs
+}
@@ -2,4 +2,4 @@ module recon
 
 go 1.25.0
 
-require golang.org/x/net v0.55.0 // indirect
+require golang.org/x/net v0.55.0
@@ -0,0 +1,224 @@
+package jobqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record types written to the journal.
+const (
+	RecordAccepted   = "accepted"
+	RecordCheckpoint = "checkpoint"
+	RecordFinished   = "finished"
+)
+
+// Record is one line of the append-only journal.
+type Record struct {
+	Type    string          `json:"type"`
+	ScanID  int64           `json:"scan_id"`
+	Phase   string          `json:"phase,omitempty"`
+	Status  string          `json:"status,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	At      time.Time       `json:"at"`
+}
+
+// Job is an accepted scan that has not reached a terminal status yet.
+type Job struct {
+	ScanID          int64
+	Payload         json.RawMessage
+	CompletedPhases []string
+	AcceptedAt      time.Time
+}
+
+// PhaseCompleted reports whether a checkpoint was recorded for phase.
+func (j Job) PhaseCompleted(phase string) bool {
+	for _, p := range j.CompletedPhases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// Journal persists accepted scan jobs and their phase checkpoints as JSON lines.
+// Every append is fsynced so a crash never loses an acknowledged job.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// Open replays the journal at path, compacts it down to unfinished jobs and
+// returns those jobs in acceptance order so the caller can resume them.
+func Open(path string) (*Journal, []Job, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, fmt.Errorf("creating journal dir: %w", err)
+	}
+
+	pending, err := replay(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := compact(path, pending); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	return &Journal{path: path, f: f}, pending, nil
+}
+
+// Accept records a newly accepted job. payload is stored as JSON and handed
+// back unchanged on replay.
+func (j *Journal) Accept(scanID int64, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode payload: %w", err)
+	}
+	return j.append(Record{Type: RecordAccepted, ScanID: scanID, Payload: data})
+}
+
+// Checkpoint records that a phase of the job completed and its artifact is on disk.
+func (j *Journal) Checkpoint(scanID int64, phase string) error {
+	return j.append(Record{Type: RecordCheckpoint, ScanID: scanID, Phase: phase})
+}
+
+// Finish records the terminal status of a job so it is not replayed again.
+func (j *Journal) Finish(scanID int64, status string) error {
+	return j.append(Record{Type: RecordFinished, ScanID: scanID, Status: status})
+}
+
+// Close closes the underlying journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+func (j *Journal) append(rec Record) error {
+	rec.At = time.Now().UTC()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.f.Write(line); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	return nil
+}
+
+func replay(path string) ([]Job, error) {
+	// Folds the journal into the set of jobs without a finished record.
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []Job{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	defer f.Close()
+
+	jobs := make(map[int64]*Job)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// A torn write from a crash can only affect the tail; skip it.
+			log.Printf("[jobqueue] skipping corrupt journal line %d: %v", lineNo, err)
+			continue
+		}
+
+		switch rec.Type {
+		case RecordAccepted:
+			jobs[rec.ScanID] = &Job{
+				ScanID:          rec.ScanID,
+				Payload:         append(json.RawMessage(nil), rec.Payload...),
+				CompletedPhases: []string{},
+				AcceptedAt:      rec.At,
+			}
+		case RecordCheckpoint:
+			if job, ok := jobs[rec.ScanID]; ok && !job.PhaseCompleted(rec.Phase) {
+				job.CompletedPhases = append(job.CompletedPhases, rec.Phase)
+			}
+		case RecordFinished:
+			delete(jobs, rec.ScanID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+
+	pending := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		pending = append(pending, *job)
+	}
+	sort.Slice(pending, func(i, k int) bool {
+		return pending[i].AcceptedAt.Before(pending[k].AcceptedAt)
+	})
+	return pending, nil
+}
+
+func compact(path string, pending []Job) error {
+	// Rewrites the journal with only unfinished jobs so it does not grow forever.
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create compacted journal: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, job := range pending {
+		records := []Record{{Type: RecordAccepted, ScanID: job.ScanID, Payload: job.Payload, At: job.AcceptedAt}}
+		for _, phase := range job.CompletedPhases {
+			records = append(records, Record{Type: RecordCheckpoint, ScanID: job.ScanID, Phase: phase, At: job.AcceptedAt})
+		}
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				f.Close()
+				return fmt.Errorf("write compacted journal: %w", err)
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("flush compacted journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync compacted journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close compacted journal: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
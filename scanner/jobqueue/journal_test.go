@@ -0,0 +1,91 @@
+package jobqueue
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalReplaysUnfinishedJobsWithCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+
+	j, pending, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected empty journal, got %d jobs", len(pending))
+	}
+
+	type payload struct {
+		Target string `json:"target"`
+	}
+	mustNoErr(t, j.Accept(1, payload{Target: "a.example"}))
+	mustNoErr(t, j.Accept(2, payload{Target: "b.example"}))
+	mustNoErr(t, j.Checkpoint(1, "subdomains"))
+	mustNoErr(t, j.Checkpoint(2, "subdomains"))
+	mustNoErr(t, j.Checkpoint(2, "endpoints"))
+	mustNoErr(t, j.Finish(2, "COMPLETED"))
+	mustNoErr(t, j.Close())
+
+	j, pending, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending job, got %d", len(pending))
+	}
+	job := pending[0]
+	if job.ScanID != 1 {
+		t.Fatalf("expected scan 1 pending, got %d", job.ScanID)
+	}
+	if !job.PhaseCompleted("subdomains") || job.PhaseCompleted("endpoints") {
+		t.Fatalf("unexpected checkpoints: %v", job.CompletedPhases)
+	}
+
+	var got payload
+	if err := json.Unmarshal(job.Payload, &got); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if got.Target != "a.example" {
+		t.Fatalf("unexpected payload target %q", got.Target)
+	}
+}
+
+func TestJournalSkipsTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+
+	j, _, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	mustNoErr(t, j.Accept(7, map[string]string{"target": "c.example"}))
+	mustNoErr(t, j.Close())
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	_, _ = f.WriteString(`{"type":"finished","scan_id":7,"sta`)
+	f.Close()
+
+	j, pending, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+
+	if len(pending) != 1 || pending[0].ScanID != 7 {
+		t.Fatalf("expected scan 7 to survive a torn finish record, got %+v", pending)
+	}
+}
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
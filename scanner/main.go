@@ -7,14 +7,22 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	endpointspkg "recon/endpoints"
+	"recon/metrics"
 	reconpkg "recon/recon"
 )
 
 func main() {
-	// This is the scanner worker entry point.
-	// It starts an HTTP service that Django calls to run scans.
+	// This is the recon entry point. Without a subcommand it runs the HTTP
+	// worker that Django calls; see cli.go for the standalone commands.
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func serve(addr string) {
+	// Starts the HTTP service that Django calls to run scans.
 	// Set up logging to both terminal and file (overwrite on each start)
 	logFile, err := os.OpenFile("scanner.log", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
@@ -28,22 +36,62 @@ func main() {
 	log.SetFlags(log.Ldate | log.Ltime)
 
 	// Initialize runtime concurrency configuration at process start.
-	_ = reconpkg.GetRuntimeConfig()
+	runtimeCfg := reconpkg.GetRuntimeConfig()
+	scheduler = newScanScheduler(runtimeCfg.MaxConcurrentScans, runtimeCfg.MaxQueuedScans, runQueuedScan)
 
+	// Auth and callback delivery must be ready before resumed scans post updates.
 	mux := http.NewServeMux()
+	handler, tlsCfg := configureWorkerAuth(mux)
+	startCallbackDelivery()
+	loadScanProfiles()
+	registerWorkerMetrics()
+	configureRateLimit()
+	configureProxy()
+	configureDNS()
+	checkTools()
+
+	// Open the durable job journal and replay scans interrupted by a restart.
+	pending := openScanJournal()
+	defer scanJournal.Close()
+	resumePendingScans(pending)
+
 	mux.HandleFunc("/jobs", jobHandler)
 	mux.HandleFunc("/endpoints", endpointsHandler)
 	mux.HandleFunc("/scan", scanHandler)
 	mux.HandleFunc("/cancel", cancelScanHandler)
-
-	addr := ":8080"
-	if v := os.Getenv("RECON_HTTP_ADDR"); v != "" {
-		addr = v
-	}
-
-	log.Printf("[recon] starting server on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	mux.HandleFunc("/pause", pauseScanHandler)
+	mux.HandleFunc("/resume", resumeScanHandler)
+	mux.HandleFunc("/scans", scanListHandler)
+	mux.HandleFunc("/scans/", scanStatusHandler)
+	mux.HandleFunc("/delivery", deliveryStatsHandler)
+	mux.HandleFunc("/profiles", profilesHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	// SIGTERM/SIGINT drain scans instead of killing them mid-phase.
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("[recon] starting server on %s", addr)
+		if tlsCfg != nil {
+			server.TLSConfig = tlsCfg.config
+			serverErr <- server.ListenAndServeTLS(tlsCfg.certFile, tlsCfg.keyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("server error: %v", err)
+	case <-signals.Done():
+		stop()
+		log.Printf("[recon] shutdown signal received")
+		shutdownWorker(server)
 	}
 }
 
@@ -60,6 +108,8 @@ func jobHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The job stops when the caller disconnects.
+	job.Ctx = r.Context()
 	results, err := reconpkg.HandleJob(job)
 	if err != nil {
 		log.Printf("[recon] job failed: %v", err)
@@ -94,7 +144,13 @@ func endpointsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	endpoints, err := endpointspkg.DiscoverEndpointsFromScan(context.Background(), req.UserID, req.ScanID, req.Target)
+	// Discovery stops when the caller disconnects or the worker shuts down.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(workerCtx, cancel)
+	defer stop()
+
+	endpoints, err := endpointspkg.DiscoverEndpointsFromScan(ctx, req.UserID, req.ScanID, req.Target)
 	if err != nil {
 		log.Printf("[endpoints] discovery failed: %v", err)
 		http.Error(w, "endpoint discovery failed", http.StatusInternalServerError)
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"runtime"
+
+	"recon/metrics"
+)
+
+// Scan metrics recorded by the worker; tool, probe and callback metrics live
+// in their own packages.
+var (
+	phaseDuration = metrics.NewHistogram("recon_phase_duration_seconds", "Run time of scan phases that were not restored from a checkpoint.", metrics.DurationBuckets, "phase")
+	scansFinished = metrics.NewCounter("recon_scans_finished_total", "Scans that reached a terminal status.", "status")
+)
+
+func registerWorkerMetrics() {
+	// Exposes scheduler and delivery state sampled at scrape time. Only the
+	// HTTP worker has a scheduler and dispatcher, so the CLI skips these.
+	metrics.NewGaugeFunc("recon_scans_active", "Scans currently running.", func() float64 {
+		return float64(scheduler.snapshot().Running)
+	})
+	metrics.NewGaugeFunc("recon_scans_queued", "Scans waiting for a free slot.", func() float64 {
+		return float64(scheduler.snapshot().Queued)
+	})
+	metrics.NewGaugeFunc("recon_callback_spool_pending", "Callback batches spooled to disk awaiting replay.", func() float64 {
+		return float64(callbacks.Stats().SpoolPending)
+	})
+	metrics.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+}
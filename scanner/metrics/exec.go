@@ -0,0 +1,17 @@
+package metrics
+
+import "time"
+
+// Metrics shared by every package that runs external tools.
+var (
+	ExecDuration = NewHistogram("recon_exec_duration_seconds", "Run time of external tools (subfinder, amass, assetfinder, httpx, gau, katana, nmap).", DurationBuckets, "tool")
+	ExecFailures = NewCounter("recon_exec_failures_total", "External tool runs that failed or timed out.", "tool")
+)
+
+// ObserveExec records one run of tool that started at start and ended with err.
+func ObserveExec(tool string, start time.Time, err error) {
+	ExecDuration.ObserveSince(start, tool)
+	if err != nil {
+		ExecFailures.Inc(tool)
+	}
+}
@@ -0,0 +1,343 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text format, without external dependencies.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets for durations in seconds.
+var (
+	// DurationBuckets suits external tools and scan phases (100ms to 1h).
+	DurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+	// LatencyBuckets suits HTTP requests (5ms to 10s).
+	LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// collector is one metric family.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]struct{}
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// Default is the registry used by the package-level constructors and Handler.
+var Default = NewRegistry()
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.names[c.name()]; dup {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.names[c.name()] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every metric in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry for Prometheus scrapes.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler { return Default.Handler() }
+
+// ---------------- VECTORS ----------------
+
+// vec stores one value per combination of label values.
+type vec[T any] struct {
+	fullName string
+	help     string
+	kind     string
+	labels   []string
+	mu       sync.Mutex
+	series   map[string]*T
+	values   map[string][]string
+	newT     func() *T
+}
+
+func newVec[T any](name, help, kind string, labels []string, newT func() *T) *vec[T] {
+	return &vec[T]{
+		fullName: name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		series:   make(map[string]*T),
+		values:   make(map[string][]string),
+		newT:     newT,
+	}
+}
+
+func (v *vec[T]) name() string { return v.fullName }
+
+func (v *vec[T]) get(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.fullName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newT()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// each calls fn for every series sorted by label values.
+func (v *vec[T]) each(fn func(labels string, s *T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		labels string
+		s      *T
+	}
+	entries := make([]entry, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, entry{formatLabels(v.labels, v.values[k]), v.series[k]})
+	}
+	v.mu.Unlock()
+	for _, e := range entries {
+		fn(e.labels, e.s)
+	}
+}
+
+func (v *vec[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.fullName, v.help, v.fullName, v.kind)
+}
+
+// ---------------- COUNTER / GAUGE ----------------
+
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (x *value) add(d float64) {
+	x.mu.Lock()
+	x.v += d
+	x.mu.Unlock()
+}
+
+func (x *value) set(v float64) {
+	x.mu.Lock()
+	x.v = v
+	x.mu.Unlock()
+}
+
+func (x *value) load() float64 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.v
+}
+
+// CounterVec is a monotonically increasing value per label combination.
+type CounterVec struct{ *vec[value] }
+
+// NewCounter registers a counter with the given label names in Default.
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels, func() *value { return &value{} })}
+	Default.register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds d (which must not be negative) to the series.
+func (c *CounterVec) Add(d float64, labelValues ...string) { c.get(labelValues).add(d) }
+
+// Value returns the current value of a series.
+func (c *CounterVec) Value(labelValues ...string) float64 { return c.get(labelValues).load() }
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.each(func(labels string, s *value) {
+		fmt.Fprintf(w, "%s%s %s\n", c.fullName, labels, formatFloat(s.load()))
+	})
+}
+
+// GaugeVec is a value that can go up and down per label combination.
+type GaugeVec struct{ *vec[value] }
+
+// NewGauge registers a gauge with the given label names in Default.
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels, func() *value { return &value{} })}
+	Default.register(g)
+	return g
+}
+
+// Set sets the series with the given label values.
+func (g *GaugeVec) Set(v float64, labelValues ...string) { g.get(labelValues).set(v) }
+
+// Add adds d (possibly negative) to the series.
+func (g *GaugeVec) Add(d float64, labelValues ...string) { g.get(labelValues).add(d) }
+
+// Value returns the current value of a series.
+func (g *GaugeVec) Value(labelValues ...string) float64 { return g.get(labelValues).load() }
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.header(w)
+	g.each(func(labels string, s *value) {
+		fmt.Fprintf(w, "%s%s %s\n", g.fullName, labels, formatFloat(s.load()))
+	})
+}
+
+// gaugeFunc reads its value when scraped.
+type gaugeFunc struct {
+	fullName, help string
+	fn             func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn on every scrape.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(&gaugeFunc{fullName: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) name() string { return g.fullName }
+
+func (g *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.fullName, g.help, g.fullName, g.fullName, formatFloat(g.fn()))
+}
+
+// ---------------- HISTOGRAM ----------------
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramVec counts observations in buckets per label combination.
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+// NewHistogram registers a histogram with upper bucket bounds in Default.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &HistogramVec{buckets: b}
+	h.vec = newVec(name, help, "histogram", labels, func() *histogram {
+		return &histogram{buckets: b, counts: make([]uint64, len(b))}
+	})
+	Default.register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) { h.get(labelValues).observe(v) }
+
+// ObserveSince records the seconds elapsed since start.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns how many observations a series has.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	s := h.get(labelValues)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w)
+	h.each(func(labels string, s *histogram) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var cumulative uint64
+		for i, upper := range s.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fullName, withLabel(labels, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fullName, withLabel(labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fullName, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fullName, labels, s.count)
+	})
+}
+
+// ---------------- FORMATTING ----------------
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = fmt.Sprintf(`%s="%s"`, n, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("content type = %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestCounterAndGaugeTextFormat(t *testing.T) {
+	c := NewCounter("test_events_total", "Events seen.", "kind")
+	c.Inc("a")
+	c.Add(2, "a")
+	c.Inc(`quote"and\slash`)
+	NewGaugeFunc("test_answer", "A computed gauge.", func() float64 { return 42 })
+
+	out := scrape(t)
+	for _, want := range []string{
+		"# HELP test_events_total Events seen.\n# TYPE test_events_total counter\n",
+		`test_events_total{kind="a"} 3` + "\n",
+		`test_events_total{kind="quote\"and\\slash"} 1` + "\n",
+		"# TYPE test_answer gauge\ntest_answer 42\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scrape missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{1, 0.1}, "tool")
+	for _, v := range []float64{0.05, 0.5, 0.7, 5} {
+		h.Observe(v, "nmap")
+	}
+
+	var buf bytes.Buffer
+	Default.Write(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		`test_duration_seconds_bucket{tool="nmap",le="0.1"} 1`,
+		`test_duration_seconds_bucket{tool="nmap",le="1"} 3`,
+		`test_duration_seconds_bucket{tool="nmap",le="+Inf"} 4`,
+		`test_duration_seconds_sum{tool="nmap"} 6.25`,
+		`test_duration_seconds_count{tool="nmap"} 4`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("scrape missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestObserveExecCountsFailures(t *testing.T) {
+	ObserveExec("testtool", time.Now(), nil)
+	ObserveExec("testtool", time.Now(), errors.New("exit status 1"))
+	if n := ExecDuration.Count("testtool"); n != 2 {
+		t.Fatalf("duration count = %d, want 2", n)
+	}
+	if n := ExecFailures.Value("testtool"); n != 1 {
+		t.Fatalf("failures = %v, want 1", n)
+	}
+}
@@ -0,0 +1,65 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScanHostPortsContextKillsNmap(t *testing.T) {
+	// A stand-in nmap that never finishes must be killed on cancellation.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nmap"), []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := ScanHostPortsContext(ctx, "127.0.0.1", DefaultNmapOptions())
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("nmap was not killed promptly (%s)", elapsed)
+	}
+}
+
+func TestCheckDirectoryPathsContextAbortsRequests(t *testing.T) {
+	// Requests in flight are aborted and the remaining paths skipped.
+	release := make(chan struct{})
+	defer close(release)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	findings := CheckDirectoryPathsContext(ctx, strings.TrimPrefix(srv.URL, "http://"), false, []string{"/a", "/b", "/c"})
+
+	if len(findings) != 0 {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("directory checks were not aborted (%s)", elapsed)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("expected only the first path to be requested, got %d requests", n)
+	}
+}
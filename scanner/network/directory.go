@@ -1,13 +1,17 @@
 package network
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
+
+	"recon/egress"
+	"recon/ratelimit"
+	"recon/scope"
 )
 
 // ============ DIRECTORY FINDING STRUCTURE ============
@@ -42,9 +46,32 @@ var sensitivePaths = []string{
 
 // ============ DIRECTORY CHECKING FUNCTIONS ============
 
+// DefaultSensitivePaths returns a copy of the paths probed by CheckDirectories.
+func DefaultSensitivePaths() []string {
+	return append([]string(nil), sensitivePaths...)
+}
+
 // CheckDirectories scans for exposed directories and sensitive files
 func CheckDirectories(host string, hasHTTPS bool) []DirectoryFinding {
-	// Probes a curated list of sensitive paths and reports only meaningful exposures.
+	return CheckDirectoryPaths(host, hasHTTPS, sensitivePaths)
+}
+
+// CheckDirectoriesContext is CheckDirectories with cancellation.
+func CheckDirectoriesContext(ctx context.Context, host string, hasHTTPS bool) []DirectoryFinding {
+	return CheckDirectoryPathsContext(ctx, host, hasHTTPS, sensitivePaths)
+}
+
+// CheckDirectoryPaths scans a custom list of paths for exposed directories and
+// sensitive files
+func CheckDirectoryPaths(host string, hasHTTPS bool, paths []string) []DirectoryFinding {
+	return CheckDirectoryPathsContext(context.Background(), host, hasHTTPS, paths)
+}
+
+// CheckDirectoryPathsContext is CheckDirectoryPaths with cancellation: the
+// request in flight is aborted and the remaining paths are skipped once ctx
+// is done.
+func CheckDirectoryPathsContext(ctx context.Context, host string, hasHTTPS bool, paths []string) []DirectoryFinding {
+	// Probes the given paths and reports only meaningful exposures.
 	scheme := "http"
 	if hasHTTPS {
 		scheme = "https"
@@ -61,14 +88,15 @@ func CheckDirectories(host string, hasHTTPS bool) []DirectoryFinding {
 			}
 			return nil
 		},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Transport: scope.NewTransport(ratelimit.NewTransport(egress.NewTransport())),
 	}
 
-	for _, path := range sensitivePaths {
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
 		url := baseURL + path
-		finding := checkPath(client, host, baseURL, path, url)
+		finding := checkPath(ctx, client, host, baseURL, path, url)
 		if finding != nil {
 			findings = append(findings, *finding)
 		}
@@ -78,9 +106,13 @@ func CheckDirectories(host string, hasHTTPS bool) []DirectoryFinding {
 }
 
 // checkPath checks a single path for issues
-func checkPath(client *http.Client, host, baseURL, path, url string) *DirectoryFinding {
+func checkPath(ctx context.Context, client *http.Client, host, baseURL, path, url string) *DirectoryFinding {
 	// Classifies accessible path responses into security-relevant finding types.
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		// Silently skip unreachable paths
 		return nil
@@ -1,11 +1,21 @@
 package network
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os/exec"
+	"strconv"
 	"sync"
+	"time"
+
+	"recon/egress"
+	"recon/metrics"
+	"recon/ratelimit"
+	"recon/scope"
 )
 
 // ============ NMAP XML PARSING STRUCTURES ============
@@ -64,23 +74,100 @@ type PortFinding struct {
 
 // ============ PORT SCANNING FUNCTIONS ============
 
+// NmapOptions configures a port scan.
+type NmapOptions struct {
+	TopPorts    int           // Number of most common ports to scan (default: 200)
+	HostTimeout time.Duration // Give up on a host after this long (default: 5m)
+	Timing      string        // nmap timing template: paranoid, sneaky, polite, normal, aggressive or insane (default: nmap's own)
+	UDP         bool          // Also scan the top UDP ports (requires root or CAP_NET_RAW, see CanScanUDP)
+	MaxRate     int           // Packets per second cap, 0 for no limit
+}
+
+// NmapTimings lists the timing templates accepted in NmapOptions.Timing.
+var NmapTimings = []string{"paranoid", "sneaky", "polite", "normal", "aggressive", "insane"}
+
+// DefaultNmapOptions returns the settings used by ScanHostPorts.
+func DefaultNmapOptions() NmapOptions {
+	return NmapOptions{
+		TopPorts:    200,
+		HostTimeout: 5 * time.Minute,
+	}
+}
+
+// NmapSupportsProxy reports whether nmap can relay its connections through u.
+// nmap's --proxies only speaks plain HTTP CONNECT and SOCKS4, so https and
+// SOCKS5 proxies are rejected rather than scanning around them.
+func NmapSupportsProxy(u *url.URL) bool {
+	return u != nil && u.Scheme == "http"
+}
+
 // ScanHostPorts performs Nmap TCP connect scan on a single host
 func ScanHostPorts(host string, topPorts int) ([]PortFinding, error) {
+	opts := DefaultNmapOptions()
+	opts.TopPorts = topPorts
+	return ScanHostPortsWithOptions(host, opts)
+}
+
+// ScanHostPortsWithOptions performs an Nmap TCP connect scan with custom settings.
+// Zero fields in opts use DefaultNmapOptions.
+func ScanHostPortsWithOptions(host string, opts NmapOptions) ([]PortFinding, error) {
+	return ScanHostPortsContext(context.Background(), host, opts)
+}
+
+// ScanHostPortsContext is ScanHostPortsWithOptions with cancellation: nmap is
+// killed as soon as ctx is done.
+func ScanHostPortsContext(ctx context.Context, host string, opts NmapOptions) ([]PortFinding, error) {
 	// Runs nmap, parses XML output, and returns only open ports with basic service metadata.
+	defaults := DefaultNmapOptions()
+	if opts.TopPorts <= 0 {
+		opts.TopPorts = defaults.TopPorts
+	}
+	if opts.HostTimeout <= 0 {
+		opts.HostTimeout = defaults.HostTimeout
+	}
+
 	args := []string{
 		"-sT", // TCP connect scan (safe, no SYN scan needed)
 		"-sV", // Version detection
-		fmt.Sprintf("--top-ports=%d", topPorts),
+		fmt.Sprintf("--top-ports=%d", opts.TopPorts),
 		"-oX", "-", // XML output to stdout
-		"--host-timeout", "5m",
+		"--host-timeout", fmt.Sprintf("%ds", int(opts.HostTimeout.Seconds())),
 		"--max-retries", "1",
 		"--version-intensity", "2", // Lighter version probing
-		host,
 	}
+	if opts.UDP {
+		args = append(args, "-sU")
+	}
+	if opts.Timing != "" {
+		args = append(args, "-T", opts.Timing)
+	}
+	if opts.MaxRate > 0 {
+		args = append(args, "--max-rate", strconv.Itoa(opts.MaxRate))
+	}
+	if u := egress.FromContext(ctx); u != nil {
+		if !NmapSupportsProxy(u) {
+			return nil, fmt.Errorf("nmap cannot use %s proxy %s", u.Scheme, u.Redacted())
+		}
+		args = append(args, "--proxies", u.String())
+	}
+	args = append(args, host)
 
-	cmd := exec.Command("nmap", args...)
+	if !scope.AllowHost(ctx, host) {
+		return nil, fmt.Errorf("%s is out of scope, not scanning ports", host)
+	}
+	// nmap paces its own probes (see MaxRate); the scan takes one slot of the
+	// host's rate limit so backoff after 429s and resets delays it too.
+	if err := ratelimit.Wait(ctx, host); err != nil {
+		return nil, fmt.Errorf("nmap cancelled for %s: %w", host, err)
+	}
+	cmd := exec.CommandContext(ctx, "nmap", args...)
+	start := time.Now()
 	output, err := cmd.Output()
+	metrics.ObserveExec("nmap", start, err)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("nmap cancelled for %s: %w", host, ctx.Err())
+		}
 		return nil, fmt.Errorf("nmap execution failed for %s: %w", host, err)
 	}
 
@@ -101,8 +188,8 @@ func ScanHostPorts(host string, topPorts int) ([]PortFinding, error) {
 		}
 
 		for _, p := range h.Ports.PortList {
-			// Only report open ports
-			if p.State.State == "open" {
+			// Only report open ports, and only those the scope allows
+			if p.State.State == "open" && scope.AllowHost(ctx, net.JoinHostPort(host, strconv.Itoa(p.PortID))) {
 				findings = append(findings, PortFinding{
 					Host:     host, // Use original hostname, not IP
 					IP:       ipAddr,
@@ -0,0 +1,36 @@
+package network
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// capNetRaw is the bit of CAP_NET_RAW in the Linux capability sets.
+const capNetRaw = 13
+
+// CanScanUDP reports whether nmap started by this process can send the raw
+// packets a UDP scan needs: the process runs as root or holds CAP_NET_RAW.
+// The answer does not change while the process runs, so it is computed once.
+var CanScanUDP = sync.OnceValue(func() bool {
+	if os.Geteuid() == 0 {
+		return true
+	}
+	return hasEffectiveCap(capNetRaw)
+})
+
+func hasEffectiveCap(bit uint) bool {
+	// Reads the effective capability set from /proc; false where it is absent.
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if hex, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			caps, err := strconv.ParseUint(strings.TrimSpace(hex), 16, 64)
+			return err == nil && caps&(1<<bit) != 0
+		}
+	}
+	return false
+}
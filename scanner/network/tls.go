@@ -1,11 +1,16 @@
 package network
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"time"
+
+	"recon/egress"
+	"recon/ratelimit"
+	"recon/scope"
 )
 
 // ============ TLS RESULT STRUCTURE ============
@@ -25,6 +30,12 @@ type TLSResult struct {
 
 // CheckTLS performs comprehensive TLS/SSL analysis on a host
 func CheckTLS(host string) TLSResult {
+	return CheckTLSContext(context.Background(), host)
+}
+
+// CheckTLSContext is CheckTLS with cancellation: handshakes in flight are
+// aborted and no further versions are tried once ctx is done.
+func CheckTLSContext(ctx context.Context, host string) TLSResult {
 	// Tests TLS support/version posture and certificate health for one host.
 	result := TLSResult{
 		Host:              host,
@@ -37,7 +48,7 @@ func CheckTLS(host string) TLSResult {
 	addr := fmt.Sprintf("%s:443", host)
 
 	// Check TLS 1.0 (weak)
-	if checkTLSVersion(addr, tls.VersionTLS10) {
+	if checkTLSVersion(ctx, addr, tls.VersionTLS10) {
 		result.SupportedVersions = append(result.SupportedVersions, "TLS1.0")
 		result.WeakVersions = append(result.WeakVersions, "TLS1.0")
 		result.Issues = append(result.Issues, "weak_tls_version_10")
@@ -45,7 +56,7 @@ func CheckTLS(host string) TLSResult {
 	}
 
 	// Check TLS 1.1 (weak)
-	if checkTLSVersion(addr, tls.VersionTLS11) {
+	if checkTLSVersion(ctx, addr, tls.VersionTLS11) {
 		result.SupportedVersions = append(result.SupportedVersions, "TLS1.1")
 		result.WeakVersions = append(result.WeakVersions, "TLS1.1")
 		result.Issues = append(result.Issues, "weak_tls_version_11")
@@ -53,27 +64,27 @@ func CheckTLS(host string) TLSResult {
 	}
 
 	// Check TLS 1.2 (good)
-	if checkTLSVersion(addr, tls.VersionTLS12) {
+	if checkTLSVersion(ctx, addr, tls.VersionTLS12) {
 		result.SupportedVersions = append(result.SupportedVersions, "TLS1.2")
 		result.HasHTTPS = true
 	}
 
 	// Check TLS 1.3 (best)
-	if checkTLSVersion(addr, tls.VersionTLS13) {
+	if checkTLSVersion(ctx, addr, tls.VersionTLS13) {
 		result.SupportedVersions = append(result.SupportedVersions, "TLS1.3")
 		result.HasHTTPS = true
 	}
 
 	// Get certificate info if HTTPS is available
-	if result.HasHTTPS {
-		extractCertificateInfo(addr, &result)
+	if result.HasHTTPS && ctx.Err() == nil {
+		extractCertificateInfo(ctx, addr, &result)
 	}
 
 	return result
 }
 
 // checkTLSVersion tests if a specific TLS version is supported
-func checkTLSVersion(addr string, version uint16) bool {
+func checkTLSVersion(ctx context.Context, addr string, version uint16) bool {
 	// Attempts a handshake pinned to one TLS version.
 	// Success means that version is supported by the target.
 	config := &tls.Config{
@@ -82,8 +93,10 @@ func checkTLSVersion(addr string, version uint16) bool {
 		MaxVersion:         version,
 	}
 
-	dialer := &net.Dialer{Timeout: 5 * time.Second}
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	if ctx.Err() != nil {
+		return false
+	}
+	conn, err := dialTLS(ctx, addr, config)
 	if err != nil {
 		return false
 	}
@@ -92,21 +105,20 @@ func checkTLSVersion(addr string, version uint16) bool {
 }
 
 // extractCertificateInfo retrieves and analyzes the server certificate
-func extractCertificateInfo(addr string, result *TLSResult) {
+func extractCertificateInfo(ctx context.Context, addr string, result *TLSResult) {
 	// Pulls certificate fields and flags expiry/not-yet-valid conditions.
 	config := &tls.Config{
 		InsecureSkipVerify: true,
 	}
 
-	dialer := &net.Dialer{Timeout: 5 * time.Second}
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	conn, err := dialTLS(ctx, addr, config)
 	if err != nil {
 		log.Printf("[tls] failed to connect to %s: %v", addr, err)
 		return
 	}
 	defer conn.Close()
 
-	state := conn.ConnectionState()
+	state := conn.(*tls.Conn).ConnectionState()
 	if len(state.PeerCertificates) == 0 {
 		return
 	}
@@ -136,3 +148,33 @@ func extractCertificateInfo(addr string, result *TLSResult) {
 		result.Issues = append(result.Issues, "certificate_not_yet_valid")
 	}
 }
+
+// dialTLS completes a handshake within 5 seconds, or sooner if ctx is done.
+// Handshakes are paced by the host's rate limit like HTTP requests and go
+// through the scan's proxy, if any. Hosts outside the scan's scope are refused.
+func dialTLS(ctx context.Context, addr string, config *tls.Config) (net.Conn, error) {
+	if !scope.AllowHost(ctx, addr) {
+		return nil, fmt.Errorf("%s is out of scope", addr)
+	}
+	if err := ratelimit.Wait(ctx, addr); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	raw, err := egress.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		ratelimit.Observe(ctx, addr, nil, err)
+		return nil, err
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	conn := tls.Client(raw, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		ratelimit.Observe(ctx, addr, nil, err)
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,277 @@
+// Package pause lets a running scan stop dispatching work and continue later.
+// Worker pools call Wait before each unit of work. While the scan is paused,
+// Wait records what the pool still has to do and blocks; the recorded queues
+// are written to disk so a restarted worker can pick up where the pool
+// stopped instead of starting the phase over.
+package pause
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the persisted pause state of one scan.
+type Checkpoint struct {
+	Paused bool                       `json:"paused"`
+	Queues map[string]json.RawMessage `json:"queues,omitempty"` // Remaining work per pool
+}
+
+// Controller pauses and resumes one scan.
+type Controller struct {
+	mu          sync.Mutex
+	paused      bool
+	pausedAt    time.Time     // Start of the pause in progress
+	pausedTotal time.Duration // Length of the pauses already over
+	resumed     chan struct{} // Closed while not paused
+	queues      map[string]json.RawMessage
+	save        func(Checkpoint) error
+}
+
+// NewController returns a controller starting from saved, e.g. a checkpoint
+// loaded after a restart. save, when set, is called with the new state on
+// every pause, resume and recorded queue.
+func NewController(saved Checkpoint, save func(Checkpoint) error) *Controller {
+	c := &Controller{
+		paused:  saved.Paused,
+		resumed: make(chan struct{}),
+		queues:  make(map[string]json.RawMessage, len(saved.Queues)),
+		save:    save,
+	}
+	for name, raw := range saved.Queues {
+		c.queues[name] = raw
+	}
+	if c.paused {
+		c.pausedAt = time.Now()
+	} else {
+		close(c.resumed)
+	}
+	return c
+}
+
+// Pause stops dispatch at the next Wait. It returns false when already paused.
+func (c *Controller) Pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return false
+	}
+	c.paused = true
+	c.pausedAt = time.Now()
+	c.resumed = make(chan struct{})
+	c.saveLocked()
+	return true
+}
+
+// Resume releases every blocked Wait. It returns false when not paused.
+func (c *Controller) Resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return false
+	}
+	c.paused = false
+	c.pausedTotal += time.Since(c.pausedAt)
+	close(c.resumed)
+	c.saveLocked()
+	return true
+}
+
+// Paused reports whether the scan is paused.
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// PausedFor returns how long the scan has been paused since the controller was
+// created, including the pause in progress. Deadlines add it so that time
+// spent paused does not count against them.
+func (c *Controller) PausedFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return c.pausedTotal + time.Since(c.pausedAt)
+	}
+	return c.pausedTotal
+}
+
+// Resumed returns a channel that is closed once the scan is not paused.
+func (c *Controller) Resumed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed
+}
+
+// Checkpoint returns the current state.
+func (c *Controller) Checkpoint() Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkpointLocked()
+}
+
+// Wait returns immediately unless the scan is paused. Otherwise it records the
+// result of snapshot as the remaining work of queue and blocks until Resume or
+// until ctx ends, returning ctx.Err() in that case. Every blocked worker of a
+// pool records the queue again, so the last one to stop leaves the most
+// recent state on disk.
+func (c *Controller) Wait(ctx context.Context, queue string, snapshot func() any) error {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return nil
+	}
+	if queue != "" && snapshot != nil {
+		if raw, err := json.Marshal(snapshot()); err != nil {
+			log.Printf("[pause] cannot record %s queue: %v", queue, err)
+		} else {
+			c.queues[queue] = raw
+			c.saveLocked()
+		}
+	}
+	resumed := c.resumed
+	c.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Restore decodes the recorded queue into v. It returns false when nothing
+// was recorded for queue or the record cannot be decoded.
+func (c *Controller) Restore(queue string, v any) bool {
+	c.mu.Lock()
+	raw, ok := c.queues[queue]
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		log.Printf("[pause] ignoring unreadable %s queue: %v", queue, err)
+		return false
+	}
+	return true
+}
+
+// Done drops the recorded queue once its pool has finished.
+func (c *Controller) Done(queue string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.queues[queue]; !ok {
+		return
+	}
+	delete(c.queues, queue)
+	c.saveLocked()
+}
+
+func (c *Controller) checkpointLocked() Checkpoint {
+	cp := Checkpoint{Paused: c.paused}
+	if len(c.queues) > 0 {
+		cp.Queues = make(map[string]json.RawMessage, len(c.queues))
+		for name, raw := range c.queues {
+			cp.Queues[name] = raw
+		}
+	}
+	return cp
+}
+
+func (c *Controller) saveLocked() {
+	if c.save == nil {
+		return
+	}
+	if err := c.save(c.checkpointLocked()); err != nil {
+		log.Printf("[pause] failed to save checkpoint: %v", err)
+	}
+}
+
+type controllerKey struct{}
+
+// WithController returns a context whose worker pools obey c.
+func WithController(ctx context.Context, c *Controller) context.Context {
+	return context.WithValue(ctx, controllerKey{}, c)
+}
+
+// FromContext returns the controller bound to ctx, or nil when none was set.
+func FromContext(ctx context.Context) *Controller {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(controllerKey{}).(*Controller)
+	return c
+}
+
+// Wait calls Wait on the controller bound to ctx; without one it returns nil.
+func Wait(ctx context.Context, queue string, snapshot func() any) error {
+	if c := FromContext(ctx); c != nil {
+		return c.Wait(ctx, queue, snapshot)
+	}
+	return nil
+}
+
+// PausedFor calls PausedFor on the controller bound to ctx; without one it
+// returns 0.
+func PausedFor(ctx context.Context) time.Duration {
+	if c := FromContext(ctx); c != nil {
+		return c.PausedFor()
+	}
+	return 0
+}
+
+// Restore calls Restore on the controller bound to ctx.
+func Restore(ctx context.Context, queue string, v any) bool {
+	if c := FromContext(ctx); c != nil {
+		return c.Restore(queue, v)
+	}
+	return false
+}
+
+// Done calls Done on the controller bound to ctx.
+func Done(ctx context.Context, queue string) {
+	if c := FromContext(ctx); c != nil {
+		c.Done(queue)
+	}
+}
+
+// LoadFile reads a checkpoint written by FileSaver. A missing file yields an
+// empty checkpoint.
+func LoadFile(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return Checkpoint{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// FileSaver returns a save function that writes checkpoints to path,
+// replacing the file atomically.
+func FileSaver(path string) func(Checkpoint) error {
+	return func(cp Checkpoint) error {
+		data, err := json.Marshal(cp)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+}
@@ -0,0 +1,135 @@
+package pause
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitWithoutControllerReturnsImmediately(t *testing.T) {
+	if err := Wait(context.Background(), "probe", func() any { return 1 }); err != nil {
+		t.Fatalf("Wait() = %v, want nil", err)
+	}
+	var v int
+	if Restore(context.Background(), "probe", &v) {
+		t.Fatal("Restore() without controller returned true")
+	}
+}
+
+func TestWaitBlocksWhilePaused(t *testing.T) {
+	var saved []Checkpoint
+	c := NewController(Checkpoint{}, func(cp Checkpoint) error {
+		saved = append(saved, cp)
+		return nil
+	})
+	ctx := WithController(context.Background(), c)
+
+	if !c.Pause() || c.Pause() {
+		t.Fatal("Pause() should succeed once")
+	}
+
+	released := make(chan error, 1)
+	go func() {
+		released <- Wait(ctx, "network", func() any { return []string{"a.example.com", "b.example.com"} })
+	}()
+
+	select {
+	case err := <-released:
+		t.Fatalf("Wait() returned %v while paused", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var remaining []string
+	if !Restore(ctx, "network", &remaining) || len(remaining) != 2 {
+		t.Fatalf("recorded queue = %v, want 2 hosts", remaining)
+	}
+
+	if !c.Resume() || c.Resume() {
+		t.Fatal("Resume() should succeed once")
+	}
+	select {
+	case err := <-released:
+		if err != nil {
+			t.Fatalf("Wait() = %v after resume", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not return after Resume")
+	}
+
+	last := saved[len(saved)-1]
+	if last.Paused || len(last.Queues["network"]) == 0 {
+		t.Fatalf("last saved checkpoint = %+v, want resumed with the network queue", last)
+	}
+
+	Done(ctx, "network")
+	if Restore(ctx, "network", &remaining) {
+		t.Fatal("queue still recorded after Done")
+	}
+}
+
+func TestWaitReturnsWhenContextEnds(t *testing.T) {
+	c := NewController(Checkpoint{Paused: true}, nil)
+	ctx, cancel := context.WithCancel(WithController(context.Background(), c))
+	cancel()
+	if err := Wait(ctx, "crawl", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() = %v, want context.Canceled", err)
+	}
+}
+
+func TestCheckpointFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints", "scan_7.json")
+
+	if cp, err := LoadFile(path); err != nil || cp.Paused {
+		t.Fatalf("LoadFile(missing) = %+v, %v", cp, err)
+	}
+
+	c := NewController(Checkpoint{}, FileSaver(path))
+	c.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = c.Wait(ctx, "probe", func() any { return map[string]int{"left": 3} })
+
+	cp, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewController(cp, nil)
+	if !restored.Paused() {
+		t.Fatal("controller from checkpoint is not paused")
+	}
+	var q map[string]int
+	if !restored.Restore("probe", &q) || q["left"] != 3 {
+		t.Fatalf("restored probe queue = %v", q)
+	}
+}
+
+func TestPausedForCountsOnlyPausedTime(t *testing.T) {
+	c := NewController(Checkpoint{}, nil)
+	if got := c.PausedFor(); got != 0 {
+		t.Fatalf("PausedFor() = %s before any pause", got)
+	}
+
+	c.Pause()
+	time.Sleep(20 * time.Millisecond)
+	if got := c.PausedFor(); got < 20*time.Millisecond {
+		t.Fatalf("PausedFor() = %s during a pause of 20ms", got)
+	}
+	c.Resume()
+	total := c.PausedFor()
+	time.Sleep(20 * time.Millisecond)
+	if got := c.PausedFor(); got != total {
+		t.Fatalf("PausedFor() grew from %s to %s while running", total, got)
+	}
+
+	// A controller restored paused counts from its creation.
+	restored := NewController(Checkpoint{Paused: true}, nil)
+	time.Sleep(10 * time.Millisecond)
+	if got := restored.PausedFor(); got < 10*time.Millisecond {
+		t.Fatalf("restored PausedFor() = %s", got)
+	}
+	if got := PausedFor(context.Background()); got != 0 {
+		t.Fatalf("PausedFor without controller = %s", got)
+	}
+}
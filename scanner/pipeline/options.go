@@ -0,0 +1,395 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"recon/dnsutil"
+	"recon/egress"
+	"recon/endpoints"
+	"recon/enum"
+	"recon/network"
+	"recon/probe"
+	"recon/ratelimit"
+	"recon/recon"
+)
+
+// Endpoint discovery tools that can be selected per scan.
+const (
+	ToolCrawl  = "crawl"
+	ToolGau    = "gau"
+	ToolKatana = "katana"
+)
+
+// Network checks that can be selected per scan.
+const (
+	CheckPorts       = "ports"
+	CheckTLS         = "tls"
+	CheckDirectories = "directories"
+)
+
+// Options selects the stages of one scan and overrides their settings. Zero
+// values keep the worker defaults, which come from environment variables.
+type Options struct {
+	Phases     []string         `json:"phases,omitempty"` // Stage names to run; dependencies are added automatically
+	Subdomains SubdomainOptions `json:"subdomains"`
+	Probe      ProbeOptions     `json:"probe"`
+	Endpoints  EndpointOptions  `json:"endpoints"`
+	Network    NetworkOptions   `json:"network"`
+	Deadlines  DeadlineOptions  `json:"deadlines"`
+	RateLimit  RateLimitOptions `json:"rate_limit"`
+	Proxy      string           `json:"proxy,omitempty"` // http, https, socks5 or socks5h URL for all scan traffic; empty uses the worker default
+}
+
+// SubdomainOptions overrides subdomain enumeration.
+type SubdomainOptions struct {
+	Sources         []string `json:"sources,omitempty"`          // Subset of subfinder, amass, assetfinder, crt, bruteforce; empty uses every installed one
+	TimeoutSeconds  int      `json:"timeout_seconds,omitempty"`  // Per source
+	Resolvers       []string `json:"resolvers,omitempty"`        // DNS servers for brute-forcing, ip or ip:port; empty uses the worker default
+	DNSQPS          int      `json:"dns_qps,omitempty"`          // DNS queries per second across the resolvers
+	Permutations    *bool    `json:"permutations,omitempty"`     // Resolve permutations of the names found (api -> api-dev, api2 -> api3)
+	MaxPermutations int      `json:"max_permutations,omitempty"` // Cap on permutation candidates resolved
+	Recursive       *bool    `json:"recursive,omitempty"`        // Enumerate discovered sub-zones (names with NS records or many children)
+	RecursionDepth  int      `json:"recursion_depth,omitempty"`  // Levels of sub-zones below the target
+	MaxHosts        int      `json:"max_hosts,omitempty"`        // Host budget after which recursion stops
+}
+
+// ProbeOptions overrides host liveness probing.
+type ProbeOptions struct {
+	Workers            int   `json:"workers,omitempty"`
+	HTTPTimeoutSeconds int   `json:"http_timeout_seconds,omitempty"`
+	DNSTimeoutSeconds  int   `json:"dns_timeout_seconds,omitempty"`
+	UseHttpx           *bool `json:"use_httpx,omitempty"`
+}
+
+// EndpointOptions overrides endpoint discovery and probing.
+type EndpointOptions struct {
+	Tools              []string `json:"tools,omitempty"` // Subset of crawl, gau, katana
+	CrawlDepth         int      `json:"crawl_depth,omitempty"`
+	CrawlMaxPages      int      `json:"crawl_max_pages,omitempty"`
+	KatanaDepth        int      `json:"katana_depth,omitempty"`
+	KatanaMaxPages     int      `json:"katana_max_pages,omitempty"`
+	MaxURLsPerHost     int      `json:"max_urls_per_host,omitempty"`
+	DiscoveryWorkers   int      `json:"discovery_workers,omitempty"`
+	ToolTimeoutSeconds int      `json:"tool_timeout_seconds,omitempty"`
+	ProbeWorkers       int      `json:"probe_workers,omitempty"`
+	RPS                int      `json:"rps,omitempty"`
+	IncludeSubdomains  *bool    `json:"include_subdomains,omitempty"`
+}
+
+// NetworkOptions overrides network analysis.
+type NetworkOptions struct {
+	Checks                 []string `json:"checks,omitempty"` // Subset of ports, tls, directories
+	TopPorts               int      `json:"top_ports,omitempty"`
+	Workers                int      `json:"workers,omitempty"`
+	PortScanTimeoutSeconds int      `json:"port_scan_timeout_seconds,omitempty"`
+	Timing                 string   `json:"timing,omitempty"` // nmap timing template, see network.NmapTimings
+	UDP                    *bool    `json:"udp,omitempty"`
+	MaxRate                int      `json:"max_rate,omitempty"`        // nmap packets per second
+	DirectoryPaths         []string `json:"directory_paths,omitempty"` // Replaces the built-in sensitive path list
+}
+
+// DeadlineOptions bounds how long a scan and its phases may run. A phase that
+// runs out of time keeps its partial results and the scan moves on.
+type DeadlineOptions struct {
+	MaxDurationSeconds int            `json:"max_duration_seconds,omitempty"` // Whole scan, from when it starts running
+	PhaseSeconds       map[string]int `json:"phase_seconds,omitempty"`        // Per phase name
+}
+
+// MaxDuration returns the overall scan limit, or 0 for none.
+func (d DeadlineOptions) MaxDuration() time.Duration {
+	return time.Duration(d.MaxDurationSeconds) * time.Second
+}
+
+// Budgets returns the per-phase limits for pipeline.RunOptions.
+func (d DeadlineOptions) Budgets() map[string]time.Duration {
+	if len(d.PhaseSeconds) == 0 {
+		return nil
+	}
+	out := make(map[string]time.Duration, len(d.PhaseSeconds))
+	for phase, secs := range d.PhaseSeconds {
+		out[phase] = time.Duration(secs) * time.Second
+	}
+	return out
+}
+
+// RateLimitOptions is the scan's request budget per target host, shared by
+// every phase. It applies on top of the worker-wide limit, so it can only
+// make a scan slower.
+type RateLimitOptions struct {
+	RequestsPerSecond int `json:"requests_per_second,omitempty"` // Per host; 0 leaves only the worker-wide limit
+	Burst             int `json:"burst,omitempty"`
+}
+
+// Config returns the limiter settings for this scan.
+func (r RateLimitOptions) Config() ratelimit.Config {
+	return ratelimit.Config{RequestsPerSecond: float64(r.RequestsPerSecond), Burst: r.Burst}
+}
+
+// ProxyURL returns the scan's proxy, or nil when it uses the worker default.
+// Call Validate first; an invalid URL is treated as unset.
+func (o Options) ProxyURL() *url.URL {
+	if o.Proxy == "" {
+		return nil
+	}
+	u, err := egress.Parse(o.Proxy)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func (o Options) proxyURL() *url.URL {
+	// The proxy the scan's traffic will actually use.
+	if u := o.ProxyURL(); u != nil {
+		return u
+	}
+	return egress.FromContext(context.Background())
+}
+
+// ValidationError lists every problem found in a set of options.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid options: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks phase names, tool and check names, and numeric ranges.
+func (o Options) Validate() error {
+	var problems []string
+	bad := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	checkRange := func(field string, v, max int) {
+		if v < 0 || v > max {
+			bad("%s must be between 0 and %d, got %d", field, max, v)
+		}
+	}
+
+	registry := DefaultRegistry()
+	for _, phase := range o.Phases {
+		if _, ok := registry.Lookup(phase); !ok {
+			bad("unknown phase %q (valid: %s)", phase, strings.Join(registry.Names(), ", "))
+		}
+	}
+
+	for _, source := range o.Subdomains.Sources {
+		if !containsString(enum.Sources, source) {
+			bad("unknown subdomains.sources entry %q (valid: %s)", source, strings.Join(enum.Sources, ", "))
+		}
+	}
+	checkRange("subdomains.timeout_seconds", o.Subdomains.TimeoutSeconds, 3600)
+	for _, resolver := range o.Subdomains.Resolvers {
+		if _, err := dnsutil.ParseResolver(resolver); err != nil {
+			bad("subdomains.resolvers: %v", err)
+		}
+	}
+	checkRange("subdomains.dns_qps", o.Subdomains.DNSQPS, 10000)
+	checkRange("subdomains.max_permutations", o.Subdomains.MaxPermutations, 100000)
+	checkRange("subdomains.recursion_depth", o.Subdomains.RecursionDepth, 5)
+	checkRange("subdomains.max_hosts", o.Subdomains.MaxHosts, 100000)
+
+	checkRange("probe.workers", o.Probe.Workers, 500)
+	checkRange("probe.http_timeout_seconds", o.Probe.HTTPTimeoutSeconds, 300)
+	checkRange("probe.dns_timeout_seconds", o.Probe.DNSTimeoutSeconds, 300)
+
+	for _, tool := range o.Endpoints.Tools {
+		switch tool {
+		case ToolCrawl, ToolGau, ToolKatana:
+		default:
+			bad("unknown endpoints.tools entry %q (valid: crawl, gau, katana)", tool)
+		}
+	}
+	checkRange("endpoints.crawl_depth", o.Endpoints.CrawlDepth, 20)
+	checkRange("endpoints.crawl_max_pages", o.Endpoints.CrawlMaxPages, 10000)
+	checkRange("endpoints.katana_depth", o.Endpoints.KatanaDepth, 10)
+	checkRange("endpoints.katana_max_pages", o.Endpoints.KatanaMaxPages, 10000)
+	checkRange("endpoints.max_urls_per_host", o.Endpoints.MaxURLsPerHost, 100000)
+	checkRange("endpoints.discovery_workers", o.Endpoints.DiscoveryWorkers, 100)
+	checkRange("endpoints.tool_timeout_seconds", o.Endpoints.ToolTimeoutSeconds, 3600)
+	checkRange("endpoints.probe_workers", o.Endpoints.ProbeWorkers, 500)
+	checkRange("endpoints.rps", o.Endpoints.RPS, 1000)
+
+	for _, check := range o.Network.Checks {
+		switch check {
+		case CheckPorts, CheckTLS, CheckDirectories:
+		default:
+			bad("unknown network.checks entry %q (valid: ports, tls, directories)", check)
+		}
+	}
+	checkRange("network.top_ports", o.Network.TopPorts, 65535)
+	checkRange("network.workers", o.Network.Workers, 100)
+	checkRange("network.port_scan_timeout_seconds", o.Network.PortScanTimeoutSeconds, 3600)
+	checkRange("network.max_rate", o.Network.MaxRate, 100000)
+	if t := o.Network.Timing; t != "" && !containsString(network.NmapTimings, t) {
+		bad("unknown network.timing %q (valid: %s)", t, strings.Join(network.NmapTimings, ", "))
+	}
+	for _, path := range o.Network.DirectoryPaths {
+		if !strings.HasPrefix(path, "/") {
+			bad("network.directory_paths entry %q must start with /", path)
+		}
+	}
+
+	checkRange("rate_limit.requests_per_second", o.RateLimit.RequestsPerSecond, 1000)
+	checkRange("rate_limit.burst", o.RateLimit.Burst, 1000)
+	if o.Proxy != "" {
+		if _, err := egress.Parse(o.Proxy); err != nil {
+			bad("proxy: %v", err)
+		}
+	}
+
+	const week = 7 * 24 * 3600
+	checkRange("deadlines.max_duration_seconds", o.Deadlines.MaxDurationSeconds, week)
+	for _, phase := range sortedKeys(o.Deadlines.PhaseSeconds) {
+		if _, ok := registry.Lookup(phase); !ok {
+			bad("unknown deadlines.phase_seconds phase %q (valid: %s)", phase, strings.Join(registry.Names(), ", "))
+			continue
+		}
+		checkRange("deadlines.phase_seconds."+phase, o.Deadlines.PhaseSeconds[phase], week)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Registry returns the built-in stages configured with these options on top
+// of the worker defaults.
+func (o Options) Registry() *Registry {
+	// DNS collection shares the scan's resolver pool with brute-forcing.
+	subdomains := o.subdomainStage()
+	return NewRegistry(
+		subdomains,
+		&ProbeStage{Options: o.probeOptions(), Persist: true},
+		&DNSStage{Client: subdomains.DNS, Persist: true},
+		&EndpointStage{Config: o.endpointConfig()},
+		&FingerprintStage{},
+		o.networkStage(),
+	)
+}
+
+// Plan validates the options and builds the pipeline for the selected phases.
+func (o Options) Plan() (*Pipeline, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return o.Registry().Plan(o.Phases...)
+}
+
+func (o Options) subdomainStage() *SubdomainStage {
+	s := o.Subdomains
+	stage := &SubdomainStage{
+		Sources: s.Sources,
+		Timeout: time.Duration(s.TimeoutSeconds) * time.Second,
+	}
+	if len(s.Resolvers) > 0 || s.DNSQPS > 0 {
+		// The scan gets its own resolver pool; invalid resolvers were reported
+		// by Validate, so a failure here keeps the worker default.
+		stage.DNS, _ = dnsutil.New(dnsutil.Config{Resolvers: s.Resolvers, QPS: s.DNSQPS})
+	}
+	if s.Recursive != nil && *s.Recursive {
+		stage.Recursion = &enum.Recursion{Depth: s.RecursionDepth, MaxHosts: s.MaxHosts, Client: stage.DNS}
+	}
+	if s.Permutations != nil && *s.Permutations {
+		stage.Permutations = &enum.Permutations{MaxCandidates: s.MaxPermutations, Client: stage.DNS, Timeout: stage.Timeout}
+	}
+	return stage
+}
+
+func (o Options) probeOptions() *probe.ProbeOptions {
+	p := o.Probe
+	if p == (ProbeOptions{}) {
+		return nil
+	}
+	opts := recon.DefaultJobProbeOptions(recon.Job{Workers: p.Workers})
+	if p.HTTPTimeoutSeconds > 0 {
+		opts.HTTPTimeout = time.Duration(p.HTTPTimeoutSeconds) * time.Second
+		opts.HttpxTimeout = p.HTTPTimeoutSeconds
+	}
+	if p.DNSTimeoutSeconds > 0 {
+		opts.DNSTimeout = time.Duration(p.DNSTimeoutSeconds) * time.Second
+	}
+	if p.UseHttpx != nil {
+		opts.UseHttpx = *p.UseHttpx
+	}
+	return opts
+}
+
+func (o Options) endpointConfig() *endpoints.ScanConfig {
+	e := o.Endpoints
+	cfg := endpoints.DefaultScanConfig()
+	d := cfg.Discovery
+
+	if len(e.Tools) > 0 {
+		d.UseRecursiveCrawl = containsString(e.Tools, ToolCrawl)
+		d.UseGau = containsString(e.Tools, ToolGau)
+		d.UseKatana = containsString(e.Tools, ToolKatana)
+	}
+	setIfPositive(&d.RecursiveDepth, e.CrawlDepth)
+	setIfPositive(&d.RecursiveMaxPages, e.CrawlMaxPages)
+	setIfPositive(&d.KatanaDepth, e.KatanaDepth)
+	setIfPositive(&d.KatanaMaxPages, e.KatanaMaxPages)
+	setIfPositive(&d.MaxURLsPerHost, e.MaxURLsPerHost)
+	setIfPositive(&d.Workers, e.DiscoveryWorkers)
+	if e.ToolTimeoutSeconds > 0 {
+		d.Timeout = time.Duration(e.ToolTimeoutSeconds) * time.Second
+	}
+	if e.IncludeSubdomains != nil {
+		d.IncludeSubdomains = *e.IncludeSubdomains
+	}
+	setIfPositive(&cfg.ProbeWorkers, e.ProbeWorkers)
+	setIfPositive(&cfg.ProbeRPS, e.RPS)
+	return cfg
+}
+
+func (o Options) networkStage() *NetworkStage {
+	n := o.Network
+	stage := &NetworkStage{
+		Workers: n.Workers,
+		Nmap: network.NmapOptions{
+			TopPorts:    n.TopPorts,
+			HostTimeout: time.Duration(n.PortScanTimeoutSeconds) * time.Second,
+			Timing:      n.Timing,
+			UDP:         n.UDP != nil && *n.UDP,
+			MaxRate:     n.MaxRate,
+		},
+		DirectoryPaths: n.DirectoryPaths,
+	}
+	if len(n.Checks) > 0 {
+		stage.SkipPorts = !containsString(n.Checks, CheckPorts)
+		stage.SkipTLS = !containsString(n.Checks, CheckTLS)
+		stage.SkipDirectories = !containsString(n.Checks, CheckDirectories)
+	}
+	return stage
+}
+
+func setIfPositive(dst *int, v int) {
+	if v > 0 {
+		*dst = v
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,468 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"recon/pause"
+)
+
+// Key names a typed artifact stored in a State. Stages declare the keys they
+// consume and produce; the registry wires them into a DAG from those names.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey declares an artifact key.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// Name returns the artifact name used for DAG wiring.
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Get returns the artifact stored under k.
+func Get[T any](st *State, k Key[T]) (T, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	v, ok := st.artifacts[k.name].(T)
+	return v, ok
+}
+
+// Put stores an artifact under k, replacing any previous value.
+func Put[T any](st *State, k Key[T], v T) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.artifacts[k.name] = v
+}
+
+// State is the shared blackboard a pipeline run reads from and writes to.
+type State struct {
+	ScanID int64
+	Target string
+	UserID int64
+
+	// Events receives streaming results and progress messages as stages run.
+	Events Events
+
+	mu        sync.RWMutex
+	artifacts map[string]any
+}
+
+// NewState creates an empty state for one scan.
+func NewState(scanID int64, target string, userID int64) *State {
+	return &State{
+		ScanID:    scanID,
+		Target:    target,
+		UserID:    userID,
+		artifacts: make(map[string]any),
+	}
+}
+
+// Has reports whether an artifact with the given name is present.
+func (st *State) Has(name string) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	_, ok := st.artifacts[name]
+	return ok
+}
+
+// Stage is one unit of scan work. Inputs and Outputs are artifact names.
+type Stage interface {
+	Name() string
+	Inputs() []string
+	Outputs() []string
+	Run(ctx context.Context, st *State) error
+}
+
+// Restorer is implemented by stages whose outputs can be reloaded from the
+// artifacts of an earlier run (e.g. after a worker restart) instead of re-running.
+type Restorer interface {
+	Restore(ctx context.Context, st *State) error
+}
+
+// StageError reports which stage stopped a run.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Registry holds the stages available to pipelines, in registration order.
+type Registry struct {
+	stages []Stage
+	byName map[string]Stage
+}
+
+// NewRegistry creates a registry with the given stages.
+func NewRegistry(stages ...Stage) *Registry {
+	r := &Registry{byName: make(map[string]Stage)}
+	for _, s := range stages {
+		r.Register(s)
+	}
+	return r
+}
+
+// Register adds a stage, replacing any stage registered under the same name.
+func (r *Registry) Register(s Stage) {
+	if _, exists := r.byName[s.Name()]; exists {
+		for i, old := range r.stages {
+			if old.Name() == s.Name() {
+				r.stages[i] = s
+			}
+		}
+	} else {
+		r.stages = append(r.stages, s)
+	}
+	r.byName[s.Name()] = s
+}
+
+// Lookup returns the stage registered under name.
+func (r *Registry) Lookup(name string) (Stage, bool) {
+	s, ok := r.byName[name]
+	return s, ok
+}
+
+// Names returns registered stage names in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.stages))
+	for _, s := range r.stages {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// Plan builds a pipeline for the named stages (all stages when none are given).
+// Stages producing a selected stage's inputs are pulled in automatically and
+// the result is ordered topologically, ties broken by registration order.
+func (r *Registry) Plan(names ...string) (*Pipeline, error) {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+
+	producers := make(map[string]Stage)
+	for _, s := range r.stages {
+		for _, out := range s.Outputs() {
+			if prev, ok := producers[out]; ok {
+				return nil, fmt.Errorf("artifact %q produced by both %s and %s", out, prev.Name(), s.Name())
+			}
+			producers[out] = s
+		}
+	}
+
+	// Resolve the dependency closure of the requested stages.
+	selected := make(map[string]Stage)
+	var visit func(name, from string) error
+	visit = func(name, from string) error {
+		if _, ok := selected[name]; ok {
+			return nil
+		}
+		s, ok := r.byName[name]
+		if !ok {
+			if from != "" {
+				return fmt.Errorf("stage %q (required by %s) is not registered", name, from)
+			}
+			return fmt.Errorf("unknown stage %q", name)
+		}
+		selected[name] = s
+		for _, in := range s.Inputs() {
+			p, ok := producers[in]
+			if !ok {
+				return fmt.Errorf("stage %s needs artifact %q but no stage produces it", name, in)
+			}
+			if err := visit(p.Name(), name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(strings.TrimSpace(name), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	// Kahn's algorithm over the selected stages.
+	order := make(map[string]int, len(r.stages))
+	for i, s := range r.stages {
+		order[s.Name()] = i
+	}
+	indegree := make(map[string]int, len(selected))
+	dependents := make(map[string][]string)
+	for name, s := range selected {
+		deps := make(map[string]struct{})
+		for _, in := range s.Inputs() {
+			deps[producers[in].Name()] = struct{}{}
+		}
+		delete(deps, name)
+		indegree[name] = len(deps)
+		for dep := range deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	ready := make([]string, 0)
+	for name, deg := range indegree {
+		if deg == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	stages := make([]Stage, 0, len(selected))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return order[ready[i]] < order[ready[j]] })
+		name := ready[0]
+		ready = ready[1:]
+		stages = append(stages, selected[name])
+		for _, next := range dependents[name] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if len(stages) != len(selected) {
+		return nil, errors.New("stage dependencies contain a cycle")
+	}
+
+	return &Pipeline{stages: stages}, nil
+}
+
+// Pipeline is an ordered, validated set of stages.
+type Pipeline struct {
+	stages []Stage
+}
+
+// Stages returns the stage names in execution order.
+func (p *Pipeline) Stages() []string {
+	names := make([]string, 0, len(p.stages))
+	for _, s := range p.stages {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// Includes reports whether the pipeline runs the named stage.
+func (p *Pipeline) Includes(name string) bool {
+	for _, s := range p.stages {
+		if s.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RunOptions customizes a pipeline run.
+type RunOptions struct {
+	// Completed lists stages finished by an earlier run. Stages implementing
+	// Restorer reload their outputs instead of running; if restoring fails the
+	// stage runs normally.
+	Completed []string
+
+	// OnStageStart is called before each stage runs or is restored.
+	OnStageStart func(stage string)
+
+	// OnStageDone is called after a stage succeeded. restored is true when its
+	// outputs came from an earlier run.
+	OnStageDone func(stage string, restored bool)
+
+	// Stop, once closed, ends the run before the next stage starts; the stage
+	// in progress finishes normally. Run then returns ErrStopped.
+	Stop <-chan struct{}
+
+	// Budgets limits how long each named stage may run. A stage that runs out
+	// is cut short, keeps whatever outputs it produced and the run moves on.
+	Budgets map[string]time.Duration
+
+	// Deadline, when set, ends the run: the stage in progress is cut short like
+	// an exhausted budget and later stages are skipped.
+	//
+	// Budgets and Deadline stop counting while the pause controller bound to
+	// ctx is paused: the time spent paused is added to them.
+	Deadline time.Time
+
+	// OnTruncated is called for every stage cut short or skipped by Budgets or
+	// Deadline.
+	OnTruncated func(Truncation)
+}
+
+// Reasons a stage was truncated.
+const (
+	TruncatedByBudget   = "phase_budget"
+	TruncatedByDeadline = "max_duration"
+)
+
+// Truncation describes a stage cut short by its budget or the run deadline.
+type Truncation struct {
+	Stage   string
+	Reason  string        // TruncatedByBudget or TruncatedByDeadline
+	Limit   time.Duration // The budget, or the time left until the deadline when the stage started
+	Skipped bool          // The deadline passed before the stage started
+}
+
+// ErrStopped is returned (inside a *StageError naming the stage that did not
+// start) when RunOptions.Stop is closed.
+var ErrStopped = errors.New("pipeline stopped before stage")
+
+// Run executes the stages in order. It stops at the first failing stage, when
+// ctx is cancelled or when opts.Stop is closed, returning a *StageError naming
+// that stage. While the pause controller bound to ctx is paused, the next
+// stage waits. Stages truncated by opts.Budgets or opts.Deadline do not count
+// as failures.
+func (p *Pipeline) Run(ctx context.Context, st *State, opts RunOptions) error {
+	completed := make(map[string]struct{}, len(opts.Completed))
+	for _, name := range opts.Completed {
+		completed[name] = struct{}{}
+	}
+	// deadline is opts.Deadline pushed back by the time paused since the run started.
+	pausedAtStart := pause.PausedFor(ctx)
+	deadline := func() time.Time {
+		return opts.Deadline.Add(pause.PausedFor(ctx) - pausedAtStart)
+	}
+
+	for i, s := range p.stages {
+		// A paused scan does not start its next stage until resumed.
+		if c := pause.FromContext(ctx); c != nil {
+			select {
+			case <-c.Resumed():
+			case <-opts.Stop:
+				return &StageError{Stage: s.Name(), Err: ErrStopped}
+			case <-ctx.Done():
+				return &StageError{Stage: s.Name(), Err: ctx.Err()}
+			}
+		}
+		if !opts.Deadline.IsZero() && !time.Now().Before(deadline()) {
+			for _, skipped := range p.stages[i:] {
+				opts.truncated(Truncation{Stage: skipped.Name(), Reason: TruncatedByDeadline, Skipped: true})
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return &StageError{Stage: s.Name(), Err: err}
+		}
+		select {
+		case <-opts.Stop:
+			return &StageError{Stage: s.Name(), Err: ErrStopped}
+		default:
+		}
+		if opts.OnStageStart != nil {
+			opts.OnStageStart(s.Name())
+		}
+
+		restored := false
+		if _, done := completed[s.Name()]; done {
+			if r, ok := s.(Restorer); ok {
+				if err := r.Restore(ctx, st); err != nil {
+					log.Printf("[pipeline] scan %d: cannot restore stage %s, re-running: %v", st.ScanID, s.Name(), err)
+				} else {
+					restored = true
+				}
+			}
+		}
+
+		if !restored {
+			stageCtx, cancel, limit := opts.stageContext(ctx, s.Name(), deadline())
+			err := s.Run(stageCtx, st)
+			truncated := stageCtx.Err() != nil && ctx.Err() == nil
+			cancel()
+			// Stages may stop early on cancellation; their outputs are then partial.
+			if err := ctx.Err(); err != nil {
+				return &StageError{Stage: s.Name(), Err: err}
+			}
+			if err != nil && !truncated {
+				return &StageError{Stage: s.Name(), Err: err}
+			}
+			if truncated {
+				log.Printf("[pipeline] scan %d: stage %s cut short by %s (%s)", st.ScanID, s.Name(), limit.Reason, limit.Limit)
+				opts.truncated(limit)
+			}
+		}
+
+		for _, out := range s.Outputs() {
+			if !st.Has(out) {
+				return &StageError{Stage: s.Name(), Err: fmt.Errorf("did not produce artifact %q", out)}
+			}
+		}
+		if opts.OnStageDone != nil {
+			opts.OnStageDone(s.Name(), restored)
+		}
+	}
+	return nil
+}
+
+func (o RunOptions) stageContext(ctx context.Context, stage string, runDeadline time.Time) (context.Context, context.CancelFunc, Truncation) {
+	// Applies the stage budget or the run deadline, whichever ends first.
+	limit := Truncation{Stage: stage}
+	var deadline time.Time
+	if budget := o.Budgets[stage]; budget > 0 {
+		deadline = time.Now().Add(budget)
+		limit.Reason, limit.Limit = TruncatedByBudget, budget
+	}
+	if !o.Deadline.IsZero() && (deadline.IsZero() || runDeadline.Before(deadline)) {
+		deadline = runDeadline
+		limit.Reason, limit.Limit = TruncatedByDeadline, time.Until(runDeadline).Round(time.Second)
+	}
+	if deadline.IsZero() {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, limit
+	}
+	ctx, cancel := withPausableDeadline(ctx, deadline)
+	return ctx, cancel, limit
+}
+
+func withPausableDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	// Like context.WithDeadline, except that the deadline moves back by the time
+	// the pause controller bound to ctx spends paused.
+	c := pause.FromContext(ctx)
+	if c == nil {
+		return context.WithDeadline(ctx, deadline)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	pausedAtStart := c.PausedFor()
+	go func() {
+		for {
+			if c.Paused() {
+				select {
+				case <-c.Resumed():
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			wait := time.Until(deadline.Add(c.PausedFor() - pausedAtStart))
+			if wait <= 0 {
+				cancel(context.DeadlineExceeded)
+				return
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+func (o RunOptions) truncated(t Truncation) {
+	if o.OnTruncated != nil {
+		o.OnTruncated(t)
+	}
+}
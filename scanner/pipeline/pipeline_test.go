@@ -0,0 +1,527 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"recon/dnsutil"
+	"recon/dnsutil/dnstest"
+	"recon/endpoints"
+	"recon/enum"
+	"recon/pause"
+	"recon/recon"
+	"recon/scope"
+)
+
+var (
+	keyB = NewKey[int]("b")
+	keyC = NewKey[int]("c")
+)
+
+// fakeStage adds one to each input and stores the sum under its outputs.
+type fakeStage struct {
+	name    string
+	inputs  []string
+	outputs []string
+	ran     *[]string
+	err     error
+}
+
+func (f *fakeStage) Name() string      { return f.name }
+func (f *fakeStage) Inputs() []string  { return f.inputs }
+func (f *fakeStage) Outputs() []string { return f.outputs }
+
+func (f *fakeStage) Run(ctx context.Context, st *State) error {
+	*f.ran = append(*f.ran, f.name)
+	if f.err != nil {
+		return f.err
+	}
+	sum := 1
+	for _, in := range f.inputs {
+		v, _ := Get(st, NewKey[int](in))
+		sum += v
+	}
+	for _, out := range f.outputs {
+		Put(st, NewKey[int](out), sum)
+	}
+	return nil
+}
+
+// slowStage stores a partial output and waits for its context to end.
+type slowStage struct{ fakeStage }
+
+func (s *slowStage) Run(ctx context.Context, st *State) error {
+	*s.ran = append(*s.ran, s.name)
+	for _, out := range s.outputs {
+		Put(st, NewKey[int](out), -1)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type restoringStage struct{ fakeStage }
+
+func (r *restoringStage) Restore(ctx context.Context, st *State) error {
+	*r.ran = append(*r.ran, "restore:"+r.name)
+	for _, out := range r.outputs {
+		Put(st, NewKey[int](out), 100)
+	}
+	return nil
+}
+
+func TestPlanOrdersStagesAndPullsInDependencies(t *testing.T) {
+	var ran []string
+	// Registered out of order on purpose.
+	reg := NewRegistry(
+		&fakeStage{name: "third", inputs: []string{"b"}, outputs: []string{"c"}, ran: &ran},
+		&fakeStage{name: "first", outputs: []string{"a"}, ran: &ran},
+		&fakeStage{name: "second", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+		&fakeStage{name: "side", inputs: []string{"a"}, outputs: []string{"d"}, ran: &ran},
+	)
+
+	plan, err := reg.Plan("third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plan.Stages(), []string{"first", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stages = %v, want %v", got, want)
+	}
+
+	st := NewState(1, "example.com", 1)
+	if err := plan.Run(context.Background(), st, RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := Get(st, keyC); c != 3 {
+		t.Fatalf("c = %d, want 3", c)
+	}
+
+	full, err := reg.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ready stages run in registration order, so "third" precedes "side".
+	if got, want := full.Stages(), []string{"first", "second", "third", "side"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("full stages = %v, want %v", got, want)
+	}
+}
+
+func TestPlanRejectsUnknownStagesMissingProducersAndCycles(t *testing.T) {
+	var ran []string
+	if _, err := NewRegistry(&fakeStage{name: "x", ran: &ran}).Plan("nope"); err == nil {
+		t.Fatal("expected unknown stage error")
+	}
+	if _, err := NewRegistry(&fakeStage{name: "x", inputs: []string{"missing"}, ran: &ran}).Plan(); err == nil {
+		t.Fatal("expected missing producer error")
+	}
+	cyclic := NewRegistry(
+		&fakeStage{name: "x", inputs: []string{"b"}, outputs: []string{"a"}, ran: &ran},
+		&fakeStage{name: "y", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+	)
+	if _, err := cyclic.Plan(); err == nil {
+		t.Fatal("expected cycle error")
+	}
+}
+
+func TestRunRestoresCompletedStagesAndReportsFailures(t *testing.T) {
+	var ran []string
+	boom := errors.New("boom")
+	reg := NewRegistry(
+		&restoringStage{fakeStage{name: "first", outputs: []string{"a"}, ran: &ran}},
+		&fakeStage{name: "second", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+		&fakeStage{name: "third", inputs: []string{"b"}, outputs: []string{"c"}, ran: &ran, err: boom},
+	)
+	plan, err := reg.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var done []string
+	st := NewState(1, "example.com", 1)
+	err = plan.Run(context.Background(), st, RunOptions{
+		Completed:   []string{"first"},
+		OnStageDone: func(stage string, restored bool) { done = append(done, stage) },
+	})
+
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "third" || !errors.Is(err, boom) {
+		t.Fatalf("expected failure in third, got %v", err)
+	}
+	if want := []string{"restore:first", "second", "third"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran = %v, want %v", ran, want)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(done, want) {
+		t.Fatalf("done = %v, want %v", done, want)
+	}
+	if b, _ := Get(st, keyB); b != 101 {
+		t.Fatalf("b = %d, want restored value + 1", b)
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	var ran []string
+	plan, err := NewRegistry(&fakeStage{name: "first", outputs: []string{"a"}, ran: &ran}).Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = plan.Run(ctx, NewState(1, "example.com", 1), RunOptions{})
+	if !errors.Is(err, context.Canceled) || len(ran) != 0 {
+		t.Fatalf("expected cancellation before running, got err=%v ran=%v", err, ran)
+	}
+}
+
+func TestDefaultRegistryWiresBuiltInStages(t *testing.T) {
+	plan, err := DefaultRegistry().Plan(StageNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plan.Stages(), []string{StageSubdomains, StageProbe, StageNetwork}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("network plan = %v, want %v", got, want)
+	}
+
+	full, err := DefaultRegistry().Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{StageSubdomains, StageProbe, StageDNS, StageEndpoints, StageFingerprint, StageNetwork}
+	if got := full.Stages(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("full plan = %v, want %v", got, want)
+	}
+}
+
+func TestSummarizeTechnologiesGroupsByHost(t *testing.T) {
+	got := SummarizeTechnologies([]endpoints.EndpointResult{
+		{URL: "https://a.example.com/", Fingerprints: []string{"nginx", "2xx", "html"}},
+		{URL: "https://a.example.com/login", Fingerprints: []string{"PHP"}, Headers: map[string]string{"CF-RAY": "1"}},
+		{URL: "https://b.example.com/api", Fingerprints: []string{"json-api"}},
+	})
+	want := []HostTechnologies{
+		{Host: "a.example.com", Technologies: []string{"cloudflare", "nginx", "php"}, Endpoints: 2},
+		{Host: "b.example.com", Technologies: []string{}, Endpoints: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("summary = %+v, want %+v", got, want)
+	}
+}
+
+func TestNetworkStageSkipsOutOfScopeHosts(t *testing.T) {
+	engine, err := scope.New(scope.Rules{}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := scope.WithEngine(context.Background(), engine)
+
+	st := NewState(1, "127.0.0.1", 1)
+	var analyzed []string
+	st.Events.HostAnalyzed = func(host string) { analyzed = append(analyzed, host) }
+	Put(st, KeySubdomains, []recon.SubdomainResult{
+		{Name: "127.0.0.1", IPs: []string{"127.0.0.1"}, Alive: true},
+		{Name: "10.0.0.1", IPs: []string{"10.0.0.1"}, Alive: true},
+	})
+
+	stage := &NetworkStage{SkipPorts: true, SkipTLS: true, SkipDirectories: true}
+	if err := stage.Run(ctx, st); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(analyzed, []string{"127.0.0.1"}) {
+		t.Fatalf("analyzed %v, want only the in-scope target", analyzed)
+	}
+}
+
+func TestSubdomainStageDegradesWhenASourceFails(t *testing.T) {
+	ct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"common_name": "api.example.com", "name_value": "api.example.com\nexample.com"}]`))
+	}))
+	defer ct.Close()
+
+	st := NewState(1, "example.com", 1)
+	var warnings []string
+	st.Events.Log = func(message, level string) {
+		if level == "warning" {
+			warnings = append(warnings, message)
+		}
+	}
+	stage := &SubdomainStage{Enumerators: []enum.Enumerator{
+		&enum.Amass{BinaryPath: filepath.Join(t.TempDir(), "amass")},
+		&enum.CertTransparency{BaseURL: ct.URL},
+	}}
+	if err := stage.Run(context.Background(), st); err != nil {
+		t.Fatalf("a failing source must not fail the stage: %v", err)
+	}
+
+	hosts, _ := Get(st, KeyHosts)
+	if want := []string{"example.com", "api.example.com"}; !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("hosts = %v, want %v", hosts, want)
+	}
+	sources, _ := Get(st, KeyHostSources)
+	if want := []string{recon.SourceTarget, enum.SourceCRT}; !reflect.DeepEqual(sources["example.com"], want) {
+		t.Fatalf("example.com sources = %v, want %v", sources["example.com"], want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "amass") {
+		t.Fatalf("warnings = %v, want one about amass", warnings)
+	}
+}
+
+func TestSubdomainStageAddsResolvingPermutations(t *testing.T) {
+	ct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"common_name": "api2.example.com", "name_value": "api2.example.com"}]`))
+	}))
+	defer ct.Close()
+	srv := dnstest.NewServer(t)
+	srv.Add("api3.example.com", dnsutil.TypeA, 60, "192.0.2.3")
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{srv.Addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewState(1, "example.com", 1)
+	stage := &SubdomainStage{
+		Enumerators:  []enum.Enumerator{&enum.CertTransparency{BaseURL: ct.URL}},
+		Permutations: &enum.Permutations{Words: []string{}, Client: client},
+	}
+	if err := stage.Run(context.Background(), st); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, _ := Get(st, KeyHosts)
+	if want := []string{"example.com", "api2.example.com", "api3.example.com"}; !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("hosts = %v, want %v", hosts, want)
+	}
+	sources, _ := Get(st, KeyHostSources)
+	if want := []string{enum.SourcePermutation}; !reflect.DeepEqual(sources["api3.example.com"], want) {
+		t.Fatalf("api3.example.com sources = %v, want %v", sources["api3.example.com"], want)
+	}
+}
+
+func TestDNSStageAttachesAndStreamsRecords(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("www.example.com", dnsutil.TypeCNAME, 300, "edge.example.net")
+	srv.Add("edge.example.net", dnsutil.TypeA, 60, "192.0.2.7")
+	srv.Add("example.com", dnsutil.TypeMX, 3600, "10 mx.example.com")
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{srv.Addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewState(1, "example.com", 1)
+	var mu sync.Mutex
+	streamed := make(map[string]dnsutil.HostRecords)
+	st.Events.DNS = func(rec dnsutil.HostRecords) {
+		mu.Lock()
+		defer mu.Unlock()
+		streamed[rec.Name] = rec
+	}
+	Put(st, KeySubdomains, []recon.SubdomainResult{{Name: "example.com"}, {Name: "www.example.com"}, {Name: "10.0.0.1"}})
+
+	if err := (&DNSStage{Client: client}).Run(context.Background(), st); err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 2 || len(streamed["example.com"].MX) != 1 {
+		t.Fatalf("streamed = %+v", streamed)
+	}
+	if probed, _ := Get(st, KeySubdomains); probed[1].DNS != nil {
+		t.Fatal("the probe stage's subdomains must not be changed")
+	}
+	subs, _ := Get(st, KeyDNSSubdomains)
+	if www := subs[1].DNS; www == nil || len(www.CNAMEChain) != 1 || www.A[0].Value != "192.0.2.7" {
+		t.Fatalf("www.example.com records = %+v", www)
+	}
+	if subs[2].DNS != nil {
+		t.Fatal("IP hosts have no records to collect")
+	}
+	if records, _ := Get(st, KeyDNS); len(records) != 2 {
+		t.Fatalf("records = %+v", records)
+	}
+}
+
+func TestRunStopsBetweenStagesWhenAsked(t *testing.T) {
+	var ran []string
+	stop := make(chan struct{})
+	reg := NewRegistry(
+		&fakeStage{name: "first", outputs: []string{"a"}, ran: &ran},
+		&fakeStage{name: "second", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+	)
+	plan, err := reg.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = plan.Run(context.Background(), NewState(1, "example.com", 1), RunOptions{
+		OnStageDone: func(stage string, restored bool) { close(stop) },
+		Stop:        stop,
+	})
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "second" || !errors.Is(err, ErrStopped) {
+		t.Fatalf("expected stop before second, got %v", err)
+	}
+	if want := []string{"first"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran = %v, want %v", ran, want)
+	}
+}
+
+func TestRunTruncatesStagesOverBudget(t *testing.T) {
+	var ran []string
+	var truncated []Truncation
+	reg := NewRegistry(
+		&slowStage{fakeStage{name: "first", outputs: []string{"a"}, ran: &ran}},
+		&fakeStage{name: "second", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+	)
+	plan, err := reg.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewState(1, "example.com", 1)
+	err = plan.Run(context.Background(), st, RunOptions{
+		Budgets:     map[string]time.Duration{"first": 20 * time.Millisecond},
+		OnTruncated: func(tr Truncation) { truncated = append(truncated, tr) },
+	})
+	if err != nil {
+		t.Fatalf("truncated stage must not fail the run: %v", err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran = %v, want %v", ran, want)
+	}
+	if b, _ := Get(st, keyB); b != 0 {
+		t.Fatalf("second stage should see the partial output, got b = %d", b)
+	}
+	if len(truncated) != 1 || truncated[0].Stage != "first" || truncated[0].Reason != TruncatedByBudget {
+		t.Fatalf("unexpected truncations: %+v", truncated)
+	}
+}
+
+func TestDNSStagePausesAndResumesItsQueue(t *testing.T) {
+	srv := dnstest.NewServer(t)
+	srv.Add("www.example.com", dnsutil.TypeA, 60, "192.0.2.7")
+	client, err := dnsutil.New(dnsutil.Config{Resolvers: []string{srv.Addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs := []recon.SubdomainResult{{Name: "example.com"}, {Name: "www.example.com"}}
+
+	// Paused before the first lookup: the stage records every host as remaining
+	// and stops when the scan is cancelled.
+	c := pause.NewController(pause.Checkpoint{}, nil)
+	c.Pause()
+	ctx, cancel := context.WithCancel(pause.WithController(context.Background(), c))
+	st := NewState(1, "example.com", 1)
+	Put(st, KeySubdomains, subs)
+	done := make(chan error, 1)
+	go func() { done <- (&DNSStage{Client: client}).Run(ctx, st) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Checkpoint().Queues[dnsQueueName] == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	var q dnsQueue
+	if err := json.Unmarshal(c.Checkpoint().Queues[dnsQueueName], &q); err != nil || len(q.Remaining) != 2 || len(q.Records) != 0 {
+		t.Fatalf("paused queue = %+v (%v)", q, err)
+	}
+
+	// After a restart only the remaining host is looked up again.
+	raw, _ := json.Marshal(dnsQueue{Remaining: []string{"www.example.com"}, Records: []dnsutil.HostRecords{{Name: "example.com", NotFound: true}}})
+	c = pause.NewController(pause.Checkpoint{Queues: map[string]json.RawMessage{dnsQueueName: raw}}, nil)
+	st = NewState(1, "example.com", 1)
+	Put(st, KeySubdomains, subs)
+	var streamed []string
+	st.Events.DNS = func(rec dnsutil.HostRecords) { streamed = append(streamed, rec.Name) }
+	if err := (&DNSStage{Client: client}).Run(pause.WithController(context.Background(), c), st); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"www.example.com"}; !reflect.DeepEqual(streamed, want) {
+		t.Fatalf("streamed = %v, want %v", streamed, want)
+	}
+	resumed, _ := Get(st, KeyDNSSubdomains)
+	if resumed[0].DNS == nil || !resumed[0].DNS.NotFound || resumed[1].DNS == nil || len(resumed[1].DNS.A) != 1 {
+		t.Fatalf("resumed records = %+v, %+v", resumed[0].DNS, resumed[1].DNS)
+	}
+	if _, ok := c.Checkpoint().Queues[dnsQueueName]; ok {
+		t.Fatal("finished stage left its queue in the checkpoint")
+	}
+}
+
+func TestRunStopsDeadlinesWhilePaused(t *testing.T) {
+	var ran []string
+	var truncated []Truncation
+	reg := NewRegistry(
+		&slowStage{fakeStage{name: "first", outputs: []string{"a"}, ran: &ran}},
+		&fakeStage{name: "second", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+	)
+	plan, err := reg.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := pause.NewController(pause.Checkpoint{}, nil)
+	ctx := pause.WithController(context.Background(), c)
+	var started time.Time
+	err = plan.Run(ctx, NewState(1, "example.com", 1), RunOptions{
+		Budgets:  map[string]time.Duration{"first": 50 * time.Millisecond},
+		Deadline: time.Now().Add(150 * time.Millisecond),
+		OnStageStart: func(stage string) {
+			if stage == "first" {
+				// Paused for longer than both the budget and the deadline.
+				started = time.Now()
+				c.Pause()
+				time.AfterFunc(300*time.Millisecond, func() { c.Resume() })
+			}
+		},
+		OnTruncated: func(tr Truncation) { truncated = append(truncated, tr) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 300*time.Millisecond {
+		t.Fatalf("budget ran out after %s, while the scan was paused", elapsed)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran = %v, want %v: the deadline must not count the pause", ran, want)
+	}
+	if len(truncated) != 1 || truncated[0].Reason != TruncatedByBudget {
+		t.Fatalf("unexpected truncations: %+v", truncated)
+	}
+}
+
+func TestRunSkipsStagesAfterDeadline(t *testing.T) {
+	var ran []string
+	var truncated []Truncation
+	reg := NewRegistry(
+		&slowStage{fakeStage{name: "first", outputs: []string{"a"}, ran: &ran}},
+		&fakeStage{name: "second", inputs: []string{"a"}, outputs: []string{"b"}, ran: &ran},
+		&fakeStage{name: "third", inputs: []string{"b"}, outputs: []string{"c"}, ran: &ran},
+	)
+	plan, err := reg.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = plan.Run(context.Background(), NewState(1, "example.com", 1), RunOptions{
+		Budgets:     map[string]time.Duration{"first": time.Hour},
+		Deadline:    time.Now().Add(20 * time.Millisecond),
+		OnTruncated: func(tr Truncation) { truncated = append(truncated, tr) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("ran = %v, want %v", ran, want)
+	}
+	if len(truncated) != 3 || truncated[0].Reason != TruncatedByDeadline || truncated[0].Skipped ||
+		!truncated[1].Skipped || !truncated[2].Skipped {
+		t.Fatalf("unexpected truncations: %+v", truncated)
+	}
+}
@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"recon/network"
+)
+
+// DefaultProfile is used when a scan request does not name a profile.
+const DefaultProfile = "standard"
+
+// Profile is a named bundle of scan options that users pick instead of tuning
+// every setting themselves.
+type Profile struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Options     Options `json:"options"`
+}
+
+// Profiles is the set of scan profiles known to the worker.
+type Profiles struct {
+	byName map[string]Profile
+	order  []string
+}
+
+// BuiltinProfiles returns the profiles shipped with the worker.
+func BuiltinProfiles() *Profiles {
+	udp := true
+	deepPaths := append(network.DefaultSensitivePaths(),
+		"/.svn/",
+		"/.DS_Store",
+		"/.aws/credentials",
+		"/config.json",
+		"/phpinfo.php",
+		"/debug/",
+		"/console",
+		"/graphql",
+		"/metrics",
+		"/wp-admin/",
+	)
+
+	p := &Profiles{byName: make(map[string]Profile)}
+	for _, profile := range []Profile{
+		{
+			Name:        "quick",
+			Description: "Shallow crawl only (no gau/katana) and the top 100 ports",
+			Options: Options{
+				Probe:     ProbeOptions{HTTPTimeoutSeconds: 5},
+				Endpoints: EndpointOptions{Tools: []string{ToolCrawl}, CrawlDepth: 2, CrawlMaxPages: 100},
+				Network:   NetworkOptions{TopPorts: 100, PortScanTimeoutSeconds: 120},
+			},
+		},
+		{
+			Name:        DefaultProfile,
+			Description: "Worker defaults for every phase",
+		},
+		{
+			Name:        "deep",
+			Description: "Recursive crawl depth 8, top 1000 TCP and UDP ports and an extended directory list",
+			Options: Options{
+				Endpoints: EndpointOptions{
+					CrawlDepth:         8,
+					CrawlMaxPages:      2000,
+					KatanaDepth:        5,
+					MaxURLsPerHost:     5000,
+					ToolTimeoutSeconds: 600,
+				},
+				Network: NetworkOptions{
+					TopPorts:               1000,
+					UDP:                    &udp,
+					PortScanTimeoutSeconds: 1200,
+					DirectoryPaths:         deepPaths,
+				},
+			},
+		},
+		{
+			Name:        "stealth",
+			Description: "Low concurrency, 1 request per second per host and polite nmap timing; skips directory checks",
+			Options: Options{
+				Probe: ProbeOptions{Workers: 5, HTTPTimeoutSeconds: 15},
+				Endpoints: EndpointOptions{
+					Tools:            []string{ToolCrawl},
+					CrawlDepth:       2,
+					DiscoveryWorkers: 1,
+					ProbeWorkers:     2,
+					RPS:              1,
+				},
+				Network: NetworkOptions{
+					Checks:   []string{CheckPorts, CheckTLS},
+					TopPorts: 100,
+					Workers:  1,
+					Timing:   "polite",
+					MaxRate:  20,
+				},
+				RateLimit: RateLimitOptions{RequestsPerSecond: 1},
+			},
+		},
+	} {
+		p.put(profile)
+	}
+	return p
+}
+
+// LoadProfiles returns the built-in profiles plus those defined in the JSON
+// file at path, which replace built-ins of the same name. A missing file is
+// not an error.
+func LoadProfiles(path string) (*Profiles, error) {
+	p := BuiltinProfiles()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Profiles []Profile `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, profile := range file.Profiles {
+		if err := p.Add(profile); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+// Add validates a profile and registers it, replacing any profile with the
+// same name.
+func (p *Profiles) Add(profile Profile) error {
+	if profile.Name == "" {
+		return errors.New("profile without a name")
+	}
+	if err := profile.Options.Validate(); err != nil {
+		return fmt.Errorf("profile %q: %w", profile.Name, err)
+	}
+	p.put(profile)
+	return nil
+}
+
+func (p *Profiles) put(profile Profile) {
+	if _, exists := p.byName[profile.Name]; !exists {
+		p.order = append(p.order, profile.Name)
+	}
+	p.byName[profile.Name] = profile
+}
+
+// Lookup returns the profile with the given name.
+func (p *Profiles) Lookup(name string) (Profile, bool) {
+	profile, ok := p.byName[name]
+	return profile, ok
+}
+
+// List returns every profile in the order it was first registered.
+func (p *Profiles) List() []Profile {
+	out := make([]Profile, 0, len(p.order))
+	for _, name := range p.order {
+		out = append(out, p.byName[name])
+	}
+	return out
+}
+
+// Resolve applies override on top of the named profile (DefaultProfile when
+// name is empty) and validates the result.
+func (p *Profiles) Resolve(name string, override Options) (Options, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profile, ok := p.byName[name]
+	if !ok {
+		return Options{}, &ValidationError{Problems: []string{fmt.Sprintf("unknown profile %q", name)}}
+	}
+	merged := profile.Options.Merge(override)
+	if err := merged.Validate(); err != nil {
+		return Options{}, err
+	}
+	return merged, nil
+}
+
+// Merge returns o with every field that is set in override replaced. Zero
+// numbers, empty strings and nil slices or pointers count as unset.
+func (o Options) Merge(override Options) Options {
+	out := o
+	overlay(reflect.ValueOf(&out).Elem(), reflect.ValueOf(override))
+	return out
+}
+
+func overlay(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Field(i)
+		if field.Kind() == reflect.Struct {
+			overlay(dst.Field(i), field)
+			continue
+		}
+		if !field.IsZero() {
+			dst.Field(i).Set(field)
+		}
+	}
+}
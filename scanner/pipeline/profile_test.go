@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuiltinProfilesAreValid(t *testing.T) {
+	p := BuiltinProfiles()
+	var names []string
+	for _, profile := range p.List() {
+		names = append(names, profile.Name)
+		if err := profile.Options.Validate(); err != nil {
+			t.Errorf("profile %s: %v", profile.Name, err)
+		}
+	}
+	if want := []string{"quick", "standard", "deep", "stealth"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("profiles = %v, want %v", names, want)
+	}
+
+	deep, _ := p.Lookup("deep")
+	ns := deep.Options.networkStage()
+	if ns.Nmap.TopPorts != 1000 || !ns.Nmap.UDP {
+		t.Fatalf("deep network settings = %+v", ns.Nmap)
+	}
+	if cfg := deep.Options.endpointConfig(); cfg.Discovery.RecursiveDepth != 8 {
+		t.Fatalf("deep crawl depth = %d, want 8", cfg.Discovery.RecursiveDepth)
+	}
+	// Permutations and recursion multiply DNS queries; no built-in profile
+	// turns them on.
+	for _, profile := range p.List() {
+		if sub := profile.Options.Subdomains; sub.Permutations != nil || sub.Recursive != nil {
+			t.Errorf("profile %s enables permutations or recursion", profile.Name)
+		}
+	}
+
+	quick, _ := p.Lookup("quick")
+	if cfg := quick.Options.endpointConfig(); cfg.Discovery.UseGau || cfg.Discovery.UseKatana {
+		t.Fatalf("quick must not run gau or katana: %+v", cfg.Discovery)
+	}
+}
+
+func TestResolveAppliesOverridesOnTopOfProfile(t *testing.T) {
+	p := BuiltinProfiles()
+	udp := false
+	opts, err := p.Resolve("deep", Options{
+		Phases:  []string{StageNetwork},
+		Network: NetworkOptions{TopPorts: 300, UDP: &udp},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Network.TopPorts != 300 || *opts.Network.UDP {
+		t.Fatalf("overrides not applied: %+v", opts.Network)
+	}
+	if opts.Endpoints.CrawlDepth != 8 || len(opts.Network.DirectoryPaths) == 0 {
+		t.Fatalf("profile settings lost: %+v", opts)
+	}
+	if !reflect.DeepEqual(opts.Phases, []string{StageNetwork}) {
+		t.Fatalf("phases = %v", opts.Phases)
+	}
+
+	if opts, err := p.Resolve("", Options{}); err != nil || !reflect.DeepEqual(opts, Options{}) {
+		t.Fatalf("empty profile should resolve to standard, got %+v, %v", opts, err)
+	}
+
+	var verr *ValidationError
+	if _, err := p.Resolve("turbo", Options{}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for unknown profile, got %v", err)
+	}
+	if _, err := p.Resolve("quick", Options{Network: NetworkOptions{Timing: "fast"}}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for bad override, got %v", err)
+	}
+}
+
+func TestLoadProfilesFromFile(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := LoadProfiles(filepath.Join(dir, "missing.json"))
+	if err != nil || len(p.List()) != 4 {
+		t.Fatalf("missing file should yield built-ins, got %v", err)
+	}
+
+	path := filepath.Join(dir, "profiles.json")
+	data := `{"profiles": [
+		{"name": "quick", "description": "ports only", "options": {"phases": ["network"], "network": {"checks": ["ports"]}}},
+		{"name": "internal", "options": {"network": {"top_ports": 10}}}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err = LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, profile := range p.List() {
+		names = append(names, profile.Name)
+	}
+	if want := []string{"quick", "standard", "deep", "stealth", "internal"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("profiles = %v, want %v", names, want)
+	}
+	quick, _ := p.Lookup("quick")
+	if quick.Description != "ports only" || quick.Options.Network.TopPorts != 0 {
+		t.Fatalf("file profile should replace built-in, got %+v", quick)
+	}
+
+	bad := `{"profiles": [{"name": "broken", "options": {"phases": ["nope"]}}]}`
+	if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfiles(path); err == nil {
+		t.Fatal("expected invalid profile to be rejected")
+	}
+}
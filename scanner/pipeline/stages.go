@@ -0,0 +1,797 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"recon/dnsutil"
+	"recon/endpoints"
+	"recon/enum"
+	"recon/fingerprint"
+	"recon/network"
+	"recon/pause"
+	"recon/probe"
+	"recon/recon"
+	"recon/scope"
+)
+
+// Built-in stage names. They double as phase names in the scan registry and
+// job journal.
+const (
+	StageSubdomains  = "subdomains"
+	StageProbe       = "probe"
+	StageDNS         = "dns"
+	StageEndpoints   = "endpoints"
+	StageFingerprint = "fingerprint"
+	StageNetwork     = "network"
+)
+
+// Artifacts exchanged by the built-in stages.
+var (
+	KeyHosts        = NewKey[[]string]("hosts")
+	KeySubdomains   = NewKey[[]recon.SubdomainResult]("subdomains")
+	KeyDNS          = NewKey[[]dnsutil.HostRecords]("dns_records")
+	KeyEndpoints    = NewKey[[]endpoints.EndpointResult]("endpoints")
+	KeyTechnologies = NewKey[[]HostTechnologies]("technologies")
+	KeyNetwork      = NewKey[NetworkSummary]("network")
+
+	// KeyHostSources maps each host to the sources that reported it. The
+	// subdomain stage adds it; probing works without it.
+	KeyHostSources = NewKey[map[string][]string]("host_sources")
+
+	// KeyDNSSubdomains is KeySubdomains with each host's DNS records attached.
+	// The DNS stage adds it; the other stages keep reading KeySubdomains.
+	KeyDNSSubdomains = NewKey[[]recon.SubdomainResult]("subdomains_with_dns")
+
+	// KeyDiscoveryAuth optionally carries login settings for endpoint discovery.
+	// It is seeded by the caller rather than produced by a stage.
+	KeyDiscoveryAuth = NewKey[*endpoints.DiscoveryAuthConfig]("discovery_auth")
+)
+
+// Events receives streaming results and progress from stages. Nil fields are
+// ignored; handlers may be called concurrently.
+type Events struct {
+	Log          func(message, level string)
+	Subdomain    func(recon.SubdomainResult)
+	DNS          func(dnsutil.HostRecords)
+	Endpoint     func(endpoints.EndpointResult)
+	Technologies func(HostTechnologies)
+	Ports        func(host string, findings []network.PortFinding)
+	TLS          func(network.TLSResult)
+	Directories  func(host string, findings []network.DirectoryFinding)
+	HostAnalyzed func(host string)
+	Error        func(err error) // Non-fatal errors, e.g. one host failing a check
+}
+
+func (e Events) log(message, level string) {
+	if e.Log != nil {
+		e.Log(message, level)
+	}
+}
+
+func (e Events) error(err error) {
+	if e.Error != nil {
+		e.Error(err)
+	}
+}
+
+func (e Events) dropped(ctx context.Context) {
+	// Summarizes the items the scope dropped since the last summary, one line
+	// per rule; each item is logged by the scope engine.
+	for _, d := range scope.TakeDrops(ctx) {
+		e.log(fmt.Sprintf("🚧 Dropped %d out-of-scope %ss (%s)", d.Count, d.Kind, d.Rule), "info")
+	}
+}
+
+// scopedSubdomains drops subdomains outside the scan's scope, judged by the
+// addresses they resolved to.
+func scopedSubdomains(ctx context.Context, subs []recon.SubdomainResult) []recon.SubdomainResult {
+	if scope.FromContext(ctx) == nil {
+		return subs
+	}
+	out := make([]recon.SubdomainResult, 0, len(subs))
+	for _, sub := range subs {
+		if scope.AllowResolved(ctx, sub.Name, sub.IPs) {
+			out = append(out, sub)
+		}
+	}
+	return out
+}
+
+// HostTechnologies summarizes the technologies seen across a host's endpoints.
+type HostTechnologies struct {
+	Host         string   `json:"host"`
+	Technologies []string `json:"technologies"`
+	Endpoints    int      `json:"endpoints"`
+}
+
+// NetworkSummary counts the findings of the network stage.
+type NetworkSummary struct {
+	Hosts             int `json:"hosts"`
+	HostsAnalyzed     int `json:"hosts_analyzed"`
+	OpenPorts         int `json:"open_ports"`
+	TLSIssues         int `json:"tls_issues"`
+	DirectoryFindings int `json:"directory_findings"`
+}
+
+// DefaultRegistry returns the built-in stages with default settings, in the
+// order a full scan runs them.
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		&SubdomainStage{},
+		&ProbeStage{Persist: true},
+		&DNSStage{Persist: true},
+		&EndpointStage{},
+		&FingerprintStage{},
+		&NetworkStage{},
+	)
+}
+
+// ---------------- SUBDOMAINS ----------------
+
+// SubdomainStage derives host candidates for the target (enumeration sources
+// run concurrently for public domains, local fallbacks for localhost/IP
+// targets). A failing source is reported and the scan goes on without it.
+// Unlike recon.HandleJob it does not probe hosts while enumeration runs: the
+// probe phase starts on the complete, scope-filtered host list.
+type SubdomainStage struct {
+	Subfinder    *enum.SubfinderOptions // nil uses recon defaults
+	Sources      []string               // Subset of enum.Sources; empty runs all of them
+	Timeout      time.Duration          // Per source; 0 uses the enum default
+	DNS          *dnsutil.Client        // Resolver pool for brute-forcing; nil uses dnsutil.Default
+	Enumerators  []enum.Enumerator      // Replaces Sources when set, e.g. with test stand-ins
+	Recursion    *enum.Recursion        // Enumerates discovered sub-zones too; nil only enumerates the target
+	Permutations *enum.Permutations     // Resolves permutations of the names found; nil skips them
+}
+
+func (s *SubdomainStage) Name() string      { return StageSubdomains }
+func (s *SubdomainStage) Inputs() []string  { return nil }
+func (s *SubdomainStage) Outputs() []string { return []string{KeyHosts.Name()} }
+
+func (s *SubdomainStage) Run(ctx context.Context, st *State) error {
+	st.Events.log(fmt.Sprintf("🔍 Starting subdomain enumeration for %s...", st.Target), "info")
+	sources := s.Enumerators
+	if sources == nil {
+		sources = enum.NewSources(s.Sources, enum.Options{Timeout: s.Timeout, Subfinder: s.Subfinder, DNS: s.DNS})
+	}
+	job := recon.Job{ScanID: st.ScanID, Target: st.Target, UserID: st.UserID, Ctx: ctx, Recurse: s.Recursion, Permute: s.Permutations}
+	found, failed, err := recon.PrepareHostSources(job, sources)
+	if err != nil {
+		return err
+	}
+	for _, f := range failed {
+		st.Events.log(fmt.Sprintf("⚠️ Subdomain source %s failed, continuing without it: %v", f.Source, f.Err), "warning")
+	}
+
+	hosts := make([]string, 0, len(found))
+	hostSources := make(map[string][]string, len(found))
+	for _, f := range found {
+		hosts = append(hosts, f.Name)
+		hostSources[f.Name] = f.Sources
+	}
+	inScope := scope.FilterHosts(ctx, hosts)
+	st.Events.dropped(ctx)
+	Put(st, KeyHosts, inScope)
+	Put(st, KeyHostSources, hostSources)
+	return nil
+}
+
+// Restore rebuilds the host list from the saved subdomain artifact.
+func (s *SubdomainStage) Restore(ctx context.Context, st *State) error {
+	subs, _, err := recon.LoadSubdomainsForScan(st.UserID, st.ScanID, st.Target)
+	if err != nil {
+		return err
+	}
+	subs = scopedSubdomains(ctx, subs)
+	hosts := make([]string, 0, len(subs))
+	hostSources := make(map[string][]string, len(subs))
+	for _, sub := range subs {
+		hosts = append(hosts, sub.Name)
+		hostSources[sub.Name] = sub.Sources
+	}
+	Put(st, KeyHosts, hosts)
+	Put(st, KeyHostSources, hostSources)
+	return nil
+}
+
+// ---------------- PROBE ----------------
+
+// ProbeStage checks DNS and HTTP liveness for every host, streaming each result.
+type ProbeStage struct {
+	Options *probe.ProbeOptions // nil uses recon.DefaultJobProbeOptions
+	Persist bool                // Save the subdomain artifact for later phases
+}
+
+func (s *ProbeStage) Name() string      { return StageProbe }
+func (s *ProbeStage) Inputs() []string  { return []string{KeyHosts.Name()} }
+func (s *ProbeStage) Outputs() []string { return []string{KeySubdomains.Name()} }
+
+func (s *ProbeStage) Run(ctx context.Context, st *State) error {
+	hosts, _ := Get(st, KeyHosts)
+	hosts = scope.FilterHosts(ctx, hosts)
+	hostSources, _ := Get(st, KeyHostSources)
+	job := recon.Job{ScanID: st.ScanID, Target: st.Target, UserID: st.UserID, Callback: st.Events.Subdomain, Ctx: ctx, Sources: hostSources}
+	if stream := st.Events.Subdomain; stream != nil && scope.FromContext(ctx) != nil {
+		// A host may resolve to an address the scope denies; it is not reported.
+		job.Callback = func(sub recon.SubdomainResult) {
+			if scope.AllowResolved(ctx, sub.Name, sub.IPs) {
+				stream(sub)
+			}
+		}
+	}
+
+	var subs []recon.SubdomainResult
+	if s.Persist {
+		subs = recon.ProbeJobHosts(job, hosts, s.Options)
+	} else {
+		subs = recon.ProbeJobHostResults(job, hosts, s.Options)
+	}
+	subs = scopedSubdomains(ctx, subs)
+	st.Events.dropped(ctx)
+	Put(st, KeySubdomains, subs)
+
+	aliveCount := 0
+	for _, sub := range subs {
+		if sub.Alive {
+			aliveCount++
+		}
+	}
+	st.Events.log(fmt.Sprintf("✅ Subdomain enumeration complete: found %d subdomains (%d alive)", len(subs), aliveCount), "success")
+	return nil
+}
+
+// Restore reloads probe results saved before a worker restart.
+func (s *ProbeStage) Restore(ctx context.Context, st *State) error {
+	subs, _, err := recon.LoadSubdomainsForScan(st.UserID, st.ScanID, st.Target)
+	if err != nil {
+		return err
+	}
+	subs = scopedSubdomains(ctx, subs)
+	Put(st, KeySubdomains, subs)
+	st.Events.log(fmt.Sprintf("♻️ Reusing %d subdomains from before the worker restart", len(subs)), "info")
+	return nil
+}
+
+// ---------------- DNS ----------------
+
+// defaultDNSWorkers is how many hosts DNSStage collects at once.
+const defaultDNSWorkers = 20
+
+// DNSStage collects the full DNS records of every probed host (CNAME chain,
+// A/AAAA, MX, NS, TXT, CAA, SOA), streams them and attaches them to copies of
+// the subdomain results.
+type DNSStage struct {
+	Client  *dnsutil.Client // nil uses dnsutil.Default
+	Workers int             // Hosts collected at once (default 20)
+	Persist bool            // Save the records with the subdomain artifact
+}
+
+func (s *DNSStage) Name() string      { return StageDNS }
+func (s *DNSStage) Inputs() []string  { return []string{KeySubdomains.Name()} }
+func (s *DNSStage) Outputs() []string { return []string{KeyDNS.Name(), KeyDNSSubdomains.Name()} }
+
+func (s *DNSStage) Run(ctx context.Context, st *State) error {
+	subs, _ := Get(st, KeySubdomains)
+	subs = append([]recon.SubdomainResult(nil), subs...)
+	client := s.Client
+	if client == nil {
+		client = dnsutil.Default()
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = defaultDNSWorkers
+	}
+	st.Events.log(fmt.Sprintf("🧾 Collecting DNS records for %d hosts...", len(subs)), "info")
+
+	records := make([]*dnsutil.HostRecords, len(subs))
+	var mu sync.Mutex
+
+	// A scan paused before a restart recorded the hosts it had left and the
+	// records already collected, which were streamed back then.
+	var restored dnsQueue
+	var remaining map[string]bool
+	if pause.Restore(ctx, dnsQueueName, &restored) {
+		remaining = make(map[string]bool, len(restored.Remaining))
+		for _, name := range restored.Remaining {
+			remaining[name] = true
+		}
+		collected := make(map[string]dnsutil.HostRecords, len(restored.Records))
+		for _, rec := range restored.Records {
+			collected[rec.Name] = rec
+		}
+		for i, sub := range subs {
+			if rec, ok := collected[sub.Name]; ok {
+				records[i] = &rec
+			}
+		}
+		log.Printf("[dns] resuming paused collection, %d hosts left", len(remaining))
+	}
+	snapshot := func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		q := dnsQueue{Remaining: []string{}, Records: []dnsutil.HostRecords{}}
+		for i, sub := range subs {
+			switch {
+			case records[i] != nil:
+				q.Records = append(q.Records, *records[i])
+			case net.ParseIP(sub.Name) == nil && (remaining == nil || remaining[sub.Name]):
+				q.Remaining = append(q.Remaining, sub.Name)
+			}
+		}
+		return q
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+dispatch:
+	for i, sub := range subs {
+		if ctx.Err() != nil {
+			break
+		}
+		if net.ParseIP(sub.Name) != nil {
+			continue // IP targets have no names to look up
+		}
+		if records[i] != nil || (remaining != nil && !remaining[sub.Name]) {
+			continue // Collected before the pause
+		}
+		if err := pause.Wait(ctx, dnsQueueName, snapshot); err != nil {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rec := client.Collect(ctx, name)
+			mu.Lock()
+			records[i] = rec
+			mu.Unlock()
+			if st.Events.DNS != nil {
+				st.Events.DNS(*rec)
+			}
+		}(i, sub.Name)
+	}
+	wg.Wait()
+	if ctx.Err() == nil {
+		pause.Done(ctx, dnsQueueName)
+	}
+
+	collected := make([]dnsutil.HostRecords, 0, len(subs))
+	failed := 0
+	for i, rec := range records {
+		if rec == nil {
+			continue
+		}
+		subs[i].DNS = rec
+		collected = append(collected, *rec)
+		if len(rec.Errors) > 0 {
+			failed++
+		}
+	}
+	Put(st, KeyDNS, collected)
+	Put(st, KeyDNSSubdomains, subs)
+
+	if s.Persist {
+		job := recon.Job{ScanID: st.ScanID, Target: st.Target, UserID: st.UserID}
+		if _, err := recon.SaveSubdomainsToFile(job, subs); err != nil {
+			log.Printf("[pipeline] scan %d: saving DNS records failed: %v", st.ScanID, err)
+		}
+	}
+	st.Events.log(fmt.Sprintf("✅ DNS records collected for %d hosts (%d with failed lookups)", len(collected), failed), "success")
+	return nil
+}
+
+// dnsQueueName names the DNS pool's queue in a pause checkpoint.
+const dnsQueueName = "dns"
+
+// dnsQueue is the work recorded when a scan is paused during DNS collection.
+type dnsQueue struct {
+	Remaining []string              `json:"remaining"`
+	Records   []dnsutil.HostRecords `json:"records"`
+}
+
+// Restore rebuilds the records from the saved subdomain artifact. An artifact
+// saved before this stage ran has none, and the stage runs again.
+func (s *DNSStage) Restore(ctx context.Context, st *State) error {
+	subs, _, err := recon.LoadSubdomainsForScan(st.UserID, st.ScanID, st.Target)
+	if err != nil {
+		return err
+	}
+	subs = scopedSubdomains(ctx, subs)
+	var collected []dnsutil.HostRecords
+	for _, sub := range subs {
+		if sub.DNS != nil {
+			collected = append(collected, *sub.DNS)
+		}
+	}
+	if len(collected) == 0 && len(subs) > 0 {
+		return fmt.Errorf("no DNS records saved for scan %d", st.ScanID)
+	}
+	Put(st, KeyDNS, collected)
+	Put(st, KeyDNSSubdomains, subs)
+	return nil
+}
+
+// ---------------- ENDPOINTS ----------------
+
+// EndpointStage discovers and probes URLs on alive hosts (crawl, gau, katana).
+type EndpointStage struct {
+	Config *endpoints.ScanConfig // nil uses endpoints.DefaultScanConfig
+}
+
+func (s *EndpointStage) Name() string      { return StageEndpoints }
+func (s *EndpointStage) Inputs() []string  { return []string{KeySubdomains.Name()} }
+func (s *EndpointStage) Outputs() []string { return []string{KeyEndpoints.Name()} }
+
+func (s *EndpointStage) Run(ctx context.Context, st *State) error {
+	subs, _ := Get(st, KeySubdomains)
+	subs = scopedSubdomains(ctx, subs)
+	auth, _ := Get(st, KeyDiscoveryAuth)
+
+	st.Events.log("🕷️ Starting endpoint discovery (gau + katana)...", "info")
+	if st.Events.Log != nil {
+		ctx = endpoints.WithLogSink(ctx, st.Events.Log)
+	}
+
+	eps, err := endpoints.DiscoverEndpointsForSubdomains(ctx, st.ScanID, st.Target, subs, s.Config, auth, st.Events.Endpoint)
+	st.Events.dropped(ctx)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	Put(st, KeyEndpoints, eps)
+	log.Printf("[pipeline] scan %d: endpoint discovery complete: %d total", st.ScanID, len(eps))
+	return nil
+}
+
+// Restore reloads the endpoint artifact saved before a worker restart.
+func (s *EndpointStage) Restore(ctx context.Context, st *State) error {
+	eps, err := endpoints.LoadEndpointsForScan(st.ScanID, st.Target)
+	if err != nil {
+		return err
+	}
+	Put(st, KeyEndpoints, eps)
+	st.Events.log(fmt.Sprintf("♻️ Reusing %d endpoints from before the worker restart", len(eps)), "info")
+	return nil
+}
+
+// ---------------- FINGERPRINT ----------------
+
+// FingerprintStage aggregates endpoint fingerprints into a per-host technology
+// summary. It works on data already collected and makes no requests.
+type FingerprintStage struct{}
+
+func (s *FingerprintStage) Name() string      { return StageFingerprint }
+func (s *FingerprintStage) Inputs() []string  { return []string{KeyEndpoints.Name()} }
+func (s *FingerprintStage) Outputs() []string { return []string{KeyTechnologies.Name()} }
+
+func (s *FingerprintStage) Run(ctx context.Context, st *State) error {
+	eps, _ := Get(st, KeyEndpoints)
+	summary := SummarizeTechnologies(eps)
+	Put(st, KeyTechnologies, summary)
+
+	distinct := make(map[string]struct{})
+	for _, host := range summary {
+		for _, tech := range host.Technologies {
+			distinct[tech] = struct{}{}
+		}
+		if st.Events.Technologies != nil {
+			st.Events.Technologies(host)
+		}
+	}
+	if len(summary) > 0 {
+		st.Events.log(fmt.Sprintf("🧬 Identified %d technologies across %d hosts", len(distinct), len(summary)), "info")
+	}
+	return nil
+}
+
+// SummarizeTechnologies groups endpoint fingerprints by host. Status-class and
+// content-type tags are dropped since they describe responses, not technologies.
+func SummarizeTechnologies(eps []endpoints.EndpointResult) []HostTechnologies {
+	type hostAgg struct {
+		techs     map[string]struct{}
+		endpoints int
+	}
+	byHost := make(map[string]*hostAgg)
+
+	for _, ep := range eps {
+		u, err := url.Parse(ep.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := strings.ToLower(u.Host)
+		agg, ok := byHost[host]
+		if !ok {
+			agg = &hostAgg{techs: make(map[string]struct{})}
+			byHost[host] = agg
+		}
+		agg.endpoints++
+
+		tags := append([]string{}, ep.Fingerprints...)
+		tags = append(tags, fingerprint.FingerprintDomain(ep.Headers, "").Tags...)
+		for _, tag := range tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" || isResponseTag(tag) {
+				continue
+			}
+			agg.techs[tag] = struct{}{}
+		}
+	}
+
+	out := make([]HostTechnologies, 0, len(byHost))
+	for host, agg := range byHost {
+		techs := make([]string, 0, len(agg.techs))
+		for tech := range agg.techs {
+			techs = append(techs, tech)
+		}
+		sort.Strings(techs)
+		out = append(out, HostTechnologies{Host: host, Technologies: techs, Endpoints: agg.endpoints})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+func isResponseTag(tag string) bool {
+	switch tag {
+	case "2xx", "3xx", "4xx", "5xx", "html", "json-api":
+		return true
+	}
+	return false
+}
+
+// ---------------- NETWORK ----------------
+
+// NetworkStage runs port scans, TLS checks and sensitive directory checks on
+// every alive host.
+type NetworkStage struct {
+	Workers         int                 // Concurrent hosts (default: 10)
+	Nmap            network.NmapOptions // Zero fields use network.DefaultNmapOptions
+	SkipPorts       bool
+	SkipTLS         bool
+	SkipDirectories bool
+	DirectoryPaths  []string // Paths probed by the directory check (default: network.DefaultSensitivePaths)
+}
+
+func (s *NetworkStage) Name() string      { return StageNetwork }
+func (s *NetworkStage) Inputs() []string  { return []string{KeySubdomains.Name()} }
+func (s *NetworkStage) Outputs() []string { return []string{KeyNetwork.Name()} }
+
+func (s *NetworkStage) Run(ctx context.Context, st *State) error {
+	subs, _ := Get(st, KeySubdomains)
+	subs = scopedSubdomains(ctx, subs)
+	log.Printf("[network] starting network analysis for scan %d", st.ScanID)
+
+	// Collect unique hosts from subdomains (alive hosts)
+	hosts := make([]string, 0)
+	seenHosts := make(map[string]struct{})
+	for _, sub := range subs {
+		if sub.Alive {
+			networkHost := NormalizeNetworkHost(sub.Name)
+			if networkHost == "" {
+				continue
+			}
+			if _, exists := seenHosts[networkHost]; exists {
+				continue
+			}
+			seenHosts[networkHost] = struct{}{}
+			hosts = append(hosts, networkHost)
+		}
+	}
+
+	summary := NetworkSummary{Hosts: len(hosts)}
+	if len(hosts) == 0 {
+		log.Printf("[network] no alive hosts found, skipping network analysis")
+		st.Events.log("⚠️ No alive hosts found, skipping network analysis", "warning")
+		Put(st, KeyNetwork, summary)
+		return nil
+	}
+
+	log.Printf("[network] analyzing %d hosts", len(hosts))
+	st.Events.log(fmt.Sprintf("🔬 Starting network analysis for %d hosts...", len(hosts)), "info")
+
+	summary = s.analyzeHosts(ctx, st, hosts)
+	st.Events.dropped(ctx)
+	Put(st, KeyNetwork, summary)
+
+	if ctx.Err() == nil {
+		st.Events.log(fmt.Sprintf("✅ Network analysis complete for %d hosts", len(hosts)), "success")
+	}
+	return nil
+}
+
+func (s *NetworkStage) analyzeHosts(ctx context.Context, st *State, hosts []string) NetworkSummary {
+	// Runs per-host network checks in a worker pool and supports cancellation.
+	workers := s.Workers
+	if workers <= 0 {
+		workers = 10
+	}
+	summary := NetworkSummary{Hosts: len(hosts)}
+
+	// A scan paused before a restart recorded the hosts it had left and the
+	// totals of the hosts already analyzed.
+	var restored networkQueue
+	if pause.Restore(ctx, networkQueueName, &restored) {
+		hosts = restored.Remaining
+		summary = restored.Summary
+		log.Printf("[network] resuming paused analysis, %d hosts left", len(hosts))
+	}
+
+	jobs := make(chan string, len(hosts))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := make(map[string]bool, len(hosts))
+	snapshot := func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		q := networkQueue{Remaining: []string{}, Summary: summary}
+		for _, host := range hosts {
+			if !finished[host] {
+				q.Remaining = append(q.Remaining, host)
+			}
+		}
+		return q
+	}
+
+	// Worker pool for concurrent host scanning
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				// Check for cancellation before processing each host
+				select {
+				case <-ctx.Done():
+					log.Printf("[network] worker cancelled, stopping analysis")
+					return
+				default:
+				}
+				if err := pause.Wait(ctx, networkQueueName, snapshot); err != nil {
+					return
+				}
+				hostSummary := s.analyzeHost(ctx, st, host)
+				if ctx.Err() != nil {
+					// Cut short: the host stays remaining and is analyzed again on resume.
+					return
+				}
+				mu.Lock()
+				finished[host] = true
+				summary.HostsAnalyzed++
+				summary.OpenPorts += hostSummary.OpenPorts
+				summary.TLSIssues += hostSummary.TLSIssues
+				summary.DirectoryFindings += hostSummary.DirectoryFindings
+				mu.Unlock()
+				if st.Events.HostAnalyzed != nil {
+					st.Events.HostAnalyzed(host)
+				}
+			}
+		}()
+	}
+
+	// Send jobs
+	for _, host := range hosts {
+		select {
+		case <-ctx.Done():
+			log.Printf("[network] context cancelled, stopping job distribution")
+			close(jobs)
+			wg.Wait()
+			return summary
+		case jobs <- host:
+		}
+	}
+	close(jobs)
+
+	// Wait for workers to finish
+	wg.Wait()
+	if ctx.Err() == nil {
+		pause.Done(ctx, networkQueueName)
+	}
+	return summary
+}
+
+// networkQueueName names the network pool's queue in a pause checkpoint.
+const networkQueueName = "network"
+
+// networkQueue is the work recorded when a scan is paused during network analysis.
+type networkQueue struct {
+	Remaining []string       `json:"remaining"`
+	Summary   NetworkSummary `json:"summary"`
+}
+
+func (s *NetworkStage) analyzeHost(ctx context.Context, st *State, host string) NetworkSummary {
+	// Runs 3 checks on one host and streams findings:
+	// open ports, TLS posture, and sensitive directory exposure.
+	log.Printf("[network] analyzing host: %s", host)
+	var summary NetworkSummary
+
+	// 1) Port Scanning
+	if !s.SkipPorts {
+		portFindings, err := network.ScanHostPortsContext(ctx, host, s.Nmap)
+		if ctx.Err() != nil {
+			return summary
+		} else if err != nil {
+			log.Printf("[network] port scan failed for %s: %v", host, err)
+			st.Events.error(err)
+		} else if len(portFindings) > 0 {
+			log.Printf("[network] found %d open ports on %s", len(portFindings), host)
+			summary.OpenPorts = len(portFindings)
+			if st.Events.Ports != nil {
+				st.Events.Ports(host, portFindings)
+			}
+		}
+	}
+
+	if s.SkipTLS && s.SkipDirectories {
+		return summary
+	}
+
+	// 2) TLS Check (directory checks also need it to pick the scheme)
+	tlsResult := network.CheckTLSContext(ctx, host)
+	if ctx.Err() != nil {
+		return summary
+	}
+	if !s.SkipTLS && (tlsResult.HasHTTPS || len(tlsResult.Issues) > 0) {
+		log.Printf("[network] TLS check for %s: HTTPS=%v, issues=%d",
+			host, tlsResult.HasHTTPS, len(tlsResult.Issues))
+		summary.TLSIssues = len(tlsResult.Issues)
+		if st.Events.TLS != nil {
+			st.Events.TLS(tlsResult)
+		}
+	}
+
+	// 3) Directory Checks
+	if s.SkipDirectories {
+		return summary
+	}
+	var dirFindings []network.DirectoryFinding
+	if len(s.DirectoryPaths) > 0 {
+		dirFindings = network.CheckDirectoryPathsContext(ctx, host, tlsResult.HasHTTPS, s.DirectoryPaths)
+	} else {
+		dirFindings = network.CheckDirectoriesContext(ctx, host, tlsResult.HasHTTPS)
+	}
+	if len(dirFindings) > 0 {
+		log.Printf("[network] found %d directory issues on %s", len(dirFindings), host)
+		summary.DirectoryFindings = len(dirFindings)
+		if st.Events.Directories != nil {
+			st.Events.Directories(host, dirFindings)
+		}
+	}
+
+	return summary
+}
+
+// NormalizeNetworkHost normalizes host values so network tools receive clean
+// hostnames. Handles cases like scheme, ports, and bracketed IPv6 notation.
+func NormalizeNetworkHost(rawHost string) string {
+	host := strings.TrimSpace(rawHost)
+	if host == "" {
+		return ""
+	}
+
+	if strings.Contains(host, "://") {
+		if parsed, err := url.Parse(host); err == nil {
+			host = parsed.Host
+		}
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.Trim(host, "[]")
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return ""
+	}
+
+	return strings.ToLower(host)
+}
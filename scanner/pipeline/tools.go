@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"recon/enum"
+	"recon/network"
+	"recon/recon"
+	"recon/tools"
+)
+
+// canScanUDP reports whether nmap may run UDP scans here; tests replace it.
+var canScanUDP = network.CanScanUDP
+
+// ToolSet reports which external tools this worker can run.
+type ToolSet interface {
+	Available(tool string) bool
+}
+
+// MissingToolsError means a scan cannot run in a useful form on this worker
+// because tools it depends on are not installed.
+type MissingToolsError struct {
+	Problems []string
+}
+
+func (e *MissingToolsError) Error() string {
+	return "required tools unavailable: " + strings.Join(e.Problems, "; ")
+}
+
+// AdaptToTools fits the options to the tools available before a scan starts.
+// Missing optional tools are dropped with a warning: gau and katana from
+// endpoint discovery, nmap from the network checks (also when the scan's proxy
+// is one nmap cannot use), UDP port scans when the worker has neither root
+// nor CAP_NET_RAW, and httpx in favour of the built-in HTTP client.
+// Subdomain sources whose binary is missing are dropped too, silently unless
+// the scan selected them. The scan is refused when nothing useful would be
+// left of a selected phase, or when target needs enumeration and none of its
+// selected sources can run. An empty target skips the enumeration check.
+func (o Options) AdaptToTools(ts ToolSet, target string) (Options, []string, error) {
+	plan, err := o.Plan()
+	if err != nil {
+		return o, nil, err
+	}
+	runs := make(map[string]bool)
+	for _, name := range plan.Stages() {
+		runs[name] = true
+	}
+
+	out := o
+	var warnings, problems []string
+
+	if runs[StageSubdomains] && target != "" && recon.NeedsEnumeration(target) {
+		selected := o.Subdomains.Sources
+		if len(selected) == 0 {
+			selected = enum.Sources
+		}
+		var kept, dropped []string
+		for _, source := range enum.Sources {
+			switch {
+			case !containsString(selected, source):
+			case enum.NeedsBinary(source) && !ts.Available(source):
+				dropped = append(dropped, source)
+			default:
+				kept = append(kept, source)
+			}
+		}
+		switch {
+		case len(kept) == 0:
+			problems = append(problems, fmt.Sprintf("%s is required to enumerate subdomains of %s", strings.Join(dropped, " or "), target))
+		case len(dropped) > 0:
+			out.Subdomains.Sources = kept
+			if len(o.Subdomains.Sources) > 0 {
+				warnings = append(warnings, fmt.Sprintf("%s not installed, subdomain enumeration uses %s only",
+					strings.Join(dropped, " and "), strings.Join(kept, ", ")))
+			}
+		}
+	}
+
+	if (runs[StageProbe] || runs[StageEndpoints]) && !ts.Available(tools.Httpx) {
+		useHttpx := false
+		out.Probe.UseHttpx = &useHttpx
+		warnings = append(warnings, "httpx is not installed, probing with the built-in HTTP client")
+	}
+
+	if runs[StageEndpoints] {
+		d := o.endpointConfig().Discovery
+		selected := map[string]bool{ToolCrawl: d.UseRecursiveCrawl, ToolGau: d.UseGau, ToolKatana: d.UseKatana}
+		var kept, dropped []string
+		for _, tool := range []string{ToolCrawl, ToolGau, ToolKatana} {
+			switch {
+			case !selected[tool]:
+			case tool != ToolCrawl && !ts.Available(tool):
+				dropped = append(dropped, tool)
+			default:
+				kept = append(kept, tool)
+			}
+		}
+		if len(dropped) > 0 {
+			if len(kept) == 0 {
+				problems = append(problems, fmt.Sprintf("endpoint discovery needs %s", strings.Join(dropped, " or ")))
+			} else {
+				out.Endpoints.Tools = kept
+				warnings = append(warnings, fmt.Sprintf("%s not installed, endpoint discovery uses %s only",
+					strings.Join(dropped, " and "), strings.Join(kept, ", ")))
+			}
+		}
+	}
+
+	if runs[StageNetwork] {
+		// nmap cannot scan without being installed, nor around a proxy it
+		// cannot speak, since that would bypass the scan's egress.
+		var problem, warning string
+		if !ts.Available(tools.Nmap) {
+			problem, warning = "port scanning needs nmap", "nmap is not installed, skipping port scans"
+		} else if u := o.proxyURL(); u != nil && !network.NmapSupportsProxy(u) {
+			problem = fmt.Sprintf("port scanning needs an http proxy, nmap cannot use %s", u.Scheme)
+			warning = fmt.Sprintf("nmap cannot use a %s proxy, skipping port scans", u.Scheme)
+		}
+		checks := o.Network.Checks
+		if len(checks) == 0 {
+			checks = []string{CheckPorts, CheckTLS, CheckDirectories}
+		}
+		if problem != "" && containsString(checks, CheckPorts) {
+			var kept []string
+			for _, check := range checks {
+				if check != CheckPorts {
+					kept = append(kept, check)
+				}
+			}
+			if len(kept) == 0 {
+				problems = append(problems, problem)
+			} else {
+				out.Network.Checks = kept
+				warnings = append(warnings, warning)
+			}
+		} else if o.Network.UDP != nil && *o.Network.UDP && containsString(checks, CheckPorts) && !canScanUDP() {
+			udp := false
+			out.Network.UDP = &udp
+			warnings = append(warnings, "UDP port scans need root or CAP_NET_RAW, scanning TCP ports only")
+		}
+	}
+
+	if len(problems) > 0 {
+		return o, nil, &MissingToolsError{Problems: problems}
+	}
+	return out, warnings, nil
+}
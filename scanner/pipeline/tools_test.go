@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type fakeTools map[string]bool
+
+func (f fakeTools) Available(tool string) bool { return !f[tool] }
+
+func TestAdaptToToolsDowngradesOptionalTools(t *testing.T) {
+	missing := fakeTools{"gau": true, "nmap": true, "httpx": true}
+
+	opts, warnings, err := Options{}.AdaptToTools(missing, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := opts.Endpoints.Tools, []string{ToolCrawl, ToolKatana}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("endpoint tools = %v, want %v", got, want)
+	}
+	if got, want := opts.Network.Checks, []string{CheckTLS, CheckDirectories}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("network checks = %v, want %v", got, want)
+	}
+	if opts.Probe.UseHttpx == nil || *opts.Probe.UseHttpx {
+		t.Fatal("httpx should be disabled")
+	}
+	if len(warnings) != 3 {
+		t.Fatalf("expected 3 warnings, got %v", warnings)
+	}
+
+	// Phases that are not selected are left alone.
+	opts, warnings, err = Options{Phases: []string{StageProbe}}.AdaptToTools(fakeTools{"nmap": true}, "127.0.0.1")
+	if err != nil || len(warnings) != 0 || opts.Network.Checks != nil {
+		t.Fatalf("unexpected adaptation: %+v %v %v", opts.Network, warnings, err)
+	}
+}
+
+func TestAdaptToToolsRefusesUselessScans(t *testing.T) {
+	opts := Options{
+		Subdomains: SubdomainOptions{Sources: []string{"subfinder"}},
+		Endpoints:  EndpointOptions{Tools: []string{ToolGau}},
+		Network:    NetworkOptions{Checks: []string{CheckPorts}},
+	}
+	_, _, err := opts.AdaptToTools(fakeTools{"subfinder": true, "gau": true, "nmap": true}, "example.com")
+
+	var missing *MissingToolsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected MissingToolsError, got %v", err)
+	}
+	if len(missing.Problems) != 3 {
+		t.Fatalf("expected subfinder, gau and nmap problems, got %v", missing.Problems)
+	}
+
+	// Local targets do not need subfinder.
+	if _, _, err := (Options{}).AdaptToTools(fakeTools{"subfinder": true}, "localhost:3000"); err != nil {
+		t.Fatalf("local target refused: %v", err)
+	}
+}
+
+func TestAdaptToToolsPicksInstalledSubdomainSources(t *testing.T) {
+	missing := fakeTools{"subfinder": true, "amass": true}
+
+	// Default sources drop missing binaries quietly; crt and bruteforce need none.
+	opts, warnings, err := Options{}.AdaptToTools(missing, "example.com")
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("unexpected adaptation: %v %v", warnings, err)
+	}
+	if got, want := opts.Subdomains.Sources, []string{"assetfinder", "crt", "bruteforce"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sources = %v, want %v", got, want)
+	}
+
+	// Selected sources that are missing are reported.
+	opts, warnings, err = Options{Subdomains: SubdomainOptions{Sources: []string{"amass", "crt"}}}.AdaptToTools(missing, "example.com")
+	if err != nil || len(warnings) != 1 || !reflect.DeepEqual(opts.Subdomains.Sources, []string{"crt"}) {
+		t.Fatalf("unexpected adaptation: %v %v %v", opts.Subdomains.Sources, warnings, err)
+	}
+}
+
+func TestAdaptToToolsSkipsPortScansThroughSOCKS(t *testing.T) {
+	all := fakeTools{}
+
+	opts, warnings, err := Options{Proxy: "socks5://127.0.0.1:1080"}.AdaptToTools(all, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := opts.Network.Checks, []string{CheckTLS, CheckDirectories}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("network checks = %v, want %v", got, want)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+
+	// nmap relays through plain HTTP proxies.
+	if opts, _, err := (Options{Proxy: "http://127.0.0.1:8080"}).AdaptToTools(all, "127.0.0.1"); err != nil || opts.Network.Checks != nil {
+		t.Fatalf("http proxy should keep port scans: %v %v", opts.Network.Checks, err)
+	}
+
+	ports := Options{Proxy: "socks5h://127.0.0.1:1080", Network: NetworkOptions{Checks: []string{CheckPorts}}}
+	var missing *MissingToolsError
+	if _, _, err := ports.AdaptToTools(all, "127.0.0.1"); !errors.As(err, &missing) {
+		t.Fatalf("expected MissingToolsError for a ports-only scan, got %v", err)
+	}
+}
+
+func TestAdaptToToolsDropsUDPWithoutPrivileges(t *testing.T) {
+	prev := canScanUDP
+	t.Cleanup(func() { canScanUDP = prev })
+	udp := true
+	opts := Options{Network: NetworkOptions{UDP: &udp}}
+
+	canScanUDP = func() bool { return false }
+	got, warnings, err := opts.AdaptToTools(fakeTools{}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Network.UDP == nil || *got.Network.UDP || len(warnings) != 1 {
+		t.Fatalf("UDP = %v, warnings %v; want UDP dropped with a warning", got.Network.UDP, warnings)
+	}
+	if !*opts.Network.UDP {
+		t.Fatal("the caller's options must not be modified")
+	}
+
+	canScanUDP = func() bool { return true }
+	if got, warnings, _ := opts.AdaptToTools(fakeTools{}, "127.0.0.1"); !*got.Network.UDP || len(warnings) != 0 {
+		t.Fatalf("privileged worker should keep UDP: %v %v", *got.Network.UDP, warnings)
+	}
+}
@@ -0,0 +1,16 @@
+package probe
+
+import "recon/metrics"
+
+// hostsProbed counts liveness checks by outcome (alive="true" or "false").
+var hostsProbed = metrics.NewCounter("recon_hosts_probed_total", "Hosts probed for liveness, by result.", "alive")
+
+func init() {
+	metrics.NewGaugeFunc("recon_hosts_alive_ratio", "Share of probed hosts that were alive since the worker started.", func() float64 {
+		alive, dead := hostsProbed.Value("true"), hostsProbed.Value("false")
+		if alive+dead == 0 {
+			return 0
+		}
+		return alive / (alive + dead)
+	})
+}
@@ -3,15 +3,21 @@ package probe
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"recon/egress"
+	"recon/metrics"
+	"recon/pause"
+	"recon/ratelimit"
+	"recon/scope"
 )
 
 // HostCheck represents the result of probing a single host.
@@ -20,6 +26,7 @@ type HostCheck struct {
 	IPs      []string `json:"ips"`       // All resolved IPs (IPv4 + IPv6)
 	Alive    bool     `json:"alive"`     // True if HTTP/HTTPS responsive
 	ErrorMsg string   `json:"error_msg"` // Error details if any
+	Restored bool     `json:"-"`         // Probed before a pause and restored from its checkpoint
 }
 
 // ProbeOptions configures the probing behavior.
@@ -52,6 +59,12 @@ func CheckHost(host string) HostCheck {
 
 // CheckHostWithOptions probes a single host with custom options.
 func CheckHostWithOptions(host string, opts *ProbeOptions) HostCheck {
+	return CheckHostContext(context.Background(), host, opts)
+}
+
+// CheckHostContext probes a single host and gives up as soon as ctx is done,
+// killing httpx and aborting in-flight DNS and HTTP requests.
+func CheckHostContext(ctx context.Context, host string, opts *ProbeOptions) HostCheck {
 	// Single-host probe flow:
 	// normalize target -> DNS resolve -> httpx check -> native HTTP fallback.
 	if opts == nil {
@@ -65,9 +78,15 @@ func CheckHostWithOptions(host string, opts *ProbeOptions) HostCheck {
 		IPs:   []string{},
 		Alive: false,
 	}
+	defer func() {
+		// Cancelled probes say nothing about the host, so they are not counted.
+		if ctx.Err() == nil {
+			hostsProbed.Inc(strconv.FormatBool(res.Alive))
+		}
+	}()
 
 	// First resolve DNS to get all IPs
-	ips, dnsErr := resolveAllIPs(dnsHost, opts.DNSTimeout)
+	ips, dnsErr := resolveAllIPs(ctx, dnsHost, opts.DNSTimeout)
 	res.IPs = ips
 	if dnsErr != nil {
 		res.ErrorMsg = fmt.Sprintf("DNS resolution failed: %v", dnsErr)
@@ -81,7 +100,7 @@ func CheckHostWithOptions(host string, opts *ProbeOptions) HostCheck {
 
 	// Try httpx first if enabled
 	if opts.UseHttpx {
-		alive, httpxErr := checkWithHttpx(requestHost, opts.HttpxBinary, opts.HttpxTimeout)
+		alive, httpxErr := checkWithHttpx(ctx, requestHost, opts.HttpxBinary, opts.HttpxTimeout)
 		if alive {
 			res.Alive = true
 			return res
@@ -89,6 +108,9 @@ func CheckHostWithOptions(host string, opts *ProbeOptions) HostCheck {
 		// If httpx failed, try native Go HTTP fallback
 		if httpxErr != nil && strings.Contains(httpxErr.Error(), "executable file not found") {
 			// httpx not installed, fall through to native HTTP
+		} else if ctx.Err() != nil {
+			res.ErrorMsg = fmt.Sprintf("probe cancelled: %v", ctx.Err())
+			return res
 		} else if httpxErr != nil {
 			// httpx ran but failed - could be no web server
 			res.ErrorMsg = fmt.Sprintf("httpx check failed: %v", httpxErr)
@@ -96,7 +118,7 @@ func CheckHostWithOptions(host string, opts *ProbeOptions) HostCheck {
 	}
 
 	// Fallback to native Go HTTP client
-	alive, httpErr := checkWithNativeHTTP(requestHost, opts.HTTPTimeout)
+	alive, httpErr := checkWithNativeHTTP(ctx, requestHost, opts.HTTPTimeout)
 	res.Alive = alive
 	if !alive && httpErr != nil {
 		if res.ErrorMsg != "" {
@@ -143,28 +165,75 @@ func ProbeHosts(hosts []string, opts *ProbeOptions) []HostCheck {
 // ProbeHostsWithCallback probes hosts and calls the callback immediately for each result.
 // If callback is nil, behaves like ProbeHosts (returns all results at end).
 func ProbeHostsWithCallback(hosts []string, opts *ProbeOptions, callback func(HostCheck)) []HostCheck {
+	return ProbeHostsContext(context.Background(), hosts, opts, callback)
+}
+
+// ProbeHostsContext is ProbeHostsWithCallback with cancellation. Once ctx is
+// done no new hosts are started and in-flight probes are aborted; hosts that
+// were not fully probed are returned with an error and not passed to callback.
+// Hosts restored from a pause checkpoint were already passed to a callback by
+// the earlier run; they are returned with Restored set and not passed again.
+func ProbeHostsContext(ctx context.Context, hosts []string, opts *ProbeOptions, callback func(HostCheck)) []HostCheck {
 	// Runs bulk probing in parallel and preserves output order by input index.
 	// Callback is triggered per host for streaming use-cases.
 	if opts == nil {
 		opts = DefaultProbeOptions()
 	}
 
+	// A scan paused before a restart recorded the hosts it had left; the hosts
+	// probed before the pause are returned instead of probed again.
+	var restored pauseQueue
+	if pause.Restore(ctx, pauseQueueName, &restored) {
+		hosts = restored.Remaining
+		for i := range restored.Done {
+			restored.Done[i].Restored = true
+		}
+	}
+
 	if len(hosts) == 0 {
-		return []HostCheck{}
+		pause.Done(ctx, pauseQueueName)
+		return append([]HostCheck{}, restored.Done...)
 	}
 
 	results := make([]HostCheck, len(hosts))
 	jobs := make(chan int, len(hosts))
 	var wg sync.WaitGroup
 
+	// Tracks finished hosts so a pause can record what is left.
+	var mu sync.Mutex
+	finished := make([]bool, len(hosts))
+	completed := append([]HostCheck{}, restored.Done...)
+	snapshot := func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		q := pauseQueue{Done: append([]HostCheck{}, completed...)}
+		for i, host := range hosts {
+			if !finished[i] {
+				q.Remaining = append(q.Remaining, host)
+			}
+		}
+		return q
+	}
+
 	// Spawn worker pool
 	for i := 0; i < opts.Workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for idx := range jobs {
-				result := CheckHostWithOptions(hosts[idx], opts)
+				if err := pause.Wait(ctx, pauseQueueName, snapshot); err != nil || ctx.Err() != nil {
+					results[idx] = cancelledCheck(hosts[idx], ctx.Err())
+					continue
+				}
+				result := CheckHostContext(ctx, hosts[idx], opts)
 				results[idx] = result
+				if ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				finished[idx] = true
+				completed = append(completed, result)
+				mu.Unlock()
 
 				// Immediately call callback if provided
 				if callback != nil {
@@ -183,23 +252,50 @@ func ProbeHostsWithCallback(hosts []string, opts *ProbeOptions, callback func(Ho
 	// Wait for completion
 	wg.Wait()
 
-	return results
+	if ctx.Err() == nil {
+		pause.Done(ctx, pauseQueueName)
+	}
+	return append(restored.Done, results...)
+}
+
+// pauseQueueName names the probe pool's queue in a pause checkpoint.
+const pauseQueueName = "probe"
+
+// pauseQueue is the work recorded when a scan is paused during probing.
+type pauseQueue struct {
+	Remaining []string    `json:"remaining"`
+	Done      []HostCheck `json:"done"`
+}
+
+func cancelledCheck(host string, err error) HostCheck {
+	requestHost, _ := normalizeProbeTarget(host)
+	return HostCheck{Host: requestHost, IPs: []string{}, ErrorMsg: fmt.Sprintf("probe cancelled: %v", err)}
 }
 
 // checkWithHttpx runs httpx and returns (alive, error).
-func checkWithHttpx(host, binary string, timeoutSec int) (bool, error) {
+func checkWithHttpx(ctx context.Context, host, binary string, timeoutSec int) (bool, error) {
 	// Delegates liveness probing to httpx for fast HTTP/HTTPS checks.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSec+5)*time.Second)
+	// httpx sends one request per scheme; pace it like one request.
+	if err := ratelimit.Wait(ctx, host); err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSec+5)*time.Second)
 	defer cancel()
 
-	// httpx -silent -u <host> -nc -timeout <sec>
-	cmd := exec.CommandContext(ctx, binary, "-silent", "-u", host, "-nc", "-timeout", fmt.Sprintf("%d", timeoutSec))
+	// httpx -silent -u <host> -nc -timeout <sec> [-http-proxy <url>]
+	args := []string{"-silent", "-u", host, "-nc", "-timeout", fmt.Sprintf("%d", timeoutSec)}
+	if u := egress.FromContext(ctx); u != nil {
+		args = append(args, "-http-proxy", u.String())
+	}
+	cmd := exec.CommandContext(ctx, binary, args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
+	start := time.Now()
 	err := cmd.Run()
+	metrics.ObserveExec("httpx", start, err)
 	if err != nil {
 		// Check if httpx is not installed
 		if strings.Contains(err.Error(), "executable file not found") {
@@ -216,13 +312,11 @@ func checkWithHttpx(host, binary string, timeoutSec int) (bool, error) {
 
 // checkWithNativeHTTP tries HTTP and HTTPS requests using Go's http.Client.
 // Returns (alive, error).
-func checkWithNativeHTTP(host string, timeout time.Duration) (bool, error) {
+func checkWithNativeHTTP(ctx context.Context, host string, timeout time.Duration) (bool, error) {
 	// Native fallback checks both HTTPS and HTTP; any response code means reachable web service.
 	client := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Timeout:   timeout,
+		Transport: scope.NewTransport(ratelimit.NewTransport(egress.NewTransport())),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse // Don't follow redirects
 		},
@@ -233,8 +327,8 @@ func checkWithNativeHTTP(host string, timeout time.Duration) (bool, error) {
 
 	for _, scheme := range schemes {
 		url := scheme + host
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		reqCtx, cancel := context.WithTimeout(ctx, timeout)
+		req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
 
 		if err != nil {
 			cancel()
@@ -260,9 +354,9 @@ func checkWithNativeHTTP(host string, timeout time.Duration) (bool, error) {
 }
 
 // resolveAllIPs performs DNS lookup and returns all IPs (IPv4 + IPv6).
-func resolveAllIPs(host string, timeout time.Duration) ([]string, error) {
+func resolveAllIPs(ctx context.Context, host string, timeout time.Duration) ([]string, error) {
 	// Resolves all A/AAAA records and returns unique IP values.
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	ips, err := net.DefaultResolver.LookupHost(ctx, host)
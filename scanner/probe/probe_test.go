@@ -1,8 +1,13 @@
 package probe
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
+
+	"recon/pause"
 )
 
 func TestCheckHost(t *testing.T) {
@@ -98,3 +103,42 @@ func TestDefaultProbeOptions(t *testing.T) {
 	t.Logf("Default options: Workers=%d, HTTPTimeout=%s, DNSTimeout=%s",
 		opts.Workers, opts.HTTPTimeout, opts.DNSTimeout)
 }
+
+func TestProbeHostsContextCancelled(t *testing.T) {
+	// A cancelled context must not start probes or stream results.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	results := ProbeHostsContext(ctx, []string{"example.com", "localhost:3000/app"}, nil, func(HostCheck) { called = true })
+
+	if called {
+		t.Error("callback must not run for cancelled probes")
+	}
+	if len(results) != 2 || results[1].Host != "localhost:3000" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	for _, r := range results {
+		if r.Alive || !strings.Contains(r.ErrorMsg, "cancelled") {
+			t.Errorf("expected cancelled result, got %+v", r)
+		}
+	}
+}
+
+func TestProbeHostsContextRestoresPausedQueue(t *testing.T) {
+	// Hosts probed before a pause are returned, not probed or streamed again.
+	queue, _ := json.Marshal(pauseQueue{Remaining: []string{}, Done: []HostCheck{{Host: "a.example.com", Alive: true}}})
+	c := pause.NewController(pause.Checkpoint{Queues: map[string]json.RawMessage{pauseQueueName: queue}}, nil)
+	ctx := pause.WithController(context.Background(), c)
+
+	var streamed []string
+	results := ProbeHostsContext(ctx, []string{"a.example.com", "b.example.com"}, nil, func(h HostCheck) { streamed = append(streamed, h.Host) })
+
+	if len(results) != 1 || !results[0].Alive || !results[0].Restored || len(streamed) != 0 {
+		t.Fatalf("results = %+v, streamed = %v", results, streamed)
+	}
+	var left pauseQueue
+	if c.Restore(pauseQueueName, &left) {
+		t.Error("probe queue still recorded after the pool finished")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"recon/egress"
+	"recon/pipeline"
+)
+
+func configureProxy() {
+	// Sets the worker-wide outbound proxy from RECON_PROXY_URL, e.g.
+	// http://127.0.0.1:8080 for Burp or socks5://egress:1080. Scans may
+	// override it with options.proxy.
+	raw := os.Getenv("RECON_PROXY_URL")
+	if raw == "" {
+		egress.SetDefault(nil)
+		return
+	}
+	u, err := egress.Parse(raw)
+	if err != nil {
+		log.Fatalf("[proxy] RECON_PROXY_URL: %v", err)
+	}
+	egress.SetDefault(u)
+	log.Printf("[proxy] scan traffic goes through %s", u.Redacted())
+}
+
+func withScanProxy(ctx context.Context, opts pipeline.Options) context.Context {
+	// Binds the scan's own proxy; without one the worker default applies.
+	if u := opts.ProxyURL(); u != nil {
+		return egress.WithProxy(ctx, u)
+	}
+	return ctx
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"recon/pipeline"
+	"recon/ratelimit"
+)
+
+func configureRateLimit() {
+	// Sets the worker-wide per-host limit shared by every scan:
+	//   RECON_RATE_LIMIT_RPS          requests per second per target host (default 10, 0 disables)
+	//   RECON_RATE_LIMIT_BURST        requests allowed back to back (default: the rate)
+	//   RECON_RATE_LIMIT_MAX_BACKOFF  longest pause after 429/503/resets (default 1m)
+	cfg := ratelimit.Config{RequestsPerSecond: 10}
+	if raw := os.Getenv("RECON_RATE_LIMIT_RPS"); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 {
+			cfg.RequestsPerSecond = v
+		} else {
+			log.Printf("[ratelimit] invalid RECON_RATE_LIMIT_RPS %q, using %g", raw, cfg.RequestsPerSecond)
+		}
+	}
+	if raw := os.Getenv("RECON_RATE_LIMIT_BURST"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			cfg.Burst = v
+		} else {
+			log.Printf("[ratelimit] invalid RECON_RATE_LIMIT_BURST %q, using the rate", raw)
+		}
+	}
+	if raw := os.Getenv("RECON_RATE_LIMIT_MAX_BACKOFF"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			cfg.MaxBackoff = d
+		} else {
+			log.Printf("[ratelimit] invalid RECON_RATE_LIMIT_MAX_BACKOFF %q, using 1m", raw)
+		}
+	}
+
+	limiter := ratelimit.New(cfg)
+	ratelimit.SetDefault(limiter)
+	cfg = limiter.Config()
+	if cfg.RequestsPerSecond > 0 {
+		log.Printf("[ratelimit] %g requests/s per target host (burst %d, max backoff %s)", cfg.RequestsPerSecond, cfg.Burst, cfg.MaxBackoff)
+	} else {
+		log.Printf("[ratelimit] no per-host rate limit, backing off on 429/503/resets only")
+	}
+}
+
+func scanRateLimiter(opts pipeline.Options) *ratelimit.Limiter {
+	// Each scan paces requests by its own budget and the worker-wide limit.
+	return ratelimit.Default().Child(opts.RateLimit.Config())
+}
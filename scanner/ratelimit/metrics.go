@@ -0,0 +1,9 @@
+package ratelimit
+
+import "recon/metrics"
+
+// Pacing metrics, across all scans.
+var (
+	throttles   = metrics.NewCounter("recon_ratelimit_throttles_total", "Backoffs triggered by target responses, by reason (429, 503, reset).", "reason")
+	waitSeconds = metrics.NewHistogram("recon_ratelimit_wait_seconds", "Time requests waited for their host's rate limit.", metrics.DurationBuckets)
+)
@@ -0,0 +1,351 @@
+// Package ratelimit paces outbound requests per target host with token
+// buckets. Each scan gets a Limiter whose parent is the worker-wide one, so a
+// request counts against both the scan's budget and the host's overall rate,
+// however many scans and workers target it. Hosts that answer 429 or 503 or
+// reset connections are backed off and then recover gradually.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Backoff limits after a throttling signal.
+const (
+	baseBackoff       = time.Second
+	defaultMaxBackoff = time.Minute
+	minRate           = 0.2 // Lowest requests per second backoff slows a host to
+	recoveryFactor    = 1.1 // Rate increase per successful request after a backoff
+)
+
+// Config sets the per-host pace of one limiter.
+type Config struct {
+	RequestsPerSecond float64       // Per host; 0 disables pacing but backoff still applies
+	Burst             int           // Requests allowed back to back (default: RequestsPerSecond rounded up, at least 1)
+	MaxBackoff        time.Duration // Longest pause after throttling (default: 1m)
+}
+
+// Limiter paces requests per host.
+type Limiter struct {
+	cfg    Config
+	parent *Limiter
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket is the token bucket of one host.
+type bucket struct {
+	rate         float64 // Current rate, below cfg.RequestsPerSecond while backed off
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	strikes      int // Consecutive throttling signals
+}
+
+// New returns a limiter with no parent.
+func New(cfg Config) *Limiter {
+	if cfg.RequestsPerSecond < 0 {
+		cfg.RequestsPerSecond = 0
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(cfg.RequestsPerSecond + 0.999)
+		if cfg.Burst < 1 {
+			cfg.Burst = 1
+		}
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	return &Limiter{cfg: cfg, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Child returns a limiter for one scan: requests wait for both the child and l.
+func (l *Limiter) Child(cfg Config) *Limiter {
+	c := New(cfg)
+	c.parent = l
+	return c
+}
+
+// Config returns the limiter's settings.
+func (l *Limiter) Config() Config { return l.cfg }
+
+// Wait blocks until host may receive another request from this limiter and
+// its parents, or until ctx ends.
+func (l *Limiter) Wait(ctx context.Context, host string) error {
+	key := Key(host)
+	for lim := l; lim != nil; lim = lim.parent {
+		d := lim.reserve(key)
+		if d <= 0 {
+			continue
+		}
+		waitSeconds.Observe(d.Seconds())
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return ctx.Err()
+}
+
+// Rate returns the number of requests per second host may currently receive,
+// the lowest along the parent chain, or 0 when nothing limits it.
+func (l *Limiter) Rate(host string) float64 {
+	key := Key(host)
+	rate := 0.0
+	for lim := l; lim != nil; lim = lim.parent {
+		lim.mu.Lock()
+		r := lim.cfg.RequestsPerSecond
+		if b, ok := lim.buckets[key]; ok && b.rate > 0 {
+			r = b.rate
+		}
+		lim.mu.Unlock()
+		if r > 0 && (rate == 0 || r < rate) {
+			rate = r
+		}
+	}
+	return rate
+}
+
+// Throttle backs host off after a 429, a 503 or a connection reset. The
+// pause doubles with each consecutive signal, and a longer Retry-After is
+// honoured up to MaxBackoff. The request rate is halved.
+func (l *Limiter) Throttle(host string, retryAfter time.Duration) {
+	key := Key(host)
+	for lim := l; lim != nil; lim = lim.parent {
+		lim.throttle(key, retryAfter)
+	}
+}
+
+// Succeeded lets a backed-off host recover towards its configured rate.
+func (l *Limiter) Succeeded(host string) {
+	key := Key(host)
+	for lim := l; lim != nil; lim = lim.parent {
+		lim.recover(key)
+	}
+}
+
+// Observe inspects the outcome of a request to host and calls Throttle or
+// Succeeded. resp may be nil when err is set.
+func (l *Limiter) Observe(host string, resp *http.Response, err error) {
+	switch {
+	case err != nil && IsConnReset(err):
+		throttles.Inc("reset")
+		l.Throttle(host, 0)
+	case err != nil:
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		throttles.Inc(strconv.Itoa(resp.StatusCode))
+		l.Throttle(host, RetryAfter(resp))
+	default:
+		l.Succeeded(host)
+	}
+}
+
+func (l *Limiter) reserve(key string) time.Duration {
+	// Takes a token, possibly going into debt, and returns how long the caller
+	// must wait for it.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.bucketLocked(key, now)
+
+	var wait time.Duration
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if max := float64(l.cfg.Burst); b.tokens > max {
+			b.tokens = max
+		}
+		b.last = now
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+		}
+	}
+	if blocked := b.blockedUntil.Sub(now); blocked > wait {
+		wait = blocked
+	}
+	return wait
+}
+
+func (l *Limiter) throttle(key string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.bucketLocked(key, now)
+
+	b.strikes++
+	backoff := baseBackoff << (b.strikes - 1)
+	if b.strikes > 16 || backoff > l.cfg.MaxBackoff {
+		backoff = l.cfg.MaxBackoff
+	}
+	if retryAfter > backoff {
+		backoff = retryAfter
+		if backoff > l.cfg.MaxBackoff {
+			backoff = l.cfg.MaxBackoff
+		}
+	}
+	if until := now.Add(backoff); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+
+	if b.rate > 0 {
+		floor := minRate
+		if l.cfg.RequestsPerSecond < floor {
+			floor = l.cfg.RequestsPerSecond
+		}
+		b.rate /= 2
+		if b.rate < floor {
+			b.rate = floor
+		}
+		if b.tokens > 0 {
+			b.tokens = 0
+		}
+	}
+}
+
+func (l *Limiter) recover(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		return
+	}
+	b.strikes = 0
+	if b.rate > 0 && b.rate < l.cfg.RequestsPerSecond {
+		b.rate *= recoveryFactor
+		if b.rate > l.cfg.RequestsPerSecond {
+			b.rate = l.cfg.RequestsPerSecond
+		}
+	}
+}
+
+func (l *Limiter) bucketLocked(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{rate: l.cfg.RequestsPerSecond, tokens: float64(l.cfg.Burst), last: now}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Key normalizes a host, host:port or URL host to the bucket key: the
+// lower-cased host name or IP without port.
+func Key(host string) string {
+	host = strings.TrimSpace(host)
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// RetryAfter parses the Retry-After header in seconds or as an HTTP date.
+func RetryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// IsConnReset reports whether err means the peer reset the connection, which
+// protected hosts commonly do to scanners.
+func IsConnReset(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// defaultLimiter is the worker-wide limiter used when ctx carries none.
+var defaultLimiter atomic.Pointer[Limiter]
+
+func init() {
+	defaultLimiter.Store(New(Config{}))
+}
+
+// SetDefault replaces the worker-wide limiter.
+func SetDefault(l *Limiter) { defaultLimiter.Store(l) }
+
+// Default returns the worker-wide limiter.
+func Default() *Limiter { return defaultLimiter.Load() }
+
+type limiterKey struct{}
+
+// WithLimiter returns a context whose outbound requests are paced by l.
+func WithLimiter(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// FromContext returns the limiter bound to ctx, or the worker-wide one.
+func FromContext(ctx context.Context) *Limiter {
+	if ctx != nil {
+		if l, ok := ctx.Value(limiterKey{}).(*Limiter); ok {
+			return l
+		}
+	}
+	return Default()
+}
+
+// Wait paces a request to host with the limiter bound to ctx.
+func Wait(ctx context.Context, host string) error {
+	return FromContext(ctx).Wait(ctx, host)
+}
+
+// Observe reports the outcome of a request to host to the limiter bound to ctx.
+func Observe(ctx context.Context, host string, resp *http.Response, err error) {
+	FromContext(ctx).Observe(host, resp, err)
+}
+
+// Transport paces every request through the limiter bound to the request
+// context and backs off on 429, 503 and connection resets. Redirects are
+// paced too, since each hop is a separate round trip.
+type Transport struct {
+	Base http.RoundTripper // nil uses http.DefaultTransport
+}
+
+// NewTransport wraps base.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	l := FromContext(ctx)
+	if err := l.Wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	l.Observe(req.URL.Host, resp, err)
+	return resp, err
+}
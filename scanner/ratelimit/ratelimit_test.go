@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeClock lets tests move time forward without sleeping.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(cfg Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := New(cfg)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestKey(t *testing.T) {
+	cases := map[string]string{
+		"Example.com":               "example.com",
+		"example.com:8443":          "example.com",
+		"https://example.com/a?b=1": "example.com",
+		"http://[2001:db8::1]:80/x": "2001:db8::1",
+		"10.0.0.5":                  "10.0.0.5",
+		" api.example.com:443 ":     "api.example.com",
+	}
+	for in, want := range cases {
+		if got := Key(in); got != want {
+			t.Errorf("Key(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReservePacesPerHost(t *testing.T) {
+	l, clock := newTestLimiter(Config{RequestsPerSecond: 2, Burst: 1})
+
+	if d := l.reserve("a.example.com"); d != 0 {
+		t.Fatalf("first request waited %s", d)
+	}
+	if d := l.reserve("a.example.com"); d != 500*time.Millisecond {
+		t.Fatalf("second request waited %s, want 500ms", d)
+	}
+	if d := l.reserve("b.example.com"); d != 0 {
+		t.Fatalf("other host waited %s", d)
+	}
+
+	clock.advance(2 * time.Second)
+	if d := l.reserve("a.example.com"); d != 0 {
+		t.Fatalf("request after refill waited %s", d)
+	}
+}
+
+func TestThrottleBacksOffAndRecovers(t *testing.T) {
+	l, clock := newTestLimiter(Config{RequestsPerSecond: 8, MaxBackoff: 5 * time.Second})
+	host := "api.example.com"
+
+	l.Throttle(host, 0)
+	if d := l.reserve(host); d != time.Second {
+		t.Fatalf("wait after first throttle = %s, want 1s", d)
+	}
+	if r := l.Rate(host); r != 4 {
+		t.Fatalf("rate after throttle = %g, want 4", r)
+	}
+
+	l.Throttle(host, 0)
+	if d := l.reserve(host); d != 2*time.Second {
+		t.Fatalf("wait after second throttle = %s, want 2s", d)
+	}
+
+	l.Throttle(host, time.Hour)
+	if d := l.reserve(host); d != 5*time.Second {
+		t.Fatalf("Retry-After must be capped at MaxBackoff, waited %s", d)
+	}
+
+	clock.advance(10 * time.Second)
+	for i := 0; i < 50; i++ {
+		l.Succeeded(host)
+	}
+	if r := l.Rate(host); r != 8 {
+		t.Fatalf("rate after recovery = %g, want 8", r)
+	}
+}
+
+func TestChildWaitsForParent(t *testing.T) {
+	parent, _ := newTestLimiter(Config{RequestsPerSecond: 1})
+	child := parent.Child(Config{})
+	child.now = parent.now
+
+	if r := child.Rate("example.com"); r != 1 {
+		t.Fatalf("child rate = %g, want the parent's 1", r)
+	}
+	child.Throttle("example.com", 0)
+	if d := parent.reserve("example.com"); d < time.Second {
+		t.Fatalf("throttling the child must back off the parent, waited %s", d)
+	}
+}
+
+func TestObserveClassifiesOutcomes(t *testing.T) {
+	l, _ := newTestLimiter(Config{RequestsPerSecond: 10})
+
+	l.Observe("a.example.com", &http.Response{StatusCode: http.StatusOK}, nil)
+	l.Observe("b.example.com", nil, errors.New("dial tcp: i/o timeout"))
+	if l.Rate("a.example.com") != 10 || l.Rate("b.example.com") != 10 {
+		t.Fatal("successes and ordinary errors must not slow a host down")
+	}
+
+	l.Observe("c.example.com", nil, syscall.ECONNRESET)
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"3"}}}
+	l.Observe("d.example.com", resp, nil)
+	if l.Rate("c.example.com") != 5 {
+		t.Errorf("connection reset must halve the rate, got %g", l.Rate("c.example.com"))
+	}
+	if d := l.reserve("d.example.com"); d != 3*time.Second {
+		t.Errorf("429 with Retry-After: 3 waited %s, want 3s", d)
+	}
+}
+
+func TestTransportUsesContextLimiter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	l := New(Config{RequestsPerSecond: 100})
+	ctx := WithLimiter(context.Background(), l)
+	client := &http.Client{Transport: NewTransport(nil)}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// The 503 blocks the host, so the next request gives up with the context.
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request after 503 = %v, want deadline exceeded while backed off", err)
+	}
+}
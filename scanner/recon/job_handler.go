@@ -2,7 +2,9 @@ package recon
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -13,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"recon/dnsutil"
 	"recon/enum"
 	"recon/probe"
 )
@@ -23,16 +26,37 @@ type Job struct {
 	UserID   int64                 `json:"user_id"` // User ID for file organization
 	Workers  int                   `json:"workers"` // Optional: number of concurrent workers
 	Callback func(SubdomainResult) `json:"-"`       // Optional: callback for streaming results
+	Ctx      context.Context       `json:"-"`       // Optional: cancels enumeration and probes (default: never)
+	Sources  map[string][]string   `json:"-"`       // Optional: sources that reported each host, copied onto its result
+	Recurse  *enum.Recursion       `json:"-"`       // Optional: also enumerates discovered sub-zones
+	Permute  *enum.Permutations    `json:"-"`       // Optional: resolves permutations of the enumerated names
+	Found    func(enum.Result)     `json:"-"`       // Optional: receives each host as soon as enumeration finds it
+}
+
+// Context returns the job's context, or context.Background when none is set.
+func (j Job) Context() context.Context {
+	if j.Ctx != nil {
+		return j.Ctx
+	}
+	return context.Background()
 }
 
 type SubdomainResult struct {
-	Name     string   `json:"name"`
-	IP       string   `json:"ip"`  // Primary IP (first one) for backward compatibility
-	IPs      []string `json:"ips"` // All resolved IPs
-	Alive    bool     `json:"alive"`
-	ErrorMsg string   `json:"error_msg"` // Error details if any
+	Name     string               `json:"name"`
+	IP       string               `json:"ip"`  // Primary IP (first one) for backward compatibility
+	IPs      []string             `json:"ips"` // All resolved IPs
+	Alive    bool                 `json:"alive"`
+	ErrorMsg string               `json:"error_msg"`         // Error details if any
+	Sources  []string             `json:"sources,omitempty"` // Where the host came from: enumeration sources, SourceTarget or SourceLocal
+	DNS      *dnsutil.HostRecords `json:"dns,omitempty"`     // Full DNS records, added by the DNS stage
 }
 
+// Host sources that are not enumeration sources.
+const (
+	SourceTarget = "target" // The scan target itself
+	SourceLocal  = "local"  // Local fallback hosts for localhost/IP targets
+)
+
 // ScanFilePath returns the JSON path for a given user_id + scan_id + target.
 // Organized as data/user_<user_id>/scan_<scan_id>_<target>.json
 func ScanFilePath(userID int64, scanID int64, target string) string {
@@ -53,56 +77,230 @@ func ScanFilePath(userID int64, scanID int64, target string) string {
 func HandleJob(job Job) ([]SubdomainResult, error) {
 	// Main recon pipeline for one target:
 	// derive host candidates -> probe concurrently -> stream results -> save artifact file.
+	// Hosts are probed as soon as a source reports them, so brute-force hits
+	// stream out alongside subfinder's instead of after every source is done.
 	log.Printf("[recon] starting job: scan_id=%d target=%s", job.ScanID, job.Target)
 
+	opts := DefaultJobProbeOptions(job)
+	stream := newStreamProber(job, opts)
+	job.Found = stream.add
+	hosts, _, err := PrepareHostSources(job, enum.NewSources(nil, enum.Options{}))
+	results, probed := stream.wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// A streamed result carries only the source that reported its host first;
+	// the saved artifact lists every source.
+	job.Sources = make(map[string][]string, len(hosts))
+	for _, h := range hosts {
+		job.Sources[h.Name] = h.Sources
+	}
+	for i := range results {
+		results[i].Sources = job.Sources[results[i].Name]
+	}
+
+	// Hosts added after enumeration, e.g. by recursion or permutations, are
+	// probed now.
+	rest := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if !probed[h.Name] {
+			rest = append(rest, h.Name)
+		}
+	}
+	results = append(results, ProbeJobHostResults(job, rest, opts)...)
+	finishJob(job, len(hosts), results)
+	return results, nil
+}
+
+// streamProber probes hosts as enumeration reports them, opts.Workers at a
+// time, and streams each result to the job's callback.
+type streamProber struct {
+	job  Job
+	opts *probe.ProbeOptions
+	sem  chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	probed  map[string]bool
+	results []SubdomainResult
+}
+
+func newStreamProber(job Job, opts *probe.ProbeOptions) *streamProber {
+	return &streamProber{job: job, opts: opts, sem: make(chan struct{}, max(opts.Workers, 1)), probed: make(map[string]bool)}
+}
+
+func (p *streamProber) add(found enum.Result) {
+	name := strings.TrimSpace(strings.ToLower(found.Name))
+	p.mu.Lock()
+	seen := p.probed[name]
+	p.probed[name] = true
+	p.mu.Unlock()
+	if name == "" || seen {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ctx := p.job.Context()
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		check := probe.CheckHostContext(ctx, name, p.opts)
+		<-p.sem
+		if ctx.Err() != nil {
+			return
+		}
+		result := SubdomainResultFromCheck(check)
+		result.Sources = found.Sources
+		p.mu.Lock()
+		p.results = append(p.results, result)
+		p.mu.Unlock()
+		if p.job.Callback != nil {
+			p.job.Callback(result)
+		}
+	}()
+}
+
+// wait returns the probed results and every host handed to add. Hosts whose
+// probe was cut short by cancellation are handed but not in the results.
+func (p *streamProber) wait() ([]SubdomainResult, map[string]bool) {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.results, p.probed
+}
+
+// PrepareHosts derives the host candidates for a job: the direct target plus
+// enumerated subdomains for public domains, or local fallback hosts otherwise.
+// Every source runs, with subfinder configured by subfinder (nil uses the
+// default binary and timeout); sources that fail are logged and skipped.
+func PrepareHosts(job Job, subfinder *enum.SubfinderOptions) ([]string, error) {
+	found, _, err := PrepareHostSources(job, enum.NewSources(nil, enum.Options{Subfinder: subfinder}))
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(found))
+	for _, f := range found {
+		hosts = append(hosts, f.Name)
+	}
+	return hosts, nil
+}
+
+// PrepareHostSources is PrepareHosts with the enumeration sources chosen by
+// the caller. Each host lists the sources that reported it. A failing source
+// degrades the result instead of failing it: its error is returned in failed,
+// alongside the hosts the other sources found. When job.Recurse is set, the
+// sources also run on discovered sub-zones; when job.Permute is set,
+// permutations of the enumerated names that resolve are added as well.
+func PrepareHostSources(job Job, sources []enum.Enumerator) (hosts []enum.Result, failed enum.SourceErrors, err error) {
 	enumDomain, directProbeHost := normalizeTargetForRecon(job.Target)
 
 	// Start with a direct probe target so local/single-host scans still work
 	// even when subdomain enumeration is not applicable.
-	hostCandidates := make([]string, 0)
+	candidates := make([]enum.Result, 0)
 	if directProbeHost != "" {
-		hostCandidates = append(hostCandidates, directProbeHost)
+		target := enum.Result{Name: directProbeHost, Sources: []string{SourceTarget}}
+		candidates = append(candidates, target)
+		if job.Found != nil {
+			job.Found(target)
+		}
 	}
 
-	// Public domains go through subfinder; localhost/IP targets use fallback host generation.
+	// Public domains are enumerated; localhost/IP targets use fallback host generation.
 	if enumDomain != "" {
-		subdomains, err := enum.EnumerateSubdomains(enumDomain, &enum.SubfinderOptions{
-			BinaryPath: "subfinder",
-			Timeout:    120 * time.Second,
-		})
-		if err != nil {
-			log.Printf("[recon] subfinder error for %s: %v", enumDomain, err)
-			return nil, err
+		found, err := enum.EnumerateStream(job.Context(), enumDomain, sources, job.Found)
+		if err != nil && !errors.As(err, &failed) {
+			return nil, nil, err
 		}
-		hostCandidates = append(hostCandidates, subdomains...)
+		if job.Recurse != nil && len(found) > 0 && job.Context().Err() == nil {
+			var zoneFailures enum.SourceErrors
+			found, zoneFailures = job.Recurse.Expand(job.Context(), enumDomain, found, sources)
+			failed = append(failed, zoneFailures...)
+		}
+		if job.Permute != nil && len(found) > 0 && job.Context().Err() == nil {
+			permuted, err := permuteHosts(job, enumDomain, found)
+			if err != nil {
+				failed = append(failed, enum.SourceError{Source: enum.SourcePermutation, Err: err})
+			}
+			found = append(found, permuted...)
+		}
+		if job.Context().Err() != nil {
+			// Cut short by cancellation or a phase deadline: keep what was found.
+			log.Printf("[recon] enumeration stopped early for %s, keeping %d subdomains", enumDomain, len(found))
+			failed = nil
+		}
+		candidates = append(candidates, found...)
 	} else {
 		fallbackHosts := enumerateLocalFallbackHosts(directProbeHost)
-		hostCandidates = append(hostCandidates, fallbackHosts...)
-		log.Printf("[recon] subfinder skipped for local/IP target: %s (fallback hosts=%d)", job.Target, len(fallbackHosts))
+		for _, h := range fallbackHosts {
+			candidates = append(candidates, enum.Result{Name: h, Sources: []string{SourceLocal}})
+		}
+		log.Printf("[recon] enumeration skipped for local/IP target: %s (fallback hosts=%d)", job.Target, len(fallbackHosts))
 	}
 
-	// Deduplicate while preserving order.
-	seen := make(map[string]struct{}, len(hostCandidates))
-	subdomains := make([]string, 0, len(hostCandidates))
-	for _, h := range hostCandidates {
-		h = strings.TrimSpace(strings.ToLower(h))
+	// Deduplicate while preserving order, merging the sources of repeated hosts.
+	index := make(map[string]int, len(candidates))
+	hosts = make([]enum.Result, 0, len(candidates))
+	for _, c := range candidates {
+		h := strings.TrimSpace(strings.ToLower(c.Name))
 		if h == "" {
 			continue
 		}
-		if _, exists := seen[h]; exists {
-			continue
+		i, exists := index[h]
+		if !exists {
+			i = len(hosts)
+			index[h] = i
+			hosts = append(hosts, enum.Result{Name: h})
+		}
+		for _, src := range c.Sources {
+			if !containsSource(hosts[i].Sources, src) {
+				hosts[i].Sources = append(hosts[i].Sources, src)
+			}
 		}
-		seen[h] = struct{}{}
-		subdomains = append(subdomains, h)
 	}
 
-	if len(subdomains) == 0 {
-		return nil, fmt.Errorf("no valid hosts derived from target: %s", job.Target)
+	if len(hosts) == 0 {
+		return nil, failed, fmt.Errorf("no valid hosts derived from target: %s", job.Target)
 	}
 
-	log.Printf("[recon] prepared %d hosts, starting concurrent probing", len(subdomains))
+	log.Printf("[recon] prepared %d hosts", len(hosts))
+	return hosts, failed, nil
+}
+
+func permuteHosts(job Job, domain string, found []enum.Result) ([]enum.Result, error) {
+	// Resolves permutations of the enumerated names; names confirmed before a
+	// failure are kept.
+	known := make([]string, 0, len(found))
+	for _, f := range found {
+		known = append(known, f.Name)
+	}
+	names, err := job.Permute.Expand(job.Context(), domain, known)
+	if err != nil {
+		log.Printf("[recon] permutation failed for %s: %v", domain, err)
+	}
+	out := make([]enum.Result, 0, len(names))
+	for _, name := range names {
+		out = append(out, enum.Result{Name: name, Sources: []string{enum.SourcePermutation}})
+	}
+	return out, err
+}
+
+func containsSource(sources []string, want string) bool {
+	for _, s := range sources {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
 
-	// Worker count is auto-tuned from machine resources unless caller overrides it.
+// DefaultJobProbeOptions returns the probe settings used for worker jobs, with
+// the worker count auto-tuned from machine resources unless the job overrides it.
+func DefaultJobProbeOptions(job Job) *probe.ProbeOptions {
 	runtimeCfg := GetRuntimeConfig()
 	workers := runtimeCfg.MaxWorkers
 	if job.Workers > 0 {
@@ -110,14 +308,13 @@ func HandleJob(job Job) ([]SubdomainResult, error) {
 	}
 
 	log.Printf(
-		"[recon] worker_pool targets=%d workers=%d config_workers=%d job_workers=%d",
-		len(subdomains),
+		"[recon] worker_pool workers=%d config_workers=%d job_workers=%d",
 		workers,
 		runtimeCfg.ComputedWorkers,
 		job.Workers,
 	)
 
-	opts := &probe.ProbeOptions{
+	return &probe.ProbeOptions{
 		Workers:      workers,
 		HTTPTimeout:  10 * time.Second,
 		DNSTimeout:   5 * time.Second,
@@ -125,61 +322,133 @@ func HandleJob(job Job) ([]SubdomainResult, error) {
 		HttpxBinary:  "httpx",
 		HttpxTimeout: 5,
 	}
+}
 
-	// Probe all hosts concurrently with streaming callback
-	results := make([]SubdomainResult, 0, len(subdomains))
-	aliveCount := 0
-	var resultsMutex sync.Mutex
+// ProbeJobHosts probes hosts concurrently, streams each result to job.Callback
+// and saves the subdomain artifact for later phases. A nil opts uses
+// DefaultJobProbeOptions.
+func ProbeJobHosts(job Job, hosts []string, opts *probe.ProbeOptions) []SubdomainResult {
+	if opts == nil {
+		opts = DefaultJobProbeOptions(job)
+	}
 
-	// Streaming callback is called as soon as each host check is ready.
-	// This enables real-time updates in frontend through Django websocket broadcast.
-	streamCallback := func(check probe.HostCheck) {
-		primaryIP := ""
-		if len(check.IPs) > 0 {
-			primaryIP = check.IPs[0]
+	log.Printf("[recon] probing %d hosts with %d workers", len(hosts), opts.Workers)
+	results := ProbeJobHostResults(job, hosts, opts)
+	finishJob(job, len(hosts), results)
+	return results
+}
+
+func finishJob(job Job, hosts int, results []SubdomainResult) {
+	// Logs the job's totals and saves the subdomain artifact.
+	aliveCount := 0
+	for _, result := range results {
+		if result.Alive {
+			aliveCount++
 		}
+	}
+	log.Printf("[recon] probing complete: %d alive out of %d subdomains", aliveCount, len(results))
+
+	// A job cut short by cancellation or a phase deadline saves what it probed.
+	if err := job.Context().Err(); err != nil {
+		log.Printf("[recon] probing stopped early: scan_id=%d probed=%d/%d", job.ScanID, len(results), hosts)
+	}
+
+	if _, err := SaveSubdomainsToFile(job, results); err != nil {
+		log.Printf("[recon] failed to save results for scan_id=%d: %v", job.ScanID, err)
+	}
 
-		// Ensure ips is always an array, never null
-		ips := check.IPs
-		if ips == nil {
-			ips = []string{}
+	log.Printf("[recon] job finished: scan_id=%d target=%s subdomains=%d alive=%d",
+		job.ScanID, job.Target, len(results), aliveCount)
+}
+
+// ProbeJobHostResults probes hosts like ProbeJobHosts without saving the
+// artifact. Each result carries the sources job.Sources lists for its host.
+func ProbeJobHostResults(job Job, hosts []string, opts *probe.ProbeOptions) []SubdomainResult {
+	if opts == nil {
+		opts = DefaultJobProbeOptions(job)
+	}
+	callback := job.Callback
+	if len(job.Sources) > 0 && callback != nil {
+		callback = func(result SubdomainResult) {
+			result.Sources = job.Sources[result.Name]
+			job.Callback(result)
 		}
+	}
 
-		result := SubdomainResult{
-			Name:     check.Host,
-			IP:       primaryIP,
-			IPs:      ips,
-			Alive:    check.Alive,
-			ErrorMsg: check.ErrorMsg,
+	results := ProbeHostResultsContext(job.Context(), hosts, opts, callback)
+	if len(job.Sources) > 0 {
+		for i := range results {
+			results[i].Sources = job.Sources[results[i].Name]
 		}
+	}
+	return results
+}
+
+// ProbeHostResults probes hosts concurrently and converts each check into a
+// SubdomainResult, passing it to callback (if set) as soon as it is ready.
+func ProbeHostResults(hosts []string, opts *probe.ProbeOptions, callback func(SubdomainResult)) []SubdomainResult {
+	return ProbeHostResultsContext(context.Background(), hosts, opts, callback)
+}
+
+// ProbeHostResultsContext is ProbeHostResults with cancellation. Hosts whose
+// probe was cut short by ctx are left out of the results. Hosts restored from
+// a pause checkpoint are in the results but not passed to callback again.
+func ProbeHostResultsContext(ctx context.Context, hosts []string, opts *probe.ProbeOptions, callback func(SubdomainResult)) []SubdomainResult {
+	results := make([]SubdomainResult, 0, len(hosts))
+	var resultsMutex sync.Mutex
+
+	// Streaming callback is called as soon as each host check is ready.
+	// This enables real-time updates in frontend through Django websocket broadcast.
+	streamCallback := func(check probe.HostCheck) {
+		result := SubdomainResultFromCheck(check)
 
 		// Thread-safe result storage
 		resultsMutex.Lock()
 		results = append(results, result)
-		if check.Alive {
-			aliveCount++
-		}
 		resultsMutex.Unlock()
 
 		// Call user-provided callback immediately (for real-time updates)
-		if job.Callback != nil {
-			job.Callback(result)
+		if callback != nil {
+			callback(result)
 		}
 	}
 
 	// Probe all hosts with streaming
-	probe.ProbeHostsWithCallback(subdomains, opts, streamCallback)
+	for _, check := range probe.ProbeHostsContext(ctx, hosts, opts, streamCallback) {
+		if check.Restored {
+			results = append(results, SubdomainResultFromCheck(check))
+		}
+	}
+	return results
+}
 
-	log.Printf("[recon] probing complete: %d alive out of %d subdomains", aliveCount, len(results))
+// SubdomainResultFromCheck converts a probe result into the ingest shape.
+func SubdomainResultFromCheck(check probe.HostCheck) SubdomainResult {
+	primaryIP := ""
+	if len(check.IPs) > 0 {
+		primaryIP = check.IPs[0]
+	}
 
-	if _, err := SaveSubdomainsToFile(job, results); err != nil {
-		log.Printf("[recon] failed to save results for scan_id=%d: %v", job.ScanID, err)
+	// Ensure ips is always an array, never null
+	ips := check.IPs
+	if ips == nil {
+		ips = []string{}
 	}
 
-	log.Printf("[recon] job finished: scan_id=%d target=%s subdomains=%d alive=%d",
-		job.ScanID, job.Target, len(results), aliveCount)
+	return SubdomainResult{
+		Name:     check.Host,
+		IP:       primaryIP,
+		IPs:      ips,
+		Alive:    check.Alive,
+		ErrorMsg: check.ErrorMsg,
+	}
+}
 
-	return results, nil
+// NeedsEnumeration reports whether PrepareHosts enumerates subdomains of target.
+// Localhost and IP targets use local fallback hosts instead.
+func NeedsEnumeration(target string) bool {
+	enumDomain, _ := normalizeTargetForRecon(target)
+	return enumDomain != ""
 }
 
 func normalizeTargetForRecon(rawTarget string) (enumDomain string, probeHost string) {
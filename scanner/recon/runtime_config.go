@@ -13,6 +13,12 @@ import (
 const (
 	gbBytes         = int64(1024 * 1024 * 1024)
 	minFreeRAMBytes = 2 * gbBytes
+
+	// Each full scan runs its own probe, httpx, katana and nmap pools, so the
+	// scan-level limit is budgeted separately from per-pool workers.
+	ramPerScanBytes       = 2 * gbBytes
+	maxComputedScans      = 8
+	defaultMaxQueuedScans = 50
 )
 
 // RuntimeConfig captures computed runtime settings for recon worker pools.
@@ -24,6 +30,10 @@ type RuntimeConfig struct {
 	ComputedWorkers int
 	MaxWorkers      int
 	EnvOverrideUsed bool
+
+	// Scan admission control for the worker's scheduler.
+	MaxConcurrentScans int
+	MaxQueuedScans     int
 }
 
 var (
@@ -59,24 +69,31 @@ func GetRuntimeConfig() RuntimeConfig {
 			}
 		}
 
+		maxScans := envPositiveInt("RECON_MAX_CONCURRENT_SCANS", scanCountFromResources(cores, freeRAMBytes))
+		maxQueued := envPositiveInt("RECON_MAX_QUEUED_SCANS", defaultMaxQueuedScans)
+
 		runtimeConfig = RuntimeConfig{
-			DetectedCores:   cores,
-			GOMAXPROCS:      gomaxprocs,
-			FreeRAMBytes:    freeRAMBytes,
-			FreeRAMGB:       freeRAMGB,
-			ComputedWorkers: computedWorkers,
-			MaxWorkers:      maxWorkers,
-			EnvOverrideUsed: envOverrideUsed,
+			DetectedCores:      cores,
+			GOMAXPROCS:         gomaxprocs,
+			FreeRAMBytes:       freeRAMBytes,
+			FreeRAMGB:          freeRAMGB,
+			ComputedWorkers:    computedWorkers,
+			MaxWorkers:         maxWorkers,
+			EnvOverrideUsed:    envOverrideUsed,
+			MaxConcurrentScans: maxScans,
+			MaxQueuedScans:     maxQueued,
 		}
 
 		log.Printf(
-			"[recon] runtime_config detected_cores=%d free_ram_gb=%.2f computed_workers=%d max_workers=%d env_override_used=%t gomaxprocs=%d",
+			"[recon] runtime_config detected_cores=%d free_ram_gb=%.2f computed_workers=%d max_workers=%d env_override_used=%t gomaxprocs=%d max_concurrent_scans=%d max_queued_scans=%d",
 			runtimeConfig.DetectedCores,
 			runtimeConfig.FreeRAMGB,
 			runtimeConfig.ComputedWorkers,
 			runtimeConfig.MaxWorkers,
 			runtimeConfig.EnvOverrideUsed,
 			runtimeConfig.GOMAXPROCS,
+			runtimeConfig.MaxConcurrentScans,
+			runtimeConfig.MaxQueuedScans,
 		)
 	})
 
@@ -105,6 +122,36 @@ func workerCountFromResources(cores int, freeRAMBytes int64) int {
 	return 2
 }
 
+func scanCountFromResources(cores int, freeRAMBytes int64) int {
+	// One scan per two cores, further capped by free RAM so concurrent nmap/katana
+	// runs cannot exhaust the machine.
+	scans := cores / 2
+	if byRAM := int(freeRAMBytes / ramPerScanBytes); byRAM < scans {
+		scans = byRAM
+	}
+	if scans > maxComputedScans {
+		scans = maxComputedScans
+	}
+	if scans < 1 {
+		scans = 1
+	}
+	return scans
+}
+
+func envPositiveInt(key string, fallback int) int {
+	// Reads a positive integer override, logging and ignoring invalid values.
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("[recon] runtime_config invalid_env_override key=%s value=%q", key, raw)
+		return fallback
+	}
+	return v
+}
+
 // getAvailableRAMBytes reads MemAvailable from /proc/meminfo.
 // If unavailable, it returns a large value so CPU-based scaling is used.
 func getAvailableRAMBytes() int64 {
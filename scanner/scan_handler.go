@@ -1,28 +1,25 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	endpointspkg "recon/endpoints"
+	"recon/jobqueue"
 	networkpkg "recon/network"
+	"recon/pause"
+	"recon/pipeline"
+	"recon/ratelimit"
 	reconpkg "recon/recon"
-)
-
-// Track active scans with their cancel functions
-var (
-	activeScans   = make(map[int64]context.CancelFunc)
-	activeScansMu sync.RWMutex
+	"recon/scope"
+	"recon/sink"
 )
 
 type ScanRequest struct {
@@ -30,13 +27,18 @@ type ScanRequest struct {
 	Target      string            `json:"target"`
 	UserID      int64             `json:"user_id"`      // User ID for file organization
 	BackendBase string            `json:"backend_base"` // e.g. http://localhost:8000
-	AuthHeader  string            `json:"auth_header"`  // pass through (dev)
+	AuthHeader  string            `json:"auth_header"`  // optional Authorization header forwarded on callbacks
 	AuthHeaders map[string]string `json:"auth_headers"`
 	AuthCookies map[string]string `json:"auth_cookies"`
 	AuthType    string            `json:"auth_type"`
 	LoginURL    string            `json:"login_url"`
 	Username    string            `json:"username"`
 	Password    string            `json:"password"`
+	Priority    int               `json:"queue_priority"` // Higher runs first when scans are queued; set from the user's plan
+	Profile     string            `json:"profile"`        // Named scan profile, see /profiles (default: standard)
+	Options     pipeline.Options  `json:"options"`        // Phase selection and overrides applied on top of the profile
+	Sinks       []sink.Config     `json:"sinks"`          // Result destinations (default: the Django backend)
+	Scope       scope.Rules       `json:"scope"`          // Hosts and URLs the scan may touch (default: the target and its subdomains)
 }
 
 func scanHandler(w http.ResponseWriter, r *http.Request) {
@@ -46,38 +48,116 @@ func scanHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if shuttingDown() {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "worker is shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	var req ScanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	// Resolve the profile now so the journal keeps the effective options even if
+	// the profile file changes before a resume.
+	opts, err := scanProfiles.Resolve(req.Profile, req.Options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Refuse or downgrade up front when tools the scan needs are not installed,
+	// instead of failing host by host.
+	toolInventory.Refresh(r.Context(), toolCheckMaxAge)
+	opts, toolWarnings, err := opts.AdaptToTools(toolInventory, req.Target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	req.Options = opts
+	if err := req.Scope.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sink.Validate(req.Sinks, scanSinkEnv(req)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Create cancellable context for this scan
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create cancellable context for this scan and register it so it can be
+	// queried through /scans and cancelled through /cancel.
+	ctx, cancel := context.WithCancel(workerCtx)
+	scan, ok := scans.start(req, cancel)
+	if !ok {
+		cancel()
+		http.Error(w, "scan already running", http.StatusConflict)
+		return
+	}
+
+	out, err := openScanSink(req)
+	if err != nil {
+		log.Printf("[scan] failed to open sinks for scan %d: %v", req.ScanID, err)
+		scan.finish("FAILED", err.Error())
+		cancel()
+		http.Error(w, "failed to open result sinks", http.StatusInternalServerError)
+		return
+	}
+	scan.attachPause(newScanPauser(req.ScanID, false), out)
+
+	// Persist the job before acknowledging it so a restart can replay it.
+	if err := journalScan(req); err != nil {
+		log.Printf("[scan] failed to journal scan %d: %v", req.ScanID, err)
+		scan.finish("FAILED", err.Error())
+		_ = out.Close()
+		cancel()
+		http.Error(w, "failed to persist scan", http.StatusInternalServerError)
+		return
+	}
 
-	// Store cancel function
-	activeScansMu.Lock()
-	activeScans[req.ScanID] = cancel
-	activeScansMu.Unlock()
+	for _, warning := range toolWarnings {
+		log.Printf("[scan] scan %d: %s", req.ScanID, warning)
+		out.OnLog("⚠️ "+warning, "warning")
+	}
 
-	go func() {
-		defer func() {
-			// Remove from active scans when done
-			activeScansMu.Lock()
-			delete(activeScans, req.ScanID)
-			activeScansMu.Unlock()
-		}()
-		runFullScan(ctx, req)
-	}()
+	// Admission control: run now, queue, or reject when the queue is full.
+	queued, err := scheduler.submit(&queuedScan{ctx: ctx, cancel: cancel, scan: scan, req: req, out: out}, false)
+	if err != nil {
+		log.Printf("[scan] rejected scan %d: %v", req.ScanID, err)
+		_ = scanJournal.Finish(req.ScanID, "REJECTED")
+		scans.remove(req.ScanID)
+		_ = out.Close()
+		cancel()
+		w.Header().Set("Retry-After", "30")
+		if errors.Is(err, errDraining) {
+			http.Error(w, "worker is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "scan queue is full, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	status := "RUNNING"
+	if queued {
+		status = "QUEUED"
+		log.Printf("[scan] queued scan %d for user %d", req.ScanID, req.UserID)
+		out.OnStatus(sink.Status{Status: "QUEUED"})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"ok":      true,
 		"scan_id": req.ScanID,
 		"target":  req.Target,
+		"status":  status,
 	})
 }
 
+func runQueuedScan(q *queuedScan) {
+	// Scheduler entry point: runs one admitted scan on a free slot.
+	defer q.cancel()
+	q.scan.markRunning()
+	runFullScan(q.ctx, q.scan, q.req, q.out, q.resume)
+}
+
 func cancelScanHandler(w http.ResponseWriter, r *http.Request) {
 	// Cancels an active scan by calling the stored context cancel function.
 	if r.Method != http.MethodPost {
@@ -93,12 +173,8 @@ func cancelScanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Look up and call cancel function
-	activeScansMu.RLock()
-	cancel, exists := activeScans[req.ScanID]
-	activeScansMu.RUnlock()
-
-	if !exists {
+	// Look up the scan in the registry and call its cancel function
+	if !scans.cancel(req.ScanID) {
 		// Scan not running or already completed
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]any{
@@ -108,8 +184,10 @@ func cancelScanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Cancel the scan
-	cancel()
+	// Scans still waiting in the queue never reach runFullScan, so report them here.
+	if q, ok := scheduler.remove(req.ScanID); ok {
+		finishScan(q.scan, q.out, "CANCELLED", "Scan cancelled by user")
+	}
 	log.Printf("[scan] cancelled scan %d", req.ScanID)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -119,341 +197,243 @@ func cancelScanHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func runFullScan(ctx context.Context, req ScanRequest) {
-	// Full scan pipeline in order:
-	// 1) subdomain discovery + liveness
-	// 2) endpoint discovery + fingerprinting
-	// 3) network analysis (ports/TLS/directories)
-	// Each phase streams progress/data back to Django ingestion endpoints.
-	statusURL := fmt.Sprintf("%s/api/recon/scans/%d/status/", req.BackendBase, req.ScanID)
-	subIngest := fmt.Sprintf("%s/api/recon/scans/%d/ingest/subdomains/", req.BackendBase, req.ScanID)
-	epIngest := fmt.Sprintf("%s/api/recon/scans/%d/ingest/endpoints/", req.BackendBase, req.ScanID)
-	portIngest := fmt.Sprintf("%s/api/recon/scans/%d/network/ports/ingest/", req.BackendBase, req.ScanID)
-	tlsIngest := fmt.Sprintf("%s/api/recon/scans/%d/network/tls/ingest/", req.BackendBase, req.ScanID)
-	dirIngest := fmt.Sprintf("%s/api/recon/scans/%d/network/dirs/ingest/", req.BackendBase, req.ScanID)
-	logURL := fmt.Sprintf("%s/api/recon/scans/%d/logs/", req.BackendBase, req.ScanID)
-
-	postStatus(req.AuthHeader, statusURL, "RUNNING", "")
-
-	// 1) Subdomains with real-time streaming
-	log.Printf("[scan] starting subdomain discovery with streaming")
-	postLog(req.AuthHeader, logURL, fmt.Sprintf("🔍 Starting subdomain enumeration for %s...", req.Target), "info")
-
-	// Check for cancellation
-	select {
-	case <-ctx.Done():
-		log.Printf("[scan] scan %d cancelled before subdomain enumeration", req.ScanID)
-		postStatus(req.AuthHeader, statusURL, "CANCELLED", "Scan cancelled by user")
-		postLog(req.AuthHeader, logURL, "❌ Scan cancelled by user", "warning")
+func scanListHandler(w http.ResponseWriter, r *http.Request) {
+	// Lists running and recently finished scans known to this worker.
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
-	default:
-	}
-
-	// Create streaming callback for immediate updates
-	subdomainCallback := func(sub reconpkg.SubdomainResult) {
-		// Send immediately to backend (single item)
-		postJSON(req.AuthHeader, subIngest, map[string]any{
-			"items": []reconpkg.SubdomainResult{sub},
-		})
-		log.Printf("[scan] streamed subdomain: %s (alive=%v)", sub.Name, sub.Alive)
 	}
 
-	subs, err := reconpkg.HandleJob(reconpkg.Job{
-		ScanID:   req.ScanID,
-		Target:   req.Target,
-		UserID:   req.UserID,
-		Callback: subdomainCallback,
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"scans":     scans.list(),
+		"scheduler": scheduler.snapshot(),
 	})
-	if err != nil {
-		postStatus(req.AuthHeader, statusURL, "FAILED", err.Error())
-		postLog(req.AuthHeader, logURL, fmt.Sprintf("❌ Subdomain enumeration failed: %v", err), "error")
+}
+
+func scanStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Reports phase, counters and timings for one scan: GET /scans/{id}.
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	log.Printf("[scan] subdomain discovery complete: %d total", len(subs))
-	aliveCount := 0
-	for _, sub := range subs {
-		if sub.Alive {
-			aliveCount++
-		}
+	rawID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/scans/"), "/")
+	scanID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid scan id", http.StatusBadRequest)
+		return
 	}
-	postLog(req.AuthHeader, logURL, fmt.Sprintf("✅ Subdomain enumeration complete: found %d subdomains (%d alive)", len(subs), aliveCount), "success")
 
-	// Check for cancellation before endpoints
-	select {
-	case <-ctx.Done():
-		log.Printf("[scan] scan %d cancelled before endpoint discovery", req.ScanID)
-		postStatus(req.AuthHeader, statusURL, "CANCELLED", "Scan cancelled by user")
-		postLog(req.AuthHeader, logURL, "❌ Scan cancelled by user", "warning")
+	scan, ok := scans.get(scanID)
+	if !ok {
+		http.Error(w, "scan not found", http.StatusNotFound)
 		return
-	default:
 	}
 
-	// 2) Endpoints with real-time streaming
-	log.Printf("[scan] starting endpoint discovery with streaming")
-	postLog(req.AuthHeader, logURL, "🕷️ Starting endpoint discovery (gau + katana)...", "info")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(scan.snapshot())
+}
 
-	// Set log callbacks for progress updates during discovery and probing
-	endpointspkg.SetLogCallback(func(message, level string) {
-		postLog(req.AuthHeader, logURL, message, level)
-	})
-	endpointspkg.SetDiscoveryLogCallback(func(message, level string) {
-		postLog(req.AuthHeader, logURL, message, level)
-	})
+func runFullScan(ctx context.Context, scan *scanEntry, req ScanRequest, out sink.Sink, resume *jobqueue.Job) {
+	// Full scan pipeline, ordered by the stage DAG:
+	// subdomains -> probe -> endpoints -> fingerprint, and probe -> network.
+	// req.Options may select a subset of phases and override their settings.
+	// Each stage streams progress/data to the scan's sinks (Django by default).
+	// resume is non-nil for jobs replayed from the journal after a restart.
+	// While paused (see /pause) the stages' worker pools stop dispatching work.
+	// Every outbound request is paced per target host by the scan's rate limit
+	// and goes through the scan's proxy, if any.
+	ctx = ratelimit.WithLimiter(ctx, scanRateLimiter(req.Options))
+	ctx = withScanProxy(ctx, req.Options)
+	pauser, _ := scan.pauseControl()
+	if pauser != nil {
+		ctx = pause.WithController(ctx, pauser)
+	}
+	if pauser != nil && pauser.Paused() {
+		out.OnStatus(sink.Status{Status: "PAUSED"})
+	} else {
+		out.OnStatus(sink.Status{Status: "RUNNING"})
+	}
+	var completed []string
+	if resume != nil {
+		completed = resume.CompletedPhases
+		out.OnLog(fmt.Sprintf("♻️ Worker restarted, resuming scan (completed phases: %s)", describePhases(completed)), "warning")
+	}
 
-	// Create streaming callback for immediate updates
-	endpointCallback := func(ep endpointspkg.EndpointResult) {
-		// Send immediately to backend (single item)
-		postJSON(req.AuthHeader, epIngest, map[string]any{
-			"items": []endpointspkg.EndpointResult{ep},
-		})
-		log.Printf("[scan] streamed endpoint: %s (status=%d)", ep.URL, ep.StatusCode)
+	plan, err := req.Options.Plan()
+	if err != nil {
+		finishScan(scan, out, "FAILED", err.Error())
+		return
+	}
+	// Stages only touch hosts and URLs in the scan's scope.
+	engine, err := scope.New(req.Scope, req.Target)
+	if err != nil {
+		finishScan(scan, out, "FAILED", err.Error())
+		return
 	}
+	ctx = scope.WithEngine(ctx, engine)
 
-	authConfig := &endpointspkg.DiscoveryAuthConfig{
+	st := pipeline.NewState(req.ScanID, req.Target, req.UserID)
+	st.Events = scanEvents(scan, out)
+	pipeline.Put(st, pipeline.KeyDiscoveryAuth, &endpointspkg.DiscoveryAuthConfig{
 		AuthType: req.AuthType,
 		LoginURL: req.LoginURL,
 		Username: req.Username,
 		Password: req.Password,
 		Headers:  req.AuthHeaders,
 		Cookies:  req.AuthCookies,
-	}
+	})
 
-	eps, err := endpointspkg.DiscoverEndpointsFromScanWithAuthAndCallback(ctx, req.UserID, req.ScanID, req.Target, authConfig, endpointCallback)
-	if err != nil {
-		// Check if error is due to cancellation
-		if err == context.Canceled {
-			log.Printf("[scan] scan %d cancelled during endpoint discovery", req.ScanID)
-			postStatus(req.AuthHeader, statusURL, "CANCELLED", "Scan cancelled by user")
-			postLog(req.AuthHeader, logURL, "❌ Scan cancelled by user", "warning")
-			return
-		}
-		postStatus(req.AuthHeader, statusURL, "FAILED", err.Error())
-		postLog(req.AuthHeader, logURL, fmt.Sprintf("❌ Endpoint discovery failed: %v", err), "error")
-		return
+	// The max duration is measured from when this run starts, so a scan resumed
+	// after a restart gets a fresh clock.
+	var deadline time.Time
+	if d := req.Options.Deadlines.MaxDuration(); d > 0 {
+		deadline = time.Now().Add(d)
 	}
 
-	log.Printf("[scan] endpoint discovery complete: %d total", len(eps))
-	// Note: Progress log already sent by endpoints package
-
-	// 3) Network Analysis - Run port scanning, TLS checks, and directory checks for discovered hosts
-	log.Printf("[network] starting network analysis for scan %d", req.ScanID)
-
-	// Collect unique hosts from subdomains (alive hosts)
-	hosts := make([]string, 0)
-	seenHosts := make(map[string]struct{})
-	for _, sub := range subs {
-		if sub.Alive {
-			networkHost := normalizeNetworkHost(sub.Name)
-			if networkHost == "" {
-				continue
+	var done []string
+	var truncated []sink.TruncatedPhase
+	var stageStart time.Time
+	err = plan.Run(ctx, st, pipeline.RunOptions{
+		Completed: completed,
+		Stop:      draining,
+		Budgets:   req.Options.Deadlines.Budgets(),
+		Deadline:  deadline,
+		OnTruncated: func(t pipeline.Truncation) {
+			tp := sink.TruncatedPhase{Phase: t.Stage, Reason: t.Reason, Skipped: t.Skipped}
+			if t.Skipped {
+				out.OnLog(fmt.Sprintf("⏭️ Skipping %s: scan reached its maximum duration", t.Stage), "warning")
+			} else {
+				tp.Limit = t.Limit.String()
+				out.OnLog(fmt.Sprintf("⏱️ %s stopped after %s (%s), keeping partial results", t.Stage, t.Limit, t.Reason), "warning")
 			}
-			if _, exists := seenHosts[networkHost]; exists {
-				continue
+			truncated = append(truncated, tp)
+		},
+		OnStageStart: func(stage string) {
+			scan.enterPhase(stage)
+			stageStart = time.Now()
+			log.Printf("[scan] scan %d: starting stage %s", req.ScanID, stage)
+		},
+		OnStageDone: func(stage string, restored bool) {
+			if !restored && errors.Is(context.Cause(ctx), errWorkerShutdown) {
+				// The stage swallowed the shutdown cancellation; its results may be
+				// incomplete, so it runs again on resume.
+				return
 			}
-			seenHosts[networkHost] = struct{}{}
-			hosts = append(hosts, networkHost)
+			done = append(done, stage)
+			if restored {
+				restoreScanCounters(scan, st, stage)
+				return
+			}
+			phaseDuration.ObserveSince(stageStart, stage)
+			checkpointScan(req.ScanID, stage)
+		},
+	})
+	if err != nil {
+		var stageErr *pipeline.StageError
+		stage := "pipeline"
+		if errors.As(err, &stageErr) {
+			stage = stageErr.Stage
+			err = stageErr.Err
 		}
-	}
-
-	if len(hosts) == 0 {
-		log.Printf("[network] no alive hosts found, skipping network analysis")
-		postLog(req.AuthHeader, logURL, "⚠️ No alive hosts found, skipping network analysis", "warning")
-	} else {
-		// Check for cancellation before network analysis
-		select {
-		case <-ctx.Done():
-			log.Printf("[scan] scan %d cancelled before network analysis", req.ScanID)
-			postStatus(req.AuthHeader, statusURL, "CANCELLED", "Scan cancelled by user")
-			postLog(req.AuthHeader, logURL, "❌ Scan cancelled by user", "warning")
+		// Shutdown stops scans between stages, or cancels them after the grace period.
+		if errors.Is(err, pipeline.ErrStopped) || errors.Is(context.Cause(ctx), errWorkerShutdown) {
+			interruptScan(scan, out, done)
 			return
-		default:
 		}
-
-		log.Printf("[network] analyzing %d hosts", len(hosts))
-		postLog(req.AuthHeader, logURL, fmt.Sprintf("🔬 Starting network analysis for %d hosts...", len(hosts)), "info")
-
-		// Run network analysis concurrently with worker pool (pass context for cancellation)
-		runNetworkAnalysis(ctx, hosts, req.AuthHeader, portIngest, tlsIngest, dirIngest)
-
-		// Check if cancelled during network analysis
-		select {
-		case <-ctx.Done():
-			log.Printf("[scan] scan %d cancelled during network analysis", req.ScanID)
-			postStatus(req.AuthHeader, statusURL, "CANCELLED", "Scan cancelled by user")
-			postLog(req.AuthHeader, logURL, "❌ Scan cancelled by user", "warning")
+		if errors.Is(err, context.Canceled) {
+			log.Printf("[scan] scan %d cancelled during %s", req.ScanID, stage)
+			out.OnLog("❌ Scan cancelled by user", "warning")
+			finishScan(scan, out, "CANCELLED", "Scan cancelled by user")
 			return
-		default:
-		}
-
-		postLog(req.AuthHeader, logURL, fmt.Sprintf("✅ Network analysis complete for %d hosts", len(hosts)), "success")
-	}
-
-	postStatus(req.AuthHeader, statusURL, "COMPLETED", "")
-	postLog(req.AuthHeader, logURL, "🎉 Scan completed successfully!", "success")
-}
-
-func normalizeNetworkHost(rawHost string) string {
-	// Normalizes host values so network tools receive clean hostnames.
-	// Handles cases like scheme, ports, and bracketed IPv6 notation.
-	host := strings.TrimSpace(rawHost)
-	if host == "" {
-		return ""
-	}
-
-	if strings.Contains(host, "://") {
-		if parsed, err := url.Parse(host); err == nil {
-			host = parsed.Host
 		}
+		out.OnLog(fmt.Sprintf("❌ Stage %s failed: %v", stage, err), "error")
+		finishScan(scan, out, "FAILED", err.Error())
+		return
 	}
-
-	if h, _, err := net.SplitHostPort(host); err == nil {
-		host = h
+	// A stage may return nil after shutdown cancelled it; the scan is not done.
+	if errors.Is(context.Cause(ctx), errWorkerShutdown) {
+		interruptScan(scan, out, done)
+		return
 	}
 
-	host = strings.Trim(host, "[]")
-	host = strings.TrimSpace(host)
-	if host == "" {
-		return ""
+	if len(truncated) > 0 {
+		msg := describeTruncation(truncated)
+		out.OnLog("⚠️ Scan completed with partial results: "+msg, "warning")
+		finishScanStatus(scan, out, sink.Status{Status: "COMPLETED_PARTIAL", Error: msg, Truncated: truncated})
+		return
 	}
 
-	return strings.ToLower(host)
+	out.OnLog("🎉 Scan completed successfully!", "success")
+	finishScan(scan, out, "COMPLETED", "")
 }
 
-func runNetworkAnalysis(ctx context.Context, hosts []string, authHeader, portIngest, tlsIngest, dirIngest string) {
-	// Runs per-host network checks in a worker pool and supports cancellation.
-	workers := 10
-	jobs := make(chan string, len(hosts))
-	var wg sync.WaitGroup
-
-	// Worker pool for concurrent host scanning
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for host := range jobs {
-				// Check for cancellation before processing each host
-				select {
-				case <-ctx.Done():
-					log.Printf("[network] worker cancelled, stopping analysis")
-					return
-				default:
-				}
-				analyzeHost(host, authHeader, portIngest, tlsIngest, dirIngest)
-			}
-		}()
-	}
-
-	// Send jobs
-	for _, host := range hosts {
-		select {
-		case <-ctx.Done():
-			log.Printf("[network] context cancelled, stopping job distribution")
-			close(jobs)
-			wg.Wait()
-			return
-		case jobs <- host:
+func describeTruncation(phases []sink.TruncatedPhase) string {
+	// Summarizes truncated phases for the final status, e.g.
+	// "endpoints stopped after 10m0s (phase_budget); network skipped".
+	parts := make([]string, 0, len(phases))
+	for _, p := range phases {
+		if p.Skipped {
+			parts = append(parts, p.Phase+" skipped")
+		} else {
+			parts = append(parts, fmt.Sprintf("%s stopped after %s (%s)", p.Phase, p.Limit, p.Reason))
 		}
 	}
-	close(jobs)
-
-	// Wait for workers to finish
-	wg.Wait()
+	return strings.Join(parts, "; ")
 }
 
-func analyzeHost(host, authHeader, portIngest, tlsIngest, dirIngest string) {
-	// Runs 3 checks on one host and sends findings in chunks:
-	// open ports, TLS posture, and sensitive directory exposure.
-	log.Printf("[network] analyzing host: %s", host)
-
-	// 1) Port Scanning
-	portFindings, err := networkpkg.ScanHostPorts(host, 200)
-	if err != nil {
-		log.Printf("[network] port scan failed for %s: %v", host, err)
-	} else if len(portFindings) > 0 {
-		log.Printf("[network] found %d open ports on %s", len(portFindings), host)
-
-		// Send port findings in chunks of 50
-		chunkSize := 50
-		for i := 0; i < len(portFindings); i += chunkSize {
-			j := i + chunkSize
-			if j > len(portFindings) {
-				j = len(portFindings)
+func scanEvents(scan *scanEntry, out sink.Sink) pipeline.Events {
+	// Routes stage results to the scan's counters and its sinks.
+	// The Django sink batches findings per ingest URL; delivery retries and spools on failure.
+	return pipeline.Events{
+		Log: out.OnLog,
+		Subdomain: func(sub reconpkg.SubdomainResult) {
+			scan.addHostProbed(sub.Alive)
+			out.OnSubdomain(sub)
+			log.Printf("[scan] streamed subdomain: %s (alive=%v)", sub.Name, sub.Alive)
+		},
+		DNS: out.OnDNS,
+		Endpoint: func(ep endpointspkg.EndpointResult) {
+			scan.addURLDiscovered()
+			out.OnEndpoint(ep)
+			log.Printf("[scan] streamed endpoint: %s (status=%d)", ep.URL, ep.StatusCode)
+		},
+		Ports: func(host string, findings []networkpkg.PortFinding) {
+			for _, finding := range findings {
+				out.OnPort(finding)
 			}
-			postJSON(authHeader, portIngest, map[string]any{
-				"items": portFindings[i:j],
-			})
-		}
-	}
-
-	// 2) TLS Check
-	tlsResult := networkpkg.CheckTLS(host)
-	if tlsResult.HasHTTPS || len(tlsResult.Issues) > 0 {
-		log.Printf("[network] TLS check for %s: HTTPS=%v, issues=%d",
-			host, tlsResult.HasHTTPS, len(tlsResult.Issues))
-		postJSON(authHeader, tlsIngest, tlsResult)
-	}
-
-	// 3) Directory Checks
-	dirFindings := networkpkg.CheckDirectories(host, tlsResult.HasHTTPS)
-	if len(dirFindings) > 0 {
-		log.Printf("[network] found %d directory issues on %s", len(dirFindings), host)
-
-		// Send directory findings in chunks of 50
-		chunkSize := 50
-		for i := 0; i < len(dirFindings); i += chunkSize {
-			j := i + chunkSize
-			if j > len(dirFindings) {
-				j = len(dirFindings)
+		},
+		TLS: out.OnTLS,
+		Directories: func(host string, findings []networkpkg.DirectoryFinding) {
+			for _, finding := range findings {
+				out.OnDirectory(finding)
 			}
-			postJSON(authHeader, dirIngest, map[string]any{
-				"items": dirFindings[i:j],
-			})
-		}
-	}
-}
-
-func postStatus(authHeader, url, status, errMsg string) {
-	// Sends scan status changes (RUNNING/COMPLETED/FAILED/CANCELLED) to Django.
-	body := map[string]any{"status": status}
-	if errMsg != "" {
-		body["error"] = errMsg
+		},
+		HostAnalyzed: func(host string) {
+			scan.addHostNetworkAnalyzed()
+		},
+		Error: func(err error) {
+			scan.recordError(err.Error())
+		},
 	}
-	postJSON(authHeader, url, body)
 }
 
-func postLog(authHeader, url, message, level string) {
-	// Sends structured log messages so frontend can show real-time scan logs.
-	body := map[string]any{
-		"message":   message,
-		"level":     level,
-		"timestamp": time.Now().Format(time.RFC3339),
-	}
-	postJSON(authHeader, url, body)
+func finishScan(scan *scanEntry, out sink.Sink, status, errMsg string) {
+	finishScanStatus(scan, out, sink.Status{Status: status, Error: errMsg})
 }
 
-func postJSON(authHeader, url string, payload any) {
-	// Shared HTTP POST helper used by all callback endpoints in this worker.
-	data, _ := json.Marshal(payload)
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
-	req.Header.Set("Content-Type", "application/json")
-	if authHeader != "" {
-		req.Header.Set("Authorization", authHeader)
+func finishScanStatus(scan *scanEntry, out sink.Sink, final sink.Status) {
+	// Records the terminal status in the registry and journal, then reports it to
+	// the sinks, which deliver queued findings first, and closes them.
+	scan.finish(final.Status, final.Error)
+	scansFinished.Inc(final.Status)
+	removePauseCheckpoint(scan.scanID)
+	if err := scanJournal.Finish(scan.scanID, final.Status); err != nil {
+		log.Printf("[scan] failed to journal final status for scan %d: %v", scan.scanID, err)
 	}
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("[scan] POST %s failed: %v", url, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Log response status
-	if resp.StatusCode >= 400 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("[scan] POST %s returned %d: %s", url, resp.StatusCode, string(bodyBytes))
-	} else {
-		log.Printf("[scan] POST %s succeeded (%d)", url, resp.StatusCode)
+	out.OnStatus(final)
+	if err := out.Close(); err != nil {
+		log.Printf("[scan] failed to close sinks for scan %d: %v", scan.scanID, err)
 	}
 }
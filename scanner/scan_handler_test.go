@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"recon/delivery"
+	"recon/jobqueue"
+	"recon/pipeline"
+)
+
+func TestScanHandlerDecodesBackendPayload(t *testing.T) {
+	prevScans, prevScheduler, prevJournal, prevProfiles, prevCallbacks := scans, scheduler, scanJournal, scanProfiles, callbacks
+	t.Cleanup(func() {
+		scans, scheduler, scanJournal, scanProfiles, callbacks = prevScans, prevScheduler, prevJournal, prevProfiles, prevCallbacks
+	})
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(backend.Close)
+	dispatcher, err := delivery.NewDispatcher(delivery.Config{SpoolDir: filepath.Join(t.TempDir(), "outbox")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dispatcher.Close(context.Background()) })
+	callbacks = dispatcher
+
+	journal, _, err := jobqueue.Open(filepath.Join(t.TempDir(), "jobs.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { journal.Close() })
+	started := make(chan ScanRequest, 1)
+	scans, scanJournal, scanProfiles = newScanRegistry(), journal, pipeline.BuiltinProfiles()
+	scheduler = newScanScheduler(1, 1, func(q *queuedScan) { started <- q.req })
+
+	// The body StartScanView posts to /scan.
+	body := `{
+		"scan_id": 21,
+		"target": "example.com",
+		"user_id": 4,
+		"backend_base": "` + backend.URL + `",
+		"auth_header": "Bearer user-jwt",
+		"auth_headers": {},
+		"auth_cookies": {},
+		"auth_type": "none",
+		"login_url": "",
+		"username": "",
+		"password": "",
+		"worker_count": 20,
+		"queue_priority": 3
+	}`
+	rec := httptest.NewRecorder()
+	scanHandler(rec, httptest.NewRequest(http.MethodPost, "/scan", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /scan = %d %s", rec.Code, rec.Body)
+	}
+
+	select {
+	case req := <-started:
+		if req.ScanID != 21 || req.UserID != 4 || req.Priority != 3 || req.AuthHeader != "Bearer user-jwt" {
+			t.Fatalf("decoded request = %+v", req)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan was never started")
+	}
+}
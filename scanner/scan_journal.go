@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"recon/jobqueue"
+	"recon/pipeline"
+	"recon/sink"
+)
+
+var (
+	// scanJournal persists accepted scans so they survive worker restarts.
+	scanJournal *jobqueue.Journal
+
+	// journalKey seals scan credentials in the journal; without it they are
+	// not journaled at all.
+	journalKey []byte
+)
+
+// errCredentialsNotJournaled fails the resume of a scan whose credentials were
+// dropped from the journal, instead of running it unauthenticated.
+var errCredentialsNotJournaled = errors.New("scan credentials were not journaled (set RECON_JOURNAL_KEY to resume authenticated scans)")
+
+// journaledScan is the journal payload of a scan: the request without its
+// credentials, which are sealed separately or dropped.
+type journaledScan struct {
+	ScanRequest
+	SealedCredentials  []byte `json:"sealed_credentials,omitempty"`
+	CredentialsDropped bool   `json:"credentials_dropped,omitempty"`
+}
+
+// scanCredentials are the secret fields of a ScanRequest.
+type scanCredentials struct {
+	AuthHeader  string            `json:"auth_header,omitempty"`
+	AuthHeaders map[string]string `json:"auth_headers,omitempty"`
+	AuthCookies map[string]string `json:"auth_cookies,omitempty"`
+	Password    string            `json:"password,omitempty"`
+	SinkAuth    map[int]string    `json:"sink_auth,omitempty"` // Sink AuthHeader by index in Sinks
+}
+
+func (c scanCredentials) empty() bool {
+	return c.AuthHeader == "" && len(c.AuthHeaders) == 0 && len(c.AuthCookies) == 0 && c.Password == "" && len(c.SinkAuth) == 0
+}
+
+func openScanJournal() []jobqueue.Job {
+	// Opens (and compacts) the on-disk journal, returning scans that never finished.
+	path := "data/jobs.journal"
+	if v := os.Getenv("RECON_JOURNAL_PATH"); v != "" {
+		path = v
+	}
+
+	journal, pending, err := jobqueue.Open(path)
+	if err != nil {
+		log.Fatalf("failed to open job journal %s: %v", path, err)
+	}
+	scanJournal = journal
+
+	if journalKey = journalKeyFromEnv(); journalKey == nil {
+		log.Printf("[scan] RECON_JOURNAL_KEY not set, scan credentials are not journaled and authenticated scans cannot be resumed")
+	}
+
+	log.Printf("[scan] job journal %s opened, %d unfinished scans", path, len(pending))
+	return pending
+}
+
+func journalKeyFromEnv() []byte {
+	// Derives the AES-256 key sealing credentials at rest from RECON_JOURNAL_KEY.
+	key := os.Getenv("RECON_JOURNAL_KEY")
+	if key == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func journalScan(req ScanRequest) error {
+	// Journals req with its credentials sealed with journalKey, or dropped when
+	// there is no key, so they are never written to disk in plaintext.
+	creds := scanCredentials{AuthHeader: req.AuthHeader, AuthHeaders: req.AuthHeaders, AuthCookies: req.AuthCookies, Password: req.Password}
+	entry := journaledScan{ScanRequest: req}
+	entry.AuthHeader, entry.AuthHeaders, entry.AuthCookies, entry.Password = "", nil, nil, ""
+	entry.Sinks = append([]sink.Config(nil), req.Sinks...)
+	for i := range entry.Sinks {
+		if entry.Sinks[i].AuthHeader != "" {
+			if creds.SinkAuth == nil {
+				creds.SinkAuth = make(map[int]string)
+			}
+			creds.SinkAuth[i] = entry.Sinks[i].AuthHeader
+			entry.Sinks[i].AuthHeader = ""
+		}
+	}
+
+	if !creds.empty() {
+		if journalKey == nil {
+			entry.CredentialsDropped = true
+		} else {
+			sealed, err := sealCredentials(journalKey, creds)
+			if err != nil {
+				return err
+			}
+			entry.SealedCredentials = sealed
+		}
+	}
+	return scanJournal.Accept(req.ScanID, entry)
+}
+
+func (entry journaledScan) request() (ScanRequest, error) {
+	// Returns the journaled request with its sealed credentials restored.
+	// Entries written before credentials were sealed carry them in plaintext.
+	req := entry.ScanRequest
+	switch {
+	case entry.CredentialsDropped:
+		return req, errCredentialsNotJournaled
+	case entry.SealedCredentials != nil:
+		if journalKey == nil {
+			return req, errCredentialsNotJournaled
+		}
+		creds, err := openCredentials(journalKey, entry.SealedCredentials)
+		if err != nil {
+			return req, err
+		}
+		req.AuthHeader, req.AuthHeaders, req.AuthCookies, req.Password = creds.AuthHeader, creds.AuthHeaders, creds.AuthCookies, creds.Password
+		for i, header := range creds.SinkAuth {
+			if i >= 0 && i < len(req.Sinks) {
+				req.Sinks[i].AuthHeader = header
+			}
+		}
+	}
+	return req, nil
+}
+
+func sealCredentials(key []byte, creds scanCredentials) ([]byte, error) {
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newJournalAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func openCredentials(key, sealed []byte) (scanCredentials, error) {
+	var creds scanCredentials
+	aead, err := newJournalAEAD(key)
+	if err != nil {
+		return creds, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return creds, errors.New("sealed scan credentials are truncated")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return creds, fmt.Errorf("cannot unseal scan credentials (RECON_JOURNAL_KEY changed?): %w", err)
+	}
+	err = json.Unmarshal(plain, &creds)
+	return creds, err
+}
+
+func newJournalAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func resumePendingScans(pending []jobqueue.Job) {
+	// Restarts every unfinished scan from its last completed phase.
+	for i := range pending {
+		job := pending[i]
+
+		var entry journaledScan
+		if err := json.Unmarshal(job.Payload, &entry); err != nil {
+			log.Printf("[scan] dropping unreadable journaled scan %d: %v", job.ScanID, err)
+			_ = scanJournal.Finish(job.ScanID, "FAILED")
+			continue
+		}
+		req, credErr := entry.request()
+
+		ctx, cancel := context.WithCancel(workerCtx)
+		scan, ok := scans.start(req, cancel)
+		if !ok {
+			cancel()
+			continue
+		}
+
+		out, err := openScanSink(req)
+		if err != nil {
+			log.Printf("[scan] dropping journaled scan %d, sinks unavailable: %v", req.ScanID, err)
+			scan.finish("FAILED", err.Error())
+			_ = scanJournal.Finish(job.ScanID, "FAILED")
+			cancel()
+			continue
+		}
+		if credErr != nil {
+			// Running without the credentials would silently scan unauthenticated.
+			log.Printf("[scan] failing journaled scan %d: %v", req.ScanID, credErr)
+			out.OnStatus(sink.Status{Status: "FAILED", Error: credErr.Error()})
+			scan.finish("FAILED", credErr.Error())
+			_ = scanJournal.Finish(job.ScanID, "FAILED")
+			_ = out.Close()
+			cancel()
+			continue
+		}
+
+		// A scan paused before the restart comes back paused.
+		pauser := newScanPauser(req.ScanID, true)
+		scan.attachPause(pauser, out)
+		if pauser.Paused() {
+			scan.setPaused(true)
+			log.Printf("[scan] scan %d was paused before the restart, waiting for /resume", req.ScanID)
+		}
+
+		log.Printf("[scan] resuming scan %d for %s (completed phases: %s)", req.ScanID, req.Target, describePhases(job.CompletedPhases))
+		queued, _ := scheduler.submit(&queuedScan{ctx: ctx, cancel: cancel, scan: scan, req: req, out: out, resume: &job}, true)
+		if queued && pauser.Paused() {
+			out.OnStatus(sink.Status{Status: "PAUSED"})
+		} else if queued {
+			out.OnStatus(sink.Status{Status: "QUEUED"})
+		}
+	}
+}
+
+func checkpointScan(scanID int64, phase string) {
+	// Marks a phase as completed; its artifact on disk is reused on resume.
+	if err := scanJournal.Checkpoint(scanID, phase); err != nil {
+		log.Printf("[scan] failed to checkpoint scan %d phase %s: %v", scanID, phase, err)
+	}
+}
+
+func restoreScanCounters(scan *scanEntry, st *pipeline.State, stage string) {
+	// Restored stages did not stream results, so rebuild the status counters from
+	// their artifacts.
+	switch stage {
+	case pipeline.StageProbe:
+		subs, _ := pipeline.Get(st, pipeline.KeySubdomains)
+		for _, sub := range subs {
+			scan.addHostProbed(sub.Alive)
+		}
+	case pipeline.StageEndpoints:
+		eps, _ := pipeline.Get(st, pipeline.KeyEndpoints)
+		for range eps {
+			scan.addURLDiscovered()
+		}
+	}
+}
+
+func describePhases(phases []string) string {
+	if len(phases) == 0 {
+		return "none"
+	}
+	return strings.Join(phases, ", ")
+}
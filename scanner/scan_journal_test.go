@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"recon/jobqueue"
+	"recon/sink"
+)
+
+func TestJournalKeepsCredentialsOffDisk(t *testing.T) {
+	prevJournal, prevKey := scanJournal, journalKey
+	t.Cleanup(func() { scanJournal, journalKey = prevJournal, prevKey })
+
+	req := ScanRequest{
+		ScanID:      5,
+		Target:      "example.com",
+		AuthHeader:  "Bearer callback-token",
+		AuthHeaders: map[string]string{"X-Api-Key": "header-secret"},
+		AuthCookies: map[string]string{"session": "cookie-secret"},
+		Username:    "alice",
+		Password:    "hunter2",
+		Sinks: []sink.Config{
+			{Type: "django"},
+			{Type: "webhook", URL: "https://hooks.example.com/recon", AuthHeader: "Bearer webhook-secret"},
+		},
+	}
+	secrets := []string{"callback-token", "header-secret", "cookie-secret", "hunter2", "webhook-secret"}
+
+	cases := []struct {
+		name    string
+		key     []byte
+		wantErr error
+	}{
+		{"sealed with a key", []byte(strings.Repeat("k", 32)), nil},
+		{"dropped without a key", nil, errCredentialsNotJournaled},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jobs.journal")
+			journal, _, err := jobqueue.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scanJournal, journalKey = journal, tc.key
+			if err := journalScan(req); err != nil {
+				t.Fatal(err)
+			}
+			journal.Close()
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range secrets {
+				if strings.Contains(string(raw), secret) {
+					t.Fatalf("journal contains %q in plaintext", secret)
+				}
+			}
+
+			_, pending, err := jobqueue.Open(path)
+			if err != nil || len(pending) != 1 {
+				t.Fatalf("reopen: %d pending, %v", len(pending), err)
+			}
+			entry := decodeJournaledScan(t, pending[0].Payload)
+			got, err := entry.request()
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("request() error = %v, want %v", err, tc.wantErr)
+			}
+			if got.Username != "alice" || got.Target != "example.com" {
+				t.Fatalf("non-secret fields lost: %+v", got)
+			}
+			if tc.wantErr == nil && (got.Password != "hunter2" || got.AuthHeader != req.AuthHeader ||
+				got.AuthHeaders["X-Api-Key"] != "header-secret" || got.AuthCookies["session"] != "cookie-secret" ||
+				got.Sinks[1].AuthHeader != "Bearer webhook-secret") {
+				t.Fatalf("credentials not restored: %+v", got)
+			}
+			if got.Sinks[1].URL != "https://hooks.example.com/recon" {
+				t.Fatalf("sink config lost: %+v", got.Sinks)
+			}
+		})
+	}
+}
+
+func TestJournaledScanWrongKey(t *testing.T) {
+	prevKey := journalKey
+	t.Cleanup(func() { journalKey = prevKey })
+
+	sealed, err := sealCredentials([]byte(strings.Repeat("a", 32)), scanCredentials{Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	journalKey = []byte(strings.Repeat("b", 32))
+	if _, err := (journaledScan{SealedCredentials: sealed}).request(); err == nil {
+		t.Fatal("credentials unsealed with the wrong key")
+	}
+
+	// Entries journaled before sealing still carry their credentials.
+	legacy := decodeJournaledScan(t, []byte(`{"scan_id":1,"password":"old"}`))
+	if req, err := legacy.request(); err != nil || req.Password != "old" {
+		t.Fatalf("legacy entry = %+v, %v", req, err)
+	}
+}
+
+func decodeJournaledScan(t *testing.T, payload []byte) journaledScan {
+	t.Helper()
+	var entry journaledScan
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"recon/pause"
+	"recon/sink"
+)
+
+func pauseCheckpointPath(scanID int64) string {
+	// RECON_CHECKPOINT_DIR (default data/checkpoints) holds one file per paused scan.
+	return filepath.Join(envOr("RECON_CHECKPOINT_DIR", "data/checkpoints"), fmt.Sprintf("scan_%d.json", scanID))
+}
+
+func newScanPauser(scanID int64, resumed bool) *pause.Controller {
+	// A resumed scan continues from the checkpoint its last run left behind; a
+	// new scan starts clean.
+	path := pauseCheckpointPath(scanID)
+	var saved pause.Checkpoint
+	if resumed {
+		var err error
+		if saved, err = pause.LoadFile(path); err != nil {
+			log.Printf("[scan] ignoring pause checkpoint of scan %d: %v", scanID, err)
+		}
+	} else {
+		removePauseCheckpoint(scanID)
+	}
+	return pause.NewController(saved, pause.FileSaver(path))
+}
+
+func removePauseCheckpoint(scanID int64) {
+	if err := os.Remove(pauseCheckpointPath(scanID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[scan] failed to remove pause checkpoint of scan %d: %v", scanID, err)
+	}
+}
+
+func pauseScanHandler(w http.ResponseWriter, r *http.Request) {
+	// Pauses a queued or running scan: worker pools stop dispatching new work and
+	// record what they have left, and the next phase does not start.
+	setScanPaused(w, r, true)
+}
+
+func resumeScanHandler(w http.ResponseWriter, r *http.Request) {
+	// Resumes a paused scan where its worker pools stopped.
+	setScanPaused(w, r, false)
+}
+
+func setScanPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ScanID int64 `json:"scan_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	reply := func(ok bool, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      ok,
+			"message": message,
+		})
+	}
+
+	scan, ok := scans.get(req.ScanID)
+	if !ok || !scan.active() {
+		reply(false, "scan not found or already completed")
+		return
+	}
+	c, out := scan.pauseControl()
+	if c == nil {
+		reply(false, "scan not found or already completed")
+		return
+	}
+
+	if paused {
+		if !c.Pause() {
+			reply(false, "scan already paused")
+			return
+		}
+		scan.setPaused(true)
+		log.Printf("[scan] paused scan %d", req.ScanID)
+		out.OnLog("⏸️ Scan paused, in-flight requests finish and no new work is dispatched", "warning")
+		out.OnStatus(sink.Status{Status: "PAUSED"})
+		reply(true, "scan paused")
+		return
+	}
+
+	if !c.Resume() {
+		reply(false, "scan is not paused")
+		return
+	}
+	status := scan.setPaused(false)
+	log.Printf("[scan] resumed scan %d", req.ScanID)
+	out.OnLog("▶️ Scan resumed", "info")
+	out.OnStatus(sink.Status{Status: status})
+	reply(true, "scan resumed")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"recon/pipeline"
+)
+
+// scanProfiles holds the named option bundles scan requests can refer to.
+var scanProfiles *pipeline.Profiles
+
+func loadScanProfiles() {
+	// Loads built-in profiles plus RECON_PROFILES_PATH (default profiles.json),
+	// whose entries replace built-ins with the same name.
+	path := "profiles.json"
+	if v := os.Getenv("RECON_PROFILES_PATH"); v != "" {
+		path = v
+	}
+
+	profiles, err := pipeline.LoadProfiles(path)
+	if err != nil {
+		log.Fatalf("failed to load scan profiles: %v", err)
+	}
+	scanProfiles = profiles
+
+	log.Printf("[scan] %d scan profiles available", len(profiles.List()))
+}
+
+func profilesHandler(w http.ResponseWriter, r *http.Request) {
+	// Lists the scan profiles and the options each one applies.
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(scanProfiles.List())
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"recon/pause"
+	"recon/sink"
+)
+
+// Finished scans stay queryable for a while so ops can inspect them after
+// Django callbacks were lost.
+const (
+	finishedScanRetention = time.Hour
+	maxFinishedScans      = 200
+)
+
+// scans is the process-wide registry of running and recently finished scans.
+var scans = newScanRegistry()
+
+// scanRegistry tracks every scan started by this worker together with its
+// cancel function, current phase, counters and timings.
+type scanRegistry struct {
+	mu    sync.RWMutex
+	scans map[int64]*scanEntry
+}
+
+// scanEntry is the mutable state for one scan. All fields are guarded by mu.
+type scanEntry struct {
+	mu sync.Mutex
+
+	scanID int64
+	target string
+	userID int64
+	cancel context.CancelFunc
+	pauser *pause.Controller
+	out    sink.Sink
+
+	status     string
+	pausedFrom string // Status to return to on resume
+	phase      string
+	phases     []*phaseTiming
+	queuedAt   time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	lastError  string
+
+	hostsProbed          int64
+	hostsAlive           int64
+	urlsDiscovered       int64
+	hostsNetworkAnalyzed int64
+}
+
+type phaseTiming struct {
+	name       string
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// ScanSnapshot is the JSON view returned by GET /scans and GET /scans/{id}.
+type ScanSnapshot struct {
+	ScanID         int64           `json:"scan_id"`
+	Target         string          `json:"target"`
+	UserID         int64           `json:"user_id"`
+	Status         string          `json:"status"`
+	Phase          string          `json:"phase"`
+	QueuedAt       time.Time       `json:"queued_at"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	ElapsedSeconds float64         `json:"elapsed_seconds"`
+	Phases         []PhaseSnapshot `json:"phases"`
+	Counters       ScanCounters    `json:"counters"`
+	LastError      string          `json:"last_error,omitempty"`
+}
+
+// PhaseSnapshot reports timing for one phase of a scan.
+type PhaseSnapshot struct {
+	Name           string     `json:"name"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	ElapsedSeconds float64    `json:"elapsed_seconds"`
+}
+
+// ScanCounters holds per-phase progress counters.
+type ScanCounters struct {
+	HostsProbed          int64 `json:"hosts_probed"`
+	HostsAlive           int64 `json:"hosts_alive"`
+	URLsDiscovered       int64 `json:"urls_discovered"`
+	HostsNetworkAnalyzed int64 `json:"hosts_network_analyzed"`
+}
+
+func newScanRegistry() *scanRegistry {
+	return &scanRegistry{scans: make(map[int64]*scanEntry)}
+}
+
+// start registers a new scan in QUEUED state. It returns false if a scan with
+// the same id is still queued or running on this worker.
+func (r *scanRegistry) start(req ScanRequest, cancel context.CancelFunc) (*scanEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pruneLocked(time.Now())
+
+	if existing, ok := r.scans[req.ScanID]; ok && existing.active() {
+		return nil, false
+	}
+
+	entry := &scanEntry{
+		scanID:   req.ScanID,
+		target:   req.Target,
+		userID:   req.UserID,
+		cancel:   cancel,
+		status:   "QUEUED",
+		queuedAt: time.Now(),
+	}
+	r.scans[req.ScanID] = entry
+	return entry, true
+}
+
+// remove forgets a scan entirely, e.g. when it was rejected by admission control.
+func (r *scanRegistry) remove(scanID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.scans, scanID)
+}
+
+// get returns the entry for a scan id, running or recently finished.
+func (r *scanRegistry) get(scanID int64) (*scanEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.scans[scanID]
+	return entry, ok
+}
+
+// cancel calls the cancel function of a queued or running scan. It returns
+// false if the scan is unknown or already finished.
+func (r *scanRegistry) cancel(scanID int64) bool {
+	entry, ok := r.get(scanID)
+	if !ok || !entry.active() {
+		return false
+	}
+	entry.cancel()
+	return true
+}
+
+// list returns snapshots of all known scans, newest first.
+func (r *scanRegistry) list() []ScanSnapshot {
+	r.mu.Lock()
+	r.pruneLocked(time.Now())
+	entries := make([]*scanEntry, 0, len(r.scans))
+	for _, entry := range r.scans {
+		entries = append(entries, entry)
+	}
+	r.mu.Unlock()
+
+	out := make([]ScanSnapshot, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entry.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].QueuedAt.After(out[j].QueuedAt)
+	})
+	return out
+}
+
+// pruneLocked drops finished scans that are older than the retention window
+// or exceed the retention count. Callers must hold r.mu.
+func (r *scanRegistry) pruneLocked(now time.Time) {
+	type finishedScan struct {
+		scanID     int64
+		finishedAt time.Time
+	}
+
+	finished := make([]finishedScan, 0)
+	for id, entry := range r.scans {
+		entry.mu.Lock()
+		finishedAt := entry.finishedAt
+		entry.mu.Unlock()
+		if finishedAt.IsZero() {
+			continue
+		}
+		if now.Sub(finishedAt) > finishedScanRetention {
+			delete(r.scans, id)
+			continue
+		}
+		finished = append(finished, finishedScan{scanID: id, finishedAt: finishedAt})
+	}
+
+	if len(finished) <= maxFinishedScans {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].finishedAt.Before(finished[j].finishedAt)
+	})
+	for _, f := range finished[:len(finished)-maxFinishedScans] {
+		delete(r.scans, f.scanID)
+	}
+}
+
+// active reports whether the scan is queued or running.
+func (e *scanEntry) active() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.finishedAt.IsZero()
+}
+
+// markRunning moves a scan out of the queue once the scheduler dispatches it.
+func (e *scanEntry) markRunning() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.status == "PAUSED" {
+		e.pausedFrom = "RUNNING"
+	} else {
+		e.status = "RUNNING"
+	}
+	e.startedAt = time.Now()
+}
+
+// attachPause records the scan's pause controller and sinks for /pause and /resume.
+func (e *scanEntry) attachPause(c *pause.Controller, out sink.Sink) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pauser = c
+	e.out = out
+}
+
+// pauseControl returns what attachPause recorded; c is nil before that.
+func (e *scanEntry) pauseControl() (*pause.Controller, sink.Sink) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pauser, e.out
+}
+
+// setPaused switches the status to PAUSED and back. It returns the status
+// now in effect.
+func (e *scanEntry) setPaused(paused bool) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.finishedAt.IsZero() {
+		return e.status
+	}
+	switch {
+	case paused && e.status != "PAUSED":
+		e.pausedFrom = e.status
+		e.status = "PAUSED"
+	case !paused && e.status == "PAUSED":
+		e.status = e.pausedFrom
+	}
+	return e.status
+}
+
+// enterPhase closes the current phase (if any) and starts timing a new one.
+func (e *scanEntry) enterPhase(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	e.closePhaseLocked(now)
+	e.phase = name
+	e.phases = append(e.phases, &phaseTiming{name: name, startedAt: now})
+}
+
+// finish records the terminal status of the scan.
+func (e *scanEntry) finish(status, errMsg string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	e.closePhaseLocked(now)
+	e.status = status
+	e.finishedAt = now
+	if errMsg != "" {
+		e.lastError = errMsg
+	}
+}
+
+// recordError keeps the most recent error without ending the scan.
+func (e *scanEntry) recordError(errMsg string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastError = errMsg
+}
+
+func (e *scanEntry) addHostProbed(alive bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hostsProbed++
+	if alive {
+		e.hostsAlive++
+	}
+}
+
+func (e *scanEntry) addURLDiscovered() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.urlsDiscovered++
+}
+
+func (e *scanEntry) addHostNetworkAnalyzed() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hostsNetworkAnalyzed++
+}
+
+func (e *scanEntry) closePhaseLocked(now time.Time) {
+	if n := len(e.phases); n > 0 && e.phases[n-1].finishedAt.IsZero() {
+		e.phases[n-1].finishedAt = now
+	}
+}
+
+func (e *scanEntry) snapshot() ScanSnapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	end := now
+	var finishedAt *time.Time
+	if !e.finishedAt.IsZero() {
+		end = e.finishedAt
+		t := e.finishedAt
+		finishedAt = &t
+	}
+
+	var startedAt *time.Time
+	elapsed := 0.0
+	if !e.startedAt.IsZero() {
+		t := e.startedAt
+		startedAt = &t
+		elapsed = end.Sub(e.startedAt).Seconds()
+	}
+
+	phases := make([]PhaseSnapshot, 0, len(e.phases))
+	for _, p := range e.phases {
+		phaseEnd := now
+		var phaseFinished *time.Time
+		if !p.finishedAt.IsZero() {
+			phaseEnd = p.finishedAt
+			t := p.finishedAt
+			phaseFinished = &t
+		}
+		phases = append(phases, PhaseSnapshot{
+			Name:           p.name,
+			StartedAt:      p.startedAt,
+			FinishedAt:     phaseFinished,
+			ElapsedSeconds: phaseEnd.Sub(p.startedAt).Seconds(),
+		})
+	}
+
+	return ScanSnapshot{
+		ScanID:         e.scanID,
+		Target:         e.target,
+		UserID:         e.userID,
+		Status:         e.status,
+		Phase:          e.phase,
+		QueuedAt:       e.queuedAt,
+		StartedAt:      startedAt,
+		FinishedAt:     finishedAt,
+		ElapsedSeconds: elapsed,
+		Phases:         phases,
+		Counters: ScanCounters{
+			HostsProbed:          e.hostsProbed,
+			HostsAlive:           e.hostsAlive,
+			URLsDiscovered:       e.urlsDiscovered,
+			HostsNetworkAnalyzed: e.hostsNetworkAnalyzed,
+		},
+		LastError: e.lastError,
+	}
+}
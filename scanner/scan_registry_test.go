@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistryStartAndFinish(t *testing.T) {
+	r := newScanRegistry()
+	cancelled := false
+	entry, ok := r.start(ScanRequest{ScanID: 1, Target: "example.com", UserID: 7}, func() { cancelled = true })
+	if !ok {
+		t.Fatal("first start rejected")
+	}
+
+	steps := []struct {
+		name       string
+		action     func()
+		wantStatus string
+		wantActive bool
+		restartOK  bool // Whether another start with the same id is accepted
+	}{
+		{"queued", func() {}, "QUEUED", true, false},
+		{"running", entry.markRunning, "RUNNING", true, false},
+		{"finished", func() { entry.finish("FAILED", "boom") }, "FAILED", false, true},
+	}
+	for _, step := range steps {
+		step.action()
+		snap := entry.snapshot()
+		if snap.Status != step.wantStatus || entry.active() != step.wantActive {
+			t.Fatalf("%s: status=%s active=%v, want %s %v", step.name, snap.Status, entry.active(), step.wantStatus, step.wantActive)
+		}
+		if step.restartOK {
+			break
+		}
+		if _, ok := r.start(ScanRequest{ScanID: 1}, func() {}); ok {
+			t.Fatalf("%s: duplicate start accepted while active", step.name)
+		}
+	}
+
+	snap := entry.snapshot()
+	if snap.Target != "example.com" || snap.UserID != 7 || snap.LastError != "boom" || snap.StartedAt == nil || snap.FinishedAt == nil {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	if r.cancel(1) || cancelled {
+		t.Fatal("a finished scan must not be cancelled")
+	}
+	if _, ok := r.start(ScanRequest{ScanID: 1}, func() {}); !ok {
+		t.Fatal("restart of a finished scan rejected")
+	}
+	if !r.cancel(1) {
+		t.Fatal("cancel of the restarted scan failed")
+	}
+}
+
+func TestRegistryPhaseTimingAndCounters(t *testing.T) {
+	r := newScanRegistry()
+	entry, _ := r.start(ScanRequest{ScanID: 2}, func() {})
+	entry.markRunning()
+
+	entry.enterPhase("subdomains")
+	time.Sleep(5 * time.Millisecond)
+	entry.enterPhase("probe")
+	entry.addHostProbed(true)
+	entry.addHostProbed(false)
+	entry.addURLDiscovered()
+	entry.addHostNetworkAnalyzed()
+	entry.recordError("one host failed")
+
+	snap := entry.snapshot()
+	if snap.Phase != "probe" || len(snap.Phases) != 2 {
+		t.Fatalf("phases = %+v", snap.Phases)
+	}
+	first, second := snap.Phases[0], snap.Phases[1]
+	if first.FinishedAt == nil || first.ElapsedSeconds <= 0 || second.FinishedAt != nil {
+		t.Fatalf("phase timings = %+v, %+v", first, second)
+	}
+	if !first.FinishedAt.Equal(second.StartedAt) {
+		t.Fatal("a phase must end when the next one starts")
+	}
+	want := ScanCounters{HostsProbed: 2, HostsAlive: 1, URLsDiscovered: 1, HostsNetworkAnalyzed: 1}
+	if snap.Counters != want || snap.LastError != "one host failed" || snap.Status != "RUNNING" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+
+	entry.finish("COMPLETED", "")
+	if snap := entry.snapshot(); snap.Phases[1].FinishedAt == nil || snap.LastError != "one host failed" {
+		t.Fatalf("finish must close the phase and keep the last error: %+v", snap)
+	}
+}
+
+func TestRegistrySetPaused(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(e *scanEntry)
+		calls []bool
+		want  []string
+	}{
+		{"pause and resume a running scan", (*scanEntry).markRunning, []bool{true, true, false}, []string{"PAUSED", "PAUSED", "RUNNING"}},
+		{"resume a scan that is not paused", (*scanEntry).markRunning, []bool{false}, []string{"RUNNING"}},
+		{"queued scan resumes to the queue", func(*scanEntry) {}, []bool{true, false}, []string{"PAUSED", "QUEUED"}},
+		{"dispatched while paused", func(e *scanEntry) { e.setPaused(true); e.markRunning() }, []bool{false}, []string{"RUNNING"}},
+		{"finished scan ignores pause", func(e *scanEntry) { e.finish("COMPLETED", "") }, []bool{true}, []string{"COMPLETED"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entry, _ := newScanRegistry().start(ScanRequest{ScanID: 3}, func() {})
+			tc.setup(entry)
+			for i, paused := range tc.calls {
+				if got := entry.setPaused(paused); got != tc.want[i] {
+					t.Fatalf("setPaused(%v) #%d = %s, want %s", paused, i, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryPruneLocked(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name     string
+		finished []time.Duration // How long ago each scan finished; 0 means still running
+		want     int
+	}{
+		{"running scans are kept", []time.Duration{0, 0}, 2},
+		{"recent finished scans are kept", []time.Duration{time.Minute, 0}, 2},
+		{"scans past the retention are dropped", []time.Duration{finishedScanRetention + time.Minute, time.Minute, 0}, 2},
+		{"count limit drops the oldest", make([]time.Duration, 0), maxFinishedScans + 1},
+	}
+	for i := 0; i < maxFinishedScans+5; i++ {
+		cases[3].finished = append(cases[3].finished, time.Duration(i+1)*time.Second)
+	}
+	cases[3].finished = append(cases[3].finished, 0)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newScanRegistry()
+			for i, ago := range tc.finished {
+				entry := &scanEntry{scanID: int64(i + 1), status: "RUNNING"}
+				if ago > 0 {
+					entry.finishedAt = now.Add(-ago)
+				}
+				r.scans[entry.scanID] = entry
+			}
+			r.mu.Lock()
+			r.pruneLocked(now)
+			r.mu.Unlock()
+			if len(r.scans) != tc.want {
+				t.Fatalf("kept %d scans, want %d", len(r.scans), tc.want)
+			}
+		})
+	}
+
+	// The count limit keeps the most recently finished scans.
+	r := newScanRegistry()
+	for i := 0; i < maxFinishedScans+1; i++ {
+		r.scans[int64(i)] = &scanEntry{scanID: int64(i), finishedAt: now.Add(-time.Duration(i+1) * time.Second)}
+	}
+	r.pruneLocked(now)
+	if _, ok := r.scans[int64(maxFinishedScans)]; ok {
+		t.Fatal("the oldest finished scan should have been pruned")
+	}
+}
+
+func TestScanStatusHandlers(t *testing.T) {
+	prevScans, prevScheduler := scans, scheduler
+	t.Cleanup(func() { scans, scheduler = prevScans, prevScheduler })
+	scans = newScanRegistry()
+	scheduler = newScanScheduler(1, 1, func(*queuedScan) {})
+
+	older, _ := scans.start(ScanRequest{ScanID: 10, Target: "a.example.com"}, func() {})
+	older.queuedAt = older.queuedAt.Add(-time.Minute)
+	running, _ := scans.start(ScanRequest{ScanID: 11, Target: "b.example.com"}, func() {})
+	running.markRunning()
+	running.enterPhase("probe")
+
+	rec := httptest.NewRecorder()
+	scanListHandler(rec, httptest.NewRequest(http.MethodGet, "/scans", nil))
+	var list struct {
+		Scans []ScanSnapshot `json:"scans"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /scans = %d %s (%v)", rec.Code, rec.Body, err)
+	}
+	if len(list.Scans) != 2 || list.Scans[0].ScanID != 11 || list.Scans[1].ScanID != 10 {
+		t.Fatalf("scans = %+v, want newest first", list.Scans)
+	}
+
+	cases := []struct {
+		method, path string
+		wantCode     int
+		wantPhase    string
+	}{
+		{http.MethodGet, "/scans/11", http.StatusOK, "probe"},
+		{http.MethodGet, "/scans/11/", http.StatusOK, "probe"},
+		{http.MethodGet, "/scans/99", http.StatusNotFound, ""},
+		{http.MethodGet, "/scans/abc", http.StatusBadRequest, ""},
+		{http.MethodPost, "/scans/11", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		scanStatusHandler(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.wantCode {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, rec.Code, tc.wantCode)
+			continue
+		}
+		if tc.wantCode != http.StatusOK {
+			continue
+		}
+		var snap ScanSnapshot
+		if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil || snap.ScanID != 11 || snap.Phase != tc.wantPhase {
+			t.Errorf("%s %s = %+v (%v)", tc.method, tc.path, snap, err)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	scanListHandler(rec, httptest.NewRequest(http.MethodPost, "/scans", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /scans = %d", rec.Code)
+	}
+}
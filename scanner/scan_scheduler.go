@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"recon/jobqueue"
+	"recon/sink"
+)
+
+// errQueueFull is returned by submit when admission control rejects a scan.
+var errQueueFull = errors.New("scan queue is full")
+
+// errDraining is returned by submit once the worker is shutting down.
+var errDraining = errors.New("worker is shutting down")
+
+// scheduler is the process-wide admission controller in front of runFullScan.
+var scheduler *scanScheduler
+
+// scanScheduler bounds how many scans run at once and queues the rest.
+// Queued scans are picked by priority first; among equal priorities the user
+// with the fewest running scans wins, then users are served round-robin, so
+// one user submitting many scans cannot starve others.
+type scanScheduler struct {
+	mu            sync.Mutex
+	maxRunning    int
+	maxQueued     int
+	running       int
+	queued        int
+	runningByUser map[int64]int
+	queues        map[int64][]*queuedScan // per-user FIFO
+	users         []int64                 // round-robin order of users with queued scans
+	cursor        int
+	run           func(*queuedScan)
+	draining      bool
+	idle          chan struct{} // Closed when draining and no scan is running
+}
+
+// queuedScan is a scan waiting for a free slot.
+type queuedScan struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	scan       *scanEntry
+	req        ScanRequest
+	out        sink.Sink // Result destinations, closed when the scan finishes
+	resume     *jobqueue.Job
+	enqueuedAt time.Time
+}
+
+// SchedulerSnapshot is the JSON view of scheduler occupancy.
+type SchedulerSnapshot struct {
+	Running    int `json:"running"`
+	Queued     int `json:"queued"`
+	MaxRunning int `json:"max_running"`
+	MaxQueued  int `json:"max_queued"`
+}
+
+func newScanScheduler(maxRunning, maxQueued int, run func(*queuedScan)) *scanScheduler {
+	if maxRunning < 1 {
+		maxRunning = 1
+	}
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+	return &scanScheduler{
+		maxRunning:    maxRunning,
+		maxQueued:     maxQueued,
+		runningByUser: make(map[int64]int),
+		queues:        make(map[int64][]*queuedScan),
+		run:           run,
+	}
+}
+
+// submit starts the scan immediately when a slot is free, otherwise queues it.
+// It reports whether the scan was queued. Replayed scans pass force=true so
+// they are never rejected after a restart.
+func (s *scanScheduler) submit(q *queuedScan, force bool) (bool, error) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return false, errDraining
+	}
+	if s.running < s.maxRunning && s.queued == 0 {
+		s.running++
+		s.runningByUser[q.req.UserID]++
+		s.mu.Unlock()
+		go s.dispatch(q)
+		return false, nil
+	}
+
+	if !force && s.queued >= s.maxQueued {
+		s.mu.Unlock()
+		return false, errQueueFull
+	}
+
+	q.enqueuedAt = time.Now()
+	userID := q.req.UserID
+	if len(s.queues[userID]) == 0 {
+		s.users = append(s.users, userID)
+	}
+	s.queues[userID] = insertByPriority(s.queues[userID], q)
+	s.queued++
+	s.mu.Unlock()
+	return true, nil
+}
+
+// remove drops a queued scan, e.g. when it is cancelled before it starts.
+func (s *scanScheduler) remove(scanID int64) (*queuedScan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID, queue := range s.queues {
+		for i, q := range queue {
+			if q.req.ScanID != scanID {
+				continue
+			}
+			queue = append(queue[:i], queue[i+1:]...)
+			s.queued--
+			if len(queue) == 0 {
+				s.dropUserLocked(userID)
+			} else {
+				s.queues[userID] = queue
+			}
+			return q, true
+		}
+	}
+	return nil, false
+}
+
+func (s *scanScheduler) snapshot() SchedulerSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SchedulerSnapshot{
+		Running:    s.running,
+		Queued:     s.queued,
+		MaxRunning: s.maxRunning,
+		MaxQueued:  s.maxQueued,
+	}
+}
+
+// drain stops admitting and starting scans and returns the scans that were
+// still queued. Running scans keep their slots until they return.
+func (s *scanScheduler) drain() []*queuedScan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return nil
+	}
+	s.draining = true
+	s.idle = make(chan struct{})
+	if s.running == 0 {
+		close(s.idle)
+	}
+
+	var pending []*queuedScan
+	for q := s.nextLocked(); q != nil; q = s.nextLocked() {
+		pending = append(pending, q)
+	}
+	return pending
+}
+
+// wait blocks until every running scan has returned after drain, or ctx ends.
+// It reports whether the scheduler became idle.
+func (s *scanScheduler) wait(ctx context.Context) bool {
+	s.mu.Lock()
+	idle := s.idle
+	s.mu.Unlock()
+	if idle == nil {
+		return true
+	}
+	select {
+	case <-idle:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *scanScheduler) dispatch(q *queuedScan) {
+	// Runs one scan and hands its slot to the next queued scan when done.
+	defer s.release(q)
+	s.run(q)
+}
+
+func (s *scanScheduler) release(done *queuedScan) {
+	s.mu.Lock()
+	if s.runningByUser[done.req.UserID]--; s.runningByUser[done.req.UserID] <= 0 {
+		delete(s.runningByUser, done.req.UserID)
+	}
+	next := s.nextLocked()
+	if next == nil {
+		s.running--
+		if s.draining && s.running == 0 {
+			close(s.idle)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.runningByUser[next.req.UserID]++
+	s.mu.Unlock()
+
+	// Keep the slot and run the next scan on it.
+	go s.dispatch(next)
+}
+
+// nextLocked pops the next scan: highest priority first, then the user with
+// the fewest running scans, then round-robin. Callers must hold s.mu.
+func (s *scanScheduler) nextLocked() *queuedScan {
+	if s.queued == 0 || len(s.users) == 0 {
+		return nil
+	}
+
+	best := -1
+	for i := 0; i < len(s.users); i++ {
+		idx := (s.cursor + i) % len(s.users)
+		if best == -1 || s.betterLocked(s.users[idx], s.users[best]) {
+			best = idx
+		}
+	}
+
+	userID := s.users[best]
+	queue := s.queues[userID]
+	q := queue[0]
+	s.queued--
+	if len(queue) == 1 {
+		s.dropUserLocked(userID)
+		if len(s.users) > 0 {
+			s.cursor = best % len(s.users)
+		}
+	} else {
+		s.queues[userID] = queue[1:]
+		s.cursor = (best + 1) % len(s.users)
+	}
+	return q
+}
+
+func (s *scanScheduler) betterLocked(candidate, current int64) bool {
+	a, b := s.queues[candidate][0], s.queues[current][0]
+	if a.req.Priority != b.req.Priority {
+		return a.req.Priority > b.req.Priority
+	}
+	return s.runningByUser[candidate] < s.runningByUser[current]
+}
+
+func (s *scanScheduler) dropUserLocked(userID int64) {
+	delete(s.queues, userID)
+	for i, id := range s.users {
+		if id == userID {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			if s.cursor > i {
+				s.cursor--
+			}
+			break
+		}
+	}
+	if len(s.users) == 0 {
+		s.cursor = 0
+	} else {
+		s.cursor %= len(s.users)
+	}
+}
+
+func insertByPriority(queue []*queuedScan, q *queuedScan) []*queuedScan {
+	// Keeps a user's queue ordered by priority (desc) and FIFO within a priority.
+	i := len(queue)
+	for i > 0 && queue[i-1].req.Priority < q.req.Priority {
+		i--
+	}
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = q
+	return queue
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerServesUsersFairly(t *testing.T) {
+	// One slot: user 1 floods the queue, user 2 submits a single scan afterwards.
+	// User 2 should run as soon as user 1's first scan finishes.
+	var mu sync.Mutex
+	order := make([]int64, 0)
+	release := make(chan struct{})
+	done := make(chan struct{}, 8)
+
+	s := newScanScheduler(1, 10, func(q *queuedScan) {
+		mu.Lock()
+		order = append(order, q.req.ScanID)
+		mu.Unlock()
+		<-release
+		done <- struct{}{}
+	})
+
+	submit := func(scanID, userID int64, priority int) {
+		t.Helper()
+		if _, err := s.submit(&queuedScan{req: ScanRequest{ScanID: scanID, UserID: userID, Priority: priority}}, false); err != nil {
+			t.Fatalf("submit %d: %v", scanID, err)
+		}
+	}
+
+	submit(1, 1, 0)
+	waitForRunning(t, s, 1)
+	submit(2, 1, 0)
+	submit(3, 1, 0)
+	submit(4, 2, 0)
+	submit(5, 1, 5)
+
+	for i := 0; i < 5; i++ {
+		release <- struct{}{}
+		<-done
+	}
+
+	want := []int64{1, 5, 4, 2, 3}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != len(want) {
+		t.Fatalf("unexpected run order: got %v want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("unexpected run order: got %v want %v", order, want)
+		}
+	}
+}
+
+func TestSchedulerRejectsWhenQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	s := newScanScheduler(1, 1, func(q *queuedScan) { <-block })
+
+	if queued, err := s.submit(&queuedScan{req: ScanRequest{ScanID: 1}}, false); err != nil || queued {
+		t.Fatalf("first scan should start immediately, queued=%v err=%v", queued, err)
+	}
+	if queued, err := s.submit(&queuedScan{req: ScanRequest{ScanID: 2}}, false); err != nil || !queued {
+		t.Fatalf("second scan should be queued, queued=%v err=%v", queued, err)
+	}
+	if _, err := s.submit(&queuedScan{req: ScanRequest{ScanID: 3}}, false); err != errQueueFull {
+		t.Fatalf("expected errQueueFull, got %v", err)
+	}
+	if _, err := s.submit(&queuedScan{req: ScanRequest{ScanID: 4}}, true); err != nil {
+		t.Fatalf("forced submit should bypass the queue limit: %v", err)
+	}
+
+	if _, ok := s.remove(2); !ok {
+		t.Fatal("expected queued scan 2 to be removable")
+	}
+	if snap := s.snapshot(); snap.Running != 1 || snap.Queued != 1 {
+		t.Fatalf("unexpected snapshot after remove: %+v", snap)
+	}
+}
+
+func TestSchedulerDrainStopsAdmissionAndWaitsForRunningScans(t *testing.T) {
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(1)
+	s := newScanScheduler(1, 10, func(q *queuedScan) {
+		started.Done()
+		<-release
+	})
+
+	if _, err := s.submit(&queuedScan{req: ScanRequest{ScanID: 1}}, false); err != nil {
+		t.Fatal(err)
+	}
+	started.Wait()
+	for _, id := range []int64{2, 3} {
+		if queued, err := s.submit(&queuedScan{req: ScanRequest{ScanID: id}}, false); err != nil || !queued {
+			t.Fatalf("scan %d should be queued, queued=%v err=%v", id, queued, err)
+		}
+	}
+
+	pending := s.drain()
+	if len(pending) != 2 || pending[0].req.ScanID != 2 || pending[1].req.ScanID != 3 {
+		t.Fatalf("drain returned %d scans", len(pending))
+	}
+	if _, err := s.submit(&queuedScan{req: ScanRequest{ScanID: 4}}, true); err != errDraining {
+		t.Fatalf("expected errDraining, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if s.wait(ctx) {
+		t.Fatal("wait returned while a scan was still running")
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !s.wait(ctx) {
+		t.Fatal("scheduler never became idle")
+	}
+	if snap := s.snapshot(); snap.Running != 0 || snap.Queued != 0 {
+		t.Fatalf("unexpected snapshot after drain: %+v", snap)
+	}
+}
+
+func waitForRunning(t *testing.T, s *scanScheduler, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if s.snapshot().Running == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("scheduler never reached %d running scans", want)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"recon/scope"
+)
+
+func loadScopeFile(path string) (scope.Rules, error) {
+	// Reads scope rules for CLI scans, in the same form as the request's scope.
+	var rules scope.Rules
+	if path == "" {
+		return rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("parse scope file %s: %w", path, err)
+	}
+	return rules, nil
+}
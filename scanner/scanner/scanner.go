@@ -1,11 +1,13 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
 	"recon/enum"
+	"recon/pipeline"
 	"recon/probe"
 )
 
@@ -52,8 +54,8 @@ func DefaultScanOptions() *ScanOptions {
 // ScanDomain performs a complete scan: subdomain enumeration + concurrent probing.
 // This is the main high-level function you should use.
 func ScanDomain(domain string, opts *ScanOptions) (*ScanResult, error) {
-	// High-level API used by demos and integrations:
-	// enumerate subdomains first, then probe them concurrently.
+	// High-level API used by demos and integrations: runs the subdomain and
+	// probe stages of the scan pipeline without saving artifacts.
 	if opts == nil {
 		opts = DefaultScanOptions()
 	}
@@ -63,53 +65,53 @@ func ScanDomain(domain string, opts *ScanOptions) (*ScanResult, error) {
 		Domain: domain,
 	}
 
-	// Step 1: Enumerate subdomains
-	log.Printf("[scanner] enumerating subdomains for %s", domain)
-	subdomains, err := enum.EnumerateSubdomains(domain, &enum.SubfinderOptions{
-		BinaryPath: opts.SubfinderBinary,
-		Timeout:    opts.SubfinderTimeout,
-	})
+	registry := pipeline.NewRegistry(
+		&pipeline.SubdomainStage{Subfinder: &enum.SubfinderOptions{
+			BinaryPath: opts.SubfinderBinary,
+			Timeout:    opts.SubfinderTimeout,
+		}},
+		&pipeline.ProbeStage{Options: &probe.ProbeOptions{
+			Workers:      opts.ProbeWorkers,
+			HTTPTimeout:  opts.ProbeHTTPTimeout,
+			DNSTimeout:   opts.ProbeDNSTimeout,
+			UseHttpx:     opts.UseHttpx,
+			HttpxBinary:  opts.HttpxBinary,
+			HttpxTimeout: opts.HttpxTimeout,
+		}},
+	)
+	plan, err := registry.Plan(pipeline.StageProbe)
 	if err != nil {
-		result.Error = fmt.Sprintf("subdomain enumeration failed: %v", err)
-		result.ScanDuration = time.Since(startTime)
-		return result, err
+		return nil, err
 	}
 
-	result.Subdomains = subdomains
-	result.TotalHosts = len(subdomains)
-	log.Printf("[scanner] found %d subdomains", len(subdomains))
-
-	if len(subdomains) == 0 {
+	log.Printf("[scanner] scanning %s (stages: %v)", domain, plan.Stages())
+	st := pipeline.NewState(0, domain, 0)
+	if err := plan.Run(context.Background(), st, pipeline.RunOptions{}); err != nil {
+		result.Error = fmt.Sprintf("scan failed: %v", err)
 		result.ScanDuration = time.Since(startTime)
-		return result, nil
-	}
-
-	// Step 2: Probe all hosts concurrently
-	log.Printf("[scanner] probing %d hosts with %d workers", len(subdomains), opts.ProbeWorkers)
-	probeOpts := &probe.ProbeOptions{
-		Workers:      opts.ProbeWorkers,
-		HTTPTimeout:  opts.ProbeHTTPTimeout,
-		DNSTimeout:   opts.ProbeDNSTimeout,
-		UseHttpx:     opts.UseHttpx,
-		HttpxBinary:  opts.HttpxBinary,
-		HttpxTimeout: opts.HttpxTimeout,
+		return result, err
 	}
 
-	hostChecks := probe.ProbeHosts(subdomains, probeOpts)
-	result.HostChecks = hostChecks
-
-	// Count alive hosts
-	aliveCount := 0
-	for _, check := range hostChecks {
-		if check.Alive {
-			aliveCount++
+	result.Subdomains, _ = pipeline.Get(st, pipeline.KeyHosts)
+	result.TotalHosts = len(result.Subdomains)
+
+	subs, _ := pipeline.Get(st, pipeline.KeySubdomains)
+	result.HostChecks = make([]probe.HostCheck, 0, len(subs))
+	for _, sub := range subs {
+		result.HostChecks = append(result.HostChecks, probe.HostCheck{
+			Host:     sub.Name,
+			IPs:      sub.IPs,
+			Alive:    sub.Alive,
+			ErrorMsg: sub.ErrorMsg,
+		})
+		if sub.Alive {
+			result.AliveHosts++
 		}
 	}
-	result.AliveHosts = aliveCount
 
 	result.ScanDuration = time.Since(startTime)
 	log.Printf("[scanner] scan complete: %d/%d hosts alive in %s",
-		aliveCount, len(hostChecks), result.ScanDuration)
+		result.AliveHosts, len(result.HostChecks), result.ScanDuration)
 
 	return result, nil
 }
@@ -0,0 +1,6 @@
+package scope
+
+import "recon/metrics"
+
+// Scope metrics, across all scans.
+var dropped = metrics.NewCounter("recon_scope_dropped_total", "Hosts and URLs dropped as out of scope, by kind (host, url).", "kind")
@@ -0,0 +1,636 @@
+// Package scope decides which hosts and URLs a scan may touch. Rules come with
+// the scan request: include rules say what is in scope (by default the target
+// and its subdomains), exclude rules carve exceptions out of it, and private,
+// loopback and link-local addresses are denied unless explicitly allowed.
+// The engine is bound to the scan context; stages filter their inputs and
+// outputs through it and HTTP clients refuse out-of-scope requests, so
+// subfinder results, archived URLs and redirects cannot widen a scan.
+package scope
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS lookups made to check host names against CIDR rules and private ranges.
+const (
+	lookupTimeout = 3 * time.Second
+	lookupWorkers = 16 // Concurrent lookups when filtering a list
+)
+
+// Rule matches hosts and URLs. Every field that is set must match.
+type Rule struct {
+	Domain string `json:"domain,omitempty"` // example.com, or *.example.com for its subdomains
+	CIDR   string `json:"cidr,omitempty"`   // 10.0.0.0/8 or a single IP; host names match by their addresses
+	Path   string `json:"path,omitempty"`   // Regular expression matched against URL paths
+	Ports  []int  `json:"ports,omitempty"`
+}
+
+// Rules is the scope of one scan.
+type Rules struct {
+	Include      []Rule `json:"include,omitempty"` // Empty: the target and its subdomains
+	Exclude      []Rule `json:"exclude,omitempty"`
+	AllowPrivate bool   `json:"allow_private,omitempty"` // Allow private, loopback and link-local addresses
+}
+
+// Validate checks every rule.
+func (r Rules) Validate() error {
+	_, err := compileRules(r)
+	return err
+}
+
+// Decision is the outcome of a scope check.
+type Decision struct {
+	Allowed bool
+	Reason  string // Why the item was dropped, naming the rule
+	Rule    string // The rule that dropped the item, without per-item detail
+}
+
+// Drop counts the items of one kind (host, url) a rule dropped.
+type Drop struct {
+	Kind  string
+	Rule  string
+	Count int
+}
+
+// Engine applies the rules of one scan.
+type Engine struct {
+	include      []*rule
+	exclude      []*rule
+	allowPrivate bool
+	needIPs      bool // Host names are looked up for CIDR rules or the private check
+	lookup       func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	ips     map[string][]net.IP // Resolved host names
+	dropped map[string]bool     // Items already logged
+	drops   map[Drop]int        // Items dropped since the last TakeDrops, by kind and rule
+}
+
+type rule struct {
+	src      Rule
+	domain   string // Lower-cased, without the "*." prefix
+	wildcard bool
+	cidr     *net.IPNet
+	path     *regexp.Regexp
+	ports    map[int]bool
+	explicit bool // Names hosts precisely enough to allow private addresses
+}
+
+// New compiles rules for a scan of target. Without include rules the target's
+// host and its subdomains are in scope. When the target itself is private or
+// loopback, private addresses are allowed.
+func New(rules Rules, target string) (*Engine, error) {
+	c, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{
+		include:      c.include,
+		exclude:      c.exclude,
+		allowPrivate: rules.AllowPrivate,
+		lookup:       net.DefaultResolver.LookupHost,
+		ips:          make(map[string][]net.IP),
+		dropped:      make(map[string]bool),
+		drops:        make(map[Drop]int),
+	}
+
+	host, _ := splitHost(target)
+	if len(e.include) == 0 && host != "" {
+		e.include = targetRules(host)
+	}
+	if ip := net.ParseIP(host); (ip != nil && isPrivate(ip)) || isLocalhost(host) {
+		e.allowPrivate = true
+	}
+	e.needIPs = !e.allowPrivate
+	for _, r := range append(append([]*rule{}, e.include...), e.exclude...) {
+		if r.cidr != nil {
+			e.needIPs = true
+		}
+	}
+	return e, nil
+}
+
+type compiled struct{ include, exclude []*rule }
+
+func compileRules(r Rules) (compiled, error) {
+	var c compiled
+	var problems []string
+	for i, src := range r.Include {
+		cr, err := compileRule(src)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("include[%d]: %v", i, err))
+			continue
+		}
+		c.include = append(c.include, cr)
+	}
+	for i, src := range r.Exclude {
+		cr, err := compileRule(src)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("exclude[%d]: %v", i, err))
+			continue
+		}
+		c.exclude = append(c.exclude, cr)
+	}
+	if len(problems) > 0 {
+		return c, fmt.Errorf("invalid scope: %s", strings.Join(problems, "; "))
+	}
+	return c, nil
+}
+
+func compileRule(src Rule) (*rule, error) {
+	if src.Domain == "" && src.CIDR == "" && src.Path == "" && len(src.Ports) == 0 {
+		return nil, fmt.Errorf("rule must set domain, cidr, path or ports")
+	}
+	if src.Domain != "" && src.CIDR != "" {
+		return nil, fmt.Errorf("rule cannot set both domain and cidr")
+	}
+	r := &rule{src: src}
+
+	if src.Domain != "" {
+		d := strings.ToLower(strings.TrimSpace(src.Domain))
+		if strings.HasPrefix(d, "*.") {
+			r.wildcard = true
+			d = d[2:]
+		}
+		if d == "" || strings.ContainsAny(d, "*/:@ ") {
+			return nil, fmt.Errorf("invalid domain %q (use example.com or *.example.com)", src.Domain)
+		}
+		r.domain = strings.TrimSuffix(d, ".")
+		r.explicit = !r.wildcard
+	}
+	if src.CIDR != "" {
+		cidr := strings.TrimSpace(src.CIDR)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid cidr %q", src.CIDR)
+			}
+			cidr = singleHostCIDR(ip)
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", src.CIDR)
+		}
+		r.cidr = network
+		r.explicit = true
+	}
+	if src.Path != "" {
+		re, err := regexp.Compile(src.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex %q: %v", src.Path, err)
+		}
+		r.path = re
+	}
+	if len(src.Ports) > 0 {
+		r.ports = make(map[int]bool, len(src.Ports))
+		for _, p := range src.Ports {
+			if p < 1 || p > 65535 {
+				return nil, fmt.Errorf("port %d out of range", p)
+			}
+			r.ports[p] = true
+		}
+	}
+	return r, nil
+}
+
+func targetRules(host string) []*rule {
+	// Default scope: the target host, its subdomains when it is a name, and
+	// the loopback ranges for localhost targets.
+	if ip := net.ParseIP(host); ip != nil {
+		_, network, _ := net.ParseCIDR(singleHostCIDR(ip))
+		return []*rule{{src: Rule{CIDR: host}, cidr: network, explicit: true}}
+	}
+	rules := []*rule{
+		{src: Rule{Domain: host}, domain: host, explicit: true},
+		{src: Rule{Domain: "*." + host}, domain: host, wildcard: true},
+	}
+	if isLocalhost(host) {
+		for _, cidr := range []string{"127.0.0.0/8", "::1/128"} {
+			_, network, _ := net.ParseCIDR(cidr)
+			rules = append(rules, &rule{src: Rule{CIDR: cidr}, cidr: network, explicit: true})
+		}
+	}
+	return rules
+}
+
+// item is what a rule is matched against. Port and path are unknown when 0
+// and nil; include rules match unknown fields, exclude rules do not.
+type item struct {
+	host string
+	ips  []net.IP
+	port int
+	path *string
+}
+
+func (r *rule) matches(it item, lenient bool) bool {
+	if r.domain != "" {
+		if net.ParseIP(it.host) != nil {
+			return false
+		}
+		if r.wildcard && !strings.HasSuffix(it.host, "."+r.domain) {
+			return false
+		}
+		if !r.wildcard && it.host != r.domain {
+			return false
+		}
+	}
+	if r.cidr != nil {
+		found := false
+		for _, ip := range it.ips {
+			if r.cidr.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.ports != nil && !(it.port == 0 && lenient) && !r.ports[it.port] {
+		return false
+	}
+	if r.path != nil && !(it.path == nil && lenient) && (it.path == nil || !r.path.MatchString(*it.path)) {
+		return false
+	}
+	return true
+}
+
+func (r *rule) String() string {
+	var parts []string
+	if r.src.Domain != "" {
+		parts = append(parts, "domain "+r.src.Domain)
+	}
+	if r.src.CIDR != "" {
+		parts = append(parts, "cidr "+r.src.CIDR)
+	}
+	if r.src.Path != "" {
+		parts = append(parts, "path "+r.src.Path)
+	}
+	if len(r.src.Ports) > 0 {
+		ports := make([]string, len(r.src.Ports))
+		for i, p := range r.src.Ports {
+			ports[i] = strconv.Itoa(p)
+		}
+		parts = append(parts, "ports "+strings.Join(ports, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *Engine) check(ctx context.Context, it item) Decision {
+	// Exclude rules win, then an include rule must match, then private
+	// addresses need an explicit allowance.
+	if it.ips == nil && e.needIPs {
+		it.ips = e.resolve(ctx, it.host)
+	}
+	for _, r := range e.exclude {
+		if r.matches(it, false) {
+			return Decision{Reason: "excluded by " + r.String(), Rule: "exclude " + r.String()}
+		}
+	}
+	matched, explicit := false, false
+	for _, r := range e.include {
+		if r.matches(it, true) {
+			matched = true
+			explicit = explicit || r.explicit
+		}
+	}
+	if !matched {
+		return Decision{Reason: "not in include rules", Rule: "include rules"}
+	}
+	if !e.allowPrivate && !explicit {
+		if isLocalhost(it.host) {
+			return Decision{Reason: "loopback host " + it.host, Rule: "loopback"}
+		}
+		for _, ip := range it.ips {
+			if isPrivate(ip) {
+				return Decision{Reason: "private address " + ip.String(), Rule: "private ranges"}
+			}
+		}
+	}
+	return Decision{Allowed: true}
+}
+
+func (e *Engine) resolve(ctx context.Context, host string) []net.IP {
+	// Returns the addresses of host, looking names up once per scan.
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	if host == "" {
+		return nil
+	}
+	e.mu.Lock()
+	ips, ok := e.ips[host]
+	e.mu.Unlock()
+	if ok {
+		return ips
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	addrs, err := e.lookup(lookupCtx, host)
+	ips = []net.IP{}
+	if err == nil {
+		for _, a := range addrs {
+			if ip := net.ParseIP(a); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if ctx.Err() == nil {
+		e.mu.Lock()
+		e.ips[host] = ips
+		e.mu.Unlock()
+	}
+	return ips
+}
+
+// Host checks a host name or IP, optionally with a port.
+func (e *Engine) Host(ctx context.Context, host string) Decision {
+	h, port := splitHost(host)
+	return e.check(ctx, item{host: h, port: port})
+}
+
+// Resolved checks a host whose addresses are already known, e.g. from probing.
+func (e *Engine) Resolved(ctx context.Context, host string, ips []string) Decision {
+	h, port := splitHost(host)
+	it := item{host: h, port: port}
+	for _, a := range ips {
+		if ip := net.ParseIP(a); ip != nil {
+			it.ips = append(it.ips, ip)
+		}
+	}
+	return e.check(ctx, it)
+}
+
+// URL checks an absolute URL by host, port and path.
+func (e *Engine) URL(ctx context.Context, raw string) Decision {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return Decision{Reason: "invalid URL", Rule: "invalid URL"}
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	it := item{host: strings.ToLower(strings.Trim(u.Hostname(), "[]")), path: &path}
+	it.port, _ = strconv.Atoi(u.Port())
+	if it.port == 0 {
+		switch u.Scheme {
+		case "http":
+			it.port = 80
+		case "https":
+			it.port = 443
+		}
+	}
+	return e.check(ctx, it)
+}
+
+func (e *Engine) prefetch(ctx context.Context, items []string) {
+	// Looks up the distinct host names of items concurrently so filtering a
+	// long list does not wait on one lookup at a time.
+	if !e.needIPs {
+		return
+	}
+	seen := make(map[string]bool)
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < lookupWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				e.resolve(ctx, host)
+			}
+		}()
+	}
+	for _, raw := range items {
+		host, _ := splitHost(raw)
+		if seen[host] || net.ParseIP(host) != nil {
+			continue
+		}
+		seen[host] = true
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (e *Engine) drop(kind, value string, d Decision) {
+	// Logs each dropped item once per scan, with the rule that dropped it.
+	e.mu.Lock()
+	seen := e.dropped[value]
+	e.dropped[value] = true
+	if !seen {
+		e.drops[Drop{Kind: kind, Rule: d.Rule}]++
+	}
+	e.mu.Unlock()
+	if seen {
+		return
+	}
+	dropped.Inc(kind)
+	log.Printf("[scope] dropped %s %s: %s", kind, value, d.Reason)
+}
+
+func splitHost(raw string) (string, int) {
+	// Extracts the lower-cased host and port from a host, host:port or URL.
+	s := strings.TrimSpace(raw)
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+	port := 0
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		s = h
+		port, _ = strconv.Atoi(p)
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.Trim(s, "[]"), ".")), port
+}
+
+func singleHostCIDR(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// TakeDrops returns the items dropped since the last call, counted by kind
+// and rule, so callers can report a summary of each rule to the scan log.
+func (e *Engine) TakeDrops() []Drop {
+	e.mu.Lock()
+	out := make([]Drop, 0, len(e.drops))
+	for d, n := range e.drops {
+		d.Count = n
+		out = append(out, d)
+	}
+	clear(e.drops)
+	e.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Rule < out[j].Rule
+	})
+	return out
+}
+
+type engineKey struct{}
+
+// WithEngine returns a context whose scan is confined to e.
+func WithEngine(ctx context.Context, e *Engine) context.Context {
+	return context.WithValue(ctx, engineKey{}, e)
+}
+
+// FromContext returns the engine bound to ctx, or nil when the scan has no
+// scope and everything is allowed.
+func FromContext(ctx context.Context) *Engine {
+	if ctx == nil {
+		return nil
+	}
+	e, _ := ctx.Value(engineKey{}).(*Engine)
+	return e
+}
+
+// AllowHost reports whether host (optionally host:port) is in the scope bound
+// to ctx, logging it when it is dropped.
+func AllowHost(ctx context.Context, host string) bool {
+	e := FromContext(ctx)
+	if e == nil {
+		return true
+	}
+	d := e.Host(ctx, host)
+	if !d.Allowed {
+		e.drop("host", host, d)
+	}
+	return d.Allowed
+}
+
+// AllowResolved is AllowHost for a host whose addresses are known.
+func AllowResolved(ctx context.Context, host string, ips []string) bool {
+	e := FromContext(ctx)
+	if e == nil {
+		return true
+	}
+	d := e.Resolved(ctx, host, ips)
+	if !d.Allowed {
+		e.drop("host", host, d)
+	}
+	return d.Allowed
+}
+
+// AllowURL reports whether raw is in the scope bound to ctx, logging it when
+// it is dropped.
+func AllowURL(ctx context.Context, raw string) bool {
+	e := FromContext(ctx)
+	if e == nil {
+		return true
+	}
+	d := e.URL(ctx, raw)
+	if !d.Allowed {
+		e.drop("url", raw, d)
+	}
+	return d.Allowed
+}
+
+// TakeDrops is Engine.TakeDrops for the engine bound to ctx.
+func TakeDrops(ctx context.Context) []Drop {
+	if e := FromContext(ctx); e != nil {
+		return e.TakeDrops()
+	}
+	return nil
+}
+
+// FilterHosts returns the hosts in scope, in order.
+func FilterHosts(ctx context.Context, hosts []string) []string {
+	e := FromContext(ctx)
+	if e == nil {
+		return hosts
+	}
+	e.prefetch(ctx, hosts)
+	out := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if AllowHost(ctx, h) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// FilterURLs returns the URLs in scope, in order.
+func FilterURLs(ctx context.Context, urls []string) []string {
+	e := FromContext(ctx)
+	if e == nil {
+		return urls
+	}
+	e.prefetch(ctx, urls)
+	out := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if AllowURL(ctx, u) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// OutOfScopeError is returned for requests the scope does not allow.
+type OutOfScopeError struct {
+	URL    string
+	Reason string
+}
+
+func (e *OutOfScopeError) Error() string {
+	return fmt.Sprintf("%s is out of scope: %s", e.URL, e.Reason)
+}
+
+// Transport refuses requests outside the scope bound to the request context,
+// including redirects, since each hop is a separate round trip.
+type Transport struct {
+	Base http.RoundTripper // nil uses http.DefaultTransport
+}
+
+// NewTransport wraps base.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if e := FromContext(ctx); e != nil {
+		raw := req.URL.String()
+		if d := e.URL(ctx, raw); !d.Allowed {
+			e.drop("url", raw, d)
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, &OutOfScopeError{URL: raw, Reason: d.Reason}
+		}
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
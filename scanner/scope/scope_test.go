@@ -0,0 +1,196 @@
+package scope
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeDNS answers lookups from a fixed table.
+func fakeDNS(table map[string]string) func(context.Context, string) ([]string, error) {
+	return func(_ context.Context, host string) ([]string, error) {
+		if ip, ok := table[host]; ok {
+			return []string{ip}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+}
+
+func newTestEngine(t *testing.T, rules Rules, target string) *Engine {
+	t.Helper()
+	e, err := New(rules, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.lookup = fakeDNS(map[string]string{
+		"example.com":          "93.184.216.34",
+		"www.example.com":      "93.184.216.34",
+		"intranet.example.com": "10.0.0.5",
+		"vpn.example.com":      "10.0.0.6",
+		"cdn.other.net":        "203.0.113.10",
+	})
+	return e
+}
+
+func TestDefaultScopeIsTargetAndSubdomains(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t, Rules{}, "https://example.com/app")
+
+	for _, host := range []string{"example.com", "www.example.com", "WWW.Example.com:8443"} {
+		if d := e.Host(ctx, host); !d.Allowed {
+			t.Errorf("%s dropped: %s", host, d.Reason)
+		}
+	}
+	if d := e.Host(ctx, "cdn.other.net"); d.Allowed || d.Reason != "not in include rules" {
+		t.Errorf("other domain: %+v", d)
+	}
+	if d := e.Host(ctx, "notexample.com"); d.Allowed {
+		t.Error("a domain sharing the suffix must not match *.example.com")
+	}
+	if d := e.Host(ctx, "intranet.example.com"); d.Allowed || !strings.Contains(d.Reason, "10.0.0.5") {
+		t.Errorf("subdomain on a private address: %+v", d)
+	}
+	if d := e.URL(ctx, "https://cdn.other.net/lib.js"); d.Allowed {
+		t.Error("archived URL on another domain must be dropped")
+	}
+}
+
+func TestExcludeRulesWin(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t, Rules{
+		Include: []Rule{{Domain: "*.example.com"}, {Domain: "example.com", Ports: []int{443}}},
+		Exclude: []Rule{{Domain: "www.example.com", Path: "^/admin"}, {CIDR: "93.184.216.0/24", Ports: []int{8080}}},
+	}, "example.com")
+
+	cases := map[string]bool{
+		"https://www.example.com/":            true,
+		"https://www.example.com/admin/users": false,
+		"https://example.com/admin":           true,
+		"http://example.com/":                 false, // port 80 is not included for the apex
+		"http://www.example.com:8080/":        false,
+	}
+	for raw, want := range cases {
+		if d := e.URL(ctx, raw); d.Allowed != want {
+			t.Errorf("URL(%s) = %+v, want allowed=%v", raw, d, want)
+		}
+	}
+
+	// Path and port excludes do not drop the whole host.
+	if d := e.Host(ctx, "www.example.com"); !d.Allowed {
+		t.Errorf("host dropped by a path rule: %s", d.Reason)
+	}
+	if d := e.Host(ctx, "www.example.com:8080"); d.Allowed || !strings.Contains(d.Reason, "cidr 93.184.216.0/24") {
+		t.Errorf("excluded port: %+v", d)
+	}
+}
+
+func TestPrivateAddressesNeedExplicitAllowance(t *testing.T) {
+	ctx := context.Background()
+
+	e := newTestEngine(t, Rules{Include: []Rule{{Domain: "*.example.com"}, {Domain: "vpn.example.com"}, {CIDR: "10.0.0.0/8"}}}, "example.com")
+	if d := e.Host(ctx, "vpn.example.com"); !d.Allowed {
+		t.Errorf("exactly named host dropped: %s", d.Reason)
+	}
+	if d := e.Host(ctx, "10.1.2.3"); !d.Allowed {
+		t.Errorf("host in an included CIDR dropped: %s", d.Reason)
+	}
+	if d := e.Resolved(ctx, "staging.example.com", []string{"192.168.0.10"}); d.Allowed {
+		t.Error("wildcard match on a private address must be dropped")
+	}
+
+	e = newTestEngine(t, Rules{AllowPrivate: true}, "example.com")
+	if d := e.Host(ctx, "intranet.example.com"); !d.Allowed {
+		t.Errorf("allow_private ignored: %s", d.Reason)
+	}
+
+	// Local targets allow their own vhosts and loopback aliases.
+	e = newTestEngine(t, Rules{}, "localhost:3000")
+	for _, host := range []string{"localhost:3000", "api.localhost:3000", "127.0.0.1"} {
+		if d := e.Host(ctx, host); !d.Allowed {
+			t.Errorf("%s dropped for a localhost target: %s", host, d.Reason)
+		}
+	}
+	e = newTestEngine(t, Rules{}, "http://192.168.1.167/dvwa/")
+	if d := e.URL(ctx, "http://192.168.1.167/dvwa/login.php"); !d.Allowed {
+		t.Errorf("private IP target dropped: %s", d.Reason)
+	}
+	if d := e.Host(ctx, "192.168.1.168"); d.Allowed {
+		t.Error("a neighbouring IP is not the target")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	err := Rules{
+		Include: []Rule{{}, {Domain: "exa*mple.com"}, {CIDR: "10.0.0.0/33"}},
+		Exclude: []Rule{{Path: "("}, {Ports: []int{70000}}},
+	}.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"include[0]", "include[1]", "include[2]", "exclude[0]", "exclude[1]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if err := (Rules{Include: []Rule{{Domain: "*.example.com", Ports: []int{443}}, {CIDR: "2001:db8::1"}}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportRefusesOutOfScopeRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://cdn.other.net/login", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t, Rules{}, srv.URL)
+	ctx := WithEngine(context.Background(), e)
+	client := &http.Client{Transport: NewTransport(nil)}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	_, err := client.Do(req)
+	var oos *OutOfScopeError
+	if !errors.As(err, &oos) || !strings.HasPrefix(oos.URL, "http://cdn.other.net/") {
+		t.Fatalf("redirect error = %v, want OutOfScopeError for cdn.other.net", err)
+	}
+
+	// Without an engine the scan is unscoped.
+	if !AllowURL(context.Background(), "http://cdn.other.net/") {
+		t.Fatal("unscoped context must allow everything")
+	}
+}
+
+func TestTakeDropsSummarizesByRule(t *testing.T) {
+	e := newTestEngine(t, Rules{Exclude: []Rule{{Domain: "www.example.com", Path: "^/admin"}}}, "example.com")
+	ctx := WithEngine(context.Background(), e)
+
+	FilterURLs(ctx, []string{
+		"https://www.example.com/admin/a",
+		"https://www.example.com/admin/b",
+		"https://www.example.com/admin/a", // Logged and counted once
+		"https://cdn.other.net/",
+		"https://www.example.com/",
+	})
+	FilterHosts(ctx, []string{"intranet.example.com", "vpn.example.com"})
+
+	want := []Drop{
+		{Kind: "host", Rule: "private ranges", Count: 2},
+		{Kind: "url", Rule: "exclude domain www.example.com path ^/admin", Count: 2},
+		{Kind: "url", Rule: "include rules", Count: 1},
+	}
+	got := TakeDrops(ctx)
+	if len(got) != len(want) {
+		t.Fatalf("drops = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("drop %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if again := TakeDrops(ctx); len(again) != 0 {
+		t.Fatalf("drops reported twice: %+v", again)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"recon/sink"
+)
+
+// errWorkerShutdown is the cancellation cause of scans cut off by a shutdown.
+var errWorkerShutdown = errors.New("worker shutting down")
+
+// workerCtx is the parent of every scan context. Shutdown cancels it with
+// errWorkerShutdown once the grace period is over.
+var workerCtx, stopWorker = context.WithCancelCause(context.Background())
+
+// draining is closed when shutdown begins; running scans stop after their
+// current phase and /scan stops accepting work.
+var (
+	draining  = make(chan struct{})
+	drainOnce sync.Once
+)
+
+// Shutdown time limits after the grace period: cancelled scans get
+// interruptWait to report, then HTTP and callback delivery get shutdownWait each.
+const (
+	interruptWait = 30 * time.Second
+	shutdownWait  = 30 * time.Second
+)
+
+func shuttingDown() bool {
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
+	}
+}
+
+func shutdownGrace() time.Duration {
+	// RECON_SHUTDOWN_GRACE (default 2m) is how long running scans may keep
+	// working on their current phase before they are cancelled.
+	if d, err := time.ParseDuration(os.Getenv("RECON_SHUTDOWN_GRACE")); err == nil && d >= 0 {
+		return d
+	}
+	return 2 * time.Minute
+}
+
+func shutdownWorker(server *http.Server) {
+	// Drains scans, reports them INTERRUPTED, and flushes callbacks before exit.
+	// Interrupted scans stay in the journal and resume on the next start.
+	grace := shutdownGrace()
+	log.Printf("[shutdown] draining scans, grace period %s", grace)
+	drainOnce.Do(func() { close(draining) })
+
+	for _, q := range scheduler.drain() {
+		var completed []string
+		if q.resume != nil {
+			completed = q.resume.CompletedPhases
+		}
+		interruptScan(q.scan, q.out, completed)
+		q.cancel()
+	}
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), grace)
+	idle := scheduler.wait(graceCtx)
+	cancel()
+	if !idle {
+		log.Printf("[shutdown] grace period over, cancelling %d running scans", scheduler.snapshot().Running)
+		stopWorker(errWorkerShutdown)
+		waitCtx, cancel := context.WithTimeout(context.Background(), interruptWait)
+		if !scheduler.wait(waitCtx) {
+			log.Printf("[shutdown] %d scans did not stop in %s", scheduler.snapshot().Running, interruptWait)
+		}
+		cancel()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownWait)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("[shutdown] http server: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownWait)
+	defer cancel()
+	if err := callbacks.Close(ctx); err != nil {
+		log.Printf("[shutdown] callback delivery: %v", err)
+	}
+	log.Printf("[shutdown] done")
+}
+
+func interruptScan(scan *scanEntry, out sink.Sink, completed []string) {
+	// Reports a scan stopped by shutdown. Unlike finishScan it leaves the job in
+	// the journal so the next worker resumes it after the last completed phase.
+	lastPhase := ""
+	if len(completed) > 0 {
+		lastPhase = completed[len(completed)-1]
+	}
+	msg := fmt.Sprintf("Worker shutting down (completed phases: %s)", describePhases(completed))
+	log.Printf("[scan] scan %d interrupted: %s", scan.scanID, msg)
+
+	scan.finish("INTERRUPTED", msg)
+	scansFinished.Inc("INTERRUPTED")
+	out.OnStatus(sink.Status{Status: "INTERRUPTED", Error: msg, LastPhase: lastPhase})
+	if err := out.Close(); err != nil {
+		log.Printf("[scan] failed to close sinks for scan %d: %v", scan.scanID, err)
+	}
+}
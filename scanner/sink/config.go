@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Sink types accepted in Config.Type.
+const (
+	KindDjango  = "django"
+	KindWebhook = "webhook"
+	KindJSONL   = "jsonl"
+	KindStdout  = "stdout"
+)
+
+// Config selects one destination for a scan's results.
+type Config struct {
+	Type       string `json:"type"`                  // django, webhook, jsonl or stdout
+	URL        string `json:"url,omitempty"`         // webhook: destination URL
+	AuthHeader string `json:"auth_header,omitempty"` // webhook: Authorization header to send
+	File       string `json:"file,omitempty"`        // jsonl: file name inside the worker's sink directory (default scan-<id>.jsonl)
+}
+
+// Env carries what sinks need to know about the scan and the worker.
+type Env struct {
+	Poster      Poster // Delivery for django and webhook sinks
+	Dir         string // Directory for jsonl sinks
+	BackendBase string // Django base URL
+	AuthHeader  string // Authorization header for Django callbacks
+	ScanID      int64
+	Target      string
+}
+
+// Validate checks sink configs without opening anything.
+func Validate(cfgs []Config, env Env) error {
+	var problems []string
+	for i, cfg := range cfgs {
+		if err := cfg.validate(env); err != nil {
+			problems = append(problems, fmt.Sprintf("sinks[%d]: %v", i, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid sinks: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c Config) validate(env Env) error {
+	switch c.Type {
+	case KindDjango:
+		if env.BackendBase == "" {
+			return errors.New("django sink needs backend_base")
+		}
+	case KindWebhook:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook url %q must be an absolute http(s) URL", c.URL)
+		}
+	case KindJSONL:
+		if c.File != "" && (filepath.Base(c.File) != c.File || c.File == "." || c.File == "..") {
+			return fmt.Errorf("jsonl file %q must be a plain file name", c.File)
+		}
+	case KindStdout:
+	default:
+		return fmt.Errorf("unknown sink type %q (valid: django, webhook, jsonl, stdout)", c.Type)
+	}
+	return nil
+}
+
+// Build opens the configured sinks and fans events out to all of them. With no
+// configs it returns a Django sink, the worker's historical behaviour.
+func Build(cfgs []Config, env Env) (Sink, error) {
+	if len(cfgs) == 0 {
+		cfgs = []Config{{Type: KindDjango}}
+	}
+	if err := Validate(cfgs, env); err != nil {
+		return nil, err
+	}
+
+	sinks := make([]Sink, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		s, err := cfg.open(env)
+		if err != nil {
+			_ = Multi(sinks...).Close()
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return Multi(sinks...), nil
+}
+
+func (c Config) open(env Env) (Sink, error) {
+	switch c.Type {
+	case KindDjango:
+		return NewDjango(env.Poster, env.BackendBase, env.ScanID, env.AuthHeader), nil
+	case KindWebhook:
+		return NewWebhook(env.Poster, c.URL, c.AuthHeader, env.ScanID, env.Target), nil
+	case KindJSONL:
+		name := c.File
+		if name == "" {
+			name = fmt.Sprintf("scan-%d.jsonl", env.ScanID)
+		}
+		return OpenJSONLFile(filepath.Join(env.Dir, name), env.ScanID, env.Target)
+	default:
+		return Stdout(env.ScanID, env.Target), nil
+	}
+}
@@ -0,0 +1,152 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"recon/dnsutil"
+	"recon/endpoints"
+	"recon/network"
+	"recon/recon"
+)
+
+// FlushTimeout bounds how long a final status waits for queued findings to be
+// delivered or spooled.
+const FlushTimeout = 30 * time.Second
+
+// Poster delivers HTTP callbacks. *delivery.Dispatcher implements it: Enqueue
+// batches items per URL, Send posts one payload, and both retry and spool.
+// The Lane variants order and flush by a named lane instead of the URL, for
+// URLs shared by several scans. FlushPrefix waits only for the lanes starting
+// with prefix, so one scan's final status does not wait for the deliveries of
+// other scans.
+type Poster interface {
+	Enqueue(url, authHeader string, item any)
+	Send(url, authHeader string, payload any)
+	EnqueueLane(lane, url, authHeader string, item any)
+	SendLane(lane, url, authHeader string, payload any)
+	FlushPrefix(ctx context.Context, prefix string) error
+}
+
+func flushBeforeFinal(p Poster, prefix, status string) {
+	// Waits for the sink's queued findings so receivers see them before the
+	// final status.
+	if !IsFinal(status) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), FlushTimeout)
+	defer cancel()
+	if err := p.FlushPrefix(ctx, prefix); err != nil {
+		log.Printf("[sink] flush incomplete after %s: %v", FlushTimeout, err)
+	}
+}
+
+// ---------------- DJANGO ----------------
+
+// Django posts results to the Revulnera backend's per-scan ingest endpoints.
+type Django struct {
+	poster     Poster
+	base       string
+	authHeader string
+}
+
+// NewDjango returns a sink for the scan's endpoints under backendBase
+// (e.g. http://localhost:8000). authHeader is forwarded on every callback.
+func NewDjango(p Poster, backendBase string, scanID int64, authHeader string) *Django {
+	return &Django{
+		poster:     p,
+		base:       fmt.Sprintf("%s/api/recon/scans/%d/", backendBase, scanID),
+		authHeader: authHeader,
+	}
+}
+
+// StatusURL returns the scan's status endpoint.
+func (d *Django) StatusURL() string { return d.base + "status/" }
+
+func (d *Django) OnSubdomain(sub recon.SubdomainResult) {
+	d.poster.Enqueue(d.base+"ingest/subdomains/", d.authHeader, sub)
+}
+
+func (d *Django) OnDNS(rec dnsutil.HostRecords) {
+	d.poster.Enqueue(d.base+"ingest/dns/", d.authHeader, rec)
+}
+
+func (d *Django) OnEndpoint(ep endpoints.EndpointResult) {
+	d.poster.Enqueue(d.base+"ingest/endpoints/", d.authHeader, ep)
+}
+
+func (d *Django) OnPort(finding network.PortFinding) {
+	d.poster.Enqueue(d.base+"network/ports/ingest/", d.authHeader, finding)
+}
+
+func (d *Django) OnTLS(result network.TLSResult) {
+	d.poster.Send(d.base+"network/tls/ingest/", d.authHeader, result)
+}
+
+func (d *Django) OnDirectory(finding network.DirectoryFinding) {
+	d.poster.Enqueue(d.base+"network/dirs/ingest/", d.authHeader, finding)
+}
+
+func (d *Django) OnLog(message, level string) {
+	// Structured log messages let the frontend show real-time scan logs.
+	d.poster.Send(d.base+"logs/", d.authHeader, map[string]any{
+		"message":   message,
+		"level":     level,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+func (d *Django) OnStatus(st Status) {
+	flushBeforeFinal(d.poster, d.base, st.Status)
+	d.poster.Send(d.StatusURL(), d.authHeader, st)
+}
+
+func (d *Django) Close() error { return nil }
+
+// ---------------- WEBHOOK ----------------
+
+// Webhook posts every event as a Record to a single URL. Findings are batched
+// as {"items": [...]}; logs and status changes are posted one at a time. The
+// URL may be shared by other scans, so deliveries go through a per-scan lane.
+type Webhook struct {
+	poster     Poster
+	url        string
+	lane       string
+	authHeader string
+	scanID     int64
+	target     string
+}
+
+// NewWebhook returns a sink posting a scan's events to url.
+func NewWebhook(p Poster, url, authHeader string, scanID int64, target string) *Webhook {
+	lane := fmt.Sprintf("%s#scan/%d/", url, scanID)
+	return &Webhook{poster: p, url: url, lane: lane, authHeader: authHeader, scanID: scanID, target: target}
+}
+
+func (w *Webhook) record(kind string, data any) Record {
+	return Record{Type: kind, ScanID: w.scanID, Target: w.target, Time: time.Now().UTC(), Data: data}
+}
+
+func (w *Webhook) enqueue(kind string, data any) {
+	w.poster.EnqueueLane(w.lane, w.url, w.authHeader, w.record(kind, data))
+}
+
+func (w *Webhook) OnSubdomain(sub recon.SubdomainResult)        { w.enqueue(TypeSubdomain, sub) }
+func (w *Webhook) OnDNS(rec dnsutil.HostRecords)                { w.enqueue(TypeDNS, rec) }
+func (w *Webhook) OnEndpoint(ep endpoints.EndpointResult)       { w.enqueue(TypeEndpoint, ep) }
+func (w *Webhook) OnPort(finding network.PortFinding)           { w.enqueue(TypePort, finding) }
+func (w *Webhook) OnTLS(result network.TLSResult)               { w.enqueue(TypeTLS, result) }
+func (w *Webhook) OnDirectory(finding network.DirectoryFinding) { w.enqueue(TypeDirectory, finding) }
+
+func (w *Webhook) OnLog(message, level string) {
+	w.poster.SendLane(w.lane, w.url, w.authHeader, w.record(TypeLog, LogEntry{Message: message, Level: level}))
+}
+
+func (w *Webhook) OnStatus(st Status) {
+	flushBeforeFinal(w.poster, w.lane, st.Status)
+	w.poster.SendLane(w.lane, w.url, w.authHeader, w.record(TypeStatus, st))
+}
+
+func (w *Webhook) Close() error { return nil }
@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"recon/dnsutil"
+	"recon/endpoints"
+	"recon/network"
+	"recon/recon"
+)
+
+// JSONL writes every event as one JSON Record per line.
+type JSONL struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+	scanID int64
+	target string
+	err    error
+}
+
+// NewJSONL writes records for a scan to w. w is not closed by Close.
+func NewJSONL(w io.Writer, scanID int64, target string) *JSONL {
+	return &JSONL{enc: json.NewEncoder(w), scanID: scanID, target: target}
+}
+
+// Stdout writes records for a scan to standard output.
+func Stdout(scanID int64, target string) *JSONL {
+	return NewJSONL(os.Stdout, scanID, target)
+}
+
+// OpenJSONLFile appends records for a scan to the file at path, creating it
+// and its directory when needed.
+func OpenJSONLFile(path string, scanID int64, target string) (*JSONL, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := NewJSONL(f, scanID, target)
+	s.closer = f
+	return s, nil
+}
+
+// Write encodes one record of the given type. The first write error is kept
+// and returned by Err and Close; later records are dropped.
+func (s *JSONL) Write(kind string, data any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = s.enc.Encode(Record{Type: kind, ScanID: s.scanID, Target: s.target, Time: time.Now().UTC(), Data: data})
+	if s.err != nil {
+		log.Printf("[sink] jsonl write failed for scan %d: %v", s.scanID, s.err)
+	}
+}
+
+// Err returns the first write error.
+func (s *JSONL) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *JSONL) OnSubdomain(sub recon.SubdomainResult)        { s.Write(TypeSubdomain, sub) }
+func (s *JSONL) OnDNS(rec dnsutil.HostRecords)                { s.Write(TypeDNS, rec) }
+func (s *JSONL) OnEndpoint(ep endpoints.EndpointResult)       { s.Write(TypeEndpoint, ep) }
+func (s *JSONL) OnPort(finding network.PortFinding)           { s.Write(TypePort, finding) }
+func (s *JSONL) OnTLS(result network.TLSResult)               { s.Write(TypeTLS, result) }
+func (s *JSONL) OnDirectory(finding network.DirectoryFinding) { s.Write(TypeDirectory, finding) }
+
+func (s *JSONL) OnLog(message, level string) {
+	s.Write(TypeLog, LogEntry{Message: message, Level: level})
+}
+
+func (s *JSONL) OnStatus(st Status) {
+	s.Write(TypeStatus, st)
+}
+
+// Close closes the underlying file, if the sink opened it.
+func (s *JSONL) Close() error {
+	err := s.Err()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+// Package sink delivers scan results to one or more destinations: the Django
+// ingest API, generic webhooks, JSONL files or stdout.
+package sink
+
+import (
+	"errors"
+	"time"
+
+	"recon/dnsutil"
+	"recon/endpoints"
+	"recon/network"
+	"recon/recon"
+)
+
+// Sink receives the findings, logs and status changes of one scan. Methods may
+// be called from several goroutines at once.
+type Sink interface {
+	OnSubdomain(sub recon.SubdomainResult)
+	OnDNS(rec dnsutil.HostRecords)
+	OnEndpoint(ep endpoints.EndpointResult)
+	OnPort(finding network.PortFinding)
+	OnTLS(result network.TLSResult)
+	OnDirectory(finding network.DirectoryFinding)
+	OnLog(message, level string)
+	// OnStatus reports a scan status (QUEUED, RUNNING, COMPLETED, FAILED,
+	// CANCELLED, INTERRUPTED). Sinks with buffered findings deliver them before
+	// a final status.
+	OnStatus(st Status)
+	// Close releases the sink after the scan's final status.
+	Close() error
+}
+
+// Record types used by the JSONL and webhook sinks.
+const (
+	TypeSubdomain = "subdomain"
+	TypeDNS       = "dns"
+	TypeEndpoint  = "endpoint"
+	TypePort      = "port"
+	TypeTLS       = "tls"
+	TypeDirectory = "directory"
+	TypeLog       = "log"
+	TypeStatus    = "status"
+)
+
+// Record is one event as written by the JSONL and webhook sinks.
+type Record struct {
+	Type   string    `json:"type"`
+	ScanID int64     `json:"scan_id,omitempty"`
+	Target string    `json:"target,omitempty"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+// LogEntry is the data of a log record.
+type LogEntry struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+}
+
+// Status is a scan status change, also the data of a status record.
+type Status struct {
+	Status    string           `json:"status"`
+	Error     string           `json:"error,omitempty"`
+	LastPhase string           `json:"last_phase,omitempty"` // Last completed phase, set for INTERRUPTED
+	Truncated []TruncatedPhase `json:"truncated,omitempty"`  // Set for COMPLETED_PARTIAL
+}
+
+// TruncatedPhase is a phase that ran out of time, reported with
+// COMPLETED_PARTIAL.
+type TruncatedPhase struct {
+	Phase   string `json:"phase"`
+	Reason  string `json:"reason"`          // phase_budget or max_duration
+	Limit   string `json:"limit,omitempty"` // Time the phase was allowed
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// IsFinal reports whether a scan status ends the scan on this worker.
+func IsFinal(status string) bool {
+	switch status {
+	case "COMPLETED", "COMPLETED_PARTIAL", "FAILED", "CANCELLED", "REJECTED", "INTERRUPTED":
+		return true
+	}
+	return false
+}
+
+// Multi fans every event out to all sinks in order.
+func Multi(sinks ...Sink) Sink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return multi(sinks)
+}
+
+type multi []Sink
+
+func (m multi) OnSubdomain(sub recon.SubdomainResult) {
+	for _, s := range m {
+		s.OnSubdomain(sub)
+	}
+}
+
+func (m multi) OnDNS(rec dnsutil.HostRecords) {
+	for _, s := range m {
+		s.OnDNS(rec)
+	}
+}
+
+func (m multi) OnEndpoint(ep endpoints.EndpointResult) {
+	for _, s := range m {
+		s.OnEndpoint(ep)
+	}
+}
+
+func (m multi) OnPort(finding network.PortFinding) {
+	for _, s := range m {
+		s.OnPort(finding)
+	}
+}
+
+func (m multi) OnTLS(result network.TLSResult) {
+	for _, s := range m {
+		s.OnTLS(result)
+	}
+}
+
+func (m multi) OnDirectory(finding network.DirectoryFinding) {
+	for _, s := range m {
+		s.OnDirectory(finding)
+	}
+}
+
+func (m multi) OnLog(message, level string) {
+	for _, s := range m {
+		s.OnLog(message, level)
+	}
+}
+
+func (m multi) OnStatus(st Status) {
+	for _, s := range m {
+		s.OnStatus(st)
+	}
+}
+
+func (m multi) Close() error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"recon/dnsutil"
+	"recon/endpoints"
+	"recon/network"
+	"recon/recon"
+)
+
+// fakePoster records calls in order.
+type fakePoster struct {
+	mu    sync.Mutex
+	calls []string
+	items []any
+}
+
+func (p *fakePoster) Enqueue(url, authHeader string, item any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, "enqueue "+url)
+	p.items = append(p.items, item)
+}
+
+func (p *fakePoster) Send(url, authHeader string, payload any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, "send "+url)
+	p.items = append(p.items, payload)
+}
+
+func (p *fakePoster) EnqueueLane(lane, url, authHeader string, item any) {
+	p.Enqueue(url+" on "+lane, authHeader, item)
+}
+
+func (p *fakePoster) SendLane(lane, url, authHeader string, payload any) {
+	p.Send(url+" on "+lane, authHeader, payload)
+}
+
+func (p *fakePoster) FlushPrefix(ctx context.Context, prefix string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, "flush "+prefix)
+	return nil
+}
+
+func TestDjangoSinkRoutesToIngestEndpoints(t *testing.T) {
+	p := &fakePoster{}
+	d := NewDjango(p, "http://django", 7, "Bearer x")
+
+	d.OnStatus(Status{Status: "RUNNING"})
+	d.OnSubdomain(recon.SubdomainResult{Name: "a.example.com"})
+	d.OnDNS(dnsutil.HostRecords{Name: "a.example.com"})
+	d.OnPort(network.PortFinding{Port: 22})
+	d.OnTLS(network.TLSResult{Host: "a.example.com"})
+	d.OnDirectory(network.DirectoryFinding{Path: "/.git/"})
+	d.OnLog("hi", "info")
+	d.OnStatus(Status{Status: "COMPLETED"})
+
+	base := "http://django/api/recon/scans/7/"
+	want := []string{
+		"send " + base + "status/",
+		"enqueue " + base + "ingest/subdomains/",
+		"enqueue " + base + "ingest/dns/",
+		"enqueue " + base + "network/ports/ingest/",
+		"send " + base + "network/tls/ingest/",
+		"enqueue " + base + "network/dirs/ingest/",
+		"send " + base + "logs/",
+		"flush " + base,
+		"send " + base + "status/",
+	}
+	if !reflect.DeepEqual(p.calls, want) {
+		t.Fatalf("calls:\n%s\nwant:\n%s", strings.Join(p.calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBuildFansOutToEverySink(t *testing.T) {
+	dir := t.TempDir()
+	p := &fakePoster{}
+	out, err := Build([]Config{
+		{Type: KindWebhook, URL: "https://hooks.example.com/recon"},
+		{Type: KindJSONL},
+	}, Env{Poster: p, Dir: dir, ScanID: 3, Target: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out.OnEndpoint(endpoints.EndpointResult{URL: "https://example.com/login"})
+	out.OnLog("working", "info")
+	out.OnStatus(Status{Status: "FAILED", Error: "boom"})
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Scans share webhook URLs, so each one gets its own lane.
+	hook, lane := "https://hooks.example.com/recon", "https://hooks.example.com/recon#scan/3/"
+	if want := []string{"enqueue " + hook + " on " + lane, "send " + hook + " on " + lane, "flush " + lane, "send " + hook + " on " + lane}; !reflect.DeepEqual(p.calls, want) {
+		t.Fatalf("webhook calls = %v", p.calls)
+	}
+	if rec := p.items[0].(Record); rec.Type != TypeEndpoint || rec.ScanID != 3 || rec.Target != "example.com" {
+		t.Fatalf("webhook record = %+v", rec)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "scan-3.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var types []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, rec.Type)
+	}
+	if want := []string{TypeEndpoint, TypeLog, TypeStatus}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("jsonl types = %v, want %v", types, want)
+	}
+}
+
+func TestValidateRejectsBadConfigs(t *testing.T) {
+	env := Env{Dir: t.TempDir()}
+	bad := [][]Config{
+		{{Type: "kafka"}},
+		{{Type: KindDjango}}, // no backend_base
+		{{Type: KindWebhook, URL: "ftp://example.com"}},
+		{{Type: KindWebhook}},
+		{{Type: KindJSONL, File: "../escape.jsonl"}},
+	}
+	for _, cfgs := range bad {
+		if err := Validate(cfgs, env); err == nil {
+			t.Errorf("expected %+v to be rejected", cfgs)
+		}
+	}
+
+	if _, err := Build(nil, env); err == nil {
+		t.Fatal("default django sink without backend_base should be rejected")
+	}
+	env.BackendBase = "http://django"
+	if _, err := Build(nil, env); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"recon/tools"
+)
+
+// toolInventory tracks which external tools this worker can run. Scans consult
+// it before starting; /healthz and /readyz report it.
+var toolInventory = tools.NewInventory(toolSpecs()...)
+
+// toolCheckMaxAge is how long health endpoints reuse the last tool check.
+const toolCheckMaxAge = time.Minute
+
+func toolSpecs() []tools.Spec {
+	// Applies RECON_REQUIRED_TOOLS (comma-separated, default subfinder) and
+	// RECON_<TOOL>_MIN_VERSION overrides to the default specs.
+	// An empty RECON_REQUIRED_TOOLS makes every tool optional.
+	required, override := os.LookupEnv("RECON_REQUIRED_TOOLS")
+
+	specs := tools.DefaultSpecs()
+	for i := range specs {
+		if override {
+			specs[i].Required = containsName(strings.Split(required, ","), specs[i].Name)
+		}
+		if v := os.Getenv("RECON_" + strings.ToUpper(specs[i].Name) + "_MIN_VERSION"); v != "" {
+			specs[i].MinVersion = v
+		}
+	}
+	return specs
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.TrimSpace(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTools() {
+	// Logs the tool inventory at startup so missing tools show up before the
+	// first scan instead of as per-host errors.
+	report := toolInventory.Check(context.Background())
+	for _, t := range report.Tools {
+		switch {
+		case t.Available && t.Error == "":
+			log.Printf("[tools] %s %s (%s)", t.Name, t.Version, t.Path)
+		case t.Available:
+			log.Printf("[tools] %s (%s): %s", t.Name, t.Path, t.Error)
+		case t.Required:
+			log.Printf("[tools] ERROR: required tool %s unavailable: %s", t.Name, t.Error)
+		default:
+			log.Printf("[tools] WARNING: %s unavailable, scans run without it: %s", t.Name, t.Error)
+		}
+	}
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	// Liveness: answers 200 while the process serves HTTP, with the tool
+	// inventory for diagnostics. ?refresh=1 re-runs the tool checks.
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status": "ok",
+		"tools":  toolReport(r),
+	})
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	// Readiness: 503 while draining for shutdown or while a required tool is
+	// unavailable, so load balancers stop sending scans here.
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := toolReport(r)
+	var missing []string
+	for _, t := range report.Tools {
+		if t.Required && !t.Available {
+			missing = append(missing, t.Name)
+		}
+	}
+	draining := shuttingDown()
+	ready := report.Ready && !draining
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"ready":            ready,
+		"draining":         draining,
+		"missing_required": missing,
+		"capabilities":     report.Capabilities,
+		"tools":            report.Tools,
+	})
+}
+
+func toolReport(r *http.Request) tools.Report {
+	if r.URL.Query().Get("refresh") != "" {
+		return toolInventory.Check(r.Context())
+	}
+	return toolInventory.Refresh(r.Context(), toolCheckMaxAge)
+}
@@ -0,0 +1,241 @@
+// Package tools keeps an inventory of the external binaries the scanner runs
+// (subfinder, amass, assetfinder, httpx, gau, katana, nmap): whether each one resolves on PATH,
+// which version it reports and which capabilities it provides.
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the external tools known to the inventory.
+const (
+	Subfinder   = "subfinder"
+	Amass       = "amass"
+	Assetfinder = "assetfinder"
+	Httpx       = "httpx"
+	Gau         = "gau"
+	Katana      = "katana"
+	Nmap        = "nmap"
+)
+
+// Capabilities provided by the external tools.
+const (
+	CapSubdomainEnumeration = "subdomain_enumeration"
+	CapHTTPProbe            = "httpx_probe"
+	CapHistoricalURLs       = "historical_urls"
+	CapHeadlessCrawl        = "headless_crawl"
+	CapPortScan             = "port_scan"
+)
+
+// versionTimeout bounds each version command.
+const versionTimeout = 10 * time.Second
+
+// Spec describes how to find and check one tool.
+type Spec struct {
+	Name         string
+	Binary       string   // Looked up on PATH unless it contains a path separator
+	VersionArgs  []string // Arguments that make the tool print its version
+	MinVersion   string   // Empty accepts any version
+	Capabilities []string
+	Required     bool // Readiness fails while a required tool is unavailable
+}
+
+// Status is the result of checking one tool.
+type Status struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path,omitempty"`
+	Version      string   `json:"version,omitempty"`
+	MinVersion   string   `json:"min_version,omitempty"`
+	Available    bool     `json:"available"`
+	Required     bool     `json:"required"`
+	Capabilities []string `json:"capabilities"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Report is the outcome of one inventory check.
+type Report struct {
+	CheckedAt    time.Time       `json:"checked_at"`
+	Ready        bool            `json:"ready"` // Every required tool is available
+	Tools        []Status        `json:"tools"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+// Missing returns the names of unavailable tools.
+func (r Report) Missing() []string {
+	var out []string
+	for _, t := range r.Tools {
+		if !t.Available {
+			out = append(out, t.Name)
+		}
+	}
+	return out
+}
+
+// DefaultSpecs returns the tools the scan pipeline uses, with the oldest
+// versions known to support the flags it passes.
+func DefaultSpecs() []Spec {
+	return []Spec{
+		{Name: Subfinder, Binary: "subfinder", VersionArgs: []string{"-version"}, MinVersion: "2.5.0", Capabilities: []string{CapSubdomainEnumeration}, Required: true},
+		{Name: Amass, Binary: "amass", VersionArgs: []string{"-version"}, MinVersion: "3.0.0", Capabilities: []string{CapSubdomainEnumeration}},
+		// assetfinder has no version flag; without arguments it reads domains
+		// from stdin, which is empty, and exits cleanly.
+		{Name: Assetfinder, Binary: "assetfinder", Capabilities: []string{CapSubdomainEnumeration}},
+		{Name: Httpx, Binary: "httpx", VersionArgs: []string{"-version"}, MinVersion: "1.3.0", Capabilities: []string{CapHTTPProbe}},
+		{Name: Gau, Binary: "gau", VersionArgs: []string{"--version"}, MinVersion: "2.1.0", Capabilities: []string{CapHistoricalURLs}},
+		{Name: Katana, Binary: "katana", VersionArgs: []string{"-version"}, MinVersion: "1.0.0", Capabilities: []string{CapHeadlessCrawl}},
+		{Name: Nmap, Binary: "nmap", VersionArgs: []string{"--version"}, MinVersion: "7.80", Capabilities: []string{CapPortScan}},
+	}
+}
+
+// Inventory checks a set of tools and caches the last report.
+type Inventory struct {
+	specs []Spec
+
+	mu     sync.Mutex
+	last   Report
+	byName map[string]Status
+}
+
+// NewInventory returns an inventory for specs. Nothing is checked until Check
+// or Refresh is called; until then every tool counts as available.
+func NewInventory(specs ...Spec) *Inventory {
+	return &Inventory{specs: specs}
+}
+
+// Check runs every version command concurrently and stores the report.
+func (inv *Inventory) Check(ctx context.Context) Report {
+	statuses := make([]Status, len(inv.specs))
+	var wg sync.WaitGroup
+	for i, spec := range inv.specs {
+		wg.Add(1)
+		go func(i int, spec Spec) {
+			defer wg.Done()
+			statuses[i] = checkTool(ctx, spec)
+		}(i, spec)
+	}
+	wg.Wait()
+
+	report := Report{CheckedAt: time.Now().UTC(), Ready: true, Tools: statuses, Capabilities: make(map[string]bool)}
+	byName := make(map[string]Status, len(statuses))
+	for _, s := range statuses {
+		byName[s.Name] = s
+		for _, c := range s.Capabilities {
+			report.Capabilities[c] = report.Capabilities[c] || s.Available
+		}
+		if s.Required && !s.Available {
+			report.Ready = false
+		}
+	}
+
+	inv.mu.Lock()
+	inv.last = report
+	inv.byName = byName
+	inv.mu.Unlock()
+	return report
+}
+
+// Refresh returns the cached report, checking again when it is older than maxAge.
+func (inv *Inventory) Refresh(ctx context.Context, maxAge time.Duration) Report {
+	inv.mu.Lock()
+	last := inv.last
+	inv.mu.Unlock()
+	if !last.CheckedAt.IsZero() && time.Since(last.CheckedAt) < maxAge {
+		return last
+	}
+	return inv.Check(ctx)
+}
+
+// Report returns the last report without checking.
+func (inv *Inventory) Report() Report {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.last
+}
+
+// Available reports whether the named tool passed the last check. Unknown
+// tools and tools that were never checked count as available, so callers
+// fall back to the old per-host error handling.
+func (inv *Inventory) Available(name string) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	s, ok := inv.byName[name]
+	return !ok || s.Available
+}
+
+func checkTool(ctx context.Context, spec Spec) Status {
+	// Resolves the binary, runs its version command and compares the version.
+	s := Status{Name: spec.Name, MinVersion: spec.MinVersion, Required: spec.Required, Capabilities: spec.Capabilities}
+
+	path, err := exec.LookPath(spec.Binary)
+	if err != nil {
+		s.Error = fmt.Sprintf("%s not found in PATH", spec.Binary)
+		return s
+	}
+	s.Path = path
+
+	ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+	defer cancel()
+	out, runErr := exec.CommandContext(ctx, path, spec.VersionArgs...).CombinedOutput()
+
+	// Some tools exit non-zero after printing their version, so the output wins.
+	s.Version = ParseVersion(string(out))
+	if s.Version == "" {
+		if runErr != nil {
+			s.Error = fmt.Sprintf("%s %s failed: %v", spec.Binary, strings.Join(spec.VersionArgs, " "), runErr)
+			return s
+		}
+		// The binary runs but prints no recognisable version; accept it.
+		s.Available = true
+		s.Error = "could not determine version"
+		return s
+	}
+
+	if spec.MinVersion != "" && CompareVersions(s.Version, spec.MinVersion) < 0 {
+		s.Error = fmt.Sprintf("version %s is older than the required %s", s.Version, spec.MinVersion)
+		return s
+	}
+	s.Available = true
+	return s
+}
+
+// versionPattern matches "version 7.94", "Version: v2.6.3" and similar.
+var versionPattern = regexp.MustCompile(`(?i)version:?\s*v?(\d+(?:\.\d+)+)`)
+
+// ParseVersion extracts the first version number printed after the word
+// "version", or returns "" when there is none.
+func ParseVersion(output string) string {
+	m := versionPattern.FindStringSubmatch(output)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// CompareVersions compares dotted numeric versions and returns -1, 0 or 1.
+// Missing components count as zero, so "7.80" equals "7.80.0".
+func CompareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAndCompareVersions(t *testing.T) {
+	for output, want := range map[string]string{
+		"Nmap version 7.94 ( https://nmap.org )":        "7.94",
+		"[INF] Current Version: v2.6.3":                 "2.6.3",
+		"gau version: 2.2.1":                            "2.2.1",
+		"[INF] Current httpx version v1.6.0 (outdated)": "1.6.0",
+		"usage: httpx [OPTIONS] URL":                    "",
+	} {
+		if got := ParseVersion(output); got != want {
+			t.Errorf("ParseVersion(%q) = %q, want %q", output, got, want)
+		}
+	}
+
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"7.80", "7.80.0", 0},
+		{"7.9", "7.80", -1},
+		{"2.10.0", "2.9.9", 1},
+	} {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func fakeTool(t *testing.T, dir, name, output string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\necho '" + output + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInventoryCheck(t *testing.T) {
+	dir := t.TempDir()
+	inv := NewInventory(
+		Spec{Name: "fresh", Binary: fakeTool(t, dir, "fresh", "Nmap version 7.94"), MinVersion: "7.80", Capabilities: []string{CapPortScan}, Required: true},
+		Spec{Name: "stale", Binary: fakeTool(t, dir, "stale", "gau version: 1.0.0"), MinVersion: "2.1.0", Capabilities: []string{CapHistoricalURLs}},
+		Spec{Name: "absent", Binary: filepath.Join(dir, "absent"), Capabilities: []string{CapHeadlessCrawl}},
+	)
+
+	if !inv.Available("stale") {
+		t.Fatal("tools must count as available before the first check")
+	}
+	report := inv.Check(context.Background())
+
+	if !report.Ready {
+		t.Fatalf("required tool is available, report should be ready: %+v", report)
+	}
+	if !inv.Available("fresh") || inv.Available("stale") || inv.Available("absent") {
+		t.Fatalf("unexpected availability: %+v", report.Tools)
+	}
+	if got := report.Tools[0].Version; got != "7.94" {
+		t.Fatalf("version = %q, want 7.94", got)
+	}
+	if !report.Capabilities[CapPortScan] || report.Capabilities[CapHistoricalURLs] || report.Capabilities[CapHeadlessCrawl] {
+		t.Fatalf("unexpected capabilities: %v", report.Capabilities)
+	}
+	if missing := report.Missing(); len(missing) != 2 {
+		t.Fatalf("missing = %v, want stale and absent", missing)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"recon/workerauth"
+)
+
+var (
+	// callbackSecret signs every callback to Django; empty disables signing (dev).
+	callbackSecret []byte
+
+	// callbackClient is shared by all callbacks so mTLS settings apply uniformly.
+	callbackClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// serverTLS holds the listener certificate when the worker serves HTTPS.
+type serverTLS struct {
+	config   *tls.Config
+	certFile string
+	keyFile  string
+}
+
+func configureWorkerAuth(next http.Handler) (http.Handler, *serverTLS) {
+	// Wires HMAC request verification, callback signing and optional mutual TLS
+	// from environment variables:
+	//   RECON_SHARED_SECRET        shared HMAC secret for inbound requests and callbacks
+	//   RECON_AUTH_MAX_SKEW        allowed clock skew for signed requests (default 5m)
+	//   RECON_TLS_CERT_FILE/KEY    serve HTTPS with this certificate
+	//   RECON_TLS_CLIENT_CA_FILE   require client certificates signed by this CA (mTLS)
+	//   RECON_CALLBACK_CERT_FILE/KEY/CA_FILE  client certificate and CA for callbacks
+	handler := next
+
+	if secret := os.Getenv("RECON_SHARED_SECRET"); secret != "" {
+		callbackSecret = []byte(secret)
+		maxSkew := 5 * time.Minute
+		if raw := os.Getenv("RECON_AUTH_MAX_SKEW"); raw != "" {
+			if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+				maxSkew = d
+			} else {
+				log.Printf("[auth] invalid RECON_AUTH_MAX_SKEW %q, using %s", raw, maxSkew)
+			}
+		}
+		handler = workerauth.NewVerifier(callbackSecret, maxSkew).Middleware(next, "/metrics", "/healthz", "/readyz") // Scrapers and probes cannot sign requests
+		log.Printf("[auth] HMAC request signing enabled (max skew %s)", maxSkew)
+	} else {
+		log.Printf("[auth] WARNING: RECON_SHARED_SECRET not set, worker API is unauthenticated and callbacks are unsigned")
+	}
+
+	if certFile := os.Getenv("RECON_CALLBACK_CERT_FILE"); certFile != "" || os.Getenv("RECON_CALLBACK_CA_FILE") != "" {
+		cfg, err := workerauth.ClientTLSConfig(certFile, os.Getenv("RECON_CALLBACK_KEY_FILE"), os.Getenv("RECON_CALLBACK_CA_FILE"))
+		if err != nil {
+			log.Fatalf("failed to load callback TLS config: %v", err)
+		}
+		callbackClient = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: cfg},
+		}
+		log.Printf("[auth] callbacks use client certificate TLS")
+	}
+
+	certFile := os.Getenv("RECON_TLS_CERT_FILE")
+	keyFile := os.Getenv("RECON_TLS_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		return handler, nil
+	}
+
+	srv := &serverTLS{
+		config:   &tls.Config{MinVersion: tls.VersionTLS12},
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if caFile := os.Getenv("RECON_TLS_CLIENT_CA_FILE"); caFile != "" {
+		cfg, err := workerauth.ServerTLSConfig(caFile)
+		if err != nil {
+			log.Fatalf("failed to load client CA: %v", err)
+		}
+		srv.config = cfg
+		log.Printf("[auth] mutual TLS enabled, client certificates required")
+	}
+	return handler, srv
+}
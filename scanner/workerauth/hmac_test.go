@@ -0,0 +1,113 @@
+package workerauth
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyAcceptsSignedRequestOnce(t *testing.T) {
+	secret := []byte("shared-secret")
+	body := []byte(`{"scan_id":1}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/scan?x=1", bytes.NewReader(body))
+	SignRequest(secret, req, body)
+
+	v := NewVerifier(secret, time.Minute)
+	if err := v.Verify(req, body); err != nil {
+		t.Fatalf("expected signed request to verify: %v", err)
+	}
+	if err := v.Verify(req, body); err != ErrReplayed {
+		t.Fatalf("expected replay to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperingAndStaleRequests(t *testing.T) {
+	secret := []byte("shared-secret")
+	body := []byte(`{"scan_id":1}`)
+	v := NewVerifier(secret, time.Minute)
+
+	tampered := httptest.NewRequest(http.MethodPost, "/scan", nil)
+	SignRequest(secret, tampered, body)
+	if err := v.Verify(tampered, []byte(`{"scan_id":2}`)); err != ErrBadSignature {
+		t.Fatalf("expected bad signature for modified body, got %v", err)
+	}
+
+	wrongKey := httptest.NewRequest(http.MethodPost, "/scan", nil)
+	SignRequest([]byte("other"), wrongKey, body)
+	if err := v.Verify(wrongKey, body); err != ErrBadSignature {
+		t.Fatalf("expected bad signature for wrong key, got %v", err)
+	}
+
+	stale := httptest.NewRequest(http.MethodPost, "/scan", nil)
+	SignRequest(secret, stale, body)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	stale.Header.Set(HeaderTimestamp, old)
+	stale.Header.Set(HeaderSignature, Signature(secret, StringToSign(http.MethodPost, "/scan", old, stale.Header.Get(HeaderNonce), body)))
+	if err := v.Verify(stale, body); err != ErrStaleTimestamp {
+		t.Fatalf("expected stale timestamp, got %v", err)
+	}
+
+	unsigned := httptest.NewRequest(http.MethodPost, "/scan", nil)
+	if err := v.Verify(unsigned, body); err != ErrMissingSignature {
+		t.Fatalf("expected missing signature, got %v", err)
+	}
+}
+
+func TestMiddlewareRestoresBodyAndHonoursExemptPaths(t *testing.T) {
+	secret := []byte("shared-secret")
+	v := NewVerifier(secret, time.Minute)
+
+	var gotBody string
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(r.Body)
+		gotBody = buf.String()
+	}), "/healthz")
+
+	body := []byte(`{"scan_id":9}`)
+	req := httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body))
+	SignRequest(secret, req, body)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || gotBody != string(body) {
+		t.Fatalf("signed request: code=%d body=%q", rec.Code, gotBody)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned request should be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("exempt path should pass, got %d", rec.Code)
+	}
+}
+
+func TestSignatureMatchesBackendVector(t *testing.T) {
+	// Shared with backend/reconscan/tests.py so both sides agree on the v1 scheme.
+	secret := []byte("shared-secret")
+	body := []byte(`{"scan_id":7,"status":"COMPLETED"}`)
+	const want = "v1=d426f3cb8586c0c7713f7560f0f7e1a83f7e28c65254be9bd687a748c571bd25"
+
+	got := Signature(secret, StringToSign(http.MethodPost, "/api/recon/scans/7/status/", "1760000000", "0123456789abcdef0123456789abcdef", body))
+	if got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/recon/scans/7/status/", bytes.NewReader(body))
+	req.Header.Set(HeaderTimestamp, "1760000000")
+	req.Header.Set(HeaderNonce, "0123456789abcdef0123456789abcdef")
+	req.Header.Set(HeaderSignature, want)
+	v := NewVerifier(secret, time.Minute)
+	v.now = func() time.Time { return time.Unix(1760000000, 0) }
+	if err := v.Verify(req, body); err != nil {
+		t.Fatalf("backend-signed request should verify: %v", err)
+	}
+}